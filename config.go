@@ -0,0 +1,335 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/catdevman/oasis/internal/config"
+	"github.com/catdevman/oasis/internal/db"
+	"github.com/catdevman/oasis/internal/logging"
+	"github.com/catdevman/oasis/internal/tracing"
+)
+
+// defaultListen is where user traffic is served unless listen says
+// otherwise.
+const defaultListen = ":8080"
+
+// AppConfig is plugins.yaml, with the overlay for the environment merged
+// in. Any value may be written as ${VAR} or ${VAR:-default}, read from the
+// environment or, for VAR_FILE, from the file it names.
+type AppConfig struct {
+	Listen    string         `yaml:"listen"` // the address user traffic is served on
+	TLS       TLSConfig      `yaml:"tls"`
+	Database  db.Config      `yaml:"database"`
+	LogLevel  string         `yaml:"log_level"`  // trace, debug, info (default), warn or error
+	AdminAddr string         `yaml:"admin_addr"` // serves /metrics apart from user traffic; empty disables it
+	Tracing   tracing.Config `yaml:"tracing"`
+	Security  SecurityConfig `yaml:"security"`
+	Plugins   []PluginConfig `yaml:"plugins"`
+
+	files    []string      // the files read, the base first
+	warnings config.Errors // settings that work but should change
+}
+
+// TLSConfig serves user traffic over HTTPS, with HTTP/2, from the
+// certificate in a pair of files or from one ACME obtains.
+type TLSConfig struct {
+	CertFile string     `yaml:"cert_file"` // PEM certificate chain, reloaded when it changes
+	KeyFile  string     `yaml:"key_file"`  // PEM private key
+	ACME     ACMEConfig `yaml:"acme"`
+	// RedirectFrom is a plain HTTP address, such as :80, that redirects to
+	// HTTPS and answers ACME http-01 challenges; empty disables it.
+	RedirectFrom string `yaml:"redirect_from"`
+	// HSTSMaxAge is how long browsers keep to HTTPS, such as 8760h; empty
+	// sends no Strict-Transport-Security header.
+	HSTSMaxAge            string `yaml:"hsts_max_age"`
+	HSTSIncludeSubdomains bool   `yaml:"hsts_include_subdomains"`
+}
+
+// ACMEConfig obtains and renews certificates for Domains from an ACME
+// certificate authority, Let's Encrypt unless DirectoryURL names another.
+type ACMEConfig struct {
+	Domains      []string `yaml:"domains"`
+	Email        string   `yaml:"email"`         // the account's contact for expiry notices
+	DirectoryURL string   `yaml:"directory_url"` // defaults to Let's Encrypt's
+	CAFile       string   `yaml:"ca_file"`       // PEM roots trusted for the directory, for a test server like Pebble
+	CacheDir     string   `yaml:"cache_dir"`     // where the account and certificates are kept; defaults to acme
+}
+
+// Enabled reports whether the host serves HTTPS.
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.ACME.Enabled()
+}
+
+// Enabled reports whether certificates come from ACME.
+func (c ACMEConfig) Enabled() bool {
+	return len(c.Domains) > 0
+}
+
+// SecurityConfig is what the host adds to every response, and checks of
+// every request, to protect browsers.
+type SecurityConfig struct {
+	Headers HeadersConfig `yaml:"headers"`
+	CSRF    CSRFConfig    `yaml:"csrf"`
+	CORS    []CORSRule    `yaml:"cors"`
+}
+
+// HeadersConfig overrides the security headers sent with every response.
+// An empty value sends the default, and off sends none.
+type HeadersConfig struct {
+	// ContentSecurityPolicy defaults to defaultCSP; {nonce} is replaced by
+	// the nonce of each response, which the UI shell's scripts carry.
+	ContentSecurityPolicy string `yaml:"content_security_policy"`
+	FrameOptions          string `yaml:"frame_options"`   // defaults to DENY
+	ReferrerPolicy        string `yaml:"referrer_policy"` // defaults to strict-origin-when-cross-origin
+}
+
+// CSRFConfig controls the check that a request sent with cookies and an
+// unsafe method comes from a page the host served.
+type CSRFConfig struct {
+	Disabled bool     `yaml:"disabled"`
+	Exempt   []string `yaml:"exempt"` // path prefixes not checked, such as webhooks authenticated otherwise
+}
+
+// CORSRule lets pages on other origins call the paths under Path.
+type CORSRule struct {
+	Path          string   `yaml:"path"`           // URL path prefix, such as /api/common/
+	Origins       []string `yaml:"origins"`        // such as https://reports.example.org, or * for any
+	Methods       []string `yaml:"methods"`        // defaults to GET, HEAD and POST
+	Headers       []string `yaml:"headers"`        // request headers allowed beyond the CORS-safelisted ones
+	ExposeHeaders []string `yaml:"expose_headers"` // response headers scripts may read
+	Credentials   bool     `yaml:"credentials"`    // allow cookies; not with the origin *
+	MaxAge        string   `yaml:"max_age"`        // how long browsers cache a preflight, such as 10m
+}
+
+type PluginConfig struct {
+	Name     string `yaml:"name"`
+	Path     string `yaml:"path"`
+	Prefix   string `yaml:"prefix"`
+	Tables   string `yaml:"tables"`
+	LogLevel string `yaml:"log_level"` // defaults to the host's
+}
+
+// configFlags adds the flags that locate the configuration to fs.
+func configFlags(fs *flag.FlagSet) (path, env *string) {
+	path = fs.String("config", "plugins.yaml", "the configuration `file`")
+	env = fs.String("env", os.Getenv("OASIS_ENV"), "the `environment` whose overlay, such as plugins.production.yaml, is merged in")
+	return path, env
+}
+
+// loadConfig reads the configuration at path with the overlay for env,
+// if not empty, and validates it.
+func loadConfig(path, env string) (*AppConfig, error) {
+	var c AppConfig
+	doc, err := config.Load(path, env, &c, config.Lookup)
+	if err != nil {
+		return nil, err
+	}
+	c.files = doc.Files
+	if c.Listen == "" {
+		c.Listen = defaultListen
+	}
+	var errs config.Errors
+	errs, c.warnings = c.validate(doc)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return &c, nil
+}
+
+// validate returns the settings of c that are wrong, and those that work
+// but should change, at their place in doc.
+func (c *AppConfig) validate(doc *config.Document) (errs, warnings config.Errors) {
+	if _, port, err := net.SplitHostPort(c.Listen); err != nil {
+		errs = append(errs, doc.Errorf("listen", "%v", err))
+	} else if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		errs = append(errs, doc.Errorf("listen", "port %q is not a number from 0 to 65535", port))
+	}
+	errs = append(errs, c.TLS.validate(doc, c.Listen)...)
+	if c.TLS.ACME.Enabled() && !strings.HasSuffix(c.Listen, ":443") && c.TLS.RedirectFrom == "" {
+		warnings = append(warnings, doc.Errorf("tls.acme", "the certificate authority verifies domains on ports 443 and 80; listen on :443 or set redirect_from to :80"))
+	}
+
+	if c.Database.URL == "" {
+		errs = append(errs, doc.Errorf("database.url", "must be set"))
+	} else if raw, _ := doc.Raw("database.url"); !strings.Contains(raw, "${") {
+		if u, err := url.Parse(raw); err == nil && u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				warnings = append(warnings, doc.Errorf("database.url",
+					"holds a password in plain text; write it as ${VAR} and set VAR or VAR_FILE"))
+			}
+		}
+	}
+	if c.Database.MaxOpenConns < 0 {
+		errs = append(errs, doc.Errorf("database.max_open_conns", "must not be negative"))
+	}
+	if c.Database.MaxIdleConns < 0 {
+		errs = append(errs, doc.Errorf("database.max_idle_conns", "must not be negative"))
+	}
+	if c.Database.ConnMaxLifetime != "" {
+		if _, err := time.ParseDuration(c.Database.ConnMaxLifetime); err != nil {
+			errs = append(errs, doc.Errorf("database.conn_max_lifetime", "%v", err))
+		}
+	}
+
+	if _, err := logging.ParseLevel(c.LogLevel); err != nil {
+		errs = append(errs, doc.Errorf("log_level", "%v", err))
+	}
+	if err := c.Tracing.Validate(); err != nil {
+		errs = append(errs, doc.Errorf("tracing", "%v", err))
+	}
+
+	errs = append(errs, c.Security.validate(doc)...)
+
+	names, prefixes := map[string]bool{}, map[string]string{}
+	for i, p := range c.Plugins {
+		at := fmt.Sprintf("plugins[%d]", i)
+		switch {
+		case p.Name == "":
+			errs = append(errs, doc.Errorf(at, "has no name"))
+		case names[p.Name]:
+			errs = append(errs, doc.Errorf(at+".name", "%s is already the name of a plugin", p.Name))
+		}
+		names[p.Name] = true
+		if p.Path == "" {
+			errs = append(errs, doc.Errorf(at, "has no path"))
+		} else if _, err := os.Stat(p.Path); err != nil {
+			warnings = append(warnings, doc.Errorf(at+".path", "%v; the plugin will not load", err))
+		}
+		if other, ok := prefixes[p.Prefix]; ok && p.Prefix != "" {
+			errs = append(errs, doc.Errorf(at+".prefix", "%s is already the prefix of %s", p.Prefix, other))
+		}
+		prefixes[p.Prefix] = p.Name
+		if _, err := logging.ParseLevel(p.LogLevel); err != nil {
+			errs = append(errs, doc.Errorf(at+".log_level", "%v", err))
+		}
+	}
+	return errs, warnings
+}
+
+// validate returns the settings of c that are wrong, at their place in
+// doc, for the host listening on listen.
+func (c TLSConfig) validate(doc *config.Document, listen string) (errs config.Errors) {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		errs = append(errs, doc.Errorf("tls", "set both cert_file and key_file, or neither"))
+	}
+	if c.CertFile != "" && c.ACME.Enabled() {
+		errs = append(errs, doc.Errorf("tls.acme", "set either cert_file and key_file or acme, not both"))
+	}
+	for _, f := range []struct{ path, file string }{
+		{"tls.cert_file", c.CertFile}, {"tls.key_file", c.KeyFile}, {"tls.acme.ca_file", c.ACME.CAFile},
+	} {
+		if _, err := os.Stat(f.file); f.file != "" && err != nil {
+			errs = append(errs, doc.Errorf(f.path, "%v", err))
+		}
+	}
+	for i, d := range c.ACME.Domains {
+		if d == "" || strings.ContainsAny(d, "/: ") {
+			errs = append(errs, doc.Errorf(fmt.Sprintf("tls.acme.domains[%d]", i), "%q is not a domain name", d))
+		}
+	}
+	if u := c.ACME.DirectoryURL; u != "" {
+		if parsed, err := url.Parse(u); err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+			errs = append(errs, doc.Errorf("tls.acme.directory_url", "%q is not an https URL", u))
+		}
+	}
+	if c.RedirectFrom != "" {
+		if !c.Enabled() {
+			errs = append(errs, doc.Errorf("tls.redirect_from", "needs a certificate: set cert_file and key_file, or acme"))
+		} else if _, _, err := net.SplitHostPort(c.RedirectFrom); err != nil {
+			errs = append(errs, doc.Errorf("tls.redirect_from", "%v", err))
+		} else if c.RedirectFrom == listen {
+			errs = append(errs, doc.Errorf("tls.redirect_from", "is the listen address"))
+		}
+	}
+	if c.HSTSMaxAge != "" {
+		if d, err := time.ParseDuration(c.HSTSMaxAge); err != nil || d < 0 {
+			errs = append(errs, doc.Errorf("tls.hsts_max_age", "%q is not a duration such as 8760h", c.HSTSMaxAge))
+		}
+	}
+	return errs
+}
+
+// originPattern matches an origin: a scheme and host, with an optional
+// port and nothing more.
+var originPattern = regexp.MustCompile(`^https?://[^/?#:]+(:[0-9]+)?$`)
+
+// validate returns the settings of c that are wrong, at their place in
+// doc.
+func (c SecurityConfig) validate(doc *config.Document) (errs config.Errors) {
+	if v := c.Headers.FrameOptions; v != "" && v != "off" && v != "DENY" && v != "SAMEORIGIN" {
+		errs = append(errs, doc.Errorf("security.headers.frame_options", "%q is not DENY, SAMEORIGIN or off", v))
+	}
+	for i, p := range c.CSRF.Exempt {
+		if !strings.HasPrefix(p, "/") {
+			errs = append(errs, doc.Errorf(fmt.Sprintf("security.csrf.exempt[%d]", i), "%q does not start with /", p))
+		}
+	}
+	for i, rule := range c.CORS {
+		at := fmt.Sprintf("security.cors[%d]", i)
+		if !strings.HasPrefix(rule.Path, "/") {
+			errs = append(errs, doc.Errorf(at+".path", "%q does not start with /", rule.Path))
+		}
+		if len(rule.Origins) == 0 {
+			errs = append(errs, doc.Errorf(at, "has no origins"))
+		}
+		for j, o := range rule.Origins {
+			switch {
+			case o == "*" && rule.Credentials:
+				errs = append(errs, doc.Errorf(fmt.Sprintf("%s.origins[%d]", at, j), "* cannot be used with credentials; list the origins"))
+			case o != "*" && !originPattern.MatchString(o):
+				errs = append(errs, doc.Errorf(fmt.Sprintf("%s.origins[%d]", at, j), "%q is not an origin such as https://reports.example.org", o))
+			}
+		}
+		for j, m := range rule.Methods {
+			if m == "" || strings.ToUpper(m) != m || strings.ContainsAny(m, " ,") {
+				errs = append(errs, doc.Errorf(fmt.Sprintf("%s.methods[%d]", at, j), "%q is not a method such as PUT", m))
+			}
+		}
+		if rule.MaxAge != "" {
+			if d, err := time.ParseDuration(rule.MaxAge); err != nil || d < 0 {
+				errs = append(errs, doc.Errorf(at+".max_age", "%q is not a duration such as 10m", rule.MaxAge))
+			}
+		}
+	}
+	return errs
+}
+
+// HostURL is where plugins reach the host's user port from the same
+// machine, for loopback calls to its APIs.
+func (c *AppConfig) HostURL() string {
+	host, port, _ := net.SplitHostPort(c.Listen)
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// checkConfig runs `oasis config check`: it loads the configuration as
+// the host would and reports every problem, returning the exit status.
+func checkConfig(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("oasis config check", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	path, env := configFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	c, err := loadConfig(*path, *env)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	for _, w := range c.warnings {
+		fmt.Fprintln(stderr, "warning:", w)
+	}
+	fmt.Fprintf(stdout, "%s: ok\n", strings.Join(c.files, ", "))
+	return 0
+}
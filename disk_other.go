@@ -0,0 +1,14 @@
+//go:build !(linux || darwin || freebsd)
+
+package main
+
+import (
+	"errors"
+
+	"github.com/catdevman/oasis/shared"
+)
+
+// diskUsage is not implemented on this platform.
+func diskUsage(path string) (*shared.DiskUsage, error) {
+	return nil, errors.ErrUnsupported
+}
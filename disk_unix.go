@@ -0,0 +1,26 @@
+//go:build linux || darwin || freebsd
+
+package main
+
+import (
+	"syscall"
+
+	"github.com/catdevman/oasis/shared"
+)
+
+// diskUsage reports the space on the filesystem holding path.
+func diskUsage(path string) (*shared.DiskUsage, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return nil, err
+	}
+	d := &shared.DiskUsage{
+		Path:       path,
+		TotalBytes: uint64(st.Blocks) * uint64(st.Bsize),
+		FreeBytes:  uint64(st.Bavail) * uint64(st.Bsize),
+	}
+	if d.TotalBytes > 0 {
+		d.UsedPercent = 100 * float64(d.TotalBytes-d.FreeBytes) / float64(d.TotalBytes)
+	}
+	return d, nil
+}
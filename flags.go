@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/catdevman/oasis/internal/flags"
+	"github.com/catdevman/oasis/shared"
+)
+
+// flagQueueSize is how many flag evaluations may wait to be recorded.
+const flagQueueSize = 4096
+
+// hostFlags are the feature flags.
+var hostFlags = flags.New()
+
+// flagRecorder records flag evaluations; it is nil until the database is
+// open.
+var flagRecorder *flags.Recorder
+
+func (hostServices) Flags() ([]shared.FeatureFlag, error) {
+	return hostFlags.List(), nil
+}
+
+func (hostServices) UpdateFlag(u shared.FlagUpdate) ([]shared.FieldError, error) {
+	if hostDB == nil {
+		return nil, errors.New("the host has no database connection")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), settingsTimeout)
+	defer cancel()
+	invalid, err := hostFlags.Update(ctx, hostDB, u)
+	if err != nil || len(invalid) > 0 {
+		return invalid, err
+	}
+	slog.Info("feature flag changed", "flag", u.Flag.Key, "deleted", u.Delete, "actor", u.Actor, "request_id", u.RequestID)
+	return nil, nil
+}
+
+func (s hostServices) EvaluateFlag(e shared.FlagEvaluation) (shared.FlagResult, error) {
+	result := hostFlags.Evaluate(e.Key, e.Subject)
+	if flagRecorder != nil {
+		flagRecorder.Record(s.plugin, e, result)
+	}
+	return result, nil
+}
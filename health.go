@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/catdevman/oasis/internal/db"
+	"github.com/catdevman/oasis/internal/metrics"
+	"github.com/catdevman/oasis/shared"
+)
+
+// healthTimeout bounds the checks behind one health report or readiness
+// probe.
+const healthTimeout = 2 * time.Second
+
+// diskFullPercent is the disk usage above which the system is degraded.
+const diskFullPercent = 90
+
+// startTime is when the host started.
+var startTime = time.Now()
+
+// hostDB is the host's own database connection, kept open after the
+// migrations to check the database's health.
+var hostDB *sql.DB
+
+// hostServices are the services the host offers the plugin it is served
+// to.
+type hostServices struct {
+	plugin string // the plugin's name
+}
+
+func (hostServices) Health() (shared.SystemHealth, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), healthTimeout)
+	defer cancel()
+	return systemHealth(ctx), nil
+}
+
+// systemHealth checks the database, every plugin and the disk.
+func systemHealth(ctx context.Context) shared.SystemHealth {
+	h := shared.SystemHealth{
+		Status:    shared.StatusHealthy,
+		StartedAt: startTime,
+		Database:  databaseHealth(ctx),
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		h.Version = buildVersion(info)
+	}
+	for _, p := range plugs {
+		h.Plugins = append(h.Plugins, p.health())
+	}
+	if disk, err := diskUsage("."); err != nil {
+		slog.Debug("checking disk usage", "error", err)
+	} else {
+		h.Disk = disk
+	}
+
+	switch {
+	case !h.Database.Connected:
+		h.Status = shared.StatusUnhealthy
+	case h.Disk != nil && h.Disk.UsedPercent >= diskFullPercent:
+		h.Status = shared.StatusDegraded
+	}
+	for _, p := range h.Plugins {
+		if h.Status == shared.StatusHealthy && (p.State != "running" || p.Pool != nil && p.Pool.Saturated()) {
+			h.Status = shared.StatusDegraded
+		}
+	}
+	return h
+}
+
+// databaseHealth pings the database and reads its migration version.
+func databaseHealth(ctx context.Context) shared.DatabaseHealth {
+	var h shared.DatabaseHealth
+	if hostDB == nil {
+		h.Error = "the host has no database connection"
+		return h
+	}
+	start := time.Now()
+	if err := hostDB.PingContext(ctx); err != nil {
+		h.Error = err.Error()
+		return h
+	}
+	h.Connected, h.LatencyMS = true, milliseconds(time.Since(start))
+	version, err := db.Version(ctx, hostDB)
+	if err != nil {
+		h.Error = err.Error()
+	}
+	h.Migration = version
+	return h
+}
+
+// health reports the plugin's process without restarting it: its latency
+// is the round trip of a GetRoutes call, and its pool statistics come from
+// the database metrics the SDK publishes.
+func (m *managedPlugin) health() shared.PluginHealth {
+	m.mu.Lock()
+	h := shared.PluginHealth{
+		Name:      m.config.Name,
+		Prefix:    m.config.Prefix,
+		State:     "running",
+		Version:   m.version,
+		StartedAt: m.startedAt,
+		Restarts:  m.restarts,
+	}
+	exited, rpc := m.client.Exited(), m.rpc
+	m.mu.Unlock()
+	if exited {
+		h.State = "exited"
+		return h
+	}
+
+	start := time.Now()
+	if _, err := rpc.GetRoutes(); err != nil {
+		h.Error = err.Error()
+		return h
+	}
+	h.LatencyMS = milliseconds(time.Since(start))
+	raw, err := rpc.GetMetrics()
+	if err != nil {
+		h.Error = err.Error()
+		return h
+	}
+	families, err := metrics.Decode(raw)
+	if err != nil {
+		h.Error = err.Error()
+		return h
+	}
+	for _, f := range families {
+		if len(f.GetMetric()) == 0 {
+			continue
+		}
+		metric := f.GetMetric()[0]
+		switch f.GetName() {
+		case "go_sql_in_use_connections":
+			h.Pool = pool(h.Pool)
+			h.Pool.InUse = int(metric.GetGauge().GetValue())
+		case "go_sql_max_open_connections":
+			h.Pool = pool(h.Pool)
+			h.Pool.MaxOpen = int(metric.GetGauge().GetValue())
+		case "go_sql_wait_count_total":
+			h.Pool = pool(h.Pool)
+			h.Pool.WaitCount = int64(metric.GetCounter().GetValue())
+		}
+	}
+	return h
+}
+
+func pool(p *shared.PoolStats) *shared.PoolStats {
+	if p == nil {
+		return new(shared.PoolStats)
+	}
+	return p
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// buildVersion names the build described by info: its module version, or
+// for a build from a checkout, its VCS revision.
+func buildVersion(info *debug.BuildInfo) string {
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+	var revision, modified string
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.modified":
+			modified = s.Value
+		}
+	}
+	if revision == "" {
+		return "devel"
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if modified == "true" {
+		revision += "-dirty"
+	}
+	return revision
+}
+
+// serveLivez answers the liveness probe: the host is serving requests.
+func serveLivez(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+// serveReadyz answers the readiness probe: the database answers and every
+// plugin process is running. Each check is listed, as Kubernetes
+// components do, and any failure makes the answer 503.
+func serveReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+	defer cancel()
+
+	var report strings.Builder
+	ready := true
+	check := func(name string, err error) {
+		if err != nil {
+			ready = false
+			fmt.Fprintf(&report, "[-]%s failed: %v\n", name, err)
+		} else {
+			fmt.Fprintf(&report, "[+]%s ok\n", name)
+		}
+	}
+	if hostDB == nil {
+		check("database", errors.New("not connected"))
+	} else {
+		check("database", hostDB.PingContext(ctx))
+	}
+	for _, p := range plugs {
+		var err error
+		if p.exited() {
+			err = errors.New("process exited")
+		}
+		check("plugin "+p.config.Name, err)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		report.WriteString("readyz check failed\n")
+	} else {
+		report.WriteString("ok\n")
+	}
+	w.Write([]byte(report.String()))
+}
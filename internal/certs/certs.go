@@ -0,0 +1,100 @@
+// Package certs serves a TLS certificate from files and keeps it current,
+// so a certificate rotated on disk, as cert-manager or certbot do, is
+// served without restarting the host.
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Reloader holds the certificate in a pair of PEM files.
+type Reloader struct {
+	certFile, keyFile string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time // the later of the files' modification times when loaded
+}
+
+// New loads the certificate in certFile and its key in keyFile.
+func New(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the files again if either has changed since they were
+// last loaded, reporting whether it did. On error the certificate already
+// loaded is kept.
+func (r *Reloader) Reload() (bool, error) {
+	modTime, err := r.lastModified()
+	if err != nil {
+		return false, err
+	}
+	r.mu.RLock()
+	current := r.cert != nil && modTime.Equal(r.modTime)
+	r.mu.RUnlock()
+	if current {
+		return false, nil
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("loading certificate: %w", err)
+	}
+	r.mu.Lock()
+	r.cert, r.modTime = &cert, modTime
+	r.mu.Unlock()
+	return true, nil
+}
+
+func (r *Reloader) lastModified() (time.Time, error) {
+	var last time.Time
+	for _, f := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("loading certificate: %w", err)
+		}
+		if info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+	}
+	return last, nil
+}
+
+// GetCertificate returns the certificate, for tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Watch reloads the certificate every interval until ctx is done, logging
+// each certificate loaded and each failure to load one.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		switch reloaded, err := r.Reload(); {
+		case err != nil:
+			slog.Error("certificate not reloaded; serving the previous one", "cert_file", r.certFile, "error", err)
+		case reloaded:
+			r.mu.RLock()
+			leaf := r.cert.Leaf
+			r.mu.RUnlock()
+			slog.Info("certificate reloaded", "cert_file", r.certFile, "subject", leaf.Subject.String(), "not_after", leaf.NotAfter)
+		}
+	}
+}
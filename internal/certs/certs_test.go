@@ -0,0 +1,95 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self-signed certificate for name to certFile and
+// keyFile, dated modTime.
+func writeCert(t *testing.T, certFile, keyFile, name string, modTime time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for file, block := range map[string]*pem.Block{
+		certFile: {Type: "CERTIFICATE", Bytes: der},
+		keyFile:  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	} {
+		if err := os.WriteFile(file, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func served(t *testing.T, r *Reloader) string {
+	t.Helper()
+	cert, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Leaf.Subject.CommonName
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	start := time.Now().Add(-time.Hour)
+	writeCert(t, certFile, keyFile, "old.example.org", start)
+
+	r, err := New(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := served(t, r); got != "old.example.org" {
+		t.Fatalf("serving %s, want old.example.org", got)
+	}
+	if reloaded, err := r.Reload(); reloaded || err != nil {
+		t.Errorf("Reload of unchanged files = %v, %v; want false, nil", reloaded, err)
+	}
+
+	writeCert(t, certFile, keyFile, "new.example.org", start.Add(time.Minute))
+	if reloaded, err := r.Reload(); !reloaded || err != nil {
+		t.Errorf("Reload of rotated files = %v, %v; want true, nil", reloaded, err)
+	}
+	if got := served(t, r); got != "new.example.org" {
+		t.Errorf("serving %s after rotation, want new.example.org", got)
+	}
+
+	// A half-written rotation is refused and the last good certificate kept.
+	os.WriteFile(keyFile, []byte("not a key"), 0o600)
+	if _, err := r.Reload(); err == nil {
+		t.Error("Reload of a broken key succeeded")
+	}
+	if got := served(t, r); got != "new.example.org" {
+		t.Errorf("serving %s after a failed reload, want new.example.org", got)
+	}
+}
@@ -0,0 +1,428 @@
+// Package config loads YAML configuration the way plugins.yaml is read: a
+// base file and an optional overlay per environment, merged; ${VAR}
+// references expanded from the environment, with VAR_FILE naming a file
+// that holds a secret; and strict decoding, so that every error names the
+// file and line it comes from.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Error is a problem at a place in a configuration file.
+type Error struct {
+	File string
+	Line int    // 0 if unknown
+	Path string // the setting, such as database.url or plugins[2].path
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	b.WriteString(e.File)
+	if e.Line > 0 {
+		fmt.Fprintf(&b, ":%d", e.Line)
+	}
+	b.WriteString(": ")
+	if e.Path != "" {
+		b.WriteString(e.Path + ": ")
+	}
+	b.WriteString(e.Msg)
+	return b.String()
+}
+
+// Errors are every problem found in a configuration, one per line.
+type Errors []*Error
+
+func (e Errors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// LookupFunc finds the value of an environment variable.
+type LookupFunc func(name string) (value string, ok bool, err error)
+
+// Lookup finds the variable name in the process environment, or, when
+// name_FILE is set instead, reads it from the file that names, as Docker
+// and Kubernetes mount secrets. A trailing newline in the file is dropped.
+func Lookup(name string) (string, bool, error) {
+	file, fromFile := os.LookupEnv(name + "_FILE")
+	value, ok := os.LookupEnv(name)
+	switch {
+	case fromFile && ok:
+		return "", false, fmt.Errorf("both %s and %s_FILE are set", name, name)
+	case fromFile:
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", false, fmt.Errorf("%s_FILE: %w", name, err)
+		}
+		return strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r"), true, nil
+	}
+	return value, ok, nil
+}
+
+// OverlayPath is the overlay of the file path for env: plugins.yaml's for
+// production is plugins.production.yaml.
+func OverlayPath(path, env string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + env + ext
+}
+
+// Document is a configuration merged from its files, ready to decode.
+type Document struct {
+	// Files are the files read, the base first.
+	Files []string
+
+	root *yaml.Node
+	file map[*yaml.Node]string // the file each node was read from
+	raw  map[*yaml.Node]string // scalars as written, before expansion
+}
+
+// Load reads path and, if env is not empty, the overlay OverlayPath(path,
+// env), which must exist; expands the variables in both with lookup; and
+// merges the overlay over the base. Each file is decoded into a new value
+// of v's type to check it on its own, so that unknown settings and values
+// of the wrong type are reported at their file and line.
+func Load(path, env string, v interface{}, lookup LookupFunc) (*Document, error) {
+	d := &Document{file: map[*yaml.Node]string{}, raw: map[*yaml.Node]string{}}
+	paths := []string{path}
+	if env != "" {
+		paths = append(paths, OverlayPath(path, env))
+	}
+	var errs Errors
+	for _, p := range paths {
+		root, err := d.read(p, lookup)
+		if err != nil {
+			return nil, err
+		}
+		if root == nil {
+			continue
+		}
+		errs = append(errs, d.check(root, reflect.TypeOf(v).Elem(), "")...)
+		errs = append(errs, d.decode(root, reflect.New(reflect.TypeOf(v).Elem()).Interface())...)
+		if d.root == nil {
+			d.root = root
+		} else {
+			merge(d.root, root)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	if d.root != nil {
+		if errs := d.decode(d.root, v); len(errs) > 0 {
+			return nil, errs
+		}
+	}
+	return d, nil
+}
+
+// read parses the file p and expands its variables, returning the root
+// mapping, or nil for an empty file.
+func (d *Document) read(p string, lookup LookupFunc) (*yaml.Node, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("could not read config file: %w", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, Errors{parseError(p, err)}
+	}
+	d.Files = append(d.Files, p)
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, Errors{{File: p, Line: root.Line, Msg: "must be a mapping of settings"}}
+	}
+	var errs Errors
+	walk(root, func(n *yaml.Node) {
+		d.file[n] = p
+		if n.Kind != yaml.ScalarNode || !strings.Contains(n.Value, "$") {
+			return
+		}
+		value, err := expand(n.Value, lookup)
+		if err != nil {
+			errs = append(errs, &Error{File: p, Line: n.Line, Msg: err.Error()})
+			return
+		}
+		d.raw[n] = n.Value
+		n.Value = value
+		if n.Style == 0 {
+			n.Tag = "" // resolve the expanded value, so ${PORT} can be an int
+		}
+	})
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return root, nil
+}
+
+// varPattern matches $$, ${NAME} and ${NAME:-default}.
+var varPattern = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expand replaces the variable references in s. $$ is a literal $.
+func expand(s string, lookup LookupFunc) (string, error) {
+	var errs []string
+	out := varPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		if ref == "$$" {
+			return "$"
+		}
+		m := varPattern.FindStringSubmatch(ref)
+		value, ok, err := lookup(m[1])
+		switch {
+		case err != nil:
+			errs = append(errs, err.Error())
+		case ok && value != "":
+			return value
+		case m[2] != "":
+			return m[3]
+		case !ok:
+			errs = append(errs, fmt.Sprintf("%s is not set", m[1]))
+		}
+		return value
+	})
+	if len(errs) > 0 {
+		return "", errors.New(strings.Join(errs, "; "))
+	}
+	return out, nil
+}
+
+// check reports the keys of n that no field of t takes, at their lines.
+func (d *Document) check(n *yaml.Node, t reflect.Type, path string) Errors {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var errs Errors
+	switch {
+	case n.Kind == yaml.MappingNode && t.Kind() == reflect.Struct:
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			f, ok := fields[key.Value]
+			if !ok {
+				errs = append(errs, &Error{File: d.file[key], Line: key.Line, Path: join(path, key.Value), Msg: "is not a setting"})
+				continue
+			}
+			errs = append(errs, d.check(value, f.Type, join(path, key.Value))...)
+		}
+	case n.Kind == yaml.MappingNode && t.Kind() == reflect.Map:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			errs = append(errs, d.check(n.Content[i+1], t.Elem(), join(path, n.Content[i].Value))...)
+		}
+	case n.Kind == yaml.SequenceNode && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array):
+		for i, item := range n.Content {
+			errs = append(errs, d.check(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+	return errs
+}
+
+// yamlFields maps the keys a struct of type t takes to its fields.
+func yamlFields(t reflect.Type) map[string]reflect.StructField {
+	fields := map[string]reflect.StructField{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "-" || !f.IsExported() {
+			continue
+		}
+		if strings.Contains(opts, "inline") {
+			for k, v := range yamlFields(f.Type) {
+				fields[k] = v
+			}
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f
+	}
+	return fields
+}
+
+// decodeLine matches the line yaml.v3 prefixes its type errors with.
+var decodeLine = regexp.MustCompile(`^line (\d+): (.*)$`)
+
+// decode decodes n into v, reporting type errors at their file and line.
+func (d *Document) decode(n *yaml.Node, v interface{}) Errors {
+	err := n.Decode(v)
+	if err == nil {
+		return nil
+	}
+	file := d.file[n]
+	var typeErr *yaml.TypeError
+	if !errors.As(err, &typeErr) {
+		return Errors{{File: file, Msg: err.Error()}}
+	}
+	var errs Errors
+	for _, msg := range typeErr.Errors {
+		e := &Error{File: file, Msg: msg}
+		if m := decodeLine.FindStringSubmatch(msg); m != nil {
+			e.Line, _ = strconv.Atoi(m[1])
+			e.Msg = m[2]
+		}
+		errs = append(errs, e)
+	}
+	return errs
+}
+
+// parseError turns a YAML syntax error into an Error at its line.
+func parseError(file string, err error) *Error {
+	msg := strings.TrimPrefix(err.Error(), "yaml: ")
+	e := &Error{File: file, Msg: msg}
+	if m := decodeLine.FindStringSubmatch(msg); m != nil {
+		e.Line, _ = strconv.Atoi(m[1])
+		e.Msg = m[2]
+	}
+	return e
+}
+
+// merge lays overlay over base: mappings merge key by key, sequences of
+// mappings with a name merge item by name, and anything else in overlay
+// replaces what base has.
+func merge(base, overlay *yaml.Node) {
+	for i := 0; i+1 < len(overlay.Content); i += 2 {
+		key, value := overlay.Content[i], overlay.Content[i+1]
+		j := mappingIndex(base, key.Value)
+		switch {
+		case j < 0:
+			base.Content = append(base.Content, key, value)
+		case base.Content[j].Kind == yaml.MappingNode && value.Kind == yaml.MappingNode:
+			merge(base.Content[j], value)
+		case base.Content[j].Kind == yaml.SequenceNode && value.Kind == yaml.SequenceNode && named(value):
+			mergeNamed(base.Content[j], value)
+		default:
+			base.Content[j] = value
+		}
+	}
+}
+
+// mergeNamed merges the items of overlay into those of base with the
+// same name, appending those base lacks.
+func mergeNamed(base, overlay *yaml.Node) {
+	for _, item := range overlay.Content {
+		name := scalar(item, "name")
+		found := false
+		for _, b := range base.Content {
+			if b.Kind == yaml.MappingNode && scalar(b, "name") == name {
+				merge(b, item)
+				found = true
+				break
+			}
+		}
+		if !found {
+			base.Content = append(base.Content, item)
+		}
+	}
+}
+
+// named reports whether every item of the sequence n is a mapping with a
+// name.
+func named(n *yaml.Node) bool {
+	for _, item := range n.Content {
+		if item.Kind != yaml.MappingNode || scalar(item, "name") == "" {
+			return false
+		}
+	}
+	return len(n.Content) > 0
+}
+
+// mappingIndex returns the index in the mapping n of the value of key, or
+// -1.
+func mappingIndex(n *yaml.Node, key string) int {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+func scalar(n *yaml.Node, key string) string {
+	if i := mappingIndex(n, key); i >= 0 && n.Content[i].Kind == yaml.ScalarNode {
+		return n.Content[i].Value
+	}
+	return ""
+}
+
+// node finds the node at path, such as plugins[2].path, or nil.
+func (d *Document) node(path string) *yaml.Node {
+	n := d.root
+	for _, part := range strings.Split(path, ".") {
+		if n == nil || part == "" {
+			return n
+		}
+		name, index, indexed := strings.Cut(part, "[")
+		if name != "" {
+			if n.Kind != yaml.MappingNode {
+				return nil
+			}
+			i := mappingIndex(n, name)
+			if i < 0 {
+				return nil
+			}
+			n = n.Content[i]
+		}
+		if indexed {
+			i, err := strconv.Atoi(strings.TrimSuffix(index, "]"))
+			if err != nil || n.Kind != yaml.SequenceNode || i < 0 || i >= len(n.Content) {
+				return nil
+			}
+			n = n.Content[i]
+		}
+	}
+	return n
+}
+
+// Errorf returns an error at the setting at path. A setting the files
+// leave out is reported at the file that would set it, the last read.
+func (d *Document) Errorf(path, format string, args ...interface{}) *Error {
+	e := &Error{Path: path, Msg: fmt.Sprintf(format, args...)}
+	if n := d.node(path); n != nil {
+		e.File, e.Line = d.file[n], n.Line
+	} else if len(d.Files) > 0 {
+		e.File = d.Files[len(d.Files)-1]
+	}
+	return e
+}
+
+// Raw returns the setting at path as written, before its variables were
+// expanded, and whether the files set it.
+func (d *Document) Raw(path string) (string, bool) {
+	n := d.node(path)
+	if n == nil {
+		return "", false
+	}
+	if raw, ok := d.raw[n]; ok {
+		return raw, true
+	}
+	return n.Value, true
+}
+
+func walk(n *yaml.Node, fn func(*yaml.Node)) {
+	fn(n)
+	for _, c := range n.Content {
+		walk(c, fn)
+	}
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type testConfig struct {
+	Listen   string `yaml:"listen"`
+	Port     int    `yaml:"port"`
+	Database struct {
+		URL string `yaml:"url"`
+	} `yaml:"database"`
+	Plugins []struct {
+		Name     string `yaml:"name"`
+		Path     string `yaml:"path"`
+		LogLevel string `yaml:"log_level"`
+	} `yaml:"plugins"`
+}
+
+// write writes files, by name, to a new directory and returns the path of
+// the first one named base.yaml.
+func write(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(dir, "base.yaml")
+}
+
+func env(vars map[string]string) LookupFunc {
+	return func(name string) (string, bool, error) {
+		v, ok := vars[name]
+		return v, ok, nil
+	}
+}
+
+func TestLoadExpands(t *testing.T) {
+	path := write(t, map[string]string{"base.yaml": `
+listen: "${HOST:-0.0.0.0}:8080"
+port: ${PORT}
+database:
+  url: "postgres://oasis:${PASSWORD}@db/oasis?cost=$$5"
+`})
+	var c testConfig
+	doc, err := Load(path, "", &c, env(map[string]string{"PORT": "9000", "PASSWORD": "s3cret"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Listen != "0.0.0.0:8080" || c.Port != 9000 || c.Database.URL != "postgres://oasis:s3cret@db/oasis?cost=$5" {
+		t.Errorf("got %+v", c)
+	}
+	if raw, _ := doc.Raw("database.url"); !strings.Contains(raw, "${PASSWORD}") {
+		t.Errorf("Raw(database.url) = %q, want it as written", raw)
+	}
+}
+
+func TestLoadUnsetVariable(t *testing.T) {
+	path := write(t, map[string]string{"base.yaml": "listen: x\ndatabase:\n  url: ${DB_URL}\n"})
+	var c testConfig
+	_, err := Load(path, "", &c, env(nil))
+	if err == nil || !strings.HasSuffix(err.Error(), "base.yaml:3: DB_URL is not set") {
+		t.Errorf("err = %v, want DB_URL not set at line 3", err)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(secret, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("OASIS_TEST_SECRET_FILE", secret)
+	if v, ok, err := Lookup("OASIS_TEST_SECRET"); v != "s3cret" || !ok || err != nil {
+		t.Errorf("Lookup from a file = %q, %v, %v", v, ok, err)
+	}
+	t.Setenv("OASIS_TEST_SECRET", "other")
+	if _, _, err := Lookup("OASIS_TEST_SECRET"); err == nil {
+		t.Error("Lookup with both VAR and VAR_FILE set succeeded")
+	}
+}
+
+func TestLoadOverlay(t *testing.T) {
+	path := write(t, map[string]string{
+		"base.yaml": `
+listen: ":8080"
+database:
+  url: "postgres://localhost/oasis"
+plugins:
+  - name: a
+    path: ./a
+  - name: b
+    path: ./b
+`,
+		"base.production.yaml": `
+listen: ":8443"
+plugins:
+  - name: b
+    log_level: warn
+  - name: c
+    path: ./c
+`,
+	})
+	var c testConfig
+	doc, err := Load(path, "production", &c, env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Files) != 2 {
+		t.Errorf("Files = %v, want the base and the overlay", doc.Files)
+	}
+	if c.Listen != ":8443" || c.Database.URL != "postgres://localhost/oasis" {
+		t.Errorf("got %+v", c)
+	}
+	var got []string
+	for _, p := range c.Plugins {
+		got = append(got, p.Name+"="+p.Path+"/"+p.LogLevel)
+	}
+	if want := "a=./a/ b=./b/warn c=./c/"; strings.Join(got, " ") != want {
+		t.Errorf("plugins = %v, want %s", got, want)
+	}
+	if e := doc.Errorf("plugins[1].log_level", "bad"); !strings.HasSuffix(e.Error(), "base.production.yaml:5: plugins[1].log_level: bad") {
+		t.Errorf("Errorf = %v, want it at the overlay's line", e)
+	}
+
+	if _, err := Load(path, "staging", &c, env(nil)); err == nil {
+		t.Error("Load with a missing overlay succeeded")
+	}
+}
+
+func TestLoadStrict(t *testing.T) {
+	path := write(t, map[string]string{"base.yaml": "listen: x\ndatabse:\n  url: y\nport: many\n"})
+	var c testConfig
+	_, err := Load(path, "", &c, env(nil))
+	errs, ok := err.(Errors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("err = %v, want two errors", err)
+	}
+	if errs[0].Line != 2 || errs[0].Path != "databse" || errs[0].Msg != "is not a setting" {
+		t.Errorf("errs[0] = %v", errs[0])
+	}
+	if errs[1].Line != 4 {
+		t.Errorf("errs[1] = %v, want it at line 4", errs[1])
+	}
+}
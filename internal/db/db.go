@@ -3,6 +3,7 @@ package db
 import (
 	"database/sql"
 	"fmt"
+	"net/url"
 	"time"
 
 	_ "github.com/lib/pq"
@@ -22,7 +23,7 @@ type Config struct {
 func Open(cfg Config) (*sql.DB, error) {
 	db, err := sql.Open("postgres", cfg.URL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database at %s: %w", cfg.URL, err)
+		return nil, fmt.Errorf("failed to open database at %s: %w", redact(cfg.URL), err)
 	}
 
 	// Connection pool
@@ -44,3 +45,12 @@ func Open(cfg Config) (*sql.DB, error) {
 
 	return db, nil
 }
+
+// redact hides the password in a database URL, for messages.
+func redact(dbURL string) string {
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		return "(unparseable URL)"
+	}
+	return u.Redacted()
+}
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
@@ -85,7 +86,7 @@ func Migrate(db *sql.DB, migrationsDir string) error {
 			return fmt.Errorf("failed to apply migration %s: %w", filename, err)
 		}
 
-		if _, err := tx.Exec("INSERT INTO _migrations (filename) VALUES (?)", filename); err != nil {
+		if _, err := tx.Exec("INSERT INTO _migrations (filename) VALUES ($1)", filename); err != nil {
 			tx.Rollback()
 			return fmt.Errorf("failed to record migration %s: %w", filename, err)
 		}
@@ -99,3 +100,14 @@ func Migrate(db *sql.DB, migrationsDir string) error {
 
 	return nil
 }
+
+// Version returns the last migration applied to db, or "" if none has
+// been.
+func Version(ctx context.Context, db *sql.DB) (string, error) {
+	var filename sql.NullString
+	err := db.QueryRowContext(ctx, "SELECT max(filename) FROM _migrations").Scan(&filename)
+	if err != nil {
+		return "", fmt.Errorf("failed to query _migrations: %w", err)
+	}
+	return filename.String, nil
+}
@@ -1,6 +1,9 @@
 package errors
 
-import "fmt"
+import (
+	"fmt"
+	"net/http"
+)
 
 // Kind categorizes errors in the Oasis system.
 type Kind int
@@ -11,6 +14,15 @@ const (
 	KindDatabase                 // database errors
 	KindNotFound                 // route/resource not found
 	KindInternal                 // internal/unexpected errors
+
+	// Kinds for requests the caller must fix; their Detail is shown to it.
+	KindInvalid              // request failed validation
+	KindForbidden            // caller's role may not perform the operation
+	KindConflict             // conflicts with the current state of a resource
+	KindNotAllowed           // method not allowed on the resource
+	KindPrecondition         // If-Match names a version that is no longer current
+	KindPreconditionRequired // conditional request sent without If-Match
+	KindTooLarge             // payload exceeds a limit
 )
 
 func (k Kind) String() string {
@@ -25,25 +37,113 @@ func (k Kind) String() string {
 		return "not found"
 	case KindInternal:
 		return "internal error"
+	case KindInvalid:
+		return "invalid request"
+	case KindForbidden:
+		return "forbidden"
+	case KindConflict:
+		return "conflict"
+	case KindNotAllowed:
+		return "method not allowed"
+	case KindPrecondition:
+		return "precondition failed"
+	case KindPreconditionRequired:
+		return "precondition required"
+	case KindTooLarge:
+		return "payload too large"
 	default:
 		return "unknown error"
 	}
 }
 
-// OasisError is the standard error type for the Oasis system.
+// Status is the HTTP status an error of kind k is reported with.
+func (k Kind) Status() int {
+	switch k {
+	case KindPlugin:
+		return http.StatusBadGateway
+	case KindNotFound:
+		return http.StatusNotFound
+	case KindInvalid:
+		return http.StatusBadRequest
+	case KindForbidden:
+		return http.StatusForbidden
+	case KindConflict:
+		return http.StatusConflict
+	case KindNotAllowed:
+		return http.StatusMethodNotAllowed
+	case KindPrecondition:
+		return http.StatusPreconditionFailed
+	case KindPreconditionRequired:
+		return http.StatusPreconditionRequired
+	case KindTooLarge:
+		return http.StatusRequestEntityTooLarge
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Code is the stable, machine-readable code of errors of kind k that do
+// not set their own.
+func (k Kind) Code() string {
+	switch k {
+	case KindPlugin:
+		return "PLUGIN_UNAVAILABLE"
+	case KindNotFound:
+		return "NOT_FOUND"
+	case KindInvalid:
+		return "INVALID_REQUEST"
+	case KindForbidden:
+		return "FORBIDDEN"
+	case KindConflict:
+		return "CONFLICT"
+	case KindNotAllowed:
+		return "METHOD_NOT_ALLOWED"
+	case KindPrecondition:
+		return "PRECONDITION_FAILED"
+	case KindPreconditionRequired:
+		return "PRECONDITION_REQUIRED"
+	case KindTooLarge:
+		return "PAYLOAD_TOO_LARGE"
+	default:
+		return "INTERNAL_ERROR"
+	}
+}
+
+// OasisError is the standard error type for the Oasis system. Err is the
+// internal cause, which is logged but never shown to clients; Detail is
+// the explanation they see for kinds with a 4xx status.
 type OasisError struct {
-	Op   string // the operation that failed (e.g., "loadConfig", "serveHTTP")
-	Kind Kind   // categorizes the error
-	Err  error  // the underlying wrapped error
+	Op     string       // the operation that failed (e.g., "loadConfig", "serveHTTP")
+	Kind   Kind         // categorizes the error
+	Err    error        // the underlying wrapped error
+	Code   string       // stable error code; empty for the Kind's
+	Detail string       // client-facing explanation
+	Fields []FieldError // the invalid fields of a KindInvalid error
 }
 
 func (e *OasisError) Error() string {
-	if e.Err != nil {
+	switch {
+	case e.Err != nil:
 		return fmt.Sprintf("%s: %s: %s", e.Op, e.Kind, e.Err.Error())
+	case e.Detail != "":
+		return fmt.Sprintf("%s: %s: %s", e.Op, e.Kind, e.Detail)
 	}
 	return fmt.Sprintf("%s: %s", e.Op, e.Kind)
 }
 
+// Status is the HTTP status e is reported with.
+func (e *OasisError) Status() int {
+	return e.Kind.Status()
+}
+
+// ErrorCode is e's Code, or its Kind's when it has none.
+func (e *OasisError) ErrorCode() string {
+	if e.Code != "" {
+		return e.Code
+	}
+	return e.Kind.Code()
+}
+
 func (e *OasisError) Unwrap() error {
 	return e.Err
 }
@@ -56,3 +156,14 @@ func E(op string, kind Kind, err error) *OasisError {
 		Err:  err,
 	}
 }
+
+// New constructs an error a client can act on, with no internal cause.
+// code may be empty to use the kind's.
+func New(op string, kind Kind, code, detail string) *OasisError {
+	return &OasisError{
+		Op:     op,
+		Kind:   kind,
+		Code:   code,
+		Detail: detail,
+	}
+}
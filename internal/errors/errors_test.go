@@ -124,3 +124,44 @@ func TestEConstructorNilErr(t *testing.T) {
 	// Should not panic
 	_ = oErr.Error()
 }
+
+func TestKindStatus(t *testing.T) {
+	tests := []struct {
+		kind Kind
+		want int
+		code string
+	}{
+		{KindConfig, 500, "INTERNAL_ERROR"},
+		{KindPlugin, 502, "PLUGIN_UNAVAILABLE"},
+		{KindNotFound, 404, "NOT_FOUND"},
+		{KindInvalid, 400, "INVALID_REQUEST"},
+		{KindForbidden, 403, "FORBIDDEN"},
+		{KindConflict, 409, "CONFLICT"},
+		{KindNotAllowed, 405, "METHOD_NOT_ALLOWED"},
+		{KindPrecondition, 412, "PRECONDITION_FAILED"},
+		{KindPreconditionRequired, 428, "PRECONDITION_REQUIRED"},
+		{KindTooLarge, 413, "PAYLOAD_TOO_LARGE"},
+		{Kind(99), 500, "INTERNAL_ERROR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kind.String(), func(t *testing.T) {
+			if got := tt.kind.Status(); got != tt.want {
+				t.Errorf("Kind(%d).Status() = %d, want %d", tt.kind, got, tt.want)
+			}
+			if got := tt.kind.Code(); got != tt.code {
+				t.Errorf("Kind(%d).Code() = %q, want %q", tt.kind, got, tt.code)
+			}
+		})
+	}
+}
+
+func TestOasisErrorErrorDetail(t *testing.T) {
+	err := New("restore", KindConflict, "", "resource is not deleted")
+	want := "restore: conflict: resource is not deleted"
+	if got := err.Error(); got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if got := err.ErrorCode(); got != "CONFLICT" {
+		t.Errorf("ErrorCode() = %q, want CONFLICT", got)
+	}
+}
@@ -0,0 +1,107 @@
+package errors
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// ContentType is the media type of RFC 9457 problem details.
+const ContentType = "application/problem+json"
+
+// RequestIDHeader carries the correlation ID the host assigns each request.
+// It is forwarded to plugins and echoed on the response.
+const RequestIDHeader = "X-Request-ID"
+
+// FieldError describes one invalid field of a request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Problem is an RFC 9457 problem details object. Code, Errors and
+// CorrelationID are extension members: a stable code clients may switch
+// on, the invalid fields of a 400, and the request ID to quote when
+// reporting a 5xx.
+type Problem struct {
+	Type          string       `json:"type"`
+	Title         string       `json:"title"`
+	Status        int          `json:"status"`
+	Detail        string       `json:"detail,omitempty"`
+	Instance      string       `json:"instance,omitempty"`
+	Code          string       `json:"code"`
+	Errors        []FieldError `json:"errors,omitempty"`
+	CorrelationID string       `json:"correlationId,omitempty"`
+}
+
+// NewProblem returns the problem for a status, code and detail.
+func NewProblem(status int, code, detail string) Problem {
+	return Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// ToProblem returns the problem err is reported as. An *OasisError in err's
+// chain supplies the status, code, detail and fields; any other error is a
+// 500. The detail of a 5xx is never taken from err, so internal causes such
+// as SQL errors cannot leak to clients.
+func ToProblem(err error) Problem {
+	var oErr *OasisError
+	if !errors.As(err, &oErr) {
+		return NewProblem(http.StatusInternalServerError, KindInternal.Code(), internalDetail)
+	}
+	status := oErr.Status()
+	if status >= http.StatusInternalServerError {
+		return NewProblem(status, oErr.ErrorCode(), internalDetail)
+	}
+	p := NewProblem(status, oErr.ErrorCode(), oErr.Detail)
+	p.Errors = oErr.Fields
+	return p
+}
+
+const internalDetail = "the server could not complete the request; quote the correlationId when reporting it"
+
+// Write writes err to w as problem details for the request r. Errors
+// reported with a 5xx are logged with their internal cause and the
+// correlation ID.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	p := ToProblem(err)
+	if p.Status >= http.StatusInternalServerError {
+		slog.Error("request failed", "method", r.Method, "path", r.URL.Path,
+			"status", p.Status, "request_id", RequestID(r), "error", err)
+	}
+	WriteProblem(w, r, p)
+}
+
+// WriteProblem writes p to w, filling in the request path and correlation
+// ID when p has none.
+func WriteProblem(w http.ResponseWriter, r *http.Request, p Problem) {
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+	if p.CorrelationID == "" {
+		p.CorrelationID = RequestID(r)
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// RequestID returns the correlation ID of r, as set by the host.
+func RequestID(r *http.Request) string {
+	return r.Header.Get(RequestIDHeader)
+}
+
+// NewRequestID returns a random correlation ID.
+func NewRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,63 @@
+package errors
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestToProblem(t *testing.T) {
+	fields := []FieldError{{Field: "firstname", Message: "must be a string"}}
+	invalid := New("create", KindInvalid, "", "request failed validation")
+	invalid.Fields = fields
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+		wantDetail string
+		wantFields int
+	}{
+		{"invalid", invalid, 400, "INVALID_REQUEST", "request failed validation", 1},
+		{"custom code", New("bulk", KindTooLarge, "TOO_MANY_RECORDS", "at most 1000"), 413, "TOO_MANY_RECORDS", "at most 1000", 0},
+		{"wrapped", fmt.Errorf("get: %w", New("get", KindNotFound, "", "resource not found")), 404, "NOT_FOUND", "resource not found", 0},
+		{"internal cause hidden", E("list", KindDatabase, fmt.Errorf(`pq: relation "x" does not exist`)), 500, "INTERNAL_ERROR", internalDetail, 0},
+		{"plugin", E("serveHTTP", KindPlugin, fmt.Errorf("connection reset")), 502, "PLUGIN_UNAVAILABLE", internalDetail, 0},
+		{"plain error", fmt.Errorf("boom"), 500, "INTERNAL_ERROR", internalDetail, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := ToProblem(tt.err)
+			if p.Status != tt.wantStatus || p.Code != tt.wantCode || p.Detail != tt.wantDetail || len(p.Errors) != tt.wantFields {
+				t.Errorf("ToProblem = %+v, want status %d code %s detail %q and %d fields",
+					p, tt.wantStatus, tt.wantCode, tt.wantDetail, tt.wantFields)
+			}
+			if p.Title != http.StatusText(tt.wantStatus) {
+				t.Errorf("Title = %q, want %q", p.Title, http.StatusText(tt.wantStatus))
+			}
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/common/ed-fi/students/x", nil)
+	r.Header.Set(RequestIDHeader, "req-1")
+	w := httptest.NewRecorder()
+	Write(w, r, New("get", KindNotFound, "", "resource not found"))
+
+	if got := w.Header().Get("Content-Type"); got != ContentType {
+		t.Errorf("Content-Type = %q, want %q", got, ContentType)
+	}
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", w.Code)
+	}
+	var p Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.CorrelationID != "req-1" || p.Instance != "/api/common/ed-fi/students/x" {
+		t.Errorf("problem = %+v, want the request's correlation ID and path", p)
+	}
+}
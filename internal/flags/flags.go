@@ -0,0 +1,224 @@
+// Package flags holds the feature flags: their storage in the host-owned
+// oasis.FeatureFlag table, whose audit trigger records every change, their
+// evaluation for a subject, and the record of each evaluation in
+// audit.FlagEvaluation.
+package flags
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"maps"
+	"regexp"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/catdevman/oasis/shared"
+	"github.com/lib/pq"
+)
+
+// keyPattern is what a flag's key must look like.
+var keyPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+// Store is the feature flags of a running host.
+type Store struct {
+	mu    sync.RWMutex
+	flags map[string]shared.FeatureFlag
+}
+
+// New returns a store with no flags.
+func New() *Store {
+	return &Store{flags: map[string]shared.FeatureFlag{}}
+}
+
+// List returns every flag, by key.
+func (s *Store) List() []shared.FeatureFlag {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]shared.FeatureFlag, 0, len(s.flags))
+	for _, key := range slices.Sorted(maps.Keys(s.flags)) {
+		list = append(list, s.flags[key])
+	}
+	return list
+}
+
+// Evaluate reports whether the flag key is on for subject. A flag that
+// does not exist is off.
+func (s *Store) Evaluate(key string, subject shared.FlagSubject) shared.FlagResult {
+	s.mu.RLock()
+	f, ok := s.flags[key]
+	s.mu.RUnlock()
+	if !ok {
+		return shared.FlagResult{Reason: shared.FlagReasonUnknown}
+	}
+	return f.Evaluate(subject)
+}
+
+// Validate checks f, naming each invalid field as it appears in JSON.
+func Validate(f shared.FeatureFlag) []shared.FieldError {
+	var invalid []shared.FieldError
+	if !keyPattern.MatchString(f.Key) {
+		invalid = append(invalid, shared.FieldError{Field: "key",
+			Message: "must be 1 to 64 lower-case letters, digits, dots, dashes or underscores, starting with a letter or digit"})
+	}
+	targets := []struct {
+		field string
+		list  []string
+	}{{"users", f.Users}, {"roles", f.Roles}, {"ed_orgs", f.EdOrgs}}
+	for _, t := range targets {
+		if slices.Contains(t.list, "") {
+			invalid = append(invalid, shared.FieldError{Field: t.field, Message: "must not contain empty entries"})
+		}
+	}
+	return invalid
+}
+
+// Load reads the flags from db.
+func (s *Store) Load(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, `SELECT Key, Description, Enabled, Users, Roles, EdOrgs, UpdatedBy, UpdatedAt
+		FROM oasis.FeatureFlag`)
+	if err != nil {
+		return fmt.Errorf("failed to query feature flags: %w", err)
+	}
+	defer rows.Close()
+	flags := map[string]shared.FeatureFlag{}
+	for rows.Next() {
+		var f shared.FeatureFlag
+		err := rows.Scan(&f.Key, &f.Description, &f.Enabled, (*pq.StringArray)(&f.Users),
+			(*pq.StringArray)(&f.Roles), (*pq.StringArray)(&f.EdOrgs), &f.UpdatedBy, &f.UpdatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to scan feature flag: %w", err)
+		}
+		flags[f.Key] = f
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating feature flags: %w", err)
+	}
+	s.mu.Lock()
+	s.flags = flags
+	s.mu.Unlock()
+	return nil
+}
+
+// Update stores or deletes u's flag in db, tagged with u's actor and
+// request ID for the audit trigger. If the flag is invalid nothing is
+// stored and the invalid fields are returned.
+func (s *Store) Update(ctx context.Context, db *sql.DB, u shared.FlagUpdate) ([]shared.FieldError, error) {
+	f := u.Flag
+	if u.Delete {
+		if !keyPattern.MatchString(f.Key) {
+			return Validate(shared.FeatureFlag{Key: f.Key}), nil
+		}
+	} else if invalid := Validate(f); len(invalid) > 0 {
+		return invalid, nil
+	}
+	f.Users, f.Roles, f.EdOrgs = nonNil(f.Users), nonNil(f.Roles), nonNil(f.EdOrgs)
+	f.UpdatedBy, f.UpdatedAt = u.Actor, time.Now()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, "SELECT set_config('oasis.actor', $1, true), set_config('oasis.request_id', $2, true)",
+		u.Actor, u.RequestID)
+	if err != nil {
+		return nil, err
+	}
+	if u.Delete {
+		_, err = tx.ExecContext(ctx, "DELETE FROM oasis.FeatureFlag WHERE Key = $1", f.Key)
+	} else {
+		_, err = tx.ExecContext(ctx, `INSERT INTO oasis.FeatureFlag (Key, Description, Enabled, Users, Roles, EdOrgs, UpdatedBy, UpdatedAt)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (Key) DO UPDATE SET Description = EXCLUDED.Description, Enabled = EXCLUDED.Enabled,
+				Users = EXCLUDED.Users, Roles = EXCLUDED.Roles, EdOrgs = EXCLUDED.EdOrgs,
+				UpdatedBy = EXCLUDED.UpdatedBy, UpdatedAt = EXCLUDED.UpdatedAt`,
+			f.Key, f.Description, f.Enabled, pq.StringArray(f.Users), pq.StringArray(f.Roles), pq.StringArray(f.EdOrgs),
+			f.UpdatedBy, f.UpdatedAt)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to store feature flag %s: %w", f.Key, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u.Delete {
+		delete(s.flags, f.Key)
+	} else {
+		s.flags[f.Key] = f
+	}
+	return nil, nil
+}
+
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
+
+// evaluation is one evaluation waiting to be recorded.
+type evaluation struct {
+	shared.FlagEvaluation
+	shared.FlagResult
+	plugin string
+}
+
+// Recorder records evaluations in audit.FlagEvaluation in the background,
+// so that recording never delays the request that asked. When more are
+// waiting than it can queue, the newest are dropped and counted.
+type Recorder struct {
+	db      *sql.DB
+	queue   chan evaluation
+	dropped atomic.Int64
+	done    chan struct{}
+}
+
+// NewRecorder starts a recorder writing to db that queues up to size
+// evaluations.
+func NewRecorder(db *sql.DB, size int) *Recorder {
+	r := &Recorder{db: db, queue: make(chan evaluation, size), done: make(chan struct{})}
+	go r.run()
+	return r
+}
+
+// Record queues e, evaluated for plugin with result, to be recorded.
+func (r *Recorder) Record(plugin string, e shared.FlagEvaluation, result shared.FlagResult) {
+	select {
+	case r.queue <- evaluation{FlagEvaluation: e, FlagResult: result, plugin: plugin}:
+	default:
+		r.dropped.Add(1)
+	}
+}
+
+// Close records the evaluations still queued and stops the recorder. No
+// evaluation may be recorded after Close.
+func (r *Recorder) Close() {
+	close(r.queue)
+	<-r.done
+}
+
+func (r *Recorder) run() {
+	defer close(r.done)
+	for e := range r.queue {
+		if n := r.dropped.Swap(0); n > 0 {
+			slog.Warn("dropped flag evaluations", "count", n)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err := r.db.ExecContext(ctx, `INSERT INTO audit.FlagEvaluation
+			(Flag, Enabled, Reason, UserId, Roles, EdOrgs, Plugin, RequestId)
+			VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, NULLIF($8, ''))`,
+			e.Key, e.Enabled, e.Reason, e.Subject.UserID, pq.StringArray(nonNil(e.Subject.Roles)),
+			pq.StringArray(nonNil(e.Subject.EdOrgs)), e.plugin, e.RequestID)
+		cancel()
+		if err != nil {
+			slog.Warn("recording flag evaluation", "flag", e.Key, "request_id", e.RequestID, "error", err)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package flags
+
+import (
+	"testing"
+
+	"github.com/catdevman/oasis/shared"
+)
+
+func TestEvaluate(t *testing.T) {
+	s := New()
+	s.flags["new-gradebook"] = shared.FeatureFlag{
+		Key:    "new-gradebook",
+		Users:  []string{"u-7"},
+		Roles:  []string{"registrar"},
+		EdOrgs: []string{"255901001"},
+	}
+	s.flags["attendance-v2"] = shared.FeatureFlag{Key: "attendance-v2", Enabled: true}
+
+	tests := []struct {
+		key     string
+		subject shared.FlagSubject
+		want    shared.FlagResult
+	}{
+		{"attendance-v2", shared.FlagSubject{}, shared.FlagResult{Enabled: true, Reason: shared.FlagReasonEnabled}},
+		{"new-gradebook", shared.FlagSubject{UserID: "u-7"}, shared.FlagResult{Enabled: true, Reason: shared.FlagReasonUser}},
+		{"new-gradebook", shared.FlagSubject{UserID: "u-1", Roles: []string{"teacher", "registrar"}}, shared.FlagResult{Enabled: true, Reason: shared.FlagReasonRole}},
+		{"new-gradebook", shared.FlagSubject{Roles: []string{"teacher"}, EdOrgs: []string{"255901001"}}, shared.FlagResult{Enabled: true, Reason: shared.FlagReasonEdOrg}},
+		{"new-gradebook", shared.FlagSubject{UserID: "u-1", Roles: []string{"teacher"}, EdOrgs: []string{"255901044"}}, shared.FlagResult{Reason: shared.FlagReasonTargeted}},
+		{"report-cards", shared.FlagSubject{UserID: "u-7"}, shared.FlagResult{Reason: shared.FlagReasonUnknown}},
+	}
+	for _, tt := range tests {
+		if got := s.Evaluate(tt.key, tt.subject); got != tt.want {
+			t.Errorf("Evaluate(%s, %+v) = %+v, want %+v", tt.key, tt.subject, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, key := range []string{"new-gradebook", "grades.v2", "a"} {
+		if invalid := Validate(shared.FeatureFlag{Key: key}); len(invalid) > 0 {
+			t.Errorf("Validate(%q) = %v, want valid", key, invalid)
+		}
+	}
+	for _, key := range []string{"", "New-Gradebook", "-gradebook", "grade book"} {
+		if invalid := Validate(shared.FeatureFlag{Key: key}); len(invalid) != 1 || invalid[0].Field != "key" {
+			t.Errorf("Validate(%q) = %v, want the key invalid", key, invalid)
+		}
+	}
+	invalid := Validate(shared.FeatureFlag{Key: "new-gradebook", Users: []string{"u-1", ""}, EdOrgs: []string{""}})
+	if len(invalid) != 2 || invalid[0].Field != "users" || invalid[1].Field != "ed_orgs" {
+		t.Errorf("Validate with empty targets = %v, want users and ed_orgs invalid", invalid)
+	}
+}
@@ -0,0 +1,167 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log"
+	"log/slog"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// levelOff is above every level anything logs at.
+const levelOff = slog.LevelError + 100
+
+// HCLog returns an hclog.Logger writing to h at level. The host hands one
+// to go-plugin per plugin, which logs the plugin's stderr through it, one
+// record per line at the level the plugin logged it. Logger names are
+// kept for Name but not logged; tag the logger with With instead.
+func HCLog(h slog.Handler, level slog.Level) hclog.Logger {
+	lv := new(slog.LevelVar)
+	lv.Set(level)
+	return &hclogger{logger: slog.New(WithLevel(h, lv)), level: lv}
+}
+
+type hclogger struct {
+	logger  *slog.Logger
+	level   *slog.LevelVar
+	name    string
+	implied []interface{}
+}
+
+func toSlog(level hclog.Level) slog.Level {
+	switch level {
+	case hclog.Trace:
+		return LevelTrace
+	case hclog.Debug:
+		return slog.LevelDebug
+	case hclog.Warn:
+		return slog.LevelWarn
+	case hclog.Error:
+		return slog.LevelError
+	case hclog.Off:
+		return levelOff
+	}
+	return slog.LevelInfo
+}
+
+func fromSlog(level slog.Level) hclog.Level {
+	if level >= levelOff {
+		return hclog.Off
+	}
+	return hclog.LevelFromString(LevelName(level))
+}
+
+// Log logs msg at level. Arguments named like one of the logger's implied
+// arguments are dropped, so go-plugin's own "plugin" path cannot shadow
+// the host's tag.
+func (l *hclogger) Log(level hclog.Level, msg string, args ...interface{}) {
+	if len(l.implied) > 0 {
+		kept := make([]interface{}, 0, len(args))
+		for i := 0; i < len(args); i += 2 {
+			if i+1 < len(args) && l.isImplied(args[i]) {
+				continue
+			}
+			kept = append(kept, args[i:min(i+2, len(args))]...)
+		}
+		args = kept
+	}
+	l.logger.Log(context.Background(), toSlog(level), msg, args...)
+}
+
+func (l *hclogger) isImplied(key interface{}) bool {
+	for i := 0; i < len(l.implied); i += 2 {
+		if l.implied[i] == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *hclogger) Trace(msg string, args ...interface{}) { l.Log(hclog.Trace, msg, args...) }
+func (l *hclogger) Debug(msg string, args ...interface{}) { l.Log(hclog.Debug, msg, args...) }
+func (l *hclogger) Info(msg string, args ...interface{})  { l.Log(hclog.Info, msg, args...) }
+func (l *hclogger) Warn(msg string, args ...interface{})  { l.Log(hclog.Warn, msg, args...) }
+func (l *hclogger) Error(msg string, args ...interface{}) { l.Log(hclog.Error, msg, args...) }
+
+func (l *hclogger) enabled(level hclog.Level) bool {
+	return l.logger.Enabled(context.Background(), toSlog(level))
+}
+
+func (l *hclogger) IsTrace() bool { return l.enabled(hclog.Trace) }
+func (l *hclogger) IsDebug() bool { return l.enabled(hclog.Debug) }
+func (l *hclogger) IsInfo() bool  { return l.enabled(hclog.Info) }
+func (l *hclogger) IsWarn() bool  { return l.enabled(hclog.Warn) }
+func (l *hclogger) IsError() bool { return l.enabled(hclog.Error) }
+
+func (l *hclogger) ImpliedArgs() []interface{} { return l.implied }
+
+func (l *hclogger) With(args ...interface{}) hclog.Logger {
+	c := *l
+	c.logger = l.logger.With(args...)
+	c.implied = append(append([]interface{}{}, l.implied...), args...)
+	return &c
+}
+
+func (l *hclogger) Name() string { return l.name }
+
+func (l *hclogger) Named(name string) hclog.Logger {
+	if l.name != "" {
+		name = l.name + "." + name
+	}
+	return l.ResetNamed(name)
+}
+
+func (l *hclogger) ResetNamed(name string) hclog.Logger {
+	c := *l
+	c.name = name
+	return &c
+}
+
+func (l *hclogger) SetLevel(level hclog.Level) { l.level.Set(toSlog(level)) }
+func (l *hclogger) GetLevel() hclog.Level      { return fromSlog(l.level.Level()) }
+
+func (l *hclogger) StandardLogger(opts *hclog.StandardLoggerOptions) *log.Logger {
+	level := slog.LevelInfo
+	if opts != nil && opts.ForceLevel != hclog.NoLevel {
+		level = toSlog(opts.ForceLevel)
+	}
+	return slog.NewLogLogger(l.logger.Handler(), level)
+}
+
+// StandardWriter returns a writer logging each write as a record. With
+// InferLevels, a leading [TRACE], [DEBUG], [INFO], [WARN] or [ERR]/[ERROR]
+// tag sets the level and is removed, as in hclog.
+func (l *hclogger) StandardWriter(opts *hclog.StandardLoggerOptions) io.Writer {
+	if opts == nil || !opts.InferLevels {
+		return l.StandardLogger(opts).Writer()
+	}
+	return &inferWriter{l: l}
+}
+
+var levelTags = []struct {
+	tag   string
+	level hclog.Level
+}{
+	{"[TRACE]", hclog.Trace},
+	{"[DEBUG]", hclog.Debug},
+	{"[INFO]", hclog.Info},
+	{"[WARN]", hclog.Warn},
+	{"[ERR]", hclog.Error},
+	{"[ERROR]", hclog.Error},
+}
+
+type inferWriter struct{ l *hclogger }
+
+func (w *inferWriter) Write(p []byte) (int, error) {
+	msg, level := strings.TrimRight(string(p), "\n"), hclog.Info
+	for _, t := range levelTags {
+		if rest, ok := strings.CutPrefix(msg, t.tag); ok {
+			msg, level = strings.TrimSpace(rest), t.level
+			break
+		}
+	}
+	w.l.Log(level, msg)
+	return len(p), nil
+}
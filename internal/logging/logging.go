@@ -0,0 +1,85 @@
+// Package logging sets up the structured JSON logs of the host and its
+// plugins. Every logger shares one log/slog handler with its own level
+// filter in front, so each plugin can log more or less than the host, and
+// HCLog bridges the hclog loggers go-plugin uses onto that handler.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// LevelTrace is below slog's Debug; go-plugin and hclog log at it.
+const LevelTrace = slog.LevelDebug - 4
+
+// ParseLevel parses a level as written in plugins.yaml: trace, debug, info,
+// warn or error, in any case. The empty string is info.
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(s) {
+	case "":
+		return slog.LevelInfo, nil
+	case "trace":
+		return LevelTrace, nil
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("invalid log level %q: want trace, debug, info, warn or error", s)
+	}
+	return level, nil
+}
+
+// LevelName is the lower-case name of level, as ParseLevel and hclog
+// accept it.
+func LevelName(level slog.Level) string {
+	if level <= LevelTrace {
+		return "trace"
+	}
+	switch {
+	case level < slog.LevelInfo:
+		return "debug"
+	case level < slog.LevelWarn:
+		return "info"
+	case level < slog.LevelError:
+		return "warn"
+	}
+	return "error"
+}
+
+// NewHandler returns the JSON handler every logger of a process shares.
+// It passes records at all levels; loggers filter with WithLevel.
+func NewHandler(w io.Writer) slog.Handler {
+	return slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level: LevelTrace,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.LevelKey {
+				a.Value = slog.StringValue(strings.ToUpper(LevelName(a.Value.Any().(slog.Level))))
+			}
+			return a
+		},
+	})
+}
+
+// WithLevel returns h with records below level dropped.
+func WithLevel(h slog.Handler, level slog.Leveler) slog.Handler {
+	return &levelHandler{Handler: h, level: level}
+}
+
+type levelHandler struct {
+	slog.Handler
+	level slog.Leveler
+}
+
+func (h *levelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level.Level() && h.Handler.Enabled(ctx, level)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{Handler: h.Handler.WithAttrs(attrs), level: h.level}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{Handler: h.Handler.WithGroup(name), level: h.level}
+}
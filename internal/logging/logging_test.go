@@ -0,0 +1,67 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		in   string
+		want slog.Level
+		name string
+	}{
+		{"", slog.LevelInfo, "info"},
+		{"trace", LevelTrace, "trace"},
+		{"DEBUG", slog.LevelDebug, "debug"},
+		{"warn", slog.LevelWarn, "warn"},
+		{"error", slog.LevelError, "error"},
+	}
+	for _, tt := range tests {
+		got, err := ParseLevel(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseLevel(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+		if name := LevelName(got); name != tt.name {
+			t.Errorf("LevelName(%v) = %q, want %q", got, name, tt.name)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("ParseLevel(verbose) succeeded")
+	}
+}
+
+func TestHCLog(t *testing.T) {
+	var buf bytes.Buffer
+	l := HCLog(NewHandler(&buf), slog.LevelDebug).With("plugin", "example")
+
+	l.Trace("hidden")
+	l.Info("shown", "pid", 42)
+	if l.IsTrace() || !l.IsDebug() {
+		t.Errorf("IsTrace, IsDebug = %v, %v at debug", l.IsTrace(), l.IsDebug())
+	}
+	l.SetLevel(hclog.Trace)
+	l.Named("stderr").Trace("now shown")
+	if l.GetLevel() != hclog.Trace {
+		t.Errorf("GetLevel = %v after SetLevel(Trace)", l.GetLevel())
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("logged %d lines, want 2:\n%s", len(lines), buf.String())
+	}
+	var first, second map[string]interface{}
+	json.Unmarshal([]byte(lines[0]), &first)
+	json.Unmarshal([]byte(lines[1]), &second)
+	if first["msg"] != "shown" || first["level"] != "INFO" || first["plugin"] != "example" || first["pid"] != 42.0 {
+		t.Errorf("first line = %v", first)
+	}
+	if second["msg"] != "now shown" || second["level"] != "TRACE" || second["plugin"] != "example" {
+		t.Errorf("second line = %v", second)
+	}
+}
@@ -0,0 +1,172 @@
+// Package metrics holds the host's Prometheus metrics and merges in the
+// metrics each plugin publishes, for the /metrics endpoint on the admin
+// port.
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/protobuf/proto"
+)
+
+// Format is the exposition format plugins return their metrics in.
+var Format = expfmt.NewFormat(expfmt.TypeProtoDelim)
+
+// Source returns a plugin's metrics in Format; shared.HTTPPlugin's
+// GetMetrics satisfies it.
+type Source func() ([]byte, error)
+
+// Metrics is the host's registry.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	mu      sync.Mutex
+	plugins prometheus.Gatherers
+
+	requests    *prometheus.CounterVec
+	latency     *prometheus.HistogramVec
+	rpcDuration *prometheus.HistogramVec
+	restarts    *prometheus.CounterVec
+}
+
+// New returns a registry with the host's request, RPC and restart metrics
+// and the Go runtime and process collectors.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "oasis_http_requests_total",
+			Help: "Requests routed to plugins, by plugin prefix, route pattern, method and status code.",
+		}, []string{"prefix", "route", "method", "code"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "oasis_http_request_duration_seconds",
+			Help:    "Time to answer requests routed to plugins, by plugin prefix, route pattern and method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"prefix", "route", "method"}),
+		rpcDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "oasis_plugin_rpc_duration_seconds",
+			Help:    "Duration of RPC calls from the host to plugins, by plugin, RPC method and outcome.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"plugin", "rpc", "outcome"}),
+		restarts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "oasis_plugin_restarts_total",
+			Help: "Times the host restarted a plugin process after it exited.",
+		}, []string{"plugin"}),
+	}
+	m.registry.MustRegister(m.requests, m.latency, m.rpcDuration, m.restarts,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	return m
+}
+
+// ObserveRequest records a request routed to the plugin under prefix. An
+// empty route, from a plugin that does not report its patterns, is
+// recorded as "unknown".
+func (m *Metrics) ObserveRequest(prefix, route, method string, code int, d time.Duration) {
+	if route == "" {
+		route = "unknown"
+	}
+	m.requests.WithLabelValues(prefix, route, method, strconv.Itoa(code)).Inc()
+	m.latency.WithLabelValues(prefix, route, method).Observe(d.Seconds())
+}
+
+// ObserveRPC records an RPC call to a plugin.
+func (m *Metrics) ObserveRPC(plugin, rpc string, d time.Duration, err error) {
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	m.rpcDuration.WithLabelValues(plugin, rpc, outcome).Observe(d.Seconds())
+}
+
+// PluginStarted makes the plugin's restart count visible from its first
+// start.
+func (m *Metrics) PluginStarted(plugin string) {
+	m.restarts.WithLabelValues(plugin)
+}
+
+// PluginRestarted counts a restart of the plugin.
+func (m *Metrics) PluginRestarted(plugin string) {
+	m.restarts.WithLabelValues(plugin).Inc()
+}
+
+// AddPlugin merges the metrics of a plugin into every scrape, labelled
+// with its name. A plugin that fails to answer is left out of that scrape
+// and the failure reported in promhttp_metric_handler_errors_total.
+func (m *Metrics) AddPlugin(name string, source Source) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.plugins = append(m.plugins, prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		raw, err := source()
+		if err != nil {
+			return nil, err
+		}
+		families, err := Decode(raw)
+		if err != nil {
+			return nil, err
+		}
+		label := &dto.LabelPair{Name: proto.String("plugin"), Value: proto.String(name)}
+		for _, f := range families {
+			for _, metric := range f.Metric {
+				metric.Label = append(metric.Label, label)
+			}
+		}
+		return families, nil
+	}))
+}
+
+// Handler serves the host's metrics and those of every added plugin.
+func (m *Metrics) Handler() http.Handler {
+	all := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		m.mu.Lock()
+		gatherers := append(prometheus.Gatherers{m.registry}, m.plugins...)
+		m.mu.Unlock()
+		return gatherers.Gather()
+	})
+	return promhttp.HandlerFor(all, promhttp.HandlerOpts{
+		ErrorHandling: promhttp.ContinueOnError,
+		Registry:      m.registry,
+	})
+}
+
+// Encode renders the metrics of g in Format, for a plugin's GetMetrics.
+func Encode(g prometheus.Gatherer) ([]byte, error) {
+	families, err := g.Gather()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := expfmt.NewEncoder(&buf, Format)
+	for _, f := range families {
+		if err := enc.Encode(f); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode parses metrics in Format.
+func Decode(raw []byte) ([]*dto.MetricFamily, error) {
+	var families []*dto.MetricFamily
+	dec := expfmt.NewDecoder(bytes.NewReader(raw), Format)
+	for {
+		f := &dto.MetricFamily{}
+		if err := dec.Decode(f); errors.Is(err, io.EOF) {
+			return families, nil
+		} else if err != nil {
+			return nil, err
+		}
+		families = append(families, f)
+	}
+}
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestHandler(t *testing.T) {
+	m := New()
+	m.ObserveRequest("api/common", "/api/common/ed-fi/students/{id}", "GET", 200, 20*time.Millisecond)
+	m.ObserveRequest("api/common", "", "GET", 502, time.Millisecond)
+	m.ObserveRPC("common-plugin", "ServeHTTP", time.Millisecond, nil)
+	m.PluginStarted("admin-plugin")
+
+	imports := prometheus.NewCounter(prometheus.CounterOpts{Name: "sis_imports_total", Help: "SIS imports run."})
+	imports.Add(3)
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(imports)
+	m.AddPlugin("sis-plugin", func() ([]byte, error) { return Encode(reg) })
+	m.AddPlugin("broken-plugin", func() ([]byte, error) { return nil, errors.New("plugin exited") })
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(w.Result().Body)
+
+	for _, want := range []string{
+		`oasis_http_requests_total{code="200",method="GET",prefix="api/common",route="/api/common/ed-fi/students/{id}"} 1`,
+		`oasis_http_requests_total{code="502",method="GET",prefix="api/common",route="unknown"} 1`,
+		`oasis_http_request_duration_seconds_count{method="GET",prefix="api/common",route="/api/common/ed-fi/students/{id}"} 1`,
+		`oasis_plugin_rpc_duration_seconds_count{outcome="ok",plugin="common-plugin",rpc="ServeHTTP"} 1`,
+		`oasis_plugin_restarts_total{plugin="admin-plugin"} 0`,
+		`sis_imports_total{plugin="sis-plugin"} 3`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("/metrics lacks %s", want)
+		}
+	}
+	if w.Code != 200 {
+		t.Errorf("/metrics = %d with one broken plugin, want 200", w.Code)
+	}
+
+	// The failed gathering is counted, and shows from the next scrape.
+	w = httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if want := `promhttp_metric_handler_errors_total{cause="gathering"} 1`; !strings.Contains(w.Body.String(), want) {
+		t.Errorf("/metrics lacks %s", want)
+	}
+}
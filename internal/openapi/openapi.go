@@ -0,0 +1,179 @@
+// Package openapi merges the OpenAPI documents published by plugins into
+// the single document the host serves at /openapi.json.
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Version is the OpenAPI version of plugin documents and of the merged one.
+const Version = "3.1.0"
+
+// Merger accumulates plugin documents. The zero value is not usable; call
+// New.
+type Merger struct {
+	paths      map[string]interface{}
+	components map[string]map[string]interface{} // section -> name -> object
+	tags       map[string]interface{}
+	operations map[string]bool
+}
+
+func New() *Merger {
+	return &Merger{
+		paths:      map[string]interface{}{},
+		components: map[string]map[string]interface{}{},
+		tags:       map[string]interface{}{},
+		operations: map[string]bool{},
+	}
+}
+
+type document struct {
+	OpenAPI    string                            `json:"openapi"`
+	Paths      map[string]interface{}            `json:"paths"`
+	Components map[string]map[string]interface{} `json:"components"`
+	Tags       []map[string]interface{}          `json:"tags"`
+}
+
+// Add merges the document of the named plugin, whose paths are relative to
+// prefix. Components that clash with a different component of the same name
+// are renamed to "{plugin}.{name}", and operation ids that clash are
+// qualified the same way. A document that is invalid, or that would
+// redefine a path already merged, is rejected whole.
+func (m *Merger) Add(plugin, prefix string, raw []byte) error {
+	var doc document
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return fmt.Errorf("openapi: %s: %w", plugin, err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.1.") {
+		return fmt.Errorf("openapi: %s: document is OpenAPI %q, want %s", plugin, doc.OpenAPI, Version)
+	}
+
+	base := ""
+	if p := strings.Trim(prefix, "/"); p != "" {
+		base = "/" + p
+	}
+	for path := range doc.Paths {
+		if _, ok := m.paths[base+path]; ok {
+			return fmt.Errorf("openapi: %s: path %s is already published", plugin, base+path)
+		}
+	}
+
+	renames := map[string]string{}
+	for section, objects := range doc.Components {
+		for name, v := range objects {
+			if existing, ok := m.components[section][name]; ok && !reflect.DeepEqual(existing, v) {
+				renames["#/components/"+section+"/"+name] = "#/components/" + section + "/" + plugin + "." + name
+			}
+		}
+	}
+	rewriteRefs(doc.Paths, renames)
+	rewriteRefs(doc.Components, renames)
+
+	for section, objects := range doc.Components {
+		if m.components[section] == nil {
+			m.components[section] = map[string]interface{}{}
+		}
+		for name, v := range objects {
+			if _, renamed := renames["#/components/"+section+"/"+name]; renamed {
+				name = plugin + "." + name
+			}
+			m.components[section][name] = v
+		}
+	}
+	for path, item := range doc.Paths {
+		m.qualifyOperations(plugin, item)
+		m.paths[base+path] = item
+	}
+	for _, tag := range doc.Tags {
+		if name, ok := tag["name"].(string); ok {
+			if _, seen := m.tags[name]; !seen {
+				m.tags[name] = tag
+			}
+		}
+	}
+	return nil
+}
+
+// qualifyOperations makes the operation ids of a path item unique across
+// plugins.
+func (m *Merger) qualifyOperations(plugin string, item interface{}) {
+	ops, ok := item.(map[string]interface{})
+	if !ok {
+		return
+	}
+	for _, op := range ops {
+		o, ok := op.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		id, ok := o["operationId"].(string)
+		if !ok {
+			continue
+		}
+		if m.operations[id] {
+			id = plugin + "." + id
+			o["operationId"] = id
+		}
+		m.operations[id] = true
+	}
+}
+
+// rewriteRefs replaces, in place, every "$ref" under v that renames maps.
+func rewriteRefs(v interface{}, renames map[string]string) {
+	if len(renames) == 0 {
+		return
+	}
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for k, child := range x {
+			if s, ok := child.(string); ok && k == "$ref" {
+				if to, ok := renames[s]; ok {
+					x[k] = to
+				}
+				continue
+			}
+			rewriteRefs(child, renames)
+		}
+	case map[string]map[string]interface{}:
+		for _, child := range x {
+			rewriteRefs(child, renames)
+		}
+	case []interface{}:
+		for _, child := range x {
+			rewriteRefs(child, renames)
+		}
+	}
+}
+
+// JSON renders the merged document.
+func (m *Merger) JSON() ([]byte, error) {
+	doc := map[string]interface{}{
+		"openapi": Version,
+		"info": map[string]interface{}{
+			"title":       "Oasis API",
+			"version":     "1.0.0",
+			"description": "The APIs of every loaded plugin, under the prefixes they are mounted at.",
+		},
+		"paths": m.paths,
+	}
+	if len(m.components) > 0 {
+		doc["components"] = m.components
+	}
+	if len(m.tags) > 0 {
+		names := make([]string, 0, len(m.tags))
+		for name := range m.tags {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		tags := make([]interface{}, len(names))
+		for i, name := range names {
+			tags[i] = m.tags[name]
+		}
+		doc["tags"] = tags
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
@@ -0,0 +1,105 @@
+package openapi
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const commonDoc = `{
+	"openapi": "3.1.0",
+	"paths": {"/ed-fi/students": {"get": {"operationId": "listStudent", "responses": {"200": {
+		"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Student"}}}},
+		"400": {"$ref": "#/components/responses/BadRequest"}}}}},
+	"components": {
+		"schemas": {"Student": {"type": "object"}, "Error": {"type": "object"}},
+		"responses": {"BadRequest": {"description": "Bad Request."}}
+	}
+}`
+
+const adminDoc = `{
+	"openapi": "3.1.0",
+	"paths": {"/health": {"get": {"operationId": "listStudent", "responses": {"200": {
+		"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Student"}}}}}}}},
+	"components": {"schemas": {"Student": {"type": "string"}, "Error": {"type": "object"}}}
+}`
+
+func merged(t *testing.T, m *Merger) map[string]interface{} {
+	t.Helper()
+	b, err := m.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func lookup(v interface{}, keys ...string) interface{} {
+	for _, k := range keys {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[k]
+	}
+	return v
+}
+
+func TestMerge(t *testing.T) {
+	m := New()
+	if err := m.Add("common-plugin", "api/common", []byte(commonDoc)); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Add("admin-plugin", "/api/admin/", []byte(adminDoc)); err != nil {
+		t.Fatal(err)
+	}
+	doc := merged(t, m)
+
+	schema := []string{"responses", "200", "content", "application/json", "schema", "$ref"}
+	tests := []struct {
+		name string
+		keys []string
+		want interface{}
+	}{
+		{"common path prefixed", append([]string{"paths", "/api/common/ed-fi/students", "get"}, schema...), "#/components/schemas/Student"},
+		{"shared response kept", []string{"paths", "/api/common/ed-fi/students", "get", "responses", "400", "$ref"}, "#/components/responses/BadRequest"},
+		{"admin path prefixed and clash renamed", append([]string{"paths", "/api/admin/health", "get"}, schema...), "#/components/schemas/admin-plugin.Student"},
+		{"first definition keeps its name", []string{"components", "schemas", "Student", "type"}, "object"},
+		{"clashing definition renamed", []string{"components", "schemas", "admin-plugin.Student", "type"}, "string"},
+		{"operation id qualified", []string{"paths", "/api/admin/health", "get", "operationId"}, "admin-plugin.listStudent"},
+		{"identical definitions shared", []string{"components", "schemas", "admin-plugin.Error"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lookup(doc, tt.keys...); got != tt.want {
+				t.Errorf("%v = %v, want %v", tt.keys, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeRejects(t *testing.T) {
+	m := New()
+	if err := m.Add("common-plugin", "api/common", []byte(commonDoc)); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, prefix, doc string
+	}{
+		{"duplicate path", "api/common", commonDoc},
+		{"not json", "api/x", `{`},
+		{"openapi 3.0", "api/x", `{"openapi": "3.0.3", "paths": {}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := m.Add("other", tt.prefix, []byte(tt.doc)); err == nil {
+				t.Error("Add succeeded, want an error")
+			}
+		})
+	}
+	if _, ok := lookup(merged(t, m), "components", "schemas", "other.Student").(map[string]interface{}); ok {
+		t.Error("a rejected document left components behind")
+	}
+}
@@ -0,0 +1,318 @@
+// Package settings holds the system settings: the sections the host and
+// plugins declare, the validation of new values against them, and their
+// storage in the host-owned oasis.Setting table, whose audit trigger
+// records every change.
+package settings
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/catdevman/oasis/shared"
+)
+
+func intPtr(n int) *int { return &n }
+
+// System is the host's own section.
+var System = shared.SettingsSection{
+	Name:  "system",
+	Label: "System",
+	Fields: []shared.SettingField{
+		{
+			Key:         "maintenance",
+			Label:       "Maintenance Mode",
+			Description: "read_only refuses changes and closed refuses every request, except from the roles below.",
+			Type:        shared.SettingString,
+			Default:     json.RawMessage(`"off"`),
+			Options:     []string{"off", "read_only", "closed"},
+		},
+		{
+			Key:         "maintenance_roles",
+			Label:       "Roles Exempt From Maintenance",
+			Description: "Roles that keep working during maintenance, separated by commas.",
+			Type:        shared.SettingList,
+			Default:     json.RawMessage(`["admin","administrator"]`),
+		},
+		{
+			Key:         "maintenance_message",
+			Label:       "Maintenance Message",
+			Description: "Shown in the banner and refusals during maintenance; empty for a standard message.",
+			Type:        shared.SettingString,
+			Default:     json.RawMessage(`""`),
+		},
+		{
+			Key:         "maintenance_retry_after",
+			Label:       "Maintenance Retry After (seconds)",
+			Description: "How long refused clients are told to wait before trying again.",
+			Type:        shared.SettingInt,
+			Default:     json.RawMessage(`300`),
+			Min:         intPtr(1),
+		},
+		{
+			Key:         "max_users",
+			Label:       "Maximum Concurrent Users",
+			Description: "The hard limit for active sessions.",
+			Type:        shared.SettingInt,
+			Default:     json.RawMessage(`5000`),
+			Min:         intPtr(1),
+		},
+		{
+			Key:         "features",
+			Label:       "Enabled Features",
+			Description: "The domains offered to users.",
+			Type:        shared.SettingList,
+			Default:     json.RawMessage(`["grades","attendance","discipline"]`),
+			Options:     []string{"grades", "attendance", "discipline"},
+		},
+	},
+}
+
+// Store is the settings of a running host: the declared sections and the
+// values stored for them.
+type Store struct {
+	mu       sync.RWMutex
+	sections []shared.SettingsSection
+	stored   shared.Settings // values set by an administrator, by section and key
+}
+
+// New returns a store declaring sections, with no values stored.
+func New(sections ...shared.SettingsSection) *Store {
+	s := &Store{stored: shared.Settings{}}
+	for _, sec := range sections {
+		if err := s.Register(sec); err != nil {
+			panic(err)
+		}
+	}
+	return s
+}
+
+// Register declares a section, such as one a plugin adds. Its name must be
+// new and every field's default must be valid.
+func (s *Store) Register(sec shared.SettingsSection) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sec.Name == "" {
+		return fmt.Errorf("settings section has no name")
+	}
+	for _, existing := range s.sections {
+		if existing.Name == sec.Name {
+			return fmt.Errorf("settings section %q is already declared", sec.Name)
+		}
+	}
+	seen := map[string]bool{}
+	for _, f := range sec.Fields {
+		if seen[f.Key] {
+			return fmt.Errorf("settings section %q declares %q twice", sec.Name, f.Key)
+		}
+		seen[f.Key] = true
+		if msg := check(f, f.Default); msg != "" {
+			return fmt.Errorf("default of %s.%s: %s", sec.Name, f.Key, msg)
+		}
+	}
+	s.sections = append(s.sections, sec)
+	return nil
+}
+
+// Document returns the declared sections with their current values.
+func (s *Store) Document() shared.SettingsDocument {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return shared.SettingsDocument{
+		Sections: slices.Clone(s.sections),
+		Values:   s.values(),
+	}
+}
+
+// Values returns the value of every declared setting: the stored value, or
+// the field's default.
+func (s *Store) Values() shared.Settings {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.values()
+}
+
+func (s *Store) values() shared.Settings {
+	values := shared.Settings{}
+	for _, sec := range s.sections {
+		section := map[string]json.RawMessage{}
+		for _, f := range sec.Fields {
+			section[f.Key] = f.Default
+			if v, ok := s.stored[sec.Name][f.Key]; ok && check(f, v) == "" {
+				section[f.Key] = v
+			}
+		}
+		values[sec.Name] = section
+	}
+	return values
+}
+
+// Validate checks values against the declared sections, naming each
+// invalid field "section.key".
+func (s *Store) Validate(values shared.Settings) []shared.FieldError {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var invalid []shared.FieldError
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		sec, ok := s.section(name)
+		if !ok {
+			invalid = append(invalid, shared.FieldError{Field: name, Message: "is not a settings section"})
+			continue
+		}
+		for _, key := range slices.Sorted(maps.Keys(values[name])) {
+			i := slices.IndexFunc(sec.Fields, func(f shared.SettingField) bool { return f.Key == key })
+			if i < 0 {
+				invalid = append(invalid, shared.FieldError{Field: name + "." + key, Message: "is not a setting"})
+			} else if msg := check(sec.Fields[i], values[name][key]); msg != "" {
+				invalid = append(invalid, shared.FieldError{Field: name + "." + key, Message: msg})
+			}
+		}
+	}
+	return invalid
+}
+
+func (s *Store) section(name string) (shared.SettingsSection, bool) {
+	for _, sec := range s.sections {
+		if sec.Name == name {
+			return sec, true
+		}
+	}
+	return shared.SettingsSection{}, false
+}
+
+// Load reads the stored values from db.
+func (s *Store) Load(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, "SELECT Section, Key, Value FROM oasis.Setting")
+	if err != nil {
+		return fmt.Errorf("failed to query settings: %w", err)
+	}
+	defer rows.Close()
+	stored := shared.Settings{}
+	for rows.Next() {
+		var section, key string
+		var value []byte
+		if err := rows.Scan(&section, &key, &value); err != nil {
+			return fmt.Errorf("failed to scan setting: %w", err)
+		}
+		if stored[section] == nil {
+			stored[section] = map[string]json.RawMessage{}
+		}
+		stored[section][key] = value
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating settings: %w", err)
+	}
+	s.mu.Lock()
+	s.stored = stored
+	s.mu.Unlock()
+	return nil
+}
+
+// Update validates u and stores its values in db in one transaction,
+// tagged with u's actor and request ID for the audit trigger. If any value
+// is invalid nothing is stored and the invalid fields are returned.
+func (s *Store) Update(ctx context.Context, db *sql.DB, u shared.SettingsUpdate) ([]shared.FieldError, error) {
+	if invalid := s.Validate(u.Values); len(invalid) > 0 {
+		return invalid, nil
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, "SELECT set_config('oasis.actor', $1, true), set_config('oasis.request_id', $2, true)",
+		u.Actor, u.RequestID)
+	if err != nil {
+		return nil, err
+	}
+	for section, values := range u.Values {
+		for key, value := range values {
+			_, err := tx.ExecContext(ctx, `INSERT INTO oasis.Setting (Section, Key, Value, UpdatedBy)
+				VALUES ($1, $2, $3, $4)
+				ON CONFLICT (Section, Key) DO UPDATE SET Value = EXCLUDED.Value, UpdatedBy = EXCLUDED.UpdatedBy, UpdatedAt = now()`,
+				section, key, []byte(compact(value)), u.Actor)
+			if err != nil {
+				return nil, fmt.Errorf("failed to store %s.%s: %w", section, key, err)
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for section, values := range u.Values {
+		if s.stored[section] == nil {
+			s.stored[section] = map[string]json.RawMessage{}
+		}
+		for key, value := range values {
+			s.stored[section][key] = compact(value)
+		}
+	}
+	return nil, nil
+}
+
+// check returns why v is not a valid value of f, or "" if it is.
+func check(f shared.SettingField, v json.RawMessage) string {
+	if v = bytes.TrimSpace(v); len(v) == 0 || string(v) == "null" {
+		return "must have a value"
+	}
+	switch f.Type {
+	case shared.SettingBool:
+		var b bool
+		if json.Unmarshal(v, &b) != nil {
+			return "must be true or false"
+		}
+	case shared.SettingInt:
+		var i int
+		if json.Unmarshal(v, &i) != nil {
+			return "must be an integer"
+		}
+		if f.Min != nil && i < *f.Min {
+			return fmt.Sprintf("must be at least %d", *f.Min)
+		}
+		if f.Max != nil && i > *f.Max {
+			return fmt.Sprintf("must be at most %d", *f.Max)
+		}
+	case shared.SettingString:
+		var str string
+		if json.Unmarshal(v, &str) != nil {
+			return "must be a string"
+		}
+		if len(f.Options) > 0 && !slices.Contains(f.Options, str) {
+			return fmt.Sprintf("must be one of %q", f.Options)
+		}
+	case shared.SettingList:
+		var list []string
+		if json.Unmarshal(v, &list) != nil {
+			return "must be a list of strings"
+		}
+		seen := map[string]bool{}
+		for _, item := range list {
+			if len(f.Options) > 0 && !slices.Contains(f.Options, item) {
+				return fmt.Sprintf("%q is not one of %q", item, f.Options)
+			}
+			if seen[item] {
+				return fmt.Sprintf("lists %q twice", item)
+			}
+			seen[item] = true
+		}
+	default:
+		return fmt.Sprintf("has unknown type %q", f.Type)
+	}
+	return ""
+}
+
+func compact(v json.RawMessage) json.RawMessage {
+	var buf bytes.Buffer
+	if json.Compact(&buf, v) != nil {
+		return v
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,91 @@
+package settings
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/catdevman/oasis/shared"
+)
+
+func TestRegister(t *testing.T) {
+	s := New(System)
+	for _, tt := range []struct {
+		name string
+		sec  shared.SettingsSection
+	}{
+		{"unnamed", shared.SettingsSection{}},
+		{"duplicate", shared.SettingsSection{Name: "system"}},
+		{"repeated key", shared.SettingsSection{Name: "grades", Fields: []shared.SettingField{
+			{Key: "scale", Type: shared.SettingString, Default: json.RawMessage(`"A-F"`)},
+			{Key: "scale", Type: shared.SettingString, Default: json.RawMessage(`"A-F"`)},
+		}}},
+		{"invalid default", shared.SettingsSection{Name: "grades", Fields: []shared.SettingField{
+			{Key: "scale", Type: shared.SettingString, Default: json.RawMessage(`"1-5"`), Options: []string{"A-F", "0-100"}},
+		}}},
+	} {
+		if err := s.Register(tt.sec); err == nil {
+			t.Errorf("Register(%s) = nil, want an error", tt.name)
+		}
+	}
+	if err := s.Register(shared.SettingsSection{Name: "grades", Fields: []shared.SettingField{
+		{Key: "scale", Type: shared.SettingString, Default: json.RawMessage(`"A-F"`), Options: []string{"A-F", "0-100"}},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	if doc := s.Document(); len(doc.Sections) != 2 || string(doc.Values["grades"]["scale"]) != `"A-F"` {
+		t.Errorf("Document() = %+v, want system and grades with defaults", doc)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	s := New(System)
+	tests := []struct {
+		name  string
+		value string
+		want  string // the invalid field's message, or "" if valid
+	}{
+		{"maintenance", `"read_only"`, ""},
+		{"maintenance", `true`, "must be a string"},
+		{"maintenance", `"upgrading"`, `must be one of ["off" "read_only" "closed"]`},
+		{"maintenance", `null`, "must have a value"},
+		{"maintenance_roles", `["admin","registrar"]`, ""},
+		{"max_users", `250`, ""},
+		{"max_users", `0`, "must be at least 1"},
+		{"max_users", `2.5`, "must be an integer"},
+		{"max_users", `"250"`, "must be an integer"},
+		{"features", `["grades"]`, ""},
+		{"features", `[]`, ""},
+		{"features", `["grades","grades"]`, `lists "grades" twice`},
+		{"features", `["payroll"]`, `"payroll" is not one of ["grades" "attendance" "discipline"]`},
+		{"theme", `"dark"`, "is not a setting"},
+	}
+	for _, tt := range tests {
+		invalid := s.Validate(shared.Settings{"system": {tt.name: json.RawMessage(tt.value)}})
+		switch {
+		case tt.want == "" && len(invalid) > 0:
+			t.Errorf("system.%s = %s: %v, want valid", tt.name, tt.value, invalid)
+		case tt.want != "" && (len(invalid) != 1 || invalid[0].Field != "system."+tt.name || invalid[0].Message != tt.want):
+			t.Errorf("system.%s = %s: %v, want %q", tt.name, tt.value, invalid, tt.want)
+		}
+	}
+	if invalid := s.Validate(shared.Settings{"payroll": {}}); len(invalid) != 1 || invalid[0].Field != "payroll" {
+		t.Errorf("unknown section: %v, want it reported", invalid)
+	}
+}
+
+func TestValuesIgnoreInvalidStored(t *testing.T) {
+	s := New(System)
+	s.stored = shared.Settings{"system": {"max_users": json.RawMessage(`-3`), "maintenance": json.RawMessage(`"closed"`)}}
+	values := s.Values()
+	var maxUsers int
+	var maintenance string
+	if err := values.Decode("system", "max_users", &maxUsers); err != nil || maxUsers != 5000 {
+		t.Errorf("max_users = %d, %v; want the default for a stored value now out of range", maxUsers, err)
+	}
+	if err := values.Decode("system", "maintenance", &maintenance); err != nil || maintenance != "closed" {
+		t.Errorf("maintenance = %q, %v; want the stored value", maintenance, err)
+	}
+	if err := values.Decode("system", "theme", new(string)); err == nil {
+		t.Error("Decode of an undeclared setting succeeded")
+	}
+}
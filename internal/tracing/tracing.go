@@ -0,0 +1,166 @@
+// Package tracing sets up OpenTelemetry tracing for the host and plugins.
+// The host starts a trace for each request it routes and hands the W3C
+// trace context to the plugin inside shared.HTTPRequest; the plugin
+// continues it in its handler and database queries. Spans are exported
+// over OTLP/HTTP to a collector, or appended as JSON lines to a file for
+// offline testing.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Config is the tracing section of plugins.yaml. The host passes it to
+// plugins in their environment.
+type Config struct {
+	Exporter    string  `yaml:"exporter"`     // otlp, file, or empty to disable tracing
+	Endpoint    string  `yaml:"endpoint"`     // OTLP/HTTP collector URL for the otlp exporter
+	File        string  `yaml:"file"`         // spans are appended here by the file exporter
+	SampleRatio float64 `yaml:"sample_ratio"` // fraction of new traces recorded; 0 records all
+}
+
+// Validate reports a config Setup would reject.
+func (c Config) Validate() error {
+	switch c.Exporter {
+	case "":
+	case "otlp":
+		if c.Endpoint == "" {
+			return errors.New("the otlp exporter needs an endpoint")
+		}
+	case "file":
+		if c.File == "" {
+			return errors.New("the file exporter needs a file")
+		}
+	default:
+		return fmt.Errorf("unknown exporter %q", c.Exporter)
+	}
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		return fmt.Errorf("sample_ratio %v is not between 0 and 1", c.SampleRatio)
+	}
+	return nil
+}
+
+// Env returns c as the environment variables FromEnv reads.
+func (c Config) Env() []string {
+	return []string{
+		"OASIS_TRACE_EXPORTER=" + c.Exporter,
+		"OASIS_TRACE_ENDPOINT=" + c.Endpoint,
+		"OASIS_TRACE_FILE=" + c.File,
+		"OASIS_TRACE_SAMPLE_RATIO=" + strconv.FormatFloat(c.SampleRatio, 'g', -1, 64),
+	}
+}
+
+// FromEnv reads the config the host started a plugin with.
+func FromEnv() (Config, error) {
+	c := Config{
+		Exporter: os.Getenv("OASIS_TRACE_EXPORTER"),
+		Endpoint: os.Getenv("OASIS_TRACE_ENDPOINT"),
+		File:     os.Getenv("OASIS_TRACE_FILE"),
+	}
+	if s := os.Getenv("OASIS_TRACE_SAMPLE_RATIO"); s != "" {
+		ratio, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return c, fmt.Errorf("OASIS_TRACE_SAMPLE_RATIO: %w", err)
+		}
+		c.SampleRatio = ratio
+	}
+	return c, nil
+}
+
+// Setup installs the global tracer provider and W3C trace context
+// propagator for service. The returned function flushes buffered spans and
+// stops the exporter. With no exporter configured only the propagator is
+// installed, so trace context still passes through untouched.
+func Setup(service string, cfg Config) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	var exporter sdktrace.SpanExporter
+	switch cfg.Exporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case "file":
+		f, err := os.OpenFile(cfg.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("opening trace file: %w", err)
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		exporter = closingExporter{exporter, f}
+	case "otlp":
+		exporter, err = otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(cfg.Endpoint))
+		if err != nil {
+			return nil, fmt.Errorf("creating OTLP exporter: %w", err)
+		}
+	}
+
+	ratio := cfg.SampleRatio
+	if ratio == 0 {
+		ratio = 1
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(service))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// closingExporter closes the file exporter's file when it shuts down.
+type closingExporter struct {
+	sdktrace.SpanExporter
+	f *os.File
+}
+
+func (e closingExporter) Shutdown(ctx context.Context) error {
+	return errors.Join(e.SpanExporter.Shutdown(ctx), e.f.Close())
+}
+
+// Tracer returns the tracer the host and plugins start their spans with.
+func Tracer() trace.Tracer {
+	return otel.Tracer("github.com/catdevman/oasis")
+}
+
+// Inject returns the trace context of ctx for shared.HTTPRequest, or nil
+// if ctx carries none.
+func Inject(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
+
+// Extract returns ctx continuing the trace context Inject returned.
+func Extract(ctx context.Context, carrier map[string]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(carrier))
+}
+
+// TraceID returns the ID of the trace ctx belongs to, for log lines, or ""
+// if it has none.
+func TraceID(ctx context.Context) string {
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		return sc.TraceID().String()
+	}
+	return ""
+}
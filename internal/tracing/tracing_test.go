@@ -0,0 +1,91 @@
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestConfigEnv(t *testing.T) {
+	want := Config{Exporter: "otlp", Endpoint: "http://collector:4318", SampleRatio: 0.25}
+	for _, kv := range want.Env() {
+		k, v, _ := strings.Cut(kv, "=")
+		t.Setenv(k, v)
+	}
+	got, err := FromEnv()
+	if err != nil || got != want {
+		t.Errorf("FromEnv() = %+v, %v; want %+v", got, err, want)
+	}
+
+	for _, bad := range []Config{
+		{Exporter: "jaeger"},
+		{Exporter: "otlp"},
+		{Exporter: "file"},
+		{SampleRatio: 2},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("Validate(%+v) = nil, want an error", bad)
+		}
+	}
+}
+
+// stubSpan is the part of the file exporter's JSON this test reads.
+type stubSpan struct {
+	Name        string
+	SpanContext struct{ TraceID, SpanID string }
+	Parent      struct{ TraceID, SpanID string }
+}
+
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.json")
+	shutdown, err := Setup("test", Config{Exporter: "file", File: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, host := Tracer().Start(context.Background(), "host", trace.WithSpanKind(trace.SpanKindServer))
+	carrier := Inject(ctx)
+	if carrier["traceparent"] == "" {
+		t.Fatalf("Inject() = %v, want a traceparent", carrier)
+	}
+	ctx, plugin := Tracer().Start(Extract(context.Background(), carrier), "plugin")
+	if got, want := TraceID(ctx), host.SpanContext().TraceID().String(); got != want {
+		t.Errorf("TraceID() across Inject/Extract = %q, want %q", got, want)
+	}
+	plugin.End()
+	host.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	spans := map[string]stubSpan{}
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for dec.More() {
+		var s stubSpan
+		if err := dec.Decode(&s); err != nil {
+			t.Fatal(err)
+		}
+		spans[s.Name] = s
+	}
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(spans))
+	}
+	if spans["plugin"].Parent.SpanID != spans["host"].SpanContext.SpanID {
+		t.Errorf("plugin span's parent = %s, want the host span %s",
+			spans["plugin"].Parent.SpanID, spans["host"].SpanContext.SpanID)
+	}
+	if TraceID(context.Background()) != "" {
+		t.Error("TraceID() without a span is not empty")
+	}
+}
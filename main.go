@@ -1,85 +1,196 @@
 package main
 
 import (
+	"context"
+	_ "embed"
+	"flag"
 	"fmt"
 	"html/template"
 	"io"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
-	"os/exec"
 	"os/signal"
+	"regexp"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/catdevman/oasis/internal/db"
+	oerrors "github.com/catdevman/oasis/internal/errors"
+	"github.com/catdevman/oasis/internal/flags"
+	"github.com/catdevman/oasis/internal/logging"
+	"github.com/catdevman/oasis/internal/metrics"
+	"github.com/catdevman/oasis/internal/openapi"
+	"github.com/catdevman/oasis/internal/tracing"
 	"github.com/catdevman/oasis/shared"
-	"github.com/hashicorp/go-plugin"
-	"gopkg.in/yaml.v3"
+	"github.com/catdevman/oasis/shared/sdk"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-type AppConfig struct {
-	Database db.Config      `yaml:"database"`
-	Plugins  []PluginConfig `yaml:"plugins"`
-}
-type PluginConfig struct {
-	Name   string `yaml:"name"`
-	Path   string `yaml:"path"`
-	Prefix string `yaml:"prefix"`
-	Tables string `yaml:"tables"`
-}
-
 var pluginClients = make(map[string]shared.HTTPPlugin)
-var plugs = []*plugin.Client{}
+var plugs []*managedPlugin
 var menuItems = []shared.MenuItem{}
 var uiTemplate *template.Template
 
+// apiDocument is the merged OpenAPI document of the loaded plugins.
+var apiDocument []byte
+
+//go:embed ui/api-docs.html
+var apiExplorerPage string
+
+// apiExplorer renders the API explorer with the nonce and CSRF token of
+// each response.
+var apiExplorer = template.Must(template.New("api-docs").Parse(apiExplorerPage))
+
+// logHandler is the JSON handler behind the host's logger and the loggers
+// of its plugins, each filtering at its own level.
+var logHandler = logging.NewHandler(os.Stderr)
+
+// hostLevel is the host's log level, from log_level in plugins.yaml.
+var hostLevel = new(slog.LevelVar)
+
+// hostMetrics are the host's Prometheus metrics, with those of the loaded
+// plugins merged in.
+var hostMetrics = metrics.New()
+
+// traceConfig is the tracing section of plugins.yaml, passed on to every
+// plugin the host starts.
+var traceConfig tracing.Config
+
+// hostURL is where plugins call the host's APIs, passed on to every plugin
+// the host starts.
+var hostURL string
+
 func main() {
+	slog.SetDefault(slog.New(logging.WithLevel(logHandler, hostLevel)))
+	if len(os.Args) > 2 && os.Args[1] == "config" && os.Args[2] == "check" {
+		os.Exit(checkConfig(os.Args[3:], os.Stdout, os.Stderr))
+	}
+	fs := flag.NewFlagSet("oasis", flag.ExitOnError)
+	configPath, env := configFlags(fs)
+	fs.Parse(os.Args[1:])
+
 	// Parse the host UI template
 	var err error
 	uiTemplate, err = template.ParseFiles("ui/layout.html")
 	if err != nil {
-		log.Fatalf("Failed to parse ui/layout.html: %v", err)
+		fatal("failed to parse ui/layout.html", err)
 	}
 
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
-	config, err := loadConfig("plugins.yaml")
+	config, err := loadConfig(*configPath, *env)
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		fatal("failed to load configuration", err)
+	}
+	for _, w := range config.warnings {
+		slog.Warn("configuration", "problem", w.Error())
+	}
+	level, _ := logging.ParseLevel(config.LogLevel)
+	hostLevel.Set(level)
+	traceConfig = config.Tracing
+	securityConfig = config.Security
+	flushTraces, err := tracing.Setup("oasis-host", traceConfig)
+	if err != nil {
+		fatal("failed to set up tracing", err)
 	}
 
 	// Initialize database and run migrations
-	database, err := db.Open(config.Database)
+	hostDB, err = db.Open(config.Database)
 	if err != nil {
-		log.Fatalf("Failed to open database: %v", err)
+		fatal("failed to open database", err)
+	}
+	if err := hostSettings.Load(context.Background(), hostDB); err != nil {
+		fatal("failed to load settings", err)
+	}
+	if err := hostFlags.Load(context.Background(), hostDB); err != nil {
+		fatal("failed to load feature flags", err)
+	}
+	flagRecorder = flags.NewRecorder(hostDB, flagQueueSize)
+
+	// Plugins call the host's APIs over loopback; when user traffic is
+	// HTTPS they get a plain HTTP port of their own, so they need no
+	// certificate for it.
+	hostURL = config.HostURL()
+	var loopback net.Listener
+	if config.TLS.Enabled() {
+		if loopback, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+			fatal("failed to listen for plugins", err)
+		}
+		hostURL = "http://" + loopback.Addr().String()
 	}
-	database.Close()
 
 	loadPlugins(config)
 
-	masterHandler := http.HandlerFunc(router)
-
-	log.Println("Host server listening on :8080")
-	log.Println("Loaded routes from config:")
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /openapi.json", serveOpenAPI)
+	mux.HandleFunc("GET /api-docs", serveAPIExplorer)
+	mux.HandleFunc("GET /livez", serveLivez)
+	mux.HandleFunc("GET /readyz", serveReadyz)
+	mux.HandleFunc("/", router)
+
+	if config.AdminAddr != "" {
+		admin := http.NewServeMux()
+		admin.Handle("GET /metrics", hostMetrics.Handler())
+		go func() {
+			slog.Info("admin server listening", "addr", config.AdminAddr)
+			fatal("admin server stopped", http.ListenAndServe(config.AdminAddr, admin))
+		}()
+	}
 	for _, p := range config.Plugins {
-		log.Printf("- %s -> /%s/*\n", p.Name, p.Prefix)
+		slog.Info("routing prefix", "plugin", p.Name, "prefix", "/"+p.Prefix)
+	}
+	handler := withRequestID(withTracing(withSecurity(securityConfig, mux)))
+	srv, redirect, err := newUserServers(context.Background(), config, handler)
+	if err != nil {
+		fatal("failed to set up TLS", err)
+	}
+	if loopback != nil {
+		go func() { fatal("plugin listener stopped", http.Serve(loopback, handler)) }()
 	}
+	if redirect != nil {
+		slog.Info("redirecting to HTTPS", "addr", redirect.Addr)
+		go func() { fatal("redirect listener stopped", redirect.ListenAndServe()) }()
+	}
+	slog.Info("host listening", "addr", config.Listen, "tls", config.TLS.Enabled())
 	go func() {
 		sig := <-c
-		fmt.Println("Received signal:", sig)
-		fmt.Println("Shutting down gracefully...")
+		slog.Info("shutting down", "signal", sig.String())
 		for _, p := range plugs {
 			p.Kill()
 		}
+		flagRecorder.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := flushTraces(ctx); err != nil {
+			slog.Warn("flushing traces", "error", err)
+		}
 		os.Exit(0)
 	}()
-	log.Fatal(http.ListenAndServe(":8080", masterHandler))
+	if srv.TLSConfig != nil {
+		fatal("server stopped", srv.ListenAndServeTLS("", ""))
+	}
+	fatal("server stopped", srv.ListenAndServe())
+}
+
+// fatal logs err and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
 
 type LayoutData struct {
 	MenuItems   []shared.MenuItem
 	InitialPath string
+	Maintenance maintenance
+	Nonce       string // for the inline scripts, per the Content-Security-Policy
+	CSRFToken   string // sent back in sdk.CSRFHeader by every request the page makes
 }
 
 func router(w http.ResponseWriter, r *http.Request) {
@@ -100,6 +211,9 @@ func router(w http.ResponseWriter, r *http.Request) {
 			role = cookie.Value
 		}
 	}
+	// The role the caller presented; only it exempts a request from
+	// maintenance, not the development default below.
+	presented := role
 	if role == "" {
 		role = "admin" // Default to admin for dev
 	}
@@ -125,7 +239,7 @@ func router(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 		if !allowed {
-			http.Error(w, "403 Forbidden: You do not have permission to view this page", http.StatusForbidden)
+			oerrors.Write(w, r, oerrors.New("router", oerrors.KindForbidden, "", "your role may not view this page"))
 			return
 		}
 	}
@@ -156,10 +270,18 @@ func router(w http.ResponseWriter, r *http.Request) {
 		uiTemplate.Execute(w, LayoutData{
 			MenuItems:   filteredMenu,
 			InitialPath: initialPath,
+			Maintenance: currentMaintenance(),
+			Nonce:       cspNonce(r),
+			CSRFToken:   csrfToken(w, r),
 		})
 		return
 	}
 
+	if m := currentMaintenance(); m.blocks(r, presented) {
+		m.refuse(w, r)
+		return
+	}
+
 	var bestMatch string
 	for prefix := range pluginClients {
 		if strings.HasPrefix(path, prefix) {
@@ -170,36 +292,61 @@ func router(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if bestMatch == "" {
-		http.Error(w, "404 Not Found: No plugin registered for this path", http.StatusNotFound)
+		oerrors.Write(w, r, oerrors.New("router", oerrors.KindNotFound, "", "no plugin is registered for this path"))
 		return
 	}
 
 	client := pluginClients[bestMatch]
-	log.Printf("Routing request for %s to matched prefix '%s'", r.URL.Path, bestMatch)
+	start := time.Now()
 
 	// We pass the EXACT original path down to the plugin so it can register absolute paths!
 	// (No longer stripping the prefix here)
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+		oerrors.Write(w, r, oerrors.E("router", oerrors.KindInternal, fmt.Errorf("reading request body: %w", err)))
 		return
 	}
 
 	if r.Header == nil {
 		r.Header = make(http.Header)
 	}
+	// Identity headers are the host's alone: drop any the client sent and
+	// set them from the role resolved above. The host knows no user ID.
+	for name := range r.Header {
+		if strings.HasPrefix(name, "X-Oasis-") {
+			r.Header.Del(name)
+		}
+	}
 	r.Header.Set("X-User-Role", role)
-
+	r.Header.Set(sdk.RolesHeader, role)
+
+	// The plugin continues the trace from a client span around the call.
+	span := trace.SpanFromContext(r.Context())
+	span.SetAttributes(attribute.String("oasis.prefix", bestMatch),
+		attribute.String("oasis.request_id", oerrors.RequestID(r)))
+	ctx, rpcSpan := tracing.Tracer().Start(r.Context(), "Plugin.ServeHTTP",
+		trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attribute.String("oasis.prefix", bestMatch)))
 	req := shared.HTTPRequest{
 		Method: r.Method, URL: r.URL.String(), Header: r.Header, Body: body,
+		TraceContext: tracing.Inject(ctx),
 	}
 
 	resp, err := client.ServeHTTP(req)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Plugin error: %s", err), http.StatusInternalServerError)
+		rpcSpan.SetStatus(codes.Error, err.Error())
+		rpcSpan.End()
+		hostMetrics.ObserveRequest(bestMatch, "", r.Method, http.StatusBadGateway, time.Since(start))
+		oerrors.Write(w, r, oerrors.E("router", oerrors.KindPlugin, fmt.Errorf("plugin for /%s: %w", bestMatch, err)))
 		return
 	}
+	rpcSpan.End()
 
+	route := resp.Header.Get(shared.RouteHeader)
+	resp.Header.Del(shared.RouteHeader)
+	if route != "" {
+		span.SetName(r.Method + " " + route)
+		span.SetAttributes(semconv.HTTPRoute(route))
+	}
 	for key, values := range resp.Header {
 		for _, value := range values {
 			w.Header().Add(key, value)
@@ -207,51 +354,69 @@ func router(w http.ResponseWriter, r *http.Request) {
 	}
 	w.WriteHeader(resp.StatusCode)
 	w.Write(resp.Body)
+	hostMetrics.ObserveRequest(bestMatch, route, r.Method, resp.StatusCode, time.Since(start))
+	slog.Info("routed request", "method", r.Method, "path", r.URL.Path, "prefix", bestMatch, "route", route,
+		"status", resp.StatusCode, "duration", time.Since(start), "request_id", oerrors.RequestID(r),
+		"trace_id", tracing.TraceID(r.Context()))
 }
 
-func loadConfig(path string) (*AppConfig, error) {
-	configFile, err := os.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("could not read config file: %w", err)
-	}
-	var config AppConfig
-	if err = yaml.Unmarshal(configFile, &config); err != nil {
-		return nil, fmt.Errorf("could not parse yaml config: %w", err)
-	}
-	return &config, nil
+// requestIDPattern is what a client-supplied X-Request-ID must look like to
+// be kept; anything else is replaced so it cannot forge log lines.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// withRequestID gives every request a correlation ID, forwarded to plugins
+// in X-Request-ID and echoed on the response, so a problem reported by a
+// client can be matched to the host and plugin logs.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(oerrors.RequestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = oerrors.NewRequestID()
+			r.Header.Set(oerrors.RequestIDHeader, id)
+		}
+		w.Header().Set(oerrors.RequestIDHeader, id)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withTracing gives every request a server span, continuing the trace of
+// a caller that sent a traceparent header. router names the span after the
+// route the plugin matched.
+func withTracing(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "oasis",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string { return r.Method }))
+}
+
+// serveOpenAPI serves the merged OpenAPI document of every loaded plugin.
+func serveOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(apiDocument)
+}
+
+// serveAPIExplorer serves an interactive explorer for /openapi.json.
+func serveAPIExplorer(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	apiExplorer.Execute(w, LayoutData{Nonce: cspNonce(r), CSRFToken: csrfToken(w, r)})
 }
 
 func loadPlugins(config *AppConfig) {
+	docs := openapi.New()
 	for _, p := range config.Plugins {
-		log.Printf("Loading plugin '%s' from path %s", p.Name, p.Path)
-
-		cmd := exec.Command(p.Path)
-		cmd.Env = append(os.Environ(),
-			"OASIS_DB_URL="+config.Database.URL,
-			"OASIS_PLUGIN_NAME="+p.Name,
-			"OASIS_PLUGIN_PREFIX="+p.Prefix,
-		)
-
-		client := plugin.NewClient(&plugin.ClientConfig{
-			HandshakeConfig: shared.Handshake,
-			Plugins:         map[string]plugin.Plugin{"http_plugin": &shared.HTTPPluginAdapter{}},
-			Cmd:             cmd,
-		})
-		plugs = append(plugs, client)
-		rpcClient, err := client.Client()
+		slog.Info("loading plugin", "plugin", p.Name, "path", p.Path)
 
-		if err != nil {
-			log.Printf("Error creating RPC client for %s: %s", p.Name, err)
-			continue
+		level := hostLevel.Level()
+		if p.LogLevel != "" {
+			level, _ = logging.ParseLevel(p.LogLevel)
 		}
-
-		raw, err := rpcClient.Dispense("http_plugin")
+		managed, err := startPlugin(p, config.Database.URL, level)
 		if err != nil {
-			log.Printf("Error dispensing plugin %s: %s", p.Name, err)
+			slog.Error("starting plugin", "plugin", p.Name, "error", err)
 			continue
 		}
-		
-		httpPlugin := raw.(shared.HTTPPlugin)
+		plugs = append(plugs, managed)
+		hostMetrics.AddPlugin(p.Name, managed.GetMetrics)
+
+		httpPlugin := managed
 		pluginClients[p.Prefix] = httpPlugin
 		
 		// Ask the plugin if it wants to claim additional top-level routes
@@ -260,17 +425,46 @@ func loadPlugins(config *AppConfig) {
 			for _, r := range dynamicRoutes {
 				cleanRoute := strings.TrimPrefix(r, "/")
 				pluginClients[cleanRoute] = httpPlugin
-				log.Printf("- %s dynamically registered route -> /%s/*", p.Name, cleanRoute)
+				slog.Info("registered route", "plugin", p.Name, "route", "/"+cleanRoute)
 			}
 		} else {
-			log.Printf("Plugin %s GetRoutes err: %v", p.Name, err)
+			slog.Error("GetRoutes failed", "plugin", p.Name, "error", err)
 		}
 
 		// Ask the plugin for its Menu Items
 		items, err := httpPlugin.GetMenuItems()
 		if err == nil && len(items) > 0 {
 			menuItems = append(menuItems, items...)
-			log.Printf("- %s registered %d menu items", p.Name, len(items))
+			slog.Info("registered menu items", "plugin", p.Name, "count", len(items))
+		}
+
+		// Ask the plugin for its OpenAPI document, if it serves an API
+		doc, err := httpPlugin.GetOpenAPI()
+		if err != nil {
+			slog.Error("GetOpenAPI failed", "plugin", p.Name, "error", err)
+		} else if doc != nil {
+			if err := docs.Add(p.Name, p.Prefix, doc); err != nil {
+				slog.Warn("skipping OpenAPI document", "plugin", p.Name, "error", err)
+			} else {
+				slog.Info("published OpenAPI document", "plugin", p.Name)
+			}
 		}
+
+		// Ask the plugin for the settings sections it adds
+		sections, err := httpPlugin.GetSettingsSections()
+		if err != nil {
+			slog.Error("GetSettingsSections failed", "plugin", p.Name, "error", err)
+		}
+		for _, sec := range sections {
+			if err := hostSettings.Register(sec); err != nil {
+				slog.Warn("skipping settings section", "plugin", p.Name, "error", err)
+			}
+		}
+	}
+
+	var err error
+	if apiDocument, err = docs.JSON(); err != nil {
+		slog.Error("rendering the OpenAPI document", "error", err)
 	}
+	pushSettings()
 }
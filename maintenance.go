@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+
+	oerrors "github.com/catdevman/oasis/internal/errors"
+)
+
+// The maintenance modes, the values of the system.maintenance setting.
+const (
+	maintenanceOff      = "off"
+	maintenanceReadOnly = "read_only" // only safe methods are served
+	maintenanceClosed   = "closed"    // nothing is served but the UI shell
+)
+
+// maintenance is the maintenance mode the system settings put the host in.
+type maintenance struct {
+	Mode       string
+	Roles      []string // roles that act as usual during maintenance
+	Message    string
+	RetryAfter int // seconds
+}
+
+// currentMaintenance reads the maintenance mode from the system settings.
+func currentMaintenance() maintenance {
+	values := hostSettings.Values()
+	var m maintenance
+	values.Decode("system", "maintenance", &m.Mode)
+	values.Decode("system", "maintenance_roles", &m.Roles)
+	values.Decode("system", "maintenance_message", &m.Message)
+	values.Decode("system", "maintenance_retry_after", &m.RetryAfter)
+	return m
+}
+
+// Active reports whether the system is under maintenance.
+func (m maintenance) Active() bool {
+	return m.Mode != "" && m.Mode != maintenanceOff
+}
+
+// Banner is the notice shown to every user during maintenance.
+func (m maintenance) Banner() string {
+	switch {
+	case m.Message != "":
+		return m.Message
+	case m.Mode == maintenanceClosed:
+		return "Oasis is closed for maintenance."
+	default:
+		return "Oasis is read-only for maintenance; changes cannot be saved."
+	}
+}
+
+// blocks reports whether maintenance refuses r from a user with role, the
+// role the caller presented. A caller that presented none is never exempt.
+func (m maintenance) blocks(r *http.Request, role string) bool {
+	if !m.Active() || role != "" && slices.Contains(m.Roles, role) {
+		return false
+	}
+	if m.Mode == maintenanceClosed {
+		return true
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// refuse answers r with a 503 telling the client when to try again.
+func (m maintenance) refuse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Retry-After", strconv.Itoa(m.RetryAfter))
+	oerrors.WriteProblem(w, r, oerrors.NewProblem(http.StatusServiceUnavailable, "MAINTENANCE", m.Banner()))
+}
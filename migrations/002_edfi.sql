@@ -0,0 +1,75 @@
+-- =============================================================================
+-- Common Plugin: Ed-Fi Resources
+-- Version: 002
+-- Description: The tables served by the generated common-plugin repositories:
+--              the edfi schema for Ed-Fi ODS resources, plus Calendar, Program
+--              and Assessment. Later migrations add their keys, row versions,
+--              audit and change tracking.
+-- =============================================================================
+
+CREATE SCHEMA IF NOT EXISTS edfi;
+
+CREATE TABLE IF NOT EXISTS edfi.Student (
+    StudentUniqueId             TEXT NOT NULL,
+    FirstName                   TEXT,
+    LastSurname                 TEXT
+);
+
+CREATE TABLE IF NOT EXISTS edfi.Staff (
+    StaffUniqueId               TEXT NOT NULL,
+    FirstName                   TEXT,
+    LastSurname                 TEXT
+);
+
+CREATE TABLE IF NOT EXISTS edfi.School (
+    OrganizationIdentifier      TEXT NOT NULL,
+    OrganizationName            TEXT
+);
+
+CREATE TABLE IF NOT EXISTS edfi.Course (
+    CourseIdentifier            TEXT NOT NULL,
+    CourseTitle                 TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS edfi.Section (
+    CourseSectionIdentifier     TEXT NOT NULL,
+    CourseTitle                 TEXT,
+    CourseIdentifier            TEXT,
+    SessionBeginDate            DATE,
+    SessionEndDate              DATE
+);
+
+CREATE TABLE IF NOT EXISTS edfi.StudentSectionAssociation (
+    CourseSectionIdentifier     TEXT NOT NULL,
+    StudentUniqueId             TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS edfi.StudentSectionAttendanceEvent (
+    CourseSectionIdentifier     TEXT NOT NULL,
+    AttendanceEventType         TEXT,
+    StudentUniqueId             TEXT NOT NULL,
+    AttendanceEventDate         DATE NOT NULL,
+    AttendanceStatus            TEXT,
+    CONSTRAINT chk_StudentSectionAttendanceEvent_AttendanceStatus CHECK (AttendanceStatus IN (
+        'Present', 'Tardy', 'Excused Absence', 'Unexcused Absence'
+    ))
+);
+
+CREATE TABLE IF NOT EXISTS Calendar (
+    CalendarCode                TEXT NOT NULL,
+    CalendarDescription         TEXT,
+    SchoolYear                  INTEGER
+);
+
+CREATE TABLE IF NOT EXISTS Program (
+    ProgramName                 TEXT NOT NULL,
+    ProgramType                 TEXT,
+    CONSTRAINT chk_Program_ProgramType CHECK (ProgramType IN (
+        'Gifted and talented program', 'Bilingual education program', 'Special education program'
+    ))
+);
+
+CREATE TABLE IF NOT EXISTS Assessment (
+    AssessmentIdentifier        TEXT NOT NULL,
+    AssessmentTitle             TEXT NOT NULL
+);
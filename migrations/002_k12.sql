@@ -5,7 +5,7 @@
 -- =============================================================================
 
 CREATE TABLE IF NOT EXISTS K12StudentEnrollment (
-    K12StudentEnrollmentId      INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    K12StudentEnrollmentId      INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
     StudentPersonIdentifier     TEXT NOT NULL,
     SchoolOrganizationIdentifier TEXT NOT NULL,
     SchoolYear                  TEXT NOT NULL,
@@ -23,7 +23,7 @@ CREATE TABLE IF NOT EXISTS K12StudentEnrollment (
 );
 
 CREATE TABLE IF NOT EXISTS StaffEmployment (
-    StaffEmploymentId           INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    StaffEmploymentId           INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
     StaffPersonIdentifier       TEXT NOT NULL,
     SchoolOrganizationIdentifier TEXT NOT NULL,
     StartDate                   TEXT,
@@ -67,7 +67,7 @@ CREATE TABLE IF NOT EXISTS Assignment (
 );
 
 CREATE TABLE IF NOT EXISTS Grade (
-    GradeId                     INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    GradeId                     INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
     AssignmentIdentifier        TEXT NOT NULL,
     StudentPersonIdentifier     TEXT NOT NULL,
     ResultScore                 TEXT NOT NULL,
@@ -77,7 +77,7 @@ CREATE TABLE IF NOT EXISTS Grade (
 );
 
 CREATE TABLE IF NOT EXISTS AttendanceEvent (
-    AttendanceEventId           INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    AttendanceEventId           INTEGER GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
     StudentPersonIdentifier     TEXT NOT NULL,
     EventDate                   TEXT NOT NULL,
     AttendanceEventType         TEXT NOT NULL,
@@ -0,0 +1,17 @@
+-- =============================================================================
+-- Common Plugin: Natural Keys
+-- Version: 003
+-- Description: Unique indexes on the natural keys used by the generated
+--              common-plugin repositories, so duplicate creates fail with a
+--              unique violation (409 CONFLICT) instead of inserting twice.
+-- =============================================================================
+
+CREATE UNIQUE INDEX IF NOT EXISTS ux_student_key ON edfi.Student (StudentUniqueId);
+CREATE UNIQUE INDEX IF NOT EXISTS ux_staff_key ON edfi.Staff (StaffUniqueId);
+CREATE UNIQUE INDEX IF NOT EXISTS ux_school_key ON edfi.School (OrganizationIdentifier);
+CREATE UNIQUE INDEX IF NOT EXISTS ux_course_key ON edfi.Course (CourseIdentifier);
+CREATE UNIQUE INDEX IF NOT EXISTS ux_section_key ON edfi.Section (CourseSectionIdentifier);
+CREATE UNIQUE INDEX IF NOT EXISTS ux_studentsectionassociation_key ON edfi.StudentSectionAssociation (CourseSectionIdentifier, StudentUniqueId);
+CREATE UNIQUE INDEX IF NOT EXISTS ux_calendar_key ON Calendar (CalendarCode);
+CREATE UNIQUE INDEX IF NOT EXISTS ux_program_key ON Program (ProgramName);
+CREATE UNIQUE INDEX IF NOT EXISTS ux_assessment_key ON Assessment (AssessmentIdentifier);
@@ -0,0 +1,18 @@
+-- =============================================================================
+-- Common Plugin: Row Versions
+-- Version: 004
+-- Description: A RowVersion counter on every table served by the generated
+--              common-plugin repositories. It is bumped on each update and
+--              exposed as the resource's ETag for If-Match / If-None-Match.
+-- =============================================================================
+
+ALTER TABLE edfi.Student ADD COLUMN IF NOT EXISTS RowVersion BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE edfi.Staff ADD COLUMN IF NOT EXISTS RowVersion BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE edfi.School ADD COLUMN IF NOT EXISTS RowVersion BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE edfi.Course ADD COLUMN IF NOT EXISTS RowVersion BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE edfi.Section ADD COLUMN IF NOT EXISTS RowVersion BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE edfi.StudentSectionAssociation ADD COLUMN IF NOT EXISTS RowVersion BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE edfi.StudentSectionAttendanceEvent ADD COLUMN IF NOT EXISTS RowVersion BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE Calendar ADD COLUMN IF NOT EXISTS RowVersion BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE Program ADD COLUMN IF NOT EXISTS RowVersion BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE Assessment ADD COLUMN IF NOT EXISTS RowVersion BIGINT NOT NULL DEFAULT 1;
@@ -0,0 +1,94 @@
+-- =============================================================================
+-- Common Plugin: Audit History
+-- Version: 005
+-- Description: Append-only change log for every table served by the generated
+--              common-plugin repositories. A trigger records each insert,
+--              update and delete with before/after row images, the actor and
+--              request ID the repository sets on its transaction
+--              (oasis.actor, oasis.request_id), and the time of the change.
+-- =============================================================================
+
+CREATE SCHEMA IF NOT EXISTS audit;
+
+CREATE TABLE IF NOT EXISTS audit.ChangeLog (
+    ChangeId                    BIGSERIAL PRIMARY KEY,
+    TableName                   TEXT NOT NULL,
+    ResourceKey                 TEXT NOT NULL,
+    Operation                   TEXT NOT NULL,
+    Before                      JSONB,
+    After                       JSONB,
+    Actor                       TEXT,
+    RequestId                   TEXT,
+    ChangedAt                   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT chk_ChangeLog_Operation CHECK (Operation IN ('INSERT', 'UPDATE', 'DELETE'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_changelog_resource ON audit.ChangeLog (TableName, ResourceKey, ChangeId);
+
+-- History is immutable: rows may be appended but never changed or removed.
+CREATE OR REPLACE FUNCTION audit.reject_change() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit.ChangeLog is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE TRIGGER changelog_immutable
+    BEFORE UPDATE OR DELETE ON audit.ChangeLog
+    FOR EACH ROW EXECUTE FUNCTION audit.reject_change();
+CREATE OR REPLACE TRIGGER changelog_no_truncate
+    BEFORE TRUNCATE ON audit.ChangeLog
+    FOR EACH STATEMENT EXECUTE FUNCTION audit.reject_change();
+
+-- audit.capture(key_column, ...) logs one row change. The key columns are
+-- the lower-case names of the row's natural key; the entry's ResourceKey is
+-- their values joined by '/', so rows of a table with a composite key keep
+-- separate histories.
+CREATE OR REPLACE FUNCTION audit.capture() RETURNS trigger AS $$
+DECLARE
+    before_row JSONB;
+    after_row  JSONB;
+    row_key    TEXT;
+BEGIN
+    IF TG_OP <> 'INSERT' THEN
+        before_row := to_jsonb(OLD);
+    END IF;
+    IF TG_OP <> 'DELETE' THEN
+        after_row := to_jsonb(NEW);
+    END IF;
+    SELECT string_agg(COALESCE(after_row, before_row) ->> k, '/' ORDER BY i)
+    INTO row_key
+    FROM unnest(TG_ARGV) WITH ORDINALITY AS key_columns (k, i);
+    INSERT INTO audit.ChangeLog (TableName, ResourceKey, Operation, Before, After, Actor, RequestId)
+    VALUES (
+        TG_RELID::regclass::text,
+        row_key,
+        TG_OP,
+        before_row,
+        after_row,
+        NULLIF(current_setting('oasis.actor', true), ''),
+        NULLIF(current_setting('oasis.request_id', true), '')
+    );
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE TRIGGER audit_changes AFTER INSERT OR UPDATE OR DELETE ON edfi.Student
+    FOR EACH ROW EXECUTE FUNCTION audit.capture('studentuniqueid');
+CREATE OR REPLACE TRIGGER audit_changes AFTER INSERT OR UPDATE OR DELETE ON edfi.Staff
+    FOR EACH ROW EXECUTE FUNCTION audit.capture('staffuniqueid');
+CREATE OR REPLACE TRIGGER audit_changes AFTER INSERT OR UPDATE OR DELETE ON edfi.School
+    FOR EACH ROW EXECUTE FUNCTION audit.capture('organizationidentifier');
+CREATE OR REPLACE TRIGGER audit_changes AFTER INSERT OR UPDATE OR DELETE ON edfi.Course
+    FOR EACH ROW EXECUTE FUNCTION audit.capture('courseidentifier');
+CREATE OR REPLACE TRIGGER audit_changes AFTER INSERT OR UPDATE OR DELETE ON edfi.Section
+    FOR EACH ROW EXECUTE FUNCTION audit.capture('coursesectionidentifier');
+CREATE OR REPLACE TRIGGER audit_changes AFTER INSERT OR UPDATE OR DELETE ON edfi.StudentSectionAssociation
+    FOR EACH ROW EXECUTE FUNCTION audit.capture('coursesectionidentifier', 'studentuniqueid');
+CREATE OR REPLACE TRIGGER audit_changes AFTER INSERT OR UPDATE OR DELETE ON edfi.StudentSectionAttendanceEvent
+    FOR EACH ROW EXECUTE FUNCTION audit.capture('coursesectionidentifier', 'studentuniqueid', 'attendanceeventdate');
+CREATE OR REPLACE TRIGGER audit_changes AFTER INSERT OR UPDATE OR DELETE ON Calendar
+    FOR EACH ROW EXECUTE FUNCTION audit.capture('calendarcode');
+CREATE OR REPLACE TRIGGER audit_changes AFTER INSERT OR UPDATE OR DELETE ON Program
+    FOR EACH ROW EXECUTE FUNCTION audit.capture('programname');
+CREATE OR REPLACE TRIGGER audit_changes AFTER INSERT OR UPDATE OR DELETE ON Assessment
+    FOR EACH ROW EXECUTE FUNCTION audit.capture('assessmentidentifier');
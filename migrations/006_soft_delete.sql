@@ -0,0 +1,12 @@
+-- =============================================================================
+-- Common Plugin: Soft Delete
+-- Version: 006
+-- Description: DeletedAt on the tables whose domains are soft-deleted
+--              (student, staff, program, assessment). A deleted row keeps its
+--              natural key and is hidden from reads until an admin restores it.
+-- =============================================================================
+
+ALTER TABLE edfi.Student ADD COLUMN IF NOT EXISTS DeletedAt TIMESTAMPTZ;
+ALTER TABLE edfi.Staff ADD COLUMN IF NOT EXISTS DeletedAt TIMESTAMPTZ;
+ALTER TABLE Program ADD COLUMN IF NOT EXISTS DeletedAt TIMESTAMPTZ;
+ALTER TABLE Assessment ADD COLUMN IF NOT EXISTS DeletedAt TIMESTAMPTZ;
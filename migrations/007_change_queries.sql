@@ -0,0 +1,112 @@
+-- =============================================================================
+-- Common Plugin: Change Queries
+-- Version: 007
+-- Description: Ed-Fi Change Queries support. Every table served by the
+--              generated common-plugin repositories gets a ChangeVersion drawn
+--              from one database-wide sequence and bumped on each insert and
+--              update. Deletes (hard or soft) and natural-key changes are
+--              recorded in changes.TrackedChange for the /deletes and
+--              /keyChanges endpoints.
+-- =============================================================================
+
+CREATE SCHEMA IF NOT EXISTS changes;
+
+CREATE SEQUENCE IF NOT EXISTS changes.ChangeVersionSequence;
+
+CREATE TABLE IF NOT EXISTS changes.TrackedChange (
+    ChangeVersion               BIGINT NOT NULL PRIMARY KEY,
+    TableName                   TEXT NOT NULL,
+    ResourceKey                 TEXT NOT NULL,
+    Operation                   TEXT NOT NULL,
+    OldKeyValues                JSONB,
+    NewKeyValues                JSONB,
+    ChangedAt                   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT chk_TrackedChange_Operation CHECK (Operation IN ('DELETE', 'KEY_CHANGE'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_trackedchange_table ON changes.TrackedChange (TableName, Operation, ChangeVersion);
+
+-- changes.key_values(row, key_columns) picks the natural key out of a row image.
+CREATE OR REPLACE FUNCTION changes.key_values(row_image JSONB, key_columns TEXT[]) RETURNS JSONB AS $$
+    SELECT jsonb_object_agg(k, row_image -> k) FROM unnest(key_columns) AS k;
+$$ LANGUAGE sql IMMUTABLE;
+
+-- changes.track(key_column, ...) stamps each written row with a new change
+-- version and records deletes and key changes. The first key column is the
+-- one the resource is addressed by. Soft deletes (DeletedAt set) are
+-- reported as deletes.
+CREATE OR REPLACE FUNCTION changes.track() RETURNS trigger AS $$
+DECLARE
+    old_row  JSONB;
+    new_row  JSONB;
+    old_keys JSONB;
+    new_keys JSONB;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        old_row := to_jsonb(OLD);
+        INSERT INTO changes.TrackedChange (ChangeVersion, TableName, ResourceKey, Operation, OldKeyValues)
+        VALUES (nextval('changes.ChangeVersionSequence'), TG_RELID::regclass::text,
+                old_row ->> TG_ARGV[0], 'DELETE', changes.key_values(old_row, TG_ARGV));
+        RETURN OLD;
+    END IF;
+
+    NEW.ChangeVersion := nextval('changes.ChangeVersionSequence');
+    IF TG_OP = 'UPDATE' THEN
+        old_row := to_jsonb(OLD);
+        new_row := to_jsonb(NEW);
+        old_keys := changes.key_values(old_row, TG_ARGV);
+        new_keys := changes.key_values(new_row, TG_ARGV);
+        IF old_keys IS DISTINCT FROM new_keys THEN
+            INSERT INTO changes.TrackedChange (ChangeVersion, TableName, ResourceKey, Operation, OldKeyValues, NewKeyValues)
+            VALUES (NEW.ChangeVersion, TG_RELID::regclass::text, new_row ->> TG_ARGV[0], 'KEY_CHANGE', old_keys, new_keys);
+        ELSIF old_row -> 'deletedat' = 'null' AND new_row -> 'deletedat' <> 'null' THEN
+            INSERT INTO changes.TrackedChange (ChangeVersion, TableName, ResourceKey, Operation, OldKeyValues)
+            VALUES (NEW.ChangeVersion, TG_RELID::regclass::text, old_row ->> TG_ARGV[0], 'DELETE', old_keys);
+        END IF;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE edfi.Student ADD COLUMN IF NOT EXISTS ChangeVersion BIGINT NOT NULL DEFAULT nextval('changes.ChangeVersionSequence');
+ALTER TABLE edfi.Staff ADD COLUMN IF NOT EXISTS ChangeVersion BIGINT NOT NULL DEFAULT nextval('changes.ChangeVersionSequence');
+ALTER TABLE edfi.School ADD COLUMN IF NOT EXISTS ChangeVersion BIGINT NOT NULL DEFAULT nextval('changes.ChangeVersionSequence');
+ALTER TABLE edfi.Course ADD COLUMN IF NOT EXISTS ChangeVersion BIGINT NOT NULL DEFAULT nextval('changes.ChangeVersionSequence');
+ALTER TABLE edfi.Section ADD COLUMN IF NOT EXISTS ChangeVersion BIGINT NOT NULL DEFAULT nextval('changes.ChangeVersionSequence');
+ALTER TABLE edfi.StudentSectionAssociation ADD COLUMN IF NOT EXISTS ChangeVersion BIGINT NOT NULL DEFAULT nextval('changes.ChangeVersionSequence');
+ALTER TABLE edfi.StudentSectionAttendanceEvent ADD COLUMN IF NOT EXISTS ChangeVersion BIGINT NOT NULL DEFAULT nextval('changes.ChangeVersionSequence');
+ALTER TABLE Calendar ADD COLUMN IF NOT EXISTS ChangeVersion BIGINT NOT NULL DEFAULT nextval('changes.ChangeVersionSequence');
+ALTER TABLE Program ADD COLUMN IF NOT EXISTS ChangeVersion BIGINT NOT NULL DEFAULT nextval('changes.ChangeVersionSequence');
+ALTER TABLE Assessment ADD COLUMN IF NOT EXISTS ChangeVersion BIGINT NOT NULL DEFAULT nextval('changes.ChangeVersionSequence');
+
+CREATE INDEX IF NOT EXISTS idx_student_changeversion ON edfi.Student (ChangeVersion);
+CREATE INDEX IF NOT EXISTS idx_staff_changeversion ON edfi.Staff (ChangeVersion);
+CREATE INDEX IF NOT EXISTS idx_school_changeversion ON edfi.School (ChangeVersion);
+CREATE INDEX IF NOT EXISTS idx_course_changeversion ON edfi.Course (ChangeVersion);
+CREATE INDEX IF NOT EXISTS idx_section_changeversion ON edfi.Section (ChangeVersion);
+CREATE INDEX IF NOT EXISTS idx_studentsectionassociation_changeversion ON edfi.StudentSectionAssociation (ChangeVersion);
+CREATE INDEX IF NOT EXISTS idx_studentsectionattendanceevent_changeversion ON edfi.StudentSectionAttendanceEvent (ChangeVersion);
+CREATE INDEX IF NOT EXISTS idx_calendar_changeversion ON Calendar (ChangeVersion);
+CREATE INDEX IF NOT EXISTS idx_program_changeversion ON Program (ChangeVersion);
+CREATE INDEX IF NOT EXISTS idx_assessment_changeversion ON Assessment (ChangeVersion);
+
+CREATE OR REPLACE TRIGGER track_changes BEFORE INSERT OR UPDATE OR DELETE ON edfi.Student
+    FOR EACH ROW EXECUTE FUNCTION changes.track('studentuniqueid');
+CREATE OR REPLACE TRIGGER track_changes BEFORE INSERT OR UPDATE OR DELETE ON edfi.Staff
+    FOR EACH ROW EXECUTE FUNCTION changes.track('staffuniqueid');
+CREATE OR REPLACE TRIGGER track_changes BEFORE INSERT OR UPDATE OR DELETE ON edfi.School
+    FOR EACH ROW EXECUTE FUNCTION changes.track('organizationidentifier');
+CREATE OR REPLACE TRIGGER track_changes BEFORE INSERT OR UPDATE OR DELETE ON edfi.Course
+    FOR EACH ROW EXECUTE FUNCTION changes.track('courseidentifier');
+CREATE OR REPLACE TRIGGER track_changes BEFORE INSERT OR UPDATE OR DELETE ON edfi.Section
+    FOR EACH ROW EXECUTE FUNCTION changes.track('coursesectionidentifier');
+CREATE OR REPLACE TRIGGER track_changes BEFORE INSERT OR UPDATE OR DELETE ON edfi.StudentSectionAssociation
+    FOR EACH ROW EXECUTE FUNCTION changes.track('coursesectionidentifier', 'studentuniqueid');
+CREATE OR REPLACE TRIGGER track_changes BEFORE INSERT OR UPDATE OR DELETE ON edfi.StudentSectionAttendanceEvent
+    FOR EACH ROW EXECUTE FUNCTION changes.track('coursesectionidentifier', 'studentuniqueid', 'attendanceeventdate');
+CREATE OR REPLACE TRIGGER track_changes BEFORE INSERT OR UPDATE OR DELETE ON Calendar
+    FOR EACH ROW EXECUTE FUNCTION changes.track('calendarcode');
+CREATE OR REPLACE TRIGGER track_changes BEFORE INSERT OR UPDATE OR DELETE ON Program
+    FOR EACH ROW EXECUTE FUNCTION changes.track('programname');
+CREATE OR REPLACE TRIGGER track_changes BEFORE INSERT OR UPDATE OR DELETE ON Assessment
+    FOR EACH ROW EXECUTE FUNCTION changes.track('assessmentidentifier');
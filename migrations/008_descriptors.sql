@@ -0,0 +1,142 @@
+-- =============================================================================
+-- Common Plugin: Descriptors
+-- Version: 008
+-- Description: Ed-Fi descriptors, the extensible code lists referenced by
+--              URI ("{Namespace}#{CodeValue}"). All descriptor types share one
+--              table. Standard values live in the uri://ed-fi.org namespace;
+--              districts add their own under another namespace. Columns that
+--              held hardcoded CHECK lists now hold descriptor URIs backed by a
+--              foreign key.
+-- =============================================================================
+
+CREATE TABLE IF NOT EXISTS edfi.Descriptor (
+    DescriptorId                BIGSERIAL PRIMARY KEY,
+    DescriptorType              TEXT NOT NULL,
+    Namespace                   TEXT NOT NULL,
+    CodeValue                   TEXT NOT NULL,
+    ShortDescription            TEXT NOT NULL,
+    Description                 TEXT,
+    EffectiveBeginDate          DATE,
+    EffectiveEndDate            DATE,
+    Uri                         TEXT GENERATED ALWAYS AS (Namespace || '#' || CodeValue) STORED,
+    RowVersion                  BIGINT NOT NULL DEFAULT 1,
+    ChangeVersion               BIGINT NOT NULL DEFAULT nextval('changes.ChangeVersionSequence'),
+    CONSTRAINT ux_Descriptor_Uri UNIQUE (Uri),
+    CONSTRAINT chk_Descriptor_Namespace CHECK (Namespace LIKE 'uri://%/' || DescriptorType || 'Descriptor')
+);
+
+CREATE INDEX IF NOT EXISTS idx_descriptor_type ON edfi.Descriptor (DescriptorType, DescriptorId);
+CREATE INDEX IF NOT EXISTS idx_descriptor_changeversion ON edfi.Descriptor (ChangeVersion);
+
+CREATE OR REPLACE TRIGGER audit_changes AFTER INSERT OR UPDATE OR DELETE ON edfi.Descriptor
+    FOR EACH ROW EXECUTE FUNCTION audit.capture('descriptorid');
+CREATE OR REPLACE TRIGGER track_changes BEFORE INSERT OR UPDATE OR DELETE ON edfi.Descriptor
+    FOR EACH ROW EXECUTE FUNCTION changes.track('descriptorid', 'namespace', 'codevalue');
+
+-- Standard values
+INSERT INTO edfi.Descriptor (DescriptorType, Namespace, CodeValue, ShortDescription)
+SELECT t, 'uri://ed-fi.org/' || t || 'Descriptor', v, v
+FROM (VALUES
+    ('AttendanceEventCategory', 'Present'),
+    ('AttendanceEventCategory', 'ExcusedAbsence'),
+    ('AttendanceEventCategory', 'UnexcusedAbsence'),
+    ('AttendanceEventCategory', 'Tardy'),
+    ('AttendanceEventCategory', 'EarlyDeparture'),
+    ('CohortType', 'Academic Intervention'),
+    ('CohortType', 'Attendance Intervention'),
+    ('CohortType', 'Extracurricular'),
+    ('CohortType', 'Field Set'),
+    ('CohortType', 'Other'),
+    ('CredentialField', 'English Language Arts'),
+    ('CredentialField', 'Mathematics'),
+    ('CredentialField', 'Science'),
+    ('CredentialField', 'Social Studies'),
+    ('CredentialField', 'Special Education'),
+    ('CredentialType', 'Certification'),
+    ('CredentialType', 'Endorsement'),
+    ('CredentialType', 'Licensure'),
+    ('CredentialType', 'Other'),
+    ('GradeType', 'Grading Period'),
+    ('GradeType', 'Semester'),
+    ('GradeType', 'Final'),
+    ('GradeType', 'Exam'),
+    ('InterventionClass', 'Curriculum'),
+    ('InterventionClass', 'Behavioral'),
+    ('InterventionClass', 'Enrichment'),
+    ('InterventionClass', 'Extended Learning'),
+    ('PostSecondaryEventCategory', 'College Application'),
+    ('PostSecondaryEventCategory', 'College Acceptance'),
+    ('PostSecondaryEventCategory', 'College Enrollment'),
+    ('PostSecondaryEventCategory', 'Military Enlistment'),
+    ('PostSecondaryEventCategory', 'Employment'),
+    ('ProgramType', 'Regular education'),
+    ('ProgramType', 'Special Education Services'),
+    ('ProgramType', 'Career and Technical Education'),
+    ('ProgramType', 'Gifted and talented program'),
+    ('ProgramType', 'Bilingual education program')
+) AS seed (t, v)
+ON CONFLICT DO NOTHING;
+
+-- Replace the hardcoded CHECK lists on descriptor columns.
+DO $$
+DECLARE
+    c RECORD;
+BEGIN
+    FOR c IN
+        SELECT con.conrelid::regclass AS tbl, con.conname
+        FROM pg_constraint con
+        JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = ANY (con.conkey)
+        WHERE con.contype = 'c'
+          AND (con.conrelid, a.attname) IN (
+              ('edfi.StudentSectionAttendanceEvent'::regclass, 'attendancestatus'),
+              ('Program'::regclass, 'programtype'))
+    LOOP
+        EXECUTE format('ALTER TABLE %s DROP CONSTRAINT %I', c.tbl, c.conname);
+    END LOOP;
+END $$;
+
+-- Codes the CHECK lists spelled differently from the standard values are
+-- mapped onto them, so no category gets a second descriptor.
+CREATE TEMPORARY TABLE descriptor_code_map (
+    DescriptorType              TEXT NOT NULL,
+    OldValue                    TEXT NOT NULL,
+    CodeValue                   TEXT NOT NULL
+) ON COMMIT DROP;
+INSERT INTO descriptor_code_map VALUES
+    ('AttendanceEventCategory', 'Excused Absence', 'ExcusedAbsence'),
+    ('AttendanceEventCategory', 'Unexcused Absence', 'UnexcusedAbsence'),
+    ('AttendanceEventCategory', 'Early Departure', 'EarlyDeparture'),
+    ('ProgramType', 'Special education program', 'Special Education Services');
+
+UPDATE edfi.StudentSectionAttendanceEvent e
+SET AttendanceStatus = m.CodeValue
+FROM descriptor_code_map m
+WHERE m.DescriptorType = 'AttendanceEventCategory' AND e.AttendanceStatus = m.OldValue;
+UPDATE Program p
+SET ProgramType = m.CodeValue
+FROM descriptor_code_map m
+WHERE m.DescriptorType = 'ProgramType' AND p.ProgramType = m.OldValue;
+
+-- Existing codes become standard descriptors and the columns hold their URIs.
+INSERT INTO edfi.Descriptor (DescriptorType, Namespace, CodeValue, ShortDescription)
+SELECT DISTINCT 'AttendanceEventCategory', 'uri://ed-fi.org/AttendanceEventCategoryDescriptor', AttendanceStatus, AttendanceStatus
+FROM edfi.StudentSectionAttendanceEvent WHERE AttendanceStatus NOT LIKE 'uri://%'
+ON CONFLICT DO NOTHING;
+UPDATE edfi.StudentSectionAttendanceEvent
+SET AttendanceStatus = 'uri://ed-fi.org/AttendanceEventCategoryDescriptor#' || AttendanceStatus
+WHERE AttendanceStatus NOT LIKE 'uri://%';
+
+INSERT INTO edfi.Descriptor (DescriptorType, Namespace, CodeValue, ShortDescription)
+SELECT DISTINCT 'ProgramType', 'uri://ed-fi.org/ProgramTypeDescriptor', ProgramType, ProgramType
+FROM Program WHERE ProgramType NOT LIKE 'uri://%'
+ON CONFLICT DO NOTHING;
+UPDATE Program
+SET ProgramType = 'uri://ed-fi.org/ProgramTypeDescriptor#' || ProgramType
+WHERE ProgramType NOT LIKE 'uri://%';
+
+ALTER TABLE edfi.StudentSectionAttendanceEvent DROP CONSTRAINT IF EXISTS fk_StudentSectionAttendanceEvent_AttendanceStatus;
+ALTER TABLE edfi.StudentSectionAttendanceEvent ADD CONSTRAINT fk_StudentSectionAttendanceEvent_AttendanceStatus
+    FOREIGN KEY (AttendanceStatus) REFERENCES edfi.Descriptor (Uri);
+ALTER TABLE Program DROP CONSTRAINT IF EXISTS fk_Program_ProgramType;
+ALTER TABLE Program ADD CONSTRAINT fk_Program_ProgramType
+    FOREIGN KEY (ProgramType) REFERENCES edfi.Descriptor (Uri);
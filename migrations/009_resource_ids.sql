@@ -0,0 +1,116 @@
+-- =============================================================================
+-- Common Plugin: Resource Ids
+-- Version: 009
+-- Description: A stable UUID "Id" on every table served by the generated
+--              common-plugin repositories. Resources are addressed by Id in
+--              URLs, so a natural key (which may span several columns) can
+--              be changed with PUT and is reported through /keyChanges.
+--              Audit history and tracked changes are keyed by Id from here
+--              on; entries written before this migration keep the natural
+--              key they were recorded under.
+-- =============================================================================
+
+ALTER TABLE edfi.Student ADD COLUMN IF NOT EXISTS Id UUID NOT NULL DEFAULT gen_random_uuid();
+ALTER TABLE edfi.Staff ADD COLUMN IF NOT EXISTS Id UUID NOT NULL DEFAULT gen_random_uuid();
+ALTER TABLE edfi.School ADD COLUMN IF NOT EXISTS Id UUID NOT NULL DEFAULT gen_random_uuid();
+ALTER TABLE edfi.Course ADD COLUMN IF NOT EXISTS Id UUID NOT NULL DEFAULT gen_random_uuid();
+ALTER TABLE edfi.Section ADD COLUMN IF NOT EXISTS Id UUID NOT NULL DEFAULT gen_random_uuid();
+ALTER TABLE edfi.StudentSectionAssociation ADD COLUMN IF NOT EXISTS Id UUID NOT NULL DEFAULT gen_random_uuid();
+ALTER TABLE edfi.StudentSectionAttendanceEvent ADD COLUMN IF NOT EXISTS Id UUID NOT NULL DEFAULT gen_random_uuid();
+ALTER TABLE Calendar ADD COLUMN IF NOT EXISTS Id UUID NOT NULL DEFAULT gen_random_uuid();
+ALTER TABLE Program ADD COLUMN IF NOT EXISTS Id UUID NOT NULL DEFAULT gen_random_uuid();
+ALTER TABLE Assessment ADD COLUMN IF NOT EXISTS Id UUID NOT NULL DEFAULT gen_random_uuid();
+
+CREATE UNIQUE INDEX IF NOT EXISTS ux_student_id ON edfi.Student (Id);
+CREATE UNIQUE INDEX IF NOT EXISTS ux_staff_id ON edfi.Staff (Id);
+CREATE UNIQUE INDEX IF NOT EXISTS ux_school_id ON edfi.School (Id);
+CREATE UNIQUE INDEX IF NOT EXISTS ux_course_id ON edfi.Course (Id);
+CREATE UNIQUE INDEX IF NOT EXISTS ux_section_id ON edfi.Section (Id);
+CREATE UNIQUE INDEX IF NOT EXISTS ux_studentsectionassociation_id ON edfi.StudentSectionAssociation (Id);
+CREATE UNIQUE INDEX IF NOT EXISTS ux_studentsectionattendanceevent_id ON edfi.StudentSectionAttendanceEvent (Id);
+CREATE UNIQUE INDEX IF NOT EXISTS ux_calendar_id ON Calendar (Id);
+CREATE UNIQUE INDEX IF NOT EXISTS ux_program_id ON Program (Id);
+CREATE UNIQUE INDEX IF NOT EXISTS ux_assessment_id ON Assessment (Id);
+
+-- Attendance events were keyed by section alone; an event is one student's
+-- attendance in a section on a date.
+CREATE UNIQUE INDEX IF NOT EXISTS ux_studentsectionattendanceevent_key
+    ON edfi.StudentSectionAttendanceEvent (CourseSectionIdentifier, StudentUniqueId, AttendanceEventDate);
+
+-- changes.track(id_column, key_column, ...) now takes the column the
+-- resource is addressed by first, followed by the natural key columns.
+CREATE OR REPLACE FUNCTION changes.track() RETURNS trigger AS $$
+DECLARE
+    key_columns TEXT[] := TG_ARGV[1:];
+    old_row  JSONB;
+    new_row  JSONB;
+    old_keys JSONB;
+    new_keys JSONB;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        old_row := to_jsonb(OLD);
+        INSERT INTO changes.TrackedChange (ChangeVersion, TableName, ResourceKey, Operation, OldKeyValues)
+        VALUES (nextval('changes.ChangeVersionSequence'), TG_RELID::regclass::text,
+                old_row ->> TG_ARGV[0], 'DELETE', changes.key_values(old_row, key_columns));
+        RETURN OLD;
+    END IF;
+
+    NEW.ChangeVersion := nextval('changes.ChangeVersionSequence');
+    IF TG_OP = 'UPDATE' THEN
+        old_row := to_jsonb(OLD);
+        new_row := to_jsonb(NEW);
+        old_keys := changes.key_values(old_row, key_columns);
+        new_keys := changes.key_values(new_row, key_columns);
+        IF old_keys IS DISTINCT FROM new_keys THEN
+            INSERT INTO changes.TrackedChange (ChangeVersion, TableName, ResourceKey, Operation, OldKeyValues, NewKeyValues)
+            VALUES (NEW.ChangeVersion, TG_RELID::regclass::text, new_row ->> TG_ARGV[0], 'KEY_CHANGE', old_keys, new_keys);
+        ELSIF old_row -> 'deletedat' = 'null' AND new_row -> 'deletedat' <> 'null' THEN
+            INSERT INTO changes.TrackedChange (ChangeVersion, TableName, ResourceKey, Operation, OldKeyValues)
+            VALUES (NEW.ChangeVersion, TG_RELID::regclass::text, old_row ->> TG_ARGV[0], 'DELETE', old_keys);
+        END IF;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE TRIGGER audit_changes AFTER INSERT OR UPDATE OR DELETE ON edfi.Student
+    FOR EACH ROW EXECUTE FUNCTION audit.capture('id');
+CREATE OR REPLACE TRIGGER audit_changes AFTER INSERT OR UPDATE OR DELETE ON edfi.Staff
+    FOR EACH ROW EXECUTE FUNCTION audit.capture('id');
+CREATE OR REPLACE TRIGGER audit_changes AFTER INSERT OR UPDATE OR DELETE ON edfi.School
+    FOR EACH ROW EXECUTE FUNCTION audit.capture('id');
+CREATE OR REPLACE TRIGGER audit_changes AFTER INSERT OR UPDATE OR DELETE ON edfi.Course
+    FOR EACH ROW EXECUTE FUNCTION audit.capture('id');
+CREATE OR REPLACE TRIGGER audit_changes AFTER INSERT OR UPDATE OR DELETE ON edfi.Section
+    FOR EACH ROW EXECUTE FUNCTION audit.capture('id');
+CREATE OR REPLACE TRIGGER audit_changes AFTER INSERT OR UPDATE OR DELETE ON edfi.StudentSectionAssociation
+    FOR EACH ROW EXECUTE FUNCTION audit.capture('id');
+CREATE OR REPLACE TRIGGER audit_changes AFTER INSERT OR UPDATE OR DELETE ON edfi.StudentSectionAttendanceEvent
+    FOR EACH ROW EXECUTE FUNCTION audit.capture('id');
+CREATE OR REPLACE TRIGGER audit_changes AFTER INSERT OR UPDATE OR DELETE ON Calendar
+    FOR EACH ROW EXECUTE FUNCTION audit.capture('id');
+CREATE OR REPLACE TRIGGER audit_changes AFTER INSERT OR UPDATE OR DELETE ON Program
+    FOR EACH ROW EXECUTE FUNCTION audit.capture('id');
+CREATE OR REPLACE TRIGGER audit_changes AFTER INSERT OR UPDATE OR DELETE ON Assessment
+    FOR EACH ROW EXECUTE FUNCTION audit.capture('id');
+
+CREATE OR REPLACE TRIGGER track_changes BEFORE INSERT OR UPDATE OR DELETE ON edfi.Student
+    FOR EACH ROW EXECUTE FUNCTION changes.track('id', 'studentuniqueid');
+CREATE OR REPLACE TRIGGER track_changes BEFORE INSERT OR UPDATE OR DELETE ON edfi.Staff
+    FOR EACH ROW EXECUTE FUNCTION changes.track('id', 'staffuniqueid');
+CREATE OR REPLACE TRIGGER track_changes BEFORE INSERT OR UPDATE OR DELETE ON edfi.School
+    FOR EACH ROW EXECUTE FUNCTION changes.track('id', 'organizationidentifier');
+CREATE OR REPLACE TRIGGER track_changes BEFORE INSERT OR UPDATE OR DELETE ON edfi.Course
+    FOR EACH ROW EXECUTE FUNCTION changes.track('id', 'courseidentifier');
+CREATE OR REPLACE TRIGGER track_changes BEFORE INSERT OR UPDATE OR DELETE ON edfi.Section
+    FOR EACH ROW EXECUTE FUNCTION changes.track('id', 'coursesectionidentifier');
+CREATE OR REPLACE TRIGGER track_changes BEFORE INSERT OR UPDATE OR DELETE ON edfi.StudentSectionAssociation
+    FOR EACH ROW EXECUTE FUNCTION changes.track('id', 'coursesectionidentifier', 'studentuniqueid');
+CREATE OR REPLACE TRIGGER track_changes BEFORE INSERT OR UPDATE OR DELETE ON edfi.StudentSectionAttendanceEvent
+    FOR EACH ROW EXECUTE FUNCTION changes.track('id', 'coursesectionidentifier', 'studentuniqueid', 'attendanceeventdate');
+CREATE OR REPLACE TRIGGER track_changes BEFORE INSERT OR UPDATE OR DELETE ON Calendar
+    FOR EACH ROW EXECUTE FUNCTION changes.track('id', 'calendarcode');
+CREATE OR REPLACE TRIGGER track_changes BEFORE INSERT OR UPDATE OR DELETE ON Program
+    FOR EACH ROW EXECUTE FUNCTION changes.track('id', 'programname');
+CREATE OR REPLACE TRIGGER track_changes BEFORE INSERT OR UPDATE OR DELETE ON Assessment
+    FOR EACH ROW EXECUTE FUNCTION changes.track('id', 'assessmentidentifier');
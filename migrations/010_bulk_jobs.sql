@@ -0,0 +1,26 @@
+-- =============================================================================
+-- Common Plugin: Bulk Jobs
+-- Version: 010
+-- Description: Async bulk upsert jobs. POST /ed-fi/{resource}/bulk?async=true
+--              records a job here and writes the records in the background;
+--              clients poll /bulk/v1/jobs/{id} for the per-record results.
+-- =============================================================================
+
+CREATE SCHEMA IF NOT EXISTS bulk;
+
+CREATE TABLE IF NOT EXISTS bulk.Job (
+    Id                          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    Resource                    TEXT NOT NULL,
+    Status                      TEXT NOT NULL,
+    Total                       INTEGER NOT NULL,
+    Succeeded                   INTEGER NOT NULL DEFAULT 0,
+    Failed                      INTEGER NOT NULL DEFAULT 0,
+    Results                     JSONB,
+    Error                       TEXT,
+    CreatedBy                   TEXT NOT NULL DEFAULT '',
+    CreatedAt                   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CompletedAt                 TIMESTAMPTZ,
+    CONSTRAINT chk_Job_Status CHECK (Status IN ('running', 'completed', 'failed'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_running ON bulk.Job (Status) WHERE Status = 'running';
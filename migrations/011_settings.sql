@@ -0,0 +1,23 @@
+-- =============================================================================
+-- Host: System Settings
+-- Version: 011
+-- Description: Values an administrator has set for the settings sections the
+--              host and plugins declare, one row per setting. Settings left
+--              at their declared default have no row. Changes are recorded in
+--              audit.ChangeLog with the actor and request ID the host sets on
+--              its transaction.
+-- =============================================================================
+
+CREATE SCHEMA IF NOT EXISTS oasis;
+
+CREATE TABLE IF NOT EXISTS oasis.Setting (
+    Section                     TEXT NOT NULL,
+    Key                         TEXT NOT NULL,
+    Value                       JSONB NOT NULL,
+    UpdatedBy                   TEXT NOT NULL DEFAULT '',
+    UpdatedAt                   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (Section, Key)
+);
+
+CREATE OR REPLACE TRIGGER audit_changes AFTER INSERT OR UPDATE OR DELETE ON oasis.Setting
+    FOR EACH ROW EXECUTE FUNCTION audit.capture('section', 'key');
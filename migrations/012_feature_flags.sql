@@ -0,0 +1,45 @@
+-- =============================================================================
+-- Host: Feature Flags
+-- Version: 012
+-- Description: Feature flags for gradual rollouts, on for everyone or for the
+--              users, roles and education organizations they target. Changes
+--              to a flag are recorded in audit.ChangeLog; every evaluation a
+--              plugin asks the host for is recorded in audit.FlagEvaluation,
+--              which is append-only like the change log.
+-- =============================================================================
+
+CREATE TABLE IF NOT EXISTS oasis.FeatureFlag (
+    Key                         TEXT NOT NULL PRIMARY KEY,
+    Description                 TEXT NOT NULL DEFAULT '',
+    Enabled                     BOOLEAN NOT NULL DEFAULT false,
+    Users                       TEXT[] NOT NULL DEFAULT '{}',
+    Roles                       TEXT[] NOT NULL DEFAULT '{}',
+    EdOrgs                      TEXT[] NOT NULL DEFAULT '{}',
+    UpdatedBy                   TEXT NOT NULL DEFAULT '',
+    UpdatedAt                   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE OR REPLACE TRIGGER audit_changes AFTER INSERT OR UPDATE OR DELETE ON oasis.FeatureFlag
+    FOR EACH ROW EXECUTE FUNCTION audit.capture('key');
+
+CREATE TABLE IF NOT EXISTS audit.FlagEvaluation (
+    EvaluationId                BIGSERIAL PRIMARY KEY,
+    Flag                        TEXT NOT NULL,
+    Enabled                     BOOLEAN NOT NULL,
+    Reason                      TEXT NOT NULL,
+    UserId                      TEXT,
+    Roles                       TEXT[] NOT NULL DEFAULT '{}',
+    EdOrgs                      TEXT[] NOT NULL DEFAULT '{}',
+    Plugin                      TEXT NOT NULL,
+    RequestId                   TEXT,
+    EvaluatedAt                 TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_flagevaluation_flag ON audit.FlagEvaluation (Flag, EvaluationId);
+
+CREATE OR REPLACE TRIGGER flagevaluation_immutable
+    BEFORE UPDATE OR DELETE ON audit.FlagEvaluation
+    FOR EACH ROW EXECUTE FUNCTION audit.reject_change();
+CREATE OR REPLACE TRIGGER flagevaluation_no_truncate
+    BEFORE TRUNCATE ON audit.FlagEvaluation
+    FOR EACH STATEMENT EXECUTE FUNCTION audit.reject_change();
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/catdevman/oasis/shared"
+)
+
+// flagsPage is what flags.html renders: every feature flag as a form, a
+// form for a new one, and the outcome of the last change.
+type flagsPage struct {
+	Flags  []flagForm
+	New    flagForm
+	Notice string // what the last change did
+	Error  string // why the last change failed, other than invalid fields
+}
+
+// flagForm is one feature flag as a form, its targets separated by commas.
+type flagForm struct {
+	Key         string
+	Description string
+	Enabled     bool
+	Users       string
+	Roles       string
+	EdOrgs      string
+	UpdatedBy   string
+	UpdatedAt   time.Time
+	Errors      map[string]string // by field, as the API names them
+}
+
+func newFlagForm(f shared.FeatureFlag) flagForm {
+	return flagForm{
+		Key:         f.Key,
+		Description: f.Description,
+		Enabled:     f.Enabled,
+		Users:       strings.Join(f.Users, ", "),
+		Roles:       strings.Join(f.Roles, ", "),
+		EdOrgs:      strings.Join(f.EdOrgs, ", "),
+		UpdatedBy:   f.UpdatedBy,
+		UpdatedAt:   f.UpdatedAt,
+	}
+}
+
+// formFlag reads the flag key from a submitted form. An unchecked box is
+// off, and a target list is entries separated by commas.
+func formFlag(key string, form url.Values) shared.FeatureFlag {
+	list := func(name string) []string {
+		entries := []string{}
+		for _, entry := range strings.Split(form.Get(name), ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				entries = append(entries, entry)
+			}
+		}
+		return entries
+	}
+	return shared.FeatureFlag{
+		Key:         key,
+		Description: strings.TrimSpace(form.Get("description")),
+		Enabled:     form.Get("enabled") == "true",
+		Users:       list("users"),
+		Roles:       list("roles"),
+		EdOrgs:      list("ed_orgs"),
+	}
+}
+
+func (p *AdminUI) handleFlags(w http.ResponseWriter, r *http.Request) {
+	p.renderFlags(w, r, flagsPage{})
+}
+
+// renderFlags renders page with the current flags. A flag in page.Flags,
+// such as one that failed to save, is shown in place of the stored one.
+func (p *AdminUI) renderFlags(w http.ResponseWriter, r *http.Request, page flagsPage) {
+	var flags []shared.FeatureFlag
+	if err := fetchAPI(r.Context(), "flags", &flags); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	shown := map[string]flagForm{}
+	for _, f := range page.Flags {
+		shown[f.Key] = f
+	}
+	page.Flags = nil
+	for _, f := range flags {
+		form, ok := shown[f.Key]
+		if !ok {
+			form = newFlagForm(f)
+		}
+		page.Flags = append(page.Flags, form)
+	}
+	p.renderTemplate(w, "flags.html", page)
+}
+
+// handleCreateFlag adds the flag in the new-flag form, refusing a key
+// that is already in use.
+func (p *AdminUI) handleCreateFlag(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	flag := formFlag(strings.TrimSpace(r.PostForm.Get("key")), r.PostForm)
+	var flags []shared.FeatureFlag
+	if err := fetchAPI(r.Context(), "flags", &flags); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, f := range flags {
+		if f.Key == flag.Key {
+			form := newFlagForm(flag)
+			form.Errors = map[string]string{"key": "is already in use"}
+			p.renderFlags(w, r, flagsPage{New: form})
+			return
+		}
+	}
+	p.saveFlag(w, r, flag, true)
+}
+
+func (p *AdminUI) handleSaveFlag(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p.saveFlag(w, r, formFlag(r.PathValue("key"), r.PostForm), false)
+}
+
+// saveFlag stores flag through the admin API, as the user who submitted
+// it, and renders the page again with the outcome; a refused flag is shown
+// as entered, with its errors.
+func (p *AdminUI) saveFlag(w http.ResponseWriter, r *http.Request, flag shared.FeatureFlag, isNew bool) {
+	problem, err := sendAPI(r, http.MethodPut, "flags/"+url.PathEscape(flag.Key), flag, nil)
+	switch {
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	case problem != nil:
+		form := newFlagForm(flag)
+		form.Errors = map[string]string{}
+		for _, e := range problem.Errors {
+			form.Errors[e.Field] = e.Message
+		}
+		page := flagsPage{Flags: []flagForm{form}}
+		if isNew {
+			page = flagsPage{New: form}
+		}
+		if len(problem.Errors) == 0 {
+			page.Error = problem.Detail
+		}
+		p.renderFlags(w, r, page)
+	default:
+		p.renderFlags(w, r, flagsPage{Notice: "Saved " + flag.Key + "."})
+	}
+}
+
+func (p *AdminUI) handleDeleteFlag(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	problem, err := sendAPI(r, http.MethodDelete, "flags/"+url.PathEscape(key), nil, nil)
+	switch {
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	case problem != nil:
+		p.renderFlags(w, r, flagsPage{Error: problem.Detail})
+	default:
+		p.renderFlags(w, r, flagsPage{Notice: "Deleted " + key + "."})
+	}
+}
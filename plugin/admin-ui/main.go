@@ -2,41 +2,60 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"embed"
 	"encoding/json"
+	"fmt"
 	"html/template"
 	"io"
 	"net/http"
-	"net/http/httptest"
 
 	"github.com/catdevman/oasis/shared"
-	"github.com/hashicorp/go-plugin"
+	"github.com/catdevman/oasis/shared/sdk"
 )
 
 //go:embed ui/*.html
 var uiTemplates embed.FS
 
-type AdminUIPlugin struct {
-	mux  *http.ServeMux
+type AdminUI struct {
 	tmpl *template.Template
 }
 
-func New() *AdminUIPlugin {
-	tmpl := template.Must(template.ParseFS(uiTemplates, "ui/*.html"))
-	
-	p := &AdminUIPlugin{
-		mux:  http.NewServeMux(),
-		tmpl: tmpl,
+func New() *sdk.Plugin {
+	p := &AdminUI{
+		tmpl: template.Must(template.ParseFS(uiTemplates, "ui/*.html")),
 	}
 
-	p.mux.HandleFunc("GET /settings", p.handleSettings)
-	p.mux.HandleFunc("GET /system-health", p.handleHealth)
-
-	return p
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /settings", p.handleSettings)
+	mux.HandleFunc("PUT /settings", p.handleSaveSettings)
+	mux.HandleFunc("GET /feature-flags", p.handleFlags)
+	mux.HandleFunc("POST /feature-flags", p.handleCreateFlag)
+	mux.HandleFunc("PUT /feature-flags/{key}", p.handleSaveFlag)
+	mux.HandleFunc("DELETE /feature-flags/{key}", p.handleDeleteFlag)
+	mux.HandleFunc("GET /system-health", p.handleHealth)
+
+	return &sdk.Plugin{
+		Handler: mux,
+		Routes: []string{
+			"/settings",
+			"/feature-flags",
+			"/system-health",
+		},
+		Menu: []shared.MenuItem{
+			{Label: "Settings", Path: "/settings", AllowedRoles: []string{"admin"}},
+			{Label: "Feature Flags", Path: "/feature-flags", AllowedRoles: []string{"admin"}},
+			{Label: "System Health", Path: "/system-health", AllowedRoles: []string{"admin"}},
+		},
+	}
 }
 
-func fetchAPI(endpoint string, result interface{}) error {
-	resp, err := http.Get("http://127.0.0.1:8080/api/admin/" + endpoint)
+func fetchAPI(ctx context.Context, endpoint string, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sdk.HostURL()+"/api/admin/"+endpoint, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := sdk.Client.Do(req)
 	if err != nil {
 		return err
 	}
@@ -50,30 +69,64 @@ func fetchAPI(endpoint string, result interface{}) error {
 	return json.Unmarshal(body, result)
 }
 
-func (p *AdminUIPlugin) renderTemplate(w http.ResponseWriter, name string, data interface{}) {
-	w.Header().Set("Content-Type", "text/html")
-	w.Write([]byte(`<div class="content-card">` + "\n"))
-	err := p.tmpl.ExecuteTemplate(w, name, data)
+// sendAPI sends body, if not nil, to the admin API endpoint with the
+// cookies of r, from which the host resolves r's identity, so the change is
+// authorized and audited as r's user, and
+// decodes the answer into result, if not nil. A refusal is returned as the
+// problem the API reported.
+func sendAPI(r *http.Request, method, endpoint string, body, result interface{}) (*shared.Problem, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(r.Context(), method, sdk.HostURL()+"/api/admin/"+endpoint, reader)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
 	}
-	w.Write([]byte("\n" + `</div>`))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for _, h := range []string{"Cookie", sdk.CSRFHeader, sdk.RequestIDHeader} {
+		if v := r.Header.Get(h); v != "" {
+			req.Header.Set(h, v)
+		}
+	}
+	resp, err := sdk.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		var problem shared.Problem
+		if err := json.NewDecoder(resp.Body).Decode(&problem); err != nil {
+			return nil, fmt.Errorf("%s %s: %s", method, endpoint, resp.Status)
+		}
+		return &problem, nil
+	}
+	if result == nil {
+		return nil, nil
+	}
+	return nil, json.NewDecoder(resp.Body).Decode(result)
 }
 
-func (p *AdminUIPlugin) handleSettings(w http.ResponseWriter, r *http.Request) {
-	var data map[string]interface{}
-	err := fetchAPI("settings", &data)
+func (p *AdminUI) renderTemplate(w http.ResponseWriter, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html")
+	w.Write([]byte(`<div class="content-card">` + "\n"))
+	err := p.tmpl.ExecuteTemplate(w, name, data)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	p.renderTemplate(w, "settings.html", data)
+	w.Write([]byte("\n" + `</div>`))
 }
 
-func (p *AdminUIPlugin) handleHealth(w http.ResponseWriter, r *http.Request) {
-	var data map[string]interface{}
-	err := fetchAPI("health", &data)
+func (p *AdminUI) handleHealth(w http.ResponseWriter, r *http.Request) {
+	var data shared.SystemHealth
+	err := fetchAPI(r.Context(), "health", &data)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -81,48 +134,6 @@ func (p *AdminUIPlugin) handleHealth(w http.ResponseWriter, r *http.Request) {
 	p.renderTemplate(w, "health.html", data)
 }
 
-func (p *AdminUIPlugin) ServeHTTP(req shared.HTTPRequest) (shared.HTTPResponse, error) {
-	r, err := http.NewRequest(req.Method, req.URL, bytes.NewReader(req.Body))
-	if err != nil {
-		return shared.HTTPResponse{}, err
-	}
-	r.Header = req.Header
-
-	w := httptest.NewRecorder()
-	p.mux.ServeHTTP(w, r)
-
-	resp := w.Result()
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return shared.HTTPResponse{}, err
-	}
-
-	return shared.HTTPResponse{
-		StatusCode: resp.StatusCode,
-		Header:     resp.Header,
-		Body:       body,
-	}, nil
-}
-
-func (p *AdminUIPlugin) GetRoutes() ([]string, error) {
-	return []string{
-		"/settings",
-		"/system-health",
-	}, nil
-}
-
-func (p *AdminUIPlugin) GetMenuItems() ([]shared.MenuItem, error) {
-	return []shared.MenuItem{
-		{Label: "Settings", Path: "/settings", AllowedRoles: []string{"admin"}},
-		{Label: "System Health", Path: "/system-health", AllowedRoles: []string{"admin"}},
-	}, nil
-}
-
 func main() {
-	plugin.Serve(&plugin.ServeConfig{
-		HandshakeConfig: shared.Handshake,
-		Plugins: map[string]plugin.Plugin{
-			"http_plugin": &shared.HTTPPluginAdapter{Impl: New()},
-		},
-	})
+	sdk.Serve(New())
 }
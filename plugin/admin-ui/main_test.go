@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/catdevman/oasis/internal/settings"
+	"github.com/catdevman/oasis/shared"
+	"github.com/catdevman/oasis/shared/plugintest"
+)
+
+func TestMenuAuthorization(t *testing.T) {
+	host := plugintest.Start(t, plugintest.Options{Name: "admin-ui-plugin", Prefix: "ui/admin"}, New)
+	if len(host.Menu) != 3 {
+		t.Fatalf("Menu = %v, want Settings, Feature Flags and System Health", host.Menu)
+	}
+	for _, role := range []string{"teacher", "student", "guardian"} {
+		for _, item := range host.Menu {
+			resp := host.As(plugintest.User{Roles: []string{role}}).Get(item.Path)
+			if resp.StatusCode != http.StatusForbidden {
+				t.Errorf("GET %s as %s = %d, want 403", item.Path, role, resp.StatusCode)
+			}
+		}
+	}
+}
+
+func TestFormSettings(t *testing.T) {
+	sections := []shared.SettingsSection{settings.System, {Name: "grades", Fields: []shared.SettingField{
+		{Key: "weighted", Type: shared.SettingBool, Default: json.RawMessage(`false`)},
+	}}}
+	form := url.Values{
+		"system.maintenance":       {"read_only"},
+		"system.maintenance_roles": {"admin, registrar,"},
+		"system.max_users":         {" 250 "},
+		"system.features":          {"grades", "discipline"},
+		"grades.weighted":          {"true"},
+	}
+	values := formSettings(sections, form)
+	want := map[string]string{
+		"system.maintenance": `"read_only"`, "system.maintenance_roles": `["admin","registrar"]`,
+		"system.max_users": `250`, "system.features": `["grades","discipline"]`, "grades.weighted": `true`,
+	}
+	for name, v := range want {
+		section, key, _ := strings.Cut(name, ".")
+		if got := string(values[section][key]); got != v {
+			t.Errorf("%s = %s, want %s", name, got, v)
+		}
+	}
+
+	// Unchecked boxes are false and empty, and an unparsed int is left for
+	// the host to reject.
+	values = formSettings(sections, url.Values{"system.max_users": {"many"}})
+	want = map[string]string{"system.max_users": `"many"`, "system.features": `[]`, "grades.weighted": `false`}
+	for name, v := range want {
+		section, key, _ := strings.Cut(name, ".")
+		if got := string(values[section][key]); got != v {
+			t.Errorf("%s = %s, want %s", name, got, v)
+		}
+	}
+
+	f := newSettingsForm(shared.SettingsDocument{Sections: sections, Values: values},
+		[]shared.FieldError{{Field: "system.max_users", Message: "must be an integer"}})
+	for _, field := range f.Sections[0].Fields {
+		if field.Key == "max_users" && (field.Value != "many" || field.Error != "must be an integer") {
+			t.Errorf("max_users field = %q, %q; want the entered value and its error", field.Value, field.Error)
+		}
+	}
+}
+
+func TestFlagsPage(t *testing.T) {
+	flag := formFlag("new-gradebook", url.Values{
+		"description": {" The redesigned gradebook "},
+		"ed_orgs":     {"255901001, ,255901044"},
+	})
+	if flag.Description != "The redesigned gradebook" || flag.Enabled || len(flag.Users) != 0 ||
+		len(flag.EdOrgs) != 2 || flag.EdOrgs[1] != "255901044" {
+		t.Errorf("formFlag = %+v, want two schools and no one else", flag)
+	}
+
+	form := newFlagForm(flag)
+	form.Errors = map[string]string{"ed_orgs": "must not contain empty entries"}
+	var out strings.Builder
+	ui := &AdminUI{tmpl: template.Must(template.ParseFS(uiTemplates, "ui/*.html"))}
+	if err := ui.tmpl.ExecuteTemplate(&out, "flags.html", flagsPage{Flags: []flagForm{form}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`hx-put="/feature-flags/new-gradebook"`, `value="255901001, 255901044"`, "Education organizations must not contain empty entries"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("flags.html lacks %s", want)
+		}
+	}
+}
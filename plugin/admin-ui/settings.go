@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/catdevman/oasis/shared"
+)
+
+// settingsForm is what settings.html renders: every section as a form,
+// with the outcome of the last save.
+type settingsForm struct {
+	Sections []sectionForm
+	Saved    bool
+	Error    string // why the save failed, other than invalid fields
+}
+
+type sectionForm struct {
+	Label  string
+	Fields []fieldForm
+}
+
+// fieldForm is one setting as a form input named Name, "section.key".
+type fieldForm struct {
+	shared.SettingField
+	Name     string
+	Value    string          // the value, or a list's items separated by commas
+	Selected map[string]bool // the items of a list setting
+	Error    string
+}
+
+func newSettingsForm(doc shared.SettingsDocument, invalid []shared.FieldError) settingsForm {
+	var form settingsForm
+	for _, sec := range doc.Sections {
+		section := sectionForm{Label: sec.Label}
+		for _, f := range sec.Fields {
+			field := fieldForm{SettingField: f, Name: sec.Name + "." + f.Key, Selected: map[string]bool{}}
+			raw := doc.Values[sec.Name][f.Key]
+			if f.Type == shared.SettingList {
+				var items []string
+				json.Unmarshal(raw, &items)
+				for _, item := range items {
+					field.Selected[item] = true
+				}
+				field.Value = strings.Join(items, ", ")
+			} else if err := json.Unmarshal(raw, &field.Value); err != nil {
+				field.Value = string(raw) // a bool or an int
+			}
+			for _, e := range invalid {
+				if e.Field == field.Name {
+					field.Error = e.Message
+				}
+			}
+			section.Fields = append(section.Fields, field)
+		}
+		form.Sections = append(form.Sections, section)
+	}
+	return form
+}
+
+// formSettings reads the values of every setting in sections from a
+// submitted form. A list is a checkbox per option, or items separated by
+// commas when it has no options; an unchecked bool is false; and an int
+// that does not parse is sent as entered for the host to reject.
+func formSettings(sections []shared.SettingsSection, form url.Values) shared.Settings {
+	values := shared.Settings{}
+	for _, sec := range sections {
+		values[sec.Name] = map[string]json.RawMessage{}
+		for _, f := range sec.Fields {
+			name := sec.Name + "." + f.Key
+			var v interface{}
+			switch f.Type {
+			case shared.SettingBool:
+				v = form.Get(name) == "true"
+			case shared.SettingInt:
+				s := strings.TrimSpace(form.Get(name))
+				if n, err := strconv.Atoi(s); err == nil {
+					v = n
+				} else {
+					v = s
+				}
+			case shared.SettingList:
+				items := form[name] // checkboxes, one per option
+				if len(f.Options) == 0 {
+					items = strings.Split(form.Get(name), ",")
+				}
+				list := []string{}
+				for _, item := range items {
+					if item = strings.TrimSpace(item); item != "" {
+						list = append(list, item)
+					}
+				}
+				v = list
+			default:
+				v = form.Get(name)
+			}
+			values[sec.Name][f.Key], _ = json.Marshal(v)
+		}
+	}
+	return values
+}
+
+func (p *AdminUI) handleSettings(w http.ResponseWriter, r *http.Request) {
+	var doc shared.SettingsDocument
+	if err := fetchAPI(r.Context(), "settings", &doc); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	p.renderTemplate(w, "settings.html", newSettingsForm(doc, nil))
+}
+
+// handleSaveSettings saves the submitted form through the admin API, as
+// the user who submitted it, and renders the form again with the outcome.
+func (p *AdminUI) handleSaveSettings(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var doc shared.SettingsDocument
+	if err := fetchAPI(r.Context(), "settings", &doc); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	submitted := formSettings(doc.Sections, r.PostForm)
+
+	var saved shared.SettingsDocument
+	problem, err := sendAPI(r, http.MethodPut, "settings", submitted, &saved)
+	switch {
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	case problem != nil:
+		// Show what was entered, so it can be corrected.
+		doc.Values = submitted
+		form := newSettingsForm(doc, problem.Errors)
+		if len(problem.Errors) == 0 {
+			form.Error = problem.Detail
+		}
+		p.renderTemplate(w, "settings.html", form)
+	default:
+		form := newSettingsForm(saved, nil)
+		form.Saved = true
+		p.renderTemplate(w, "settings.html", form)
+	}
+}
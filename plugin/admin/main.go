@@ -1,92 +1,191 @@
 package main
 
 import (
-	"bytes"
+	_ "embed"
 	"encoding/json"
-	"io"
 	"net/http"
-	"net/http/httptest"
-	"os"
 
+	oerrors "github.com/catdevman/oasis/internal/errors"
 	"github.com/catdevman/oasis/shared"
-	"github.com/hashicorp/go-plugin"
+	"github.com/catdevman/oasis/shared/sdk"
 )
 
-type AdminPlugin struct {
-	mux *http.ServeMux
-}
+//go:embed openapi.json
+var openAPI []byte
 
-func New() *AdminPlugin {
-	p := &AdminPlugin{
-		mux: http.NewServeMux(),
-	}
+func New() *sdk.Plugin {
+	mux := http.NewServeMux()
+	basePath := "/" + sdk.Prefix("api/admin")
 
-	prefix := os.Getenv("OASIS_PLUGIN_PREFIX")
-	if prefix == "" {
-		prefix = "api/admin"
-	}
-	basePath := "/" + prefix
+	mux.HandleFunc("GET "+basePath+"/health", handleHealth)
+	mux.HandleFunc("GET "+basePath+"/settings", handleSettings)
+	mux.Handle("PUT "+basePath+"/settings", sdk.RequireRole(http.HandlerFunc(handleUpdateSettings), adminRoles...))
+	mux.HandleFunc("GET "+basePath+"/flags", handleFlags)
+	mux.Handle("PUT "+basePath+"/flags/{key}", sdk.RequireRole(http.HandlerFunc(handlePutFlag), adminRoles...))
+	mux.Handle("DELETE "+basePath+"/flags/{key}", sdk.RequireRole(http.HandlerFunc(handleDeleteFlag), adminRoles...))
+
+	return &sdk.Plugin{Handler: mux, OpenAPI: openAPI}
+}
 
-	p.mux.HandleFunc("GET " + basePath + "/health", p.handleHealth)
-	p.mux.HandleFunc("GET " + basePath + "/settings", p.handleSettings)
+// adminRoles may change the system settings and feature flags.
+var adminRoles = []string{"admin", "administrator"}
 
-	return p
+// maxSettingsBody bounds the body of a settings or feature flag update.
+const maxSettingsBody = 1 << 20
+
+// connectedHost returns the host's services, or writes a 503 and returns
+// nil if the plugin is not connected to a host.
+func connectedHost(w http.ResponseWriter, r *http.Request) shared.HostServices {
+	host := sdk.Host()
+	if host == nil {
+		shared.WriteProblem(w, r, http.StatusServiceUnavailable, "HOST_UNAVAILABLE", "the plugin is not connected to a host")
+	}
+	return host
 }
 
-func (p *AdminPlugin) handleHealth(w http.ResponseWriter, r *http.Request) {
+// handleHealth reports the system health the host checks on request.
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	host := connectedHost(w, r)
+	if host == nil {
+		return
+	}
+	health, err := host.Health()
+	if err != nil {
+		shared.WriteError(w, r, oerrors.E("handleHealth", oerrors.KindPlugin, err))
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"status": "healthy",
-		"version": "1.0.0",
-		"uptime": "99.9%",
-	})
+	json.NewEncoder(w).Encode(health)
 }
 
-func (p *AdminPlugin) handleSettings(w http.ResponseWriter, r *http.Request) {
+// handleSettings returns every settings section with its current values.
+func handleSettings(w http.ResponseWriter, r *http.Request) {
+	host := connectedHost(w, r)
+	if host == nil {
+		return
+	}
+	doc, err := host.Settings()
+	if err != nil {
+		shared.WriteError(w, r, oerrors.E("handleSettings", oerrors.KindPlugin, err))
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"maintenance_mode": false,
-		"max_users": 5000,
-		"features": []string{"grades", "attendance", "discipline"},
-	})
+	json.NewEncoder(w).Encode(doc)
 }
 
-func (p *AdminPlugin) ServeHTTP(req shared.HTTPRequest) (shared.HTTPResponse, error) {
-	r, err := http.NewRequest(req.Method, req.URL, bytes.NewReader(req.Body))
+// handleUpdateSettings changes the settings in the request body, an object
+// of sections holding the keys to set, and returns them all as
+// handleSettings does. Settings not named keep their values.
+func handleUpdateSettings(w http.ResponseWriter, r *http.Request) {
+	host := connectedHost(w, r)
+	if host == nil {
+		return
+	}
+	var values shared.Settings
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSettingsBody)).Decode(&values); err != nil {
+		shared.WriteError(w, r, oerrors.New("handleUpdateSettings", oerrors.KindInvalid, "", "the body must be a JSON object of settings sections"))
+		return
+	}
+	id := sdk.IdentityFrom(r)
+	invalid, err := host.UpdateSettings(shared.SettingsUpdate{Values: values, Actor: id.Name(), RequestID: id.RequestID})
 	if err != nil {
-		return shared.HTTPResponse{}, err
+		shared.WriteError(w, r, oerrors.E("handleUpdateSettings", oerrors.KindPlugin, err))
+		return
 	}
-	r.Header = req.Header
-
-	w := httptest.NewRecorder()
-	p.mux.ServeHTTP(w, r)
+	if len(invalid) > 0 {
+		e := oerrors.New("handleUpdateSettings", oerrors.KindInvalid, "", "settings failed validation")
+		e.Fields = invalid
+		shared.WriteError(w, r, e)
+		return
+	}
+	handleSettings(w, r)
+}
 
-	resp := w.Result()
-	body, err := io.ReadAll(resp.Body)
+// handleFlags returns every feature flag.
+func handleFlags(w http.ResponseWriter, r *http.Request) {
+	host := connectedHost(w, r)
+	if host == nil {
+		return
+	}
+	flags, err := host.Flags()
 	if err != nil {
-		return shared.HTTPResponse{}, err
+		shared.WriteError(w, r, oerrors.E("handleFlags", oerrors.KindPlugin, err))
+		return
+	}
+	if flags == nil {
+		flags = []shared.FeatureFlag{}
 	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(flags)
+}
 
-	return shared.HTTPResponse{
-		StatusCode: resp.StatusCode,
-		Header:     resp.Header,
-		Body:       body,
-	}, nil
+// handlePutFlag creates or replaces the feature flag named in the path
+// with the one in the request body, and returns it as stored.
+func handlePutFlag(w http.ResponseWriter, r *http.Request) {
+	host := connectedHost(w, r)
+	if host == nil {
+		return
+	}
+	var flag shared.FeatureFlag
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSettingsBody)).Decode(&flag); err != nil {
+		shared.WriteError(w, r, oerrors.New("handlePutFlag", oerrors.KindInvalid, "", "the body must be a JSON feature flag"))
+		return
+	}
+	key := r.PathValue("key")
+	if flag.Key != "" && flag.Key != key {
+		shared.WriteError(w, r, oerrors.New("handlePutFlag", oerrors.KindInvalid, "", "the body's key differs from the path's"))
+		return
+	}
+	flag.Key = key
+	if !updateFlag(w, r, host, shared.FlagUpdate{Flag: flag}) {
+		return
+	}
+	flags, err := host.Flags()
+	if err != nil {
+		shared.WriteError(w, r, oerrors.E("handlePutFlag", oerrors.KindPlugin, err))
+		return
+	}
+	for _, f := range flags {
+		if f.Key == key {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(f)
+			return
+		}
+	}
+	shared.WriteError(w, r, oerrors.New("handlePutFlag", oerrors.KindConflict, "", "the feature flag was deleted as it was stored"))
 }
 
-func (p *AdminPlugin) GetRoutes() ([]string, error) {
-	return []string{}, nil
+// handleDeleteFlag deletes the feature flag named in the path, if it
+// exists.
+func handleDeleteFlag(w http.ResponseWriter, r *http.Request) {
+	host := connectedHost(w, r)
+	if host == nil {
+		return
+	}
+	if updateFlag(w, r, host, shared.FlagUpdate{Flag: shared.FeatureFlag{Key: r.PathValue("key")}, Delete: true}) {
+		w.WriteHeader(http.StatusNoContent)
+	}
 }
 
-func (p *AdminPlugin) GetMenuItems() ([]shared.MenuItem, error) {
-	return nil, nil
+// updateFlag sends u to the host as r's caller, writing the error if it
+// is refused, and reports whether it was stored.
+func updateFlag(w http.ResponseWriter, r *http.Request, host shared.HostServices, u shared.FlagUpdate) bool {
+	id := sdk.IdentityFrom(r)
+	u.Actor, u.RequestID = id.Name(), id.RequestID
+	invalid, err := host.UpdateFlag(u)
+	if err != nil {
+		shared.WriteError(w, r, oerrors.E("updateFlag", oerrors.KindPlugin, err))
+		return false
+	}
+	if len(invalid) > 0 {
+		e := oerrors.New("updateFlag", oerrors.KindInvalid, "", "the feature flag failed validation")
+		e.Fields = invalid
+		shared.WriteError(w, r, e)
+		return false
+	}
+	return true
 }
 
 func main() {
-	plugin.Serve(&plugin.ServeConfig{
-		HandshakeConfig: shared.Handshake,
-		Plugins: map[string]plugin.Plugin{
-			"http_plugin": &shared.HTTPPluginAdapter{Impl: New()},
-		},
-	})
+	sdk.Serve(New())
 }
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/catdevman/oasis/internal/flags"
+	"github.com/catdevman/oasis/internal/settings"
+	"github.com/catdevman/oasis/shared"
+	"github.com/catdevman/oasis/shared/plugintest"
+)
+
+// stubHost reports a fixed health and validates settings updates against
+// the system section, recording the last valid one instead of storing it.
+// It keeps feature flags in memory.
+type stubHost struct {
+	health  shared.SystemHealth
+	updated *shared.SettingsUpdate
+	flags   map[string]shared.FeatureFlag
+}
+
+var systemSettings = settings.New(settings.System)
+
+func (h stubHost) Health() (shared.SystemHealth, error) { return h.health, nil }
+
+func (h stubHost) Settings() (shared.SettingsDocument, error) { return systemSettings.Document(), nil }
+
+func (h stubHost) UpdateSettings(u shared.SettingsUpdate) ([]shared.FieldError, error) {
+	if invalid := systemSettings.Validate(u.Values); len(invalid) > 0 {
+		return invalid, nil
+	}
+	*h.updated = u
+	return nil, nil
+}
+
+func (h stubHost) Flags() ([]shared.FeatureFlag, error) {
+	var list []shared.FeatureFlag
+	for _, key := range slices.Sorted(maps.Keys(h.flags)) {
+		list = append(list, h.flags[key])
+	}
+	return list, nil
+}
+
+func (h stubHost) UpdateFlag(u shared.FlagUpdate) ([]shared.FieldError, error) {
+	if u.Delete {
+		delete(h.flags, u.Flag.Key)
+		return nil, nil
+	}
+	if invalid := flags.Validate(u.Flag); len(invalid) > 0 {
+		return invalid, nil
+	}
+	u.Flag.UpdatedBy = u.Actor
+	h.flags[u.Flag.Key] = u.Flag
+	return nil, nil
+}
+
+func (h stubHost) EvaluateFlag(e shared.FlagEvaluation) (shared.FlagResult, error) {
+	return h.flags[e.Key].Evaluate(e.Subject), nil
+}
+
+func TestRoutes(t *testing.T) {
+	host := plugintest.Start(t, plugintest.Options{Name: "admin-plugin", Prefix: "api/admin", Host: stubHost{}}, New)
+	admin := host.As(plugintest.User{Roles: []string{"admin"}})
+
+	for _, path := range []string{"/api/admin/health", "/api/admin/settings"} {
+		resp := admin.Get(path)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s = %d, want 200", path, resp.StatusCode)
+		}
+		var body map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Errorf("GET %s: decoding body: %v", path, err)
+		}
+	}
+	if resp := admin.Post("/api/admin/health", "application/json", nil); resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST /api/admin/health = %d, want 405", resp.StatusCode)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	want := shared.SystemHealth{
+		Status:   shared.StatusDegraded,
+		Plugins:  []shared.PluginHealth{{Name: "common-plugin", State: "exited", Restarts: 2}},
+		Database: shared.DatabaseHealth{Connected: true, Migration: "010_bulk_jobs.sql"},
+	}
+	host := plugintest.Start(t, plugintest.Options{Prefix: "api/admin", Host: stubHost{health: want}}, New)
+	resp := host.As(plugintest.User{Roles: []string{"admin"}}).Get("/api/admin/health")
+	var got shared.SystemHealth
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != want.Status || len(got.Plugins) != 1 || got.Plugins[0] != want.Plugins[0] || got.Database != want.Database {
+		t.Errorf("health = %+v, want the host's %+v", got, want)
+	}
+}
+
+func TestUpdateSettings(t *testing.T) {
+	var updated shared.SettingsUpdate
+	host := plugintest.Start(t, plugintest.Options{Prefix: "api/admin", Host: stubHost{updated: &updated}}, New)
+	admin := host.As(plugintest.User{ID: "u-1", Roles: []string{"admin"}})
+
+	resp := admin.Do(http.MethodPut, "/api/admin/settings", "application/json", []byte(`{"system":{"max_users":0,"theme":"dark"}}`))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("PUT invalid settings = %d, want 400", resp.StatusCode)
+	}
+	var problem shared.Problem
+	if err := json.NewDecoder(resp.Body).Decode(&problem); err != nil {
+		t.Fatal(err)
+	}
+	if len(problem.Errors) != 2 || problem.Errors[0].Field != "system.max_users" || problem.Errors[1].Field != "system.theme" {
+		t.Errorf("errors = %+v, want system.max_users and system.theme", problem.Errors)
+	}
+
+	resp = admin.Do(http.MethodPut, "/api/admin/settings", "application/json", []byte(`{"system":{"maintenance":"read_only"}}`))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT settings = %d, want 200", resp.StatusCode)
+	}
+	if updated.Actor != "u-1" || string(updated.Values["system"]["maintenance"]) != `"read_only"` {
+		t.Errorf("update = %+v, want maintenance mode set by u-1", updated)
+	}
+
+	teacher := host.As(plugintest.User{ID: "u-2", Roles: []string{"teacher"}})
+	if resp := teacher.Do(http.MethodPut, "/api/admin/settings", "application/json", []byte(`{}`)); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("PUT settings as a teacher = %d, want 403", resp.StatusCode)
+	}
+}
+
+func TestFlags(t *testing.T) {
+	host := plugintest.Start(t, plugintest.Options{Prefix: "api/admin", Host: stubHost{flags: map[string]shared.FeatureFlag{}}}, New)
+	admin := host.As(plugintest.User{ID: "u-1", Roles: []string{"admin"}})
+
+	resp := admin.Do(http.MethodPut, "/api/admin/flags/new-gradebook", "application/json",
+		[]byte(`{"description":"The redesigned gradebook","ed_orgs":["255901001"]}`))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT flag = %d, want 200", resp.StatusCode)
+	}
+	var flag shared.FeatureFlag
+	if err := json.NewDecoder(resp.Body).Decode(&flag); err != nil {
+		t.Fatal(err)
+	}
+	if flag.Key != "new-gradebook" || flag.UpdatedBy != "u-1" || len(flag.EdOrgs) != 1 {
+		t.Errorf("stored flag = %+v, want new-gradebook for one school, by u-1", flag)
+	}
+
+	resp = admin.Do(http.MethodPut, "/api/admin/flags/New%20Gradebook", "application/json", []byte(`{"roles":[""]}`))
+	var problem shared.Problem
+	json.NewDecoder(resp.Body).Decode(&problem)
+	if resp.StatusCode != http.StatusBadRequest || len(problem.Errors) != 2 {
+		t.Errorf("PUT invalid flag = %d %+v, want 400 naming the key and roles", resp.StatusCode, problem.Errors)
+	}
+
+	teacher := host.As(plugintest.User{ID: "u-2", Roles: []string{"teacher"}})
+	if resp := teacher.Do(http.MethodDelete, "/api/admin/flags/new-gradebook", "", nil); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("DELETE flag as a teacher = %d, want 403", resp.StatusCode)
+	}
+	if resp := admin.Do(http.MethodDelete, "/api/admin/flags/new-gradebook", "", nil); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("DELETE flag = %d, want 204", resp.StatusCode)
+	}
+	var list []shared.FeatureFlag
+	if err := json.NewDecoder(admin.Get("/api/admin/flags").Body).Decode(&list); err != nil || len(list) != 0 {
+		t.Errorf("flags after delete = %v, %v; want none", list, err)
+	}
+}
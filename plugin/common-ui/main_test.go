@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/catdevman/oasis/shared"
+	"github.com/catdevman/oasis/shared/plugintest"
+)
+
+func TestMenuAuthorization(t *testing.T) {
+	host := plugintest.Start(t, plugintest.Options{Name: "common-ui-plugin"}, New)
+
+	tests := []struct {
+		role   string
+		path   string
+		status int
+	}{
+		{"guardian", "/overview", http.StatusOK},
+		{"student", "/overview", http.StatusOK},
+		{"guardian", "/students", http.StatusForbidden},
+		{"teacher", "/schools", http.StatusForbidden},
+		{"student", "/sections", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		resp := host.As(plugintest.User{Roles: []string{tt.role}}).Get(tt.path)
+		if resp.StatusCode != tt.status {
+			t.Errorf("GET %s as %s = %d, want %d", tt.path, tt.role, resp.StatusCode, tt.status)
+		}
+	}
+
+	resp := host.As(plugintest.User{Roles: []string{"teacher"}}).Get("/overview")
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "Welcome to Oasis") {
+		t.Errorf("GET /overview body = %q, want the welcome card", body)
+	}
+	for _, route := range host.Routes {
+		found := false
+		for _, item := range host.Menu {
+			found = found || item.Path == route
+		}
+		if !found {
+			t.Errorf("route %s has no menu item", route)
+		}
+	}
+}
+
+func TestListPages(t *testing.T) {
+	api := http.NewServeMux()
+	api.HandleFunc("GET /api/common/ed-fi/staffs", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("offset"); got != "10" {
+			t.Errorf("staffs requested from offset %s, want 10", got)
+		}
+		w.Header().Set("Total-Count", "30")
+		io.WriteString(w, `[{"staffuniqueid":"S-11","firstname":"Ada"}]`)
+	})
+	api.HandleFunc("GET /api/common/ed-fi/sections", func(w http.ResponseWriter, r *http.Request) {
+		shared.WriteProblem(w, r, http.StatusForbidden, "FORBIDDEN", "your role may not read sections")
+	})
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	t.Setenv("OASIS_HOST_URL", srv.URL)
+
+	host := plugintest.Start(t, plugintest.Options{Name: "common-ui-plugin"}, New)
+	admin := host.As(plugintest.User{Roles: []string{"admin"}})
+
+	body, _ := io.ReadAll(admin.Get("/staff?page=2").Body)
+	for _, want := range []string{"S-11", "/staff?page=3&amp;pageSize=10"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("GET /staff?page=2 body lacks %q:\n%s", want, body)
+		}
+	}
+
+	body, _ = io.ReadAll(admin.Get("/sections").Body)
+	if !strings.Contains(string(body), "your role may not read sections") || strings.Contains(string(body), "No sections found") {
+		t.Errorf("GET /sections body = %s, want the API's problem", body)
+	}
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"embed"
+	"errors"
 	"fmt"
 	"html/template"
 	"net/http"
@@ -10,6 +12,7 @@ import (
 	"strconv"
 
 	"github.com/catdevman/oasis/shared"
+	"github.com/catdevman/oasis/shared/sdk"
 )
 
 //go:embed ui/*.html
@@ -52,19 +55,43 @@ func (h *UIHandler) handleOverview(w http.ResponseWriter, r *http.Request) {
 	`))
 }
 
-func fetchAPI(endpoint string, result interface{}) error {
-	resp, err := http.Get("http://127.0.0.1:8080/api/common/ed-fi/" + endpoint)
+// apiError is a refusal from the API, reported as the problem it answered
+// with.
+type apiError struct {
+	problem shared.Problem
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.problem.Status, e.problem.Code, e.problem.Detail)
+}
+
+// fetchAPI decodes the answer of a common API endpoint into result and
+// returns its headers, such as the Total-Count returned when totalCount=true
+// is requested. An error status is returned as an *apiError.
+func fetchAPI(ctx context.Context, endpoint string, result interface{}) (http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sdk.HostURL()+"/api/common/ed-fi/"+endpoint, nil)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	resp, err := sdk.Client.Do(req)
+	if err != nil {
+		return nil, err
 	}
 	defer resp.Body.Close()
-	
+
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		var problem shared.Problem
+		if err := json.Unmarshal(body, &problem); err != nil {
+			return nil, fmt.Errorf("%s: %s", endpoint, resp.Status)
+		}
+		return nil, &apiError{problem: problem}
 	}
-	
-	return json.Unmarshal(body, result)
+
+	return resp.Header, json.Unmarshal(body, result)
 }
 
 func (h *UIHandler) renderTemplate(w http.ResponseWriter, name string, data interface{}) {
@@ -78,60 +105,63 @@ func (h *UIHandler) renderTemplate(w http.ResponseWriter, name string, data inte
 	w.Write([]byte("\n" + `</div>`))
 }
 
-func (h *UIHandler) handleStudents(w http.ResponseWriter, r *http.Request) {
+// renderList renders one page of a list endpoint with template name,
+// paging by the page and pageSize parameters of r with the Total-Count the
+// endpoint reports.
+func (h *UIHandler) renderList(w http.ResponseWriter, r *http.Request, endpoint, name string) {
 	page := 1
 	if p := r.URL.Query().Get("page"); p != "" {
 		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
 			page = parsed
 		}
 	}
-	limit := 10
+	limit := shared.PageSizes[0]
+	if s := r.URL.Query().Get("pageSize"); s != "" {
+		if parsed, err := strconv.Atoi(s); err == nil && parsed > 0 && parsed <= 100 {
+			limit = parsed
+		}
+	}
 	offset := (page - 1) * limit
 
 	var items []map[string]interface{}
-	endpoint := fmt.Sprintf("students?limit=%d&offset=%d", limit+1, offset)
-	err := fetchAPI(endpoint, &items)
+	header, err := fetchAPI(r.Context(), fmt.Sprintf("%s?limit=%d&offset=%d&totalCount=true", endpoint, limit, offset), &items)
+	var refused *apiError
+	if errors.As(err, &refused) {
+		h.renderTemplate(w, "error.html", refused.problem)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	total, err := strconv.Atoi(header.Get("Total-Count"))
+	if err != nil {
+		http.Error(w, endpoint+" API did not return Total-Count", http.StatusBadGateway)
+		return
+	}
 
-	pagination := shared.NewPagination("/students", page, limit, &items)
+	pagination := shared.NewPaginationWithTotal(r.URL.Path, page, limit, total)
 
 	data := PaginatedData{
 		Items:      items,
 		Pagination: pagination.Render(),
 	}
 
-	h.renderTemplate(w, "students.html", data)
+	h.renderTemplate(w, name, data)
+}
+
+func (h *UIHandler) handleStudents(w http.ResponseWriter, r *http.Request) {
+	h.renderList(w, r, "students", "students.html")
 }
 
 func (h *UIHandler) handleStaff(w http.ResponseWriter, r *http.Request) {
-	var items []map[string]interface{}
-	err := fetchAPI("staffs", &items)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	h.renderTemplate(w, "staff.html", items)
+	h.renderList(w, r, "staffs", "staff.html")
 }
 
 func (h *UIHandler) handleSchools(w http.ResponseWriter, r *http.Request) {
-	var items []map[string]interface{}
-	err := fetchAPI("education-organizations", &items)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	h.renderTemplate(w, "schools.html", items)
+	h.renderList(w, r, "education-organizations", "schools.html")
 }
 
 func (h *UIHandler) handleSections(w http.ResponseWriter, r *http.Request) {
-	var items []map[string]interface{}
-	err := fetchAPI("sections", &items)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	h.renderTemplate(w, "sections.html", items)
+	h.renderList(w, r, "sections", "sections.html")
 }
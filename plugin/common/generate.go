@@ -4,38 +4,249 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"go/format"
 	"log"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"text/template"
+
+	"github.com/catdevman/oasis/plugin/common/internal/descriptor"
+)
+
+// Column describes one column of a generated resource. Type is one of
+// "string", "integer" or "date" and drives both the Go field type and the
+// request body validation. Filter whitelists the column as a list filter.
+// Descriptor names the Ed-Fi descriptor type whose URIs the column holds;
+// writes are rejected unless the URI names a known descriptor of that type.
+// Key marks the columns of the natural key, which must be Required and are
+// the default list order. Every row is addressed by its UUID "id" instead.
+type Column struct {
+	Name       string
+	Type       string
+	Required   bool
+	Filter     bool
+	Key        bool
+	Descriptor string
+}
+
+// Ref declares a reference to another domain's resource, which clients can
+// embed with expand=Name. Cols are this domain's columns holding the
+// target's natural key, in the order of the target's Key columns.
+type Ref struct {
+	Name   string
+	Domain string
+	Cols   []string
+}
+
+// DeletePolicy says what DELETE does to a domain's rows.
+type DeletePolicy string
+
+const (
+	HardDelete  DeletePolicy = ""          // rows are removed
+	SoftDelete  DeletePolicy = "soft"      // DeletedAt is set; admins may restore
+	NeverDelete DeletePolicy = "forbidden" // DELETE is rejected with 405
 )
 
 type Domain struct {
 	Name     string
 	Table    string
-	Cols     []string
+	Cols     []Column
 	Struct   string
 	Endpoint string
+	Delete   DeletePolicy
+	// Bulk adds POST /bulk, which upserts many records by natural key.
+	Bulk bool
+	Refs []Ref
+	// Read limits the read routes, and expansions into this domain, to the
+	// given roles. Empty allows any caller.
+	Read []string
 }
 
 func (d Domain) HasTable() bool {
 	return d.Table != ""
 }
 
-func (d Domain) ColsJoined() string {
-	return strings.Join(d.Cols, ", ")
+// HasDescriptors reports whether any column holds descriptor URIs.
+func (d Domain) HasDescriptors() bool {
+	for _, c := range d.Cols {
+		if c.Descriptor != "" {
+			return true
+		}
+	}
+	return false
 }
 
-func (d Domain) IdCol() string {
-	if len(d.Cols) > 0 {
-		return d.Cols[0]
+func (d Domain) SoftDelete() bool  { return d.Delete == SoftDelete }
+func (d Domain) NeverDelete() bool { return d.Delete == NeverDelete }
+
+// Live is the condition appended to key lookups so soft-deleted rows
+// behave as if they were gone.
+func (d Domain) Live() string {
+	if d.SoftDelete() {
+		return " AND DeletedAt IS NULL"
 	}
 	return ""
 }
 
+func (d Domain) ColsJoined() string {
+	names := make([]string, len(d.Cols))
+	for i, c := range d.Cols {
+		names[i] = c.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// SelectList is ColsJoined with DATE columns formatted as YYYY-MM-DD; it
+// must stay in step with resource.SelectList used by List.
+func (d Domain) SelectList() string {
+	exprs := make([]string, len(d.Cols))
+	for i, c := range d.Cols {
+		exprs[i] = c.Name
+		if c.Type == "date" {
+			exprs[i] = "to_char(" + c.Name + ", 'YYYY-MM-DD')"
+		}
+	}
+	return strings.Join(exprs, ", ")
+}
+
+// KeyCols are the columns of the natural key.
+func (d Domain) KeyCols() []Column {
+	var keys []Column
+	for _, c := range d.Cols {
+		if c.Key {
+			keys = append(keys, c)
+		}
+	}
+	return keys
+}
+
+// Guard returns the expression registered for the read route served by
+// handler, wrapped in the domain's role check when it has one.
+func (d Domain) Guard(handler string) string {
+	if len(d.Read) > 0 {
+		return "schema.RequireRead(h." + handler + ")"
+	}
+	return "h." + handler
+}
+
+// check rejects specs the templates cannot render correctly. byName holds
+// every domain, for resolving Refs.
+func (d Domain) check(byName map[string]Domain) error {
+	if !d.HasTable() {
+		return nil
+	}
+	if len(d.KeyCols()) == 0 {
+		return fmt.Errorf("%s: no natural key columns", d.Name)
+	}
+	for _, c := range d.KeyCols() {
+		if !c.Required {
+			return fmt.Errorf("%s: key column %s must be required", d.Name, c.Name)
+		}
+	}
+	for _, ref := range d.Refs {
+		target, ok := byName[ref.Domain]
+		if !ok || !target.HasTable() {
+			return fmt.Errorf("%s: ref %s targets unknown domain %s", d.Name, ref.Name, ref.Domain)
+		}
+		if len(ref.Cols) != len(target.KeyCols()) {
+			return fmt.Errorf("%s: ref %s needs %d columns for %s's key", d.Name, ref.Name, len(target.KeyCols()), ref.Domain)
+		}
+		for _, name := range ref.Cols {
+			if !d.hasCol(name) {
+				return fmt.Errorf("%s: ref %s names unknown column %s", d.Name, ref.Name, name)
+			}
+		}
+		if d.hasCol(ref.Name) || strings.EqualFold(ref.Name, "id") {
+			return fmt.Errorf("%s: ref %s clashes with a property", d.Name, ref.Name)
+		}
+	}
+	return nil
+}
+
+func (d Domain) hasCol(name string) bool {
+	for _, c := range d.Cols {
+		if strings.EqualFold(c.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyList returns the natural key columns, comma-separated, as the
+// ON CONFLICT target of a bulk upsert.
+func (d Domain) KeyList() string {
+	names := make([]string, 0, len(d.Cols))
+	for _, c := range d.KeyCols() {
+		names = append(names, c.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// UpsertSet returns the SET list of a bulk upsert's DO UPDATE: every
+// column outside the natural key takes the incoming value, and the row
+// version is bumped. The target table is aliased t.
+func (d Domain) UpsertSet() string {
+	var set []string
+	for _, c := range d.Cols {
+		if !c.Key {
+			set = append(set, fmt.Sprintf("%s = EXCLUDED.%s", c.Name, c.Name))
+		}
+	}
+	return strings.Join(append(set, "RowVersion = t.RowVersion + 1"), ", ")
+}
+
+// Placeholders returns "$1, $2, ..." for an INSERT of every column.
+func (d Domain) Placeholders() string {
+	ph := make([]string, len(d.Cols))
+	for i := range d.Cols {
+		ph[i] = fmt.Sprintf("$%d", i+1)
+	}
+	return strings.Join(ph, ", ")
+}
+
+// UpdateSet returns "A = $1, B = $2" for every column, natural key
+// included; the id is bound to the next placeholder, returned by
+// UpdateIdPlaceholder.
+func (d Domain) UpdateSet() string {
+	set := make([]string, len(d.Cols))
+	for i, c := range d.Cols {
+		set[i] = fmt.Sprintf("%s = $%d", c.Name, i+1)
+	}
+	return strings.Join(set, ", ")
+}
+
+func (d Domain) UpdateIdPlaceholder() string {
+	return fmt.Sprintf("$%d", len(d.Cols)+1)
+}
+
+// UpdateVersionPlaceholder follows the id; it carries the If-Match version.
+func (d Domain) UpdateVersionPlaceholder() string {
+	return fmt.Sprintf("$%d", len(d.Cols)+2)
+}
+
+func (c Column) GoType() string {
+	if c.Type == "integer" {
+		return "*int64"
+	}
+	return "*string"
+}
+
+func (c Column) ResourceType() string {
+	switch c.Type {
+	case "integer":
+		return "resource.Integer"
+	case "date":
+		return "resource.Date"
+	default:
+		return "resource.String"
+	}
+}
+
 func main() {
 	var repoTmpl = template.Must(template.New("repo").Funcs(template.FuncMap{
 		"toLower": strings.ToLower,
@@ -43,7 +254,13 @@ func main() {
 package {{.Name}}
 
 import (
+	"context"
 	"database/sql"
+{{- if .HasTable}}
+	"encoding/json"
+{{- end}}
+
+	"github.com/catdevman/oasis/plugin/common/internal/resource"
 )
 
 type Repository struct {
@@ -55,34 +272,101 @@ func NewRepository(db *sql.DB) *Repository {
 }
 
 {{if .HasTable}}
+var columns = []resource.Column{
+	resource.IDColumn,
+{{- range .Cols}}
+	{Name: "{{.Name}}", JSON: "{{.Name | toLower}}", Type: {{.ResourceType}}, Required: {{.Required}}, Filter: {{.Filter}}{{if .Key}}, Key: true{{end}}{{if .Descriptor}}, Descriptor: "{{.Descriptor}}"{{end}}},
+{{- end}}
+}
+
+// schema describes the resource to expand=, for expanding both its own
+// references and references into it.
+var schema = resource.Schema{
+	Name:    "{{.Name}}",
+	Table:   "{{.Table}}",
+	Columns: columns,
+{{- if .Refs}}
+	Refs: []resource.Ref{
+{{- range .Refs}}
+		{Name: "{{.Name}}", Target: "{{.Domain}}", Cols: []string{ {{- range $i, $c := .Cols}}{{if $i}}, {{end}}"{{$c}}"{{end -}} }},
+{{- end}}
+	},
+{{- end}}
+{{- if .Read}}
+	ReadRoles: []string{ {{- range $i, $r := .Read}}{{if $i}}, {{end}}"{{$r}}"{{end -}} },
+{{- end}}
+	SoftDelete: {{.SoftDelete}},
+}
+
+func init() {
+	resource.RegisterSchema(&schema)
+}
+
+// {{.Struct}} is identified by Id; its natural key is{{range $i, $c := .KeyCols}}{{if $i}},{{end}} {{$c.Name}}{{end}}.
 type {{.Struct}} struct {
-{{range $i, $col := .Cols}}
-	Field{{$i}} *string ` + "`" + `json:"{{$col | toLower}}"` + "`" + `
+	Id *string ` + "`" + `json:"id"` + "`" + `
+{{range .Cols}}
+	{{.Name}} {{.GoType}} ` + "`" + `json:"{{.Name | toLower}}"` + "`" + `
 {{end}}
+	ETag *string ` + "`" + `json:"_etag"` + "`" + `
 }
 
-func (r *Repository) List(limit, offset int) ([]{{.Struct}}, error) {
-	rows, err := r.db.Query("SELECT {{.ColsJoined}} FROM {{.Table}} LIMIT $1 OFFSET $2", limit, offset)
+// targets returns scan destinations for cols, in order.
+func (s *{{.Struct}}) targets(cols []resource.Column) []interface{} {
+	dest := make([]interface{}, len(cols))
+	for i, c := range cols {
+		switch c.Name {
+		case resource.IDColumn.Name:
+			dest[i] = &s.Id
+{{- range .Cols}}
+		case "{{.Name}}":
+			dest[i] = &s.{{.Name}}
+{{- end}}
+		case resource.VersionColumn.Name:
+			dest[i] = &s.ETag
+		}
+	}
+	return dest
+}
+
+func (r *Repository) List(ctx context.Context, q resource.ListQuery) ([]{{.Struct}}, error) {
+{{- if .SoftDelete}}
+	q = q.NotDeleted()
+{{- end}}
+	query, args := q.SQL("{{.Table}}", columns)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	selected := q.Selected(columns)
 	var items []{{.Struct}}
 	for rows.Next() {
 		var s {{.Struct}}
-		if err := rows.Scan({{range $i, $col := .Cols}}{{if $i}}, {{end}}&s.Field{{$i}}{{end}}); err != nil {
+		if err := rows.Scan(s.targets(selected)...); err != nil {
 			return nil, err
 		}
 		items = append(items, s)
 	}
-	return items, nil
+	return items, rows.Err()
 }
 
-func (r *Repository) Get(id string) (*{{.Struct}}, error) {
-	row := r.db.QueryRow("SELECT {{.ColsJoined}} FROM {{.Table}} WHERE {{.IdCol}} = $1", id)
+// Count returns the number of rows matching the query's filters.
+func (r *Repository) Count(ctx context.Context, q resource.ListQuery) (int64, error) {
+{{- if .SoftDelete}}
+	q = q.NotDeleted()
+{{- end}}
+	query, args := q.CountSQL("{{.Table}}")
+	var n int64
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(&n)
+	return n, err
+}
+
+func (r *Repository) Get(ctx context.Context, id string) (*{{.Struct}}, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT Id, {{.SelectList}}, RowVersion::text FROM {{.Table}} WHERE Id = $1{{.Live}}", id)
 	var s {{.Struct}}
-	if err := row.Scan({{range $i, $col := .Cols}}{{if $i}}, {{end}}&s.Field{{$i}}{{end}}); err != nil {
+	if err := row.Scan(&s.Id, {{range .Cols}}&s.{{.Name}}, {{end}}&s.ETag); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
@@ -91,29 +375,224 @@ func (r *Repository) Get(id string) (*{{.Struct}}, error) {
 	return &s, nil
 }
 
-func (r *Repository) Delete(id string) error {
-	_, err := r.db.Exec("DELETE FROM {{.Table}} WHERE {{.IdCol}} = $1", id)
-	return err
+// Create inserts s and sets s.Id and s.ETag to the new row's id and
+// version. The write is attributed to the Actor carried by ctx in the audit
+// history.
+func (r *Repository) Create(ctx context.Context, s *{{.Struct}}) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+{{- if .HasDescriptors}}
+	if err := resource.CheckDescriptors(ctx, tx, columns, s.targets(columns)); err != nil {
+		return err
+	}
+{{- end}}
+	err = tx.QueryRowContext(ctx, "INSERT INTO {{.Table}} ({{.ColsJoined}}) VALUES ({{.Placeholders}}) RETURNING Id, RowVersion::text",
+		{{range $i, $col := .Cols}}{{if $i}}, {{end}}s.{{$col.Name}}{{end}}).Scan(&s.Id, &s.ETag)
+	if err != nil {
+		return resource.FromDB(err)
+	}
+	return tx.Commit()
+}
+{{- if .Bulk}}
+
+// Bulk upserts records by natural key in one transaction: rows whose key
+// exists are overwritten and the rest are inserted. Each record's outcome
+// is reported in the returned report.
+func (r *Repository) Bulk(ctx context.Context, records []json.RawMessage) (resource.BulkReport, error) {
+	return resource.Bulk(ctx, r.db, records, columns, func(tx *sql.Tx, raw json.RawMessage) (resource.Written, error) {
+		var w resource.Written
+		var s {{.Struct}}
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return w, resource.FieldErrors{{"{{"}}Field: "", Message: err.Error()}}
+		}
+{{- if .HasDescriptors}}
+		if err := resource.CheckDescriptors(ctx, tx, columns, s.targets(columns)); err != nil {
+			return w, err
+		}
+{{- end}}
+		err := tx.QueryRowContext(ctx, "INSERT INTO {{.Table}} AS t ({{.ColsJoined}}) VALUES ({{.Placeholders}}) ON CONFLICT ({{.KeyList}}) DO UPDATE SET {{.UpsertSet}}{{if .SoftDelete}} WHERE t.DeletedAt IS NULL{{end}} RETURNING Id, RowVersion::text, xmax = 0",
+			{{range $i, $col := .Cols}}{{if $i}}, {{end}}s.{{$col.Name}}{{end}}).Scan(&w.ID, &w.Version, &w.Created)
+{{- if .SoftDelete}}
+		if err == sql.ErrNoRows {
+			// The key belongs to a soft-deleted row, which must be restored first.
+			return w, resource.ErrConflict
+		}
+{{- end}}
+		return w, resource.FromDB(err)
+	})
+}
+
+// StartBulk runs Bulk in a background job and returns the job.
+func (r *Repository) StartBulk(ctx context.Context, records []json.RawMessage) (*resource.Job, error) {
+	return resource.StartJob(ctx, r.db, "{{.Endpoint}}", records, r.Bulk)
+}
+{{- end}}
+
+// Update overwrites the row with the given id, natural key included, if its
+// version still matches (an empty version matches any) and sets s.ETag to
+// the bumped version.
+func (r *Repository) Update(ctx context.Context, id, version string, s *{{.Struct}}) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+{{- if .HasDescriptors}}
+	if err := resource.CheckDescriptors(ctx, tx, columns, s.targets(columns)); err != nil {
+		return err
+	}
+{{- end}}
+	err = tx.QueryRowContext(ctx, "UPDATE {{.Table}} SET {{.UpdateSet}}, RowVersion = RowVersion + 1 WHERE Id = {{.UpdateIdPlaceholder}}{{.Live}} AND ({{.UpdateVersionPlaceholder}} = '' OR RowVersion::text = {{.UpdateVersionPlaceholder}}) RETURNING RowVersion::text",
+		{{range .Cols}}s.{{.Name}}, {{end}}id, version).Scan(&s.ETag)
+	if err == sql.ErrNoRows {
+		return missOrStale(ctx, tx, id)
+	}
+	if err != nil {
+		return resource.FromDB(err)
+	}
+	s.Id = &id
+	return tx.Commit()
+}
+
+{{- if not .NeverDelete}}
+{{- if .SoftDelete}}
+// Delete soft-deletes the row with the given id if its version still matches: it
+// stays in the table, hidden from reads, until an admin restores it.
+{{- else}}
+// Delete removes the row with the given id if its version still matches.
+{{- end}}
+func (r *Repository) Delete(ctx context.Context, id, version string) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+{{- if .SoftDelete}}
+	res, err := tx.ExecContext(ctx, "UPDATE {{.Table}} SET DeletedAt = now(), RowVersion = RowVersion + 1 WHERE Id = $1 AND DeletedAt IS NULL AND ($2 = '' OR RowVersion::text = $2)", id, version)
+{{- else}}
+	res, err := tx.ExecContext(ctx, "DELETE FROM {{.Table}} WHERE Id = $1 AND ($2 = '' OR RowVersion::text = $2)", id, version)
+{{- end}}
+	if err != nil {
+		return resource.FromDB(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return missOrStale(ctx, tx, id)
+	}
+	return tx.Commit()
+}
+{{- end}}
+{{- if .SoftDelete}}
+
+// Restore undoes a soft delete. It returns resource.ErrConflict when the
+// row exists but is not deleted.
+func (r *Repository) Restore(ctx context.Context, id string) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var deleted bool
+	err = tx.QueryRowContext(ctx, "SELECT DeletedAt IS NOT NULL FROM {{.Table}} WHERE Id = $1 FOR UPDATE", id).Scan(&deleted)
+	switch {
+	case err == sql.ErrNoRows:
+		return resource.ErrNotFound
+	case err != nil:
+		return err
+	case !deleted:
+		return resource.ErrConflict
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE {{.Table}} SET DeletedAt = NULL, RowVersion = RowVersion + 1 WHERE Id = $1", id); err != nil {
+		return resource.FromDB(err)
+	}
+	return tx.Commit()
+}
+{{- end}}
+
+// missOrStale explains a conditional write that matched no row.
+func missOrStale(ctx context.Context, tx *sql.Tx, id string) error {
+	var one int
+	err := tx.QueryRowContext(ctx, "SELECT 1 FROM {{.Table}} WHERE Id = $1{{.Live}}", id).Scan(&one)
+	switch {
+	case err == sql.ErrNoRows:
+		return resource.ErrNotFound
+	case err != nil:
+		return err
+	}
+	return resource.ErrPreconditionFailed
+}
+
+// History returns the audit history of the row with the given id, oldest first.
+func (r *Repository) History(ctx context.Context, id string, q resource.ListQuery) ([]resource.Change, error) {
+	return resource.History(ctx, r.db, "{{.Table}}", id, q)
+}
+
+// Deletes returns the rows deleted within q's change version bounds.
+func (r *Repository) Deletes(ctx context.Context, q resource.ListQuery) ([]resource.Delete, error) {
+	return resource.Deletes(ctx, r.db, "{{.Table}}", q)
+}
+
+// KeyChanges returns the natural key changes within q's change version bounds.
+func (r *Repository) KeyChanges(ctx context.Context, q resource.ListQuery) ([]resource.KeyChange, error) {
+	return resource.KeyChanges(ctx, r.db, "{{.Table}}", q)
+}
+
+// Expand embeds the references named by e in items.
+func (r *Repository) Expand(ctx context.Context, items interface{}, e resource.Expansion) ([]map[string]json.RawMessage, error) {
+	return resource.Expand(ctx, r.db, &schema, items, e)
 }
 {{else}}
-func (r *Repository) List(limit, offset int) ([]interface{}, error) {
+var columns []resource.Column
+
+func (r *Repository) List(ctx context.Context, q resource.ListQuery) ([]interface{}, error) {
 	return []interface{}{}, nil
 }
+
+func (r *Repository) Count(ctx context.Context, q resource.ListQuery) (int64, error) {
+	return 0, nil
+}
 {{end}}
 `))
 
-	var handlerTmpl = template.Must(template.New("handler").Parse(`// Code generated by go generate; DO NOT EDIT.
+	var handlerTmpl = template.Must(template.New("handler").Funcs(template.FuncMap{
+		"toLower": strings.ToLower,
+	}).Parse(`// Code generated by go generate; DO NOT EDIT.
 package {{.Name}}
 
 import (
+{{- if .HasTable}}
 	"encoding/json"
+{{- end}}
+{{- if and .HasTable (or .SoftDelete .Bulk)}}
+	"errors"
+{{- end}}
+{{- if .Bulk}}
+	"fmt"
+{{- end}}
+{{- if .HasTable}}
+	"io"
+{{- end}}
 	"net/http"
 	"os"
+{{- if .Bulk}}
 	"strconv"
+{{- end}}
+
+	"github.com/catdevman/oasis/plugin/common/internal/resource"
 )
 
 type Handler struct {
-	repo *Repository
+	repo     *Repository
+	basePath string
+{{- if .Bulk}}
+	jobsPath string
+{{- end}}
 }
 
 func NewHandler(repo *Repository) *Handler {
@@ -126,50 +605,112 @@ func (h *Handler) Register(mux *http.ServeMux) {
 		prefix = "api/common"
 	}
 	basePath := "/" + prefix + "/ed-fi/{{.Endpoint}}"
-	mux.HandleFunc("GET "+basePath, h.list)
-	mux.HandleFunc("GET "+basePath+"/{id}", h.{{if .HasTable}}get{{else}}notImplemented{{end}})
+	h.basePath = basePath
+	mux.HandleFunc("GET "+basePath, {{.Guard "list"}})
+	mux.HandleFunc("GET "+basePath+"/{id}", {{if .HasTable}}{{.Guard "get"}}{{else}}h.notImplemented{{end}})
 	mux.HandleFunc("POST "+basePath, h.{{if .HasTable}}create{{else}}notImplemented{{end}})
 	mux.HandleFunc("PUT "+basePath+"/{id}", h.{{if .HasTable}}update{{else}}notImplemented{{end}})
-	mux.HandleFunc("DELETE "+basePath+"/{id}", h.{{if .HasTable}}delete{{else}}notImplemented{{end}})
+	mux.HandleFunc("DELETE "+basePath+"/{id}", h.{{if .NeverDelete}}deleteForbidden{{else if .HasTable}}delete{{else}}notImplemented{{end}})
+	mux.HandleFunc("GET "+basePath+"/{id}/history", {{if .HasTable}}{{.Guard "history"}}{{else}}h.notImplemented{{end}})
+	mux.HandleFunc("GET "+basePath+"/deletes", {{if .HasTable}}{{.Guard "deletes"}}{{else}}h.notImplemented{{end}})
+	mux.HandleFunc("GET "+basePath+"/keyChanges", {{if .HasTable}}{{.Guard "keyChanges"}}{{else}}h.notImplemented{{end}})
+{{- if and .HasTable .SoftDelete}}
+	mux.HandleFunc("POST "+basePath+"/{id}/restore", h.restore)
+{{- end}}
+{{- if .Bulk}}
+	h.jobsPath = "/" + prefix + "/bulk/v1/jobs"
+	mux.HandleFunc("POST "+basePath+"/bulk", h.bulk)
+{{- end}}
 }
 
 func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
-	limit := 50
-	offset := 0
-	if l := r.URL.Query().Get("limit"); l != "" {
-		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
-			limit = parsed
-		}
+	q, errs := resource.ParseListQuery(r.URL.Query(), columns)
+	if len(errs) > 0 {
+		resource.WriteFieldErrors(w, r, errs)
+		return
 	}
-	if o := r.URL.Query().Get("offset"); o != "" {
-		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
-			offset = parsed
-		}
+{{- if .HasTable}}
+	expand, ok := resource.ExpandParam(w, r, &schema)
+	if !ok {
+		return
 	}
-	items, err := h.repo.List(limit, offset)
+	q.Fields = expand.Fields(&schema, q.Fields)
+{{- end}}
+	items, err := h.repo.List(r.Context(), q)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		resource.WriteRepoError(w, r, err)
 		return
 	}
 	if items == nil {
 		items = make([]{{if .HasTable}}{{.Struct}}{{else}}interface{}{{end}}, 0)
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(items)
+	page := resource.Page{Total: -1}
+	if len(items) > q.Limit {
+		items = items[:q.Limit]
+		page.HasNext = true
+{{- if .HasTable}}
+		page.Next = q.NextCursor(items[len(items)-1].targets(q.OrderColumns()))
+{{- end}}
+	}
+	if q.TotalCount {
+		if page.Total, err = h.repo.Count(r.Context(), q); err != nil {
+			resource.WriteRepoError(w, r, err)
+			return
+		}
+	}
+	q.WriteHeaders(w, r.URL, page)
+	projected, err := resource.Project(items, q.Fields)
+	if err != nil {
+		resource.WriteRepoError(w, r, err)
+		return
+	}
+{{- if .HasTable}}
+	if len(expand) > 0 {
+		if projected, err = h.repo.Expand(r.Context(), projected, expand); err != nil {
+			resource.WriteRepoError(w, r, err)
+			return
+		}
+	}
+{{- end}}
+	if err := resource.WriteTagged(w, r, projected); err != nil {
+		resource.WriteRepoError(w, r, err)
+	}
 }
 
 {{if .HasTable}}
 func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
-	item, err := h.repo.Get(id)
+	id, ok := resource.PathID(w, r)
+	if !ok {
+		return
+	}
+	expand, ok := resource.ExpandParam(w, r, &schema)
+	if !ok {
+		return
+	}
+	item, err := h.repo.Get(r.Context(), id)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		resource.WriteRepoError(w, r, err)
 		return
 	}
 	if item == nil {
-		w.WriteHeader(http.StatusNotFound)
+		resource.WriteRepoError(w, r, resource.ErrNotFound)
+		return
+	}
+	if len(expand) > 0 {
+		// The row version does not cover the expanded resources, so the
+		// ETag is taken from the whole body instead.
+		expanded, err := h.repo.Expand(r.Context(), []*{{.Struct}}{item}, expand)
+		if err != nil {
+			resource.WriteRepoError(w, r, err)
+			return
+		}
+		if err := resource.WriteTagged(w, r, expanded[0]); err != nil {
+			resource.WriteRepoError(w, r, err)
+		}
+		return
+	}
+	w.Header().Set("ETag", resource.FormatETag(*item.ETag))
+	if resource.NotModified(w, r) {
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -177,56 +718,260 @@ func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"message": "created"})
+	item, ok := decode(w, r)
+	if !ok {
+		return
+	}
+	if err := h.repo.Create(resource.ActorContext(r), item); err != nil {
+		resource.WriteRepoError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", h.basePath+"/"+*item.Id)
+	w.Header().Set("ETag", resource.FormatETag(*item.ETag))
+	resource.WriteJSON(w, http.StatusCreated, item)
 }
 
 func (h *Handler) update(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"message": "updated"})
+	id, ok := resource.PathID(w, r)
+	if !ok {
+		return
+	}
+	version, ok := resource.IfMatch(w, r)
+	if !ok {
+		return
+	}
+	item, ok := decode(w, r)
+	if !ok {
+		return
+	}
+	if item.Id != nil && *item.Id != id {
+		resource.WriteFieldErrors(w, r, []resource.FieldError{
+			{Field: "id", Message: "must match the id in the URL"},
+		})
+		return
+	}
+	if err := h.repo.Update(resource.ActorContext(r), id, version, item); err != nil {
+		resource.WriteRepoError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", resource.FormatETag(*item.ETag))
+	resource.WriteJSON(w, http.StatusOK, item)
 }
 
-func (h *Handler) delete(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
-	err := h.repo.Delete(id)
+// decode reads and validates the request body, writing a 400 listing every
+// invalid field when it does not match the resource's columns.
+func decode(w http.ResponseWriter, r *http.Request) (*{{.Struct}}, bool) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		resource.WriteError(w, r, http.StatusBadRequest, "INVALID_REQUEST", "could not read request body")
+		return nil, false
+	}
+	if errs := resource.Validate(body, columns); len(errs) > 0 {
+		resource.WriteFieldErrors(w, r, errs)
+		return nil, false
+	}
+	var item {{.Struct}}
+	if err := json.Unmarshal(body, &item); err != nil {
+		resource.WriteError(w, r, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		return nil, false
+	}
+	return &item, true
+}
+{{- if .Bulk}}
+
+// bulk upserts many records at once, sent as a JSON array or as NDJSON
+// (Content-Type application/x-ndjson). With async=true the records are
+// written by a background job and the response is 202 pointing at it.
+func (h *Handler) bulk(w http.ResponseWriter, r *http.Request) {
+	async := false
+	if v := r.URL.Query().Get("async"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			resource.WriteFieldErrors(w, r, []resource.FieldError{{"{{"}}Field: "async", Message: "must be true or false"}})
+			return
+		}
+		async = b
+	}
+	limit := resource.MaxBulkRecords
+	if async {
+		limit = resource.MaxBulkJobRecords
+	}
+	records, err := resource.ReadBulk(r, limit)
+	if errors.Is(err, resource.ErrTooManyRecords) {
+		msg := fmt.Sprintf("at most %d records per request; send larger payloads with async=true", limit)
+		if async {
+			msg = fmt.Sprintf("at most %d records per job", limit)
+		}
+		resource.WriteError(w, r, http.StatusRequestEntityTooLarge, "TOO_MANY_RECORDS", msg)
+		return
+	}
+	if err != nil {
+		resource.WriteError(w, r, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		return
+	}
+	if async {
+		job, err := h.repo.StartBulk(resource.ActorContext(r), records)
+		if err != nil {
+			resource.WriteRepoError(w, r, err)
+			return
+		}
+		w.Header().Set("Location", h.jobsPath+"/"+job.ID)
+		resource.WriteJSON(w, http.StatusAccepted, job)
+		return
+	}
+	report, err := h.repo.Bulk(resource.ActorContext(r), records)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		resource.WriteRepoError(w, r, err)
+		return
+	}
+	resource.WriteJSON(w, http.StatusOK, report)
+}
+{{- end}}
+{{- if not .NeverDelete}}
+
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request) {
+	id, ok := resource.PathID(w, r)
+	if !ok {
+		return
+	}
+	version, ok := resource.IfMatch(w, r)
+	if !ok {
+		return
+	}
+	if err := h.repo.Delete(resource.ActorContext(r), id, version); err != nil {
+		resource.WriteRepoError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
+{{- end}}
+{{- if .SoftDelete}}
+
+// restore brings back a soft-deleted resource. Only admins may restore.
+func (h *Handler) restore(w http.ResponseWriter, r *http.Request) {
+	if !resource.ActorFrom(r).HasRole(resource.AdminRoles...) {
+		resource.WriteError(w, r, http.StatusForbidden, "FORBIDDEN", "only administrators may restore deleted resources")
+		return
+	}
+	id, ok := resource.PathID(w, r)
+	if !ok {
+		return
+	}
+	err := h.repo.Restore(resource.ActorContext(r), id)
+	if errors.Is(err, resource.ErrConflict) {
+		resource.WriteError(w, r, http.StatusConflict, "CONFLICT", "resource is not deleted")
+		return
+	}
+	if err != nil {
+		resource.WriteRepoError(w, r, err)
+		return
+	}
+	h.get(w, r)
+}
+{{- end}}
+
+// history lists the audit entries for one resource, oldest first. It pages
+// with limit and offset only.
+func (h *Handler) history(w http.ResponseWriter, r *http.Request) {
+	id, ok := resource.PathID(w, r)
+	if !ok {
+		return
+	}
+	q, errs := resource.ParseListQuery(r.URL.Query(), nil)
+	if len(errs) > 0 {
+		resource.WriteFieldErrors(w, r, errs)
+		return
+	}
+	changes, err := h.repo.History(r.Context(), id, q)
+	if err != nil {
+		resource.WriteRepoError(w, r, err)
+		return
+	}
+	if len(changes) == 0 && q.Offset == 0 {
+		resource.WriteError(w, r, http.StatusNotFound, "NOT_FOUND", "resource has no history")
+		return
+	}
+	resource.WriteJSON(w, http.StatusOK, changes)
+}
+
+// deletes lists deleted resources for Ed-Fi Change Queries. It pages with
+// limit and offset and honours minChangeVersion and maxChangeVersion.
+func (h *Handler) deletes(w http.ResponseWriter, r *http.Request) {
+	q, errs := resource.ParseListQuery(r.URL.Query(), nil)
+	if len(errs) > 0 {
+		resource.WriteFieldErrors(w, r, errs)
+		return
+	}
+	deletes, err := h.repo.Deletes(r.Context(), q)
+	if err != nil {
+		resource.WriteRepoError(w, r, err)
+		return
+	}
+	resource.WriteJSON(w, http.StatusOK, deletes)
+}
+
+// keyChanges lists natural key changes for Ed-Fi Change Queries.
+func (h *Handler) keyChanges(w http.ResponseWriter, r *http.Request) {
+	q, errs := resource.ParseListQuery(r.URL.Query(), nil)
+	if len(errs) > 0 {
+		resource.WriteFieldErrors(w, r, errs)
+		return
+	}
+	changes, err := h.repo.KeyChanges(r.Context(), q)
+	if err != nil {
+		resource.WriteRepoError(w, r, err)
+		return
+	}
+	resource.WriteJSON(w, http.StatusOK, changes)
+}
 {{else}}
 func (h *Handler) notImplemented(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusNotImplemented)
+	resource.WriteError(w, r, http.StatusNotImplemented, "NOT_IMPLEMENTED", "{{.Endpoint}} are not implemented yet")
+}
+{{end}}
+{{- if .NeverDelete}}
+// deleteForbidden rejects DELETE: {{.Endpoint}} are kept for the record and
+// are corrected with PUT instead.
+func (h *Handler) deleteForbidden(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Allow", "GET, PUT")
+	resource.WriteError(w, r, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "{{.Endpoint}} may not be deleted; correct them with PUT")
 }
 {{end}}
 `))
 
 	domains := []Domain{
-		{Name: "academicrecord", Endpoint: "student-academic-records"},
-		{Name: "assessment", Table: "Assessment", Cols: []string{"AssessmentIdentifier", "AssessmentTitle"}, Struct: "Assessment", Endpoint: "assessments"},
-		{Name: "attendance", Table: "edfi.StudentSectionAttendanceEvent", Cols: []string{"CourseSectionIdentifier", "AttendanceEventType"}, Struct: "Attendance", Endpoint: "attendances"},
+		{Name: "academicrecord", Endpoint: "student-academic-records", Delete: NeverDelete},
+		{Name: "assessment", Table: "Assessment", Cols: []Column{{Name: "AssessmentIdentifier", Required: true, Filter: true, Key: true}, {Name: "AssessmentTitle", Required: true, Filter: true}}, Struct: "Assessment", Endpoint: "assessments", Delete: SoftDelete, Bulk: true},
+		{Name: "attendance", Table: "edfi.StudentSectionAttendanceEvent", Cols: []Column{{Name: "CourseSectionIdentifier", Required: true, Filter: true, Key: true}, {Name: "AttendanceEventType", Filter: true}, {Name: "StudentUniqueId", Required: true, Filter: true, Key: true}, {Name: "AttendanceEventDate", Type: "date", Required: true, Filter: true, Key: true}, {Name: "AttendanceStatus", Filter: true, Descriptor: "AttendanceEventCategory"}}, Struct: "Attendance", Endpoint: "attendances", Delete: NeverDelete, Bulk: true,
+			Refs: []Ref{{Name: "section", Domain: "section", Cols: []string{"CourseSectionIdentifier"}}, {Name: "student", Domain: "student", Cols: []string{"StudentUniqueId"}}}},
 		{Name: "bellschedule", Endpoint: "bell-schedules"},
-		{Name: "calendar", Table: "Calendar", Cols: []string{"CalendarCode", "CalendarDescription", "SchoolYear"}, Struct: "Calendar", Endpoint: "calendars"},
+		{Name: "calendar", Table: "Calendar", Cols: []Column{{Name: "CalendarCode", Required: true, Filter: true, Key: true}, {Name: "CalendarDescription"}, {Name: "SchoolYear", Type: "integer", Filter: true}}, Struct: "Calendar", Endpoint: "calendars"},
 		{Name: "cohort", Endpoint: "cohorts"},
-		{Name: "coursecatalog", Table: "edfi.Course", Cols: []string{"CourseIdentifier", "CourseTitle"}, Struct: "Course", Endpoint: "course-catalogs"},
+		{Name: "coursecatalog", Table: "edfi.Course", Cols: []Column{{Name: "CourseIdentifier", Required: true, Filter: true, Key: true}, {Name: "CourseTitle", Required: true, Filter: true}}, Struct: "Course", Endpoint: "course-catalogs"},
 		{Name: "credential", Endpoint: "credentials"},
-		{Name: "discipline", Endpoint: "disciplines"},
-		{Name: "educationorg", Table: "edfi.School", Cols: []string{"OrganizationIdentifier", "OrganizationName"}, Struct: "EducationOrg", Endpoint: "education-organizations"},
+		{Name: "discipline", Endpoint: "disciplines", Delete: NeverDelete},
+		{Name: "educationorg", Table: "edfi.School", Cols: []Column{{Name: "OrganizationIdentifier", Required: true, Filter: true, Key: true}, {Name: "OrganizationName", Filter: true}}, Struct: "EducationOrg", Endpoint: "education-organizations"},
 		{Name: "grades", Endpoint: "grades"},
 		{Name: "graduation", Endpoint: "graduation-plans"},
-		{Name: "intervention", Endpoint: "interventions"},
+		{Name: "intervention", Endpoint: "interventions", Delete: NeverDelete},
 		{Name: "postsecondary", Endpoint: "post-secondary-events"},
-		{Name: "program", Table: "Program", Cols: []string{"ProgramName", "ProgramType"}, Struct: "Program", Endpoint: "programs"},
-		{Name: "section", Table: "edfi.Section", Cols: []string{"CourseSectionIdentifier", "CourseTitle"}, Struct: "Section", Endpoint: "sections"},
-		{Name: "staff", Table: "edfi.Staff", Cols: []string{"StaffUniqueId", "FirstName", "LastSurname"}, Struct: "Staff", Endpoint: "staffs"},
-		{Name: "student", Table: "edfi.Student", Cols: []string{"StudentUniqueId", "FirstName", "LastSurname"}, Struct: "Student", Endpoint: "students"},
-		{Name: "studentsection", Table: "edfi.StudentSectionAssociation", Cols: []string{"CourseSectionIdentifier", "StudentUniqueId"}, Struct: "StudentSection", Endpoint: "student-section-associations"},
+		{Name: "program", Table: "Program", Cols: []Column{{Name: "ProgramName", Required: true, Filter: true, Key: true}, {Name: "ProgramType", Filter: true, Descriptor: "ProgramType"}}, Struct: "Program", Endpoint: "programs", Delete: SoftDelete},
+		{Name: "section", Table: "edfi.Section", Cols: []Column{{Name: "CourseSectionIdentifier", Required: true, Filter: true, Key: true}, {Name: "CourseTitle", Filter: true}, {Name: "CourseIdentifier", Filter: true}, {Name: "SessionBeginDate", Type: "date", Filter: true}, {Name: "SessionEndDate", Type: "date", Filter: true}}, Struct: "Section", Endpoint: "sections",
+			Refs: []Ref{{Name: "course", Domain: "coursecatalog", Cols: []string{"CourseIdentifier"}}}},
+		{Name: "staff", Table: "edfi.Staff", Cols: []Column{{Name: "StaffUniqueId", Required: true, Filter: true, Key: true}, {Name: "FirstName", Filter: true}, {Name: "LastSurname", Filter: true}}, Struct: "Staff", Endpoint: "staffs", Delete: SoftDelete, Read: []string{"admin", "administrator", "teacher"}},
+		{Name: "student", Table: "edfi.Student", Cols: []Column{{Name: "StudentUniqueId", Required: true, Filter: true, Key: true}, {Name: "FirstName", Filter: true}, {Name: "LastSurname", Filter: true}}, Struct: "Student", Endpoint: "students", Delete: SoftDelete, Read: []string{"admin", "administrator", "teacher"}},
+		{Name: "studentsection", Table: "edfi.StudentSectionAssociation", Cols: []Column{{Name: "CourseSectionIdentifier", Required: true, Filter: true, Key: true}, {Name: "StudentUniqueId", Required: true, Filter: true, Key: true}}, Struct: "StudentSection", Endpoint: "student-section-associations",
+			Refs: []Ref{{Name: "section", Domain: "section", Cols: []string{"CourseSectionIdentifier"}}, {Name: "student", Domain: "student", Cols: []string{"StudentUniqueId"}}}},
 	}
 
+	byName := make(map[string]Domain, len(domains))
 	for _, d := range domains {
+		byName[d.Name] = d
+	}
+	for _, d := range domains {
+		if err := d.check(byName); err != nil {
+			log.Fatalf("invalid domain spec: %v", err)
+		}
 		dir := filepath.Join("internal", d.Name)
 		if err := os.MkdirAll(dir, 0755); err != nil {
 			log.Fatalf("failed to create directory %s: %v", dir, err)
@@ -257,7 +1002,429 @@ func (h *Handler) notImplemented(w http.ResponseWriter, r *http.Request) {
 		if err := os.WriteFile(filepath.Join(dir, "handler.go"), handlerFmt, 0644); err != nil {
 			log.Fatalf("failed to write handler.go for %s: %v", d.Name, err)
 		}
-		
+
 		fmt.Printf("Generated %s\n", d.Name)
 	}
+
+	spec, err := openAPI(domains, byName)
+	if err != nil {
+		log.Fatalf("failed to render openapi.json: %v", err)
+	}
+	if err := os.WriteFile("openapi.json", spec, 0644); err != nil {
+		log.Fatalf("failed to write openapi.json: %v", err)
+	}
+	fmt.Println("Generated openapi.json")
+}
+
+// obj is a JSON object of the OpenAPI document under construction.
+// encoding/json sorts map keys, so the output is stable across runs.
+type obj = map[string]interface{}
+
+func schemaRef(name string) obj { return obj{"$ref": "#/components/schemas/" + name} }
+func paramRef(name string) obj  { return obj{"$ref": "#/components/parameters/" + name} }
+func respRef(name string) obj   { return obj{"$ref": "#/components/responses/" + name} }
+
+func jsonContent(schema obj) obj { return obj{"application/json": obj{"schema": schema}} }
+func arrayOf(schema obj) obj     { return obj{"type": "array", "items": schema} }
+
+// errorResponses are the shared error responses, by status code.
+var errorResponses = map[int]string{
+	http.StatusBadRequest:            "BadRequest",
+	http.StatusForbidden:             "Forbidden",
+	http.StatusNotFound:              "NotFound",
+	http.StatusMethodNotAllowed:      "MethodNotAllowed",
+	http.StatusConflict:              "Conflict",
+	http.StatusPreconditionFailed:    "PreconditionFailed",
+	http.StatusRequestEntityTooLarge: "TooManyRecords",
+}
+
+// responses returns an operation's responses: ok plus a reference to the
+// shared error response of each status in errs.
+func responses(ok obj, errs ...int) obj {
+	r := obj{}
+	for code, v := range ok {
+		r[code] = v
+	}
+	for _, status := range errs {
+		r[strconv.Itoa(status)] = respRef(errorResponses[status])
+	}
+	return r
+}
+
+// schema returns the OpenAPI schema of the column's JSON property. Key
+// columns are never null.
+func (c Column) schema() obj {
+	s := obj{}
+	switch {
+	case c.Type == "integer":
+		s["type"] = "integer"
+	case c.Type == "date":
+		s["type"], s["format"] = "string", "date"
+	case c.Descriptor != "":
+		s["type"], s["format"] = "string", "uri"
+		s["description"] = "URI of a " + c.Descriptor + "Descriptor."
+	default:
+		s["type"] = "string"
+	}
+	if !c.Key {
+		s["type"] = []string{s["type"].(string), "null"}
+	}
+	return s
+}
+
+// filterParam documents the column's list filter.
+func (c Column) filterParam() obj {
+	name := strings.ToLower(c.Name)
+	ops := "ne, contains, startswith"
+	if c.Type == "integer" || c.Type == "date" {
+		ops = "ne, gt, gte, lt, lte"
+	}
+	schema := c.schema()
+	if t, ok := schema["type"].([]string); ok {
+		schema["type"] = t[0]
+	}
+	delete(schema, "description")
+	return obj{
+		"name": name, "in": "query", "schema": schema,
+		"description": "Repeat to match any of several values. Other comparisons are written " +
+			name + "[op]=value, with op one of " + ops + ".",
+	}
+}
+
+// schema returns the OpenAPI schema of the domain's resource. byName
+// resolves Refs.
+func (d Domain) schema(byName map[string]Domain) obj {
+	props := obj{
+		"id":    obj{"type": "string", "format": "uuid", "readOnly": true},
+		"_etag": obj{"type": "string", "readOnly": true},
+	}
+	required := []string{}
+	for _, c := range d.Cols {
+		props[strings.ToLower(c.Name)] = c.schema()
+		if c.Required {
+			required = append(required, strings.ToLower(c.Name))
+		}
+	}
+	for _, ref := range d.Refs {
+		props[ref.Name] = obj{
+			"anyOf":       []obj{schemaRef(byName[ref.Domain].Struct), {"type": "null"}},
+			"readOnly":    true,
+			"description": "Present only with expand=" + ref.Name + "; null when nothing matches.",
+		}
+	}
+	return obj{"type": "object", "properties": props, "required": required}
+}
+
+// paths returns the OpenAPI path items of the domain's routes, relative to
+// the plugin prefix, mirroring the handler template's Register.
+func (d Domain) paths() obj {
+	base := "/ed-fi/" + d.Endpoint
+	tags := []string{d.Endpoint}
+	res := schemaRef(d.Struct)
+	etag := obj{"description": "Version of the resource, for If-Match.", "schema": obj{"type": "string"}}
+	one := obj{"description": "The resource.", "headers": obj{"ETag": etag}, "content": jsonContent(res)}
+	idParams := []obj{paramRef("id")}
+
+	// Read routes answer 403 to roles outside Read.
+	readNote, readErrs := "", []int{}
+	if len(d.Read) > 0 {
+		readNote = " Readable by " + strings.Join(d.Read, ", ") + "."
+		readErrs = append(readErrs, http.StatusForbidden)
+	}
+	readResponses := func(ok obj, errs ...int) obj {
+		return responses(ok, append(errs, readErrs...)...)
+	}
+
+	listParams := []obj{paramRef("limit"), paramRef("offset"), paramRef("cursor"), paramRef("totalCount"),
+		paramRef("sort"), paramRef("fields"), paramRef("minChangeVersion"), paramRef("maxChangeVersion")}
+	getParams := idParams
+	if len(d.Refs) > 0 {
+		names := make([]string, len(d.Refs))
+		for i, ref := range d.Refs {
+			names[i] = ref.Name
+		}
+		expand := obj{
+			"name": "expand", "in": "query", "schema": obj{"type": "string"},
+			"description": "Comma-separated references to embed, nested with dots up to two levels deep: " +
+				strings.Join(names, ", ") + ".",
+		}
+		listParams = append(listParams, expand)
+		getParams = append([]obj{paramRef("id")}, expand)
+	}
+	for _, c := range d.Cols {
+		if c.Filter {
+			listParams = append(listParams, c.filterParam())
+		}
+	}
+
+	paths := obj{}
+	paths[base] = obj{
+		"get": obj{
+			"tags": tags, "operationId": "list" + d.Struct, "summary": "List " + d.Endpoint + "." + readNote,
+			"parameters": listParams,
+			"responses": readResponses(obj{"200": obj{
+				"description": "A page of resources, ordered by natural key unless sorted.",
+				"headers": obj{
+					"Total-Count": obj{"description": "Filtered row count, when totalCount=true.", "schema": obj{"type": "integer"}},
+					"Link":        obj{"description": "RFC 8288 links to the first and next pages.", "schema": obj{"type": "string"}},
+				},
+				"content": jsonContent(arrayOf(res)),
+			}}, http.StatusBadRequest),
+		},
+		"post": obj{
+			"tags": tags, "operationId": "create" + d.Struct, "summary": "Create " + d.Endpoint + ".",
+			"requestBody": obj{"required": true, "content": jsonContent(res)},
+			"responses": responses(obj{"201": obj{
+				"description": "Created.",
+				"headers": obj{
+					"Location": obj{"description": "URL of the new resource.", "schema": obj{"type": "string"}},
+					"ETag":     etag,
+				},
+				"content": jsonContent(res),
+			}}, http.StatusBadRequest, http.StatusConflict),
+		},
+	}
+
+	item := obj{
+		"get": obj{
+			"tags": tags, "operationId": "get" + d.Struct, "summary": "Get one of " + d.Endpoint + " by id." + readNote,
+			"parameters": getParams,
+			"responses":  readResponses(obj{"200": one, "304": obj{"description": "Not modified since If-None-Match."}}, http.StatusNotFound),
+		},
+		"put": obj{
+			"tags": tags, "operationId": "update" + d.Struct, "summary": "Replace one of " + d.Endpoint + ".",
+			"parameters":  []obj{paramRef("id"), paramRef("If-Match")},
+			"requestBody": obj{"required": true, "content": jsonContent(res)},
+			"responses":   responses(obj{"200": one}, http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusPreconditionFailed),
+		},
+	}
+	switch {
+	case d.NeverDelete():
+		item["delete"] = obj{
+			"tags": tags, "operationId": "delete" + d.Struct, "summary": d.Endpoint + " may not be deleted.",
+			"parameters": idParams,
+			"responses":  responses(obj{}, http.StatusMethodNotAllowed),
+		}
+	default:
+		summary := "Delete one of " + d.Endpoint + "."
+		if d.SoftDelete() {
+			summary = "Delete one of " + d.Endpoint + "; administrators may restore it."
+		}
+		item["delete"] = obj{
+			"tags": tags, "operationId": "delete" + d.Struct, "summary": summary,
+			"parameters": []obj{paramRef("id"), paramRef("If-Match")},
+			"responses":  responses(obj{"204": obj{"description": "Deleted."}}, http.StatusNotFound, http.StatusPreconditionFailed),
+		}
+	}
+	paths[base+"/{id}"] = item
+
+	paths[base+"/{id}/history"] = obj{"get": obj{
+		"tags": tags, "operationId": "history" + d.Struct, "summary": "Audit history of one of " + d.Endpoint + ", oldest first." + readNote,
+		"parameters": idParams,
+		"responses":  readResponses(obj{"200": obj{"description": "Audit entries.", "content": jsonContent(arrayOf(schemaRef("Change")))}}, http.StatusNotFound),
+	}}
+	changeParams := []obj{paramRef("limit"), paramRef("offset"), paramRef("minChangeVersion"), paramRef("maxChangeVersion")}
+	paths[base+"/deletes"] = obj{"get": obj{
+		"tags": tags, "operationId": "deletes" + d.Struct, "summary": "Deleted " + d.Endpoint + ", for Change Queries." + readNote,
+		"parameters": changeParams,
+		"responses":  readResponses(obj{"200": obj{"description": "Deletes, oldest first.", "content": jsonContent(arrayOf(schemaRef("Delete")))}}, http.StatusBadRequest),
+	}}
+	paths[base+"/keyChanges"] = obj{"get": obj{
+		"tags": tags, "operationId": "keyChanges" + d.Struct, "summary": "Natural key changes of " + d.Endpoint + ", for Change Queries." + readNote,
+		"parameters": changeParams,
+		"responses":  readResponses(obj{"200": obj{"description": "Key changes, oldest first.", "content": jsonContent(arrayOf(schemaRef("KeyChange")))}}, http.StatusBadRequest),
+	}}
+	if d.SoftDelete() {
+		paths[base+"/{id}/restore"] = obj{"post": obj{
+			"tags": tags, "operationId": "restore" + d.Struct, "summary": "Restore a deleted one of " + d.Endpoint + "; administrators only.",
+			"parameters": idParams,
+			"responses":  responses(obj{"200": one}, http.StatusForbidden, http.StatusNotFound, http.StatusConflict),
+		}}
+	}
+	if d.Bulk {
+		paths[base+"/bulk"] = obj{"post": obj{
+			"tags": tags, "operationId": "bulk" + d.Struct,
+			"summary": "Upsert " + d.Endpoint + " by natural key, up to 1000 at once or 100000 as an async job.",
+			"parameters": []obj{{
+				"name": "async", "in": "query", "schema": obj{"type": "boolean"},
+				"description": "Run as a background job, answering 202 with the job.",
+			}},
+			"requestBody": obj{"required": true, "content": obj{
+				"application/json":     obj{"schema": arrayOf(res)},
+				"application/x-ndjson": obj{"schema": obj{"type": "string"}},
+			}},
+			"responses": responses(obj{
+				"200": obj{"description": "Per-record results.", "content": jsonContent(schemaRef("BulkReport"))},
+				"202": obj{
+					"description": "Job started.",
+					"headers":     obj{"Location": obj{"description": "URL of the job.", "schema": obj{"type": "string"}}},
+					"content":     jsonContent(schemaRef("Job")),
+				},
+			}, http.StatusBadRequest, http.StatusRequestEntityTooLarge),
+		}}
+	}
+	return paths
+}
+
+// descriptorPaths returns the path items of the descriptor endpoints, which
+// are hand-written rather than generated.
+func descriptorPaths() obj {
+	paths := obj{}
+	tags := []string{"descriptors"}
+	one := obj{"description": "The descriptor.", "content": jsonContent(schemaRef("Descriptor"))}
+	idParams := []obj{{"name": "id", "in": "path", "required": true, "schema": obj{"type": "integer"}}}
+	for _, t := range descriptor.Types {
+		base := "/ed-fi/" + strings.ToLower(t[:1]) + t[1:] + "Descriptors"
+		paths[base] = obj{
+			"get": obj{
+				"tags": tags, "operationId": "list" + t + "Descriptors", "summary": "List " + t + " descriptors.",
+				"parameters": []obj{paramRef("limit"), paramRef("offset"), paramRef("cursor"), paramRef("totalCount"), paramRef("sort"), paramRef("fields")},
+				"responses":  responses(obj{"200": obj{"description": "A page of descriptors.", "content": jsonContent(arrayOf(schemaRef("Descriptor")))}}, http.StatusBadRequest),
+			},
+			"post": obj{
+				"tags": tags, "operationId": "create" + t + "Descriptor", "summary": "Add a " + t + " descriptor outside the ed-fi.org namespace; administrators only.",
+				"requestBody": obj{"required": true, "content": jsonContent(schemaRef("Descriptor"))},
+				"responses":   responses(obj{"201": one}, http.StatusBadRequest, http.StatusForbidden, http.StatusConflict),
+			},
+		}
+		paths[base+"/{id}"] = obj{
+			"get": obj{
+				"tags": tags, "operationId": "get" + t + "Descriptor", "summary": "Get a " + t + " descriptor.",
+				"parameters": idParams,
+				"responses":  responses(obj{"200": one}, http.StatusNotFound),
+			},
+			"put": obj{
+				"tags": tags, "operationId": "update" + t + "Descriptor", "summary": "Replace a district " + t + " descriptor; administrators only.",
+				"parameters":  idParams,
+				"requestBody": obj{"required": true, "content": jsonContent(schemaRef("Descriptor"))},
+				"responses":   responses(obj{"200": one}, http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound),
+			},
+			"delete": obj{
+				"tags": tags, "operationId": "delete" + t + "Descriptor", "summary": "Delete a district " + t + " descriptor; administrators only.",
+				"parameters": idParams,
+				"responses":  responses(obj{"204": obj{"description": "Deleted."}}, http.StatusForbidden, http.StatusNotFound),
+			},
+		}
+	}
+	return paths
+}
+
+// sharedSchemas are the component schemas of the resource package's types.
+var sharedSchemas = obj{
+	"FieldError": obj{"type": "object", "properties": obj{
+		"field": obj{"type": "string"}, "message": obj{"type": "string"},
+	}},
+	"Problem": obj{"type": "object", "required": []string{"type", "title", "status", "code"}, "properties": obj{
+		"type": obj{"type": "string"}, "title": obj{"type": "string"}, "status": obj{"type": "integer"},
+		"detail": obj{"type": "string"}, "instance": obj{"type": "string"},
+		"code":          obj{"type": "string", "description": "Stable error code, e.g. NOT_FOUND."},
+		"errors":        arrayOf(schemaRef("FieldError")),
+		"correlationId": obj{"type": "string", "description": "The request's X-Request-ID, to quote when reporting an error."},
+	}},
+	"Change": obj{"type": "object", "properties": obj{
+		"changeId": obj{"type": "integer"}, "operation": obj{"type": "string"},
+		"before": obj{}, "after": obj{},
+		"actor": obj{"type": []string{"string", "null"}}, "requestId": obj{"type": []string{"string", "null"}},
+		"changedAt": obj{"type": "string", "format": "date-time"},
+	}},
+	"Delete": obj{"type": "object", "properties": obj{
+		"id": obj{"type": "string", "format": "uuid"}, "changeVersion": obj{"type": "integer"},
+		"keyValues": obj{"type": "object"},
+	}},
+	"KeyChange": obj{"type": "object", "properties": obj{
+		"id": obj{"type": "string", "format": "uuid"}, "changeVersion": obj{"type": "integer"},
+		"oldKeyValues": obj{"type": "object"}, "newKeyValues": obj{"type": "object"},
+	}},
+	"ChangeVersions": obj{"type": "object", "properties": obj{
+		"oldestChangeVersion": obj{"type": "integer"}, "newestChangeVersion": obj{"type": "integer"},
+	}},
+	"BulkResult": obj{"type": "object", "properties": obj{
+		"index": obj{"type": "integer"}, "status": obj{"type": "integer"},
+		"id": obj{"type": "string", "format": "uuid"}, "_etag": obj{"type": "string"},
+		"error": schemaRef("Problem"),
+	}},
+	"BulkReport": obj{"type": "object", "properties": obj{
+		"total": obj{"type": "integer"}, "succeeded": obj{"type": "integer"}, "failed": obj{"type": "integer"},
+		"results": arrayOf(schemaRef("BulkResult")),
+	}},
+	"Job": obj{"type": "object", "properties": obj{
+		"id": obj{"type": "string", "format": "uuid"}, "resource": obj{"type": "string"},
+		"status": obj{"type": "string", "enum": []string{"running", "completed", "failed"}},
+		"total":  obj{"type": "integer"}, "succeeded": obj{"type": "integer"}, "failed": obj{"type": "integer"},
+		"results": arrayOf(schemaRef("BulkResult")), "error": obj{"type": "string"},
+		"createdBy": obj{"type": "string"}, "createdAt": obj{"type": "string", "format": "date-time"},
+		"completedAt": obj{"type": []string{"string", "null"}, "format": "date-time"},
+	}},
+	"Descriptor": obj{"type": "object", "required": []string{"namespace", "codeValue", "shortDescription"}, "properties": obj{
+		"descriptorId": obj{"type": "integer", "readOnly": true}, "namespace": obj{"type": "string"},
+		"codeValue": obj{"type": "string"}, "shortDescription": obj{"type": "string"},
+		"description":        obj{"type": []string{"string", "null"}},
+		"effectiveBeginDate": obj{"type": []string{"string", "null"}, "format": "date"},
+		"effectiveEndDate":   obj{"type": []string{"string", "null"}, "format": "date"},
+		"_etag":              obj{"type": "string", "readOnly": true},
+	}},
+}
+
+// sharedParameters are the component parameters used across resources.
+var sharedParameters = obj{
+	"id":               obj{"name": "id", "in": "path", "required": true, "schema": obj{"type": "string", "format": "uuid"}},
+	"limit":            obj{"name": "limit", "in": "query", "schema": obj{"type": "integer", "minimum": 1, "maximum": 500, "default": 50}},
+	"offset":           obj{"name": "offset", "in": "query", "schema": obj{"type": "integer", "minimum": 0}},
+	"cursor":           obj{"name": "cursor", "in": "query", "schema": obj{"type": "string"}, "description": "Keyset paging token from a Link rel=\"next\" URL."},
+	"totalCount":       obj{"name": "totalCount", "in": "query", "schema": obj{"type": "boolean"}, "description": "Report the filtered row count in Total-Count."},
+	"sort":             obj{"name": "sort", "in": "query", "schema": obj{"type": "string"}, "description": "Comma-separated properties; a leading - sorts descending."},
+	"fields":           obj{"name": "fields", "in": "query", "schema": obj{"type": "string"}, "description": "Comma-separated properties to return."},
+	"minChangeVersion": obj{"name": "minChangeVersion", "in": "query", "schema": obj{"type": "integer"}, "description": "Only rows changed at or after this version."},
+	"maxChangeVersion": obj{"name": "maxChangeVersion", "in": "query", "schema": obj{"type": "integer"}, "description": "Only rows changed at or before this version."},
+	"If-Match":         obj{"name": "If-Match", "in": "header", "schema": obj{"type": "string"}, "description": "ETag the write is conditional on."},
+}
+
+// openAPI renders the plugin's OpenAPI 3.1 document, with paths relative to
+// its prefix. Stub domains, which answer 501, are left out.
+func openAPI(domains []Domain, byName map[string]Domain) ([]byte, error) {
+	schemas := obj{}
+	for name, s := range sharedSchemas {
+		schemas[name] = s
+	}
+	errs := obj{}
+	for status, name := range errorResponses {
+		errs[name] = obj{"description": http.StatusText(status) + ".", "content": obj{
+			"application/problem+json": obj{"schema": schemaRef("Problem")},
+		}}
+	}
+
+	paths := descriptorPaths()
+	for _, d := range domains {
+		if !d.HasTable() {
+			continue
+		}
+		schemas[d.Struct] = d.schema(byName)
+		for path, item := range d.paths() {
+			paths[path] = item
+		}
+	}
+	paths["/ChangeQueries/v1/availableChangeVersions"] = obj{"get": obj{
+		"tags": []string{"ChangeQueries"}, "operationId": "availableChangeVersions",
+		"summary":   "The range of change versions a client may query.",
+		"responses": responses(obj{"200": obj{"description": "Change versions.", "content": jsonContent(schemaRef("ChangeVersions"))}}),
+	}}
+	paths["/bulk/v1/jobs/{id}"] = obj{"get": obj{
+		"tags": []string{"bulk"}, "operationId": "getBulkJob",
+		"summary":    "Status and results of an async bulk job, visible to its creator and administrators.",
+		"parameters": []obj{paramRef("id")},
+		"responses":  responses(obj{"200": obj{"description": "The job.", "content": jsonContent(schemaRef("Job"))}}, http.StatusNotFound),
+	}}
+
+	doc := obj{
+		"openapi": "3.1.0",
+		"info": obj{
+			"title":       "Oasis Common API",
+			"version":     "1.0.0",
+			"description": "Ed-Fi resources served by the common plugin. Generated by generate.go; do not edit.",
+		},
+		"paths":      paths,
+		"components": obj{"schemas": schemas, "responses": errs, "parameters": sharedParameters},
+	}
+	out, err := json.MarshalIndent(doc, "", "  ")
+	return append(out, '\n'), err
 }
@@ -2,7 +2,11 @@
 package assessment
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+
+	"github.com/catdevman/oasis/plugin/common/internal/resource"
 )
 
 type Repository struct {
@@ -13,34 +17,88 @@ func NewRepository(db *sql.DB) *Repository {
 	return &Repository{db: db}
 }
 
+var columns = []resource.Column{
+	resource.IDColumn,
+	{Name: "AssessmentIdentifier", JSON: "assessmentidentifier", Type: resource.String, Required: true, Filter: true, Key: true},
+	{Name: "AssessmentTitle", JSON: "assessmenttitle", Type: resource.String, Required: true, Filter: true},
+}
+
+// schema describes the resource to expand=, for expanding both its own
+// references and references into it.
+var schema = resource.Schema{
+	Name:       "assessment",
+	Table:      "Assessment",
+	Columns:    columns,
+	SoftDelete: true,
+}
+
+func init() {
+	resource.RegisterSchema(&schema)
+}
+
+// Assessment is identified by Id; its natural key is AssessmentIdentifier.
 type Assessment struct {
-	Field0 *string `json:"assessmentidentifier"`
+	Id *string `json:"id"`
+
+	AssessmentIdentifier *string `json:"assessmentidentifier"`
 
-	Field1 *string `json:"assessmenttitle"`
+	AssessmentTitle *string `json:"assessmenttitle"`
+
+	ETag *string `json:"_etag"`
 }
 
-func (r *Repository) List(limit, offset int) ([]Assessment, error) {
-	rows, err := r.db.Query("SELECT AssessmentIdentifier, AssessmentTitle FROM Assessment LIMIT $1 OFFSET $2", limit, offset)
+// targets returns scan destinations for cols, in order.
+func (s *Assessment) targets(cols []resource.Column) []interface{} {
+	dest := make([]interface{}, len(cols))
+	for i, c := range cols {
+		switch c.Name {
+		case resource.IDColumn.Name:
+			dest[i] = &s.Id
+		case "AssessmentIdentifier":
+			dest[i] = &s.AssessmentIdentifier
+		case "AssessmentTitle":
+			dest[i] = &s.AssessmentTitle
+		case resource.VersionColumn.Name:
+			dest[i] = &s.ETag
+		}
+	}
+	return dest
+}
+
+func (r *Repository) List(ctx context.Context, q resource.ListQuery) ([]Assessment, error) {
+	q = q.NotDeleted()
+	query, args := q.SQL("Assessment", columns)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	selected := q.Selected(columns)
 	var items []Assessment
 	for rows.Next() {
 		var s Assessment
-		if err := rows.Scan(&s.Field0, &s.Field1); err != nil {
+		if err := rows.Scan(s.targets(selected)...); err != nil {
 			return nil, err
 		}
 		items = append(items, s)
 	}
-	return items, nil
+	return items, rows.Err()
+}
+
+// Count returns the number of rows matching the query's filters.
+func (r *Repository) Count(ctx context.Context, q resource.ListQuery) (int64, error) {
+	q = q.NotDeleted()
+	query, args := q.CountSQL("Assessment")
+	var n int64
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(&n)
+	return n, err
 }
 
-func (r *Repository) Get(id string) (*Assessment, error) {
-	row := r.db.QueryRow("SELECT AssessmentIdentifier, AssessmentTitle FROM Assessment WHERE AssessmentIdentifier = $1", id)
+func (r *Repository) Get(ctx context.Context, id string) (*Assessment, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT Id, AssessmentIdentifier, AssessmentTitle, RowVersion::text FROM Assessment WHERE Id = $1 AND DeletedAt IS NULL", id)
 	var s Assessment
-	if err := row.Scan(&s.Field0, &s.Field1); err != nil {
+	if err := row.Scan(&s.Id, &s.AssessmentIdentifier, &s.AssessmentTitle, &s.ETag); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
@@ -49,7 +107,144 @@ func (r *Repository) Get(id string) (*Assessment, error) {
 	return &s, nil
 }
 
-func (r *Repository) Delete(id string) error {
-	_, err := r.db.Exec("DELETE FROM Assessment WHERE AssessmentIdentifier = $1", id)
-	return err
+// Create inserts s and sets s.Id and s.ETag to the new row's id and
+// version. The write is attributed to the Actor carried by ctx in the audit
+// history.
+func (r *Repository) Create(ctx context.Context, s *Assessment) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = tx.QueryRowContext(ctx, "INSERT INTO Assessment (AssessmentIdentifier, AssessmentTitle) VALUES ($1, $2) RETURNING Id, RowVersion::text",
+		s.AssessmentIdentifier, s.AssessmentTitle).Scan(&s.Id, &s.ETag)
+	if err != nil {
+		return resource.FromDB(err)
+	}
+	return tx.Commit()
+}
+
+// Bulk upserts records by natural key in one transaction: rows whose key
+// exists are overwritten and the rest are inserted. Each record's outcome
+// is reported in the returned report.
+func (r *Repository) Bulk(ctx context.Context, records []json.RawMessage) (resource.BulkReport, error) {
+	return resource.Bulk(ctx, r.db, records, columns, func(tx *sql.Tx, raw json.RawMessage) (resource.Written, error) {
+		var w resource.Written
+		var s Assessment
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return w, resource.FieldErrors{{Field: "", Message: err.Error()}}
+		}
+		err := tx.QueryRowContext(ctx, "INSERT INTO Assessment AS t (AssessmentIdentifier, AssessmentTitle) VALUES ($1, $2) ON CONFLICT (AssessmentIdentifier) DO UPDATE SET AssessmentTitle = EXCLUDED.AssessmentTitle, RowVersion = t.RowVersion + 1 WHERE t.DeletedAt IS NULL RETURNING Id, RowVersion::text, xmax = 0",
+			s.AssessmentIdentifier, s.AssessmentTitle).Scan(&w.ID, &w.Version, &w.Created)
+		if err == sql.ErrNoRows {
+			// The key belongs to a soft-deleted row, which must be restored first.
+			return w, resource.ErrConflict
+		}
+		return w, resource.FromDB(err)
+	})
+}
+
+// StartBulk runs Bulk in a background job and returns the job.
+func (r *Repository) StartBulk(ctx context.Context, records []json.RawMessage) (*resource.Job, error) {
+	return resource.StartJob(ctx, r.db, "assessments", records, r.Bulk)
+}
+
+// Update overwrites the row with the given id, natural key included, if its
+// version still matches (an empty version matches any) and sets s.ETag to
+// the bumped version.
+func (r *Repository) Update(ctx context.Context, id, version string, s *Assessment) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = tx.QueryRowContext(ctx, "UPDATE Assessment SET AssessmentIdentifier = $1, AssessmentTitle = $2, RowVersion = RowVersion + 1 WHERE Id = $3 AND DeletedAt IS NULL AND ($4 = '' OR RowVersion::text = $4) RETURNING RowVersion::text",
+		s.AssessmentIdentifier, s.AssessmentTitle, id, version).Scan(&s.ETag)
+	if err == sql.ErrNoRows {
+		return missOrStale(ctx, tx, id)
+	}
+	if err != nil {
+		return resource.FromDB(err)
+	}
+	s.Id = &id
+	return tx.Commit()
+}
+
+// Delete soft-deletes the row with the given id if its version still matches: it
+// stays in the table, hidden from reads, until an admin restores it.
+func (r *Repository) Delete(ctx context.Context, id, version string) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, "UPDATE Assessment SET DeletedAt = now(), RowVersion = RowVersion + 1 WHERE Id = $1 AND DeletedAt IS NULL AND ($2 = '' OR RowVersion::text = $2)", id, version)
+	if err != nil {
+		return resource.FromDB(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return missOrStale(ctx, tx, id)
+	}
+	return tx.Commit()
+}
+
+// Restore undoes a soft delete. It returns resource.ErrConflict when the
+// row exists but is not deleted.
+func (r *Repository) Restore(ctx context.Context, id string) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var deleted bool
+	err = tx.QueryRowContext(ctx, "SELECT DeletedAt IS NOT NULL FROM Assessment WHERE Id = $1 FOR UPDATE", id).Scan(&deleted)
+	switch {
+	case err == sql.ErrNoRows:
+		return resource.ErrNotFound
+	case err != nil:
+		return err
+	case !deleted:
+		return resource.ErrConflict
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE Assessment SET DeletedAt = NULL, RowVersion = RowVersion + 1 WHERE Id = $1", id); err != nil {
+		return resource.FromDB(err)
+	}
+	return tx.Commit()
+}
+
+// missOrStale explains a conditional write that matched no row.
+func missOrStale(ctx context.Context, tx *sql.Tx, id string) error {
+	var one int
+	err := tx.QueryRowContext(ctx, "SELECT 1 FROM Assessment WHERE Id = $1 AND DeletedAt IS NULL", id).Scan(&one)
+	switch {
+	case err == sql.ErrNoRows:
+		return resource.ErrNotFound
+	case err != nil:
+		return err
+	}
+	return resource.ErrPreconditionFailed
+}
+
+// History returns the audit history of the row with the given id, oldest first.
+func (r *Repository) History(ctx context.Context, id string, q resource.ListQuery) ([]resource.Change, error) {
+	return resource.History(ctx, r.db, "Assessment", id, q)
+}
+
+// Deletes returns the rows deleted within q's change version bounds.
+func (r *Repository) Deletes(ctx context.Context, q resource.ListQuery) ([]resource.Delete, error) {
+	return resource.Deletes(ctx, r.db, "Assessment", q)
+}
+
+// KeyChanges returns the natural key changes within q's change version bounds.
+func (r *Repository) KeyChanges(ctx context.Context, q resource.ListQuery) ([]resource.KeyChange, error) {
+	return resource.KeyChanges(ctx, r.db, "Assessment", q)
+}
+
+// Expand embeds the references named by e in items.
+func (r *Repository) Expand(ctx context.Context, items interface{}, e resource.Expansion) ([]map[string]json.RawMessage, error) {
+	return resource.Expand(ctx, r.db, &schema, items, e)
 }
@@ -3,13 +3,20 @@ package attendance
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"strconv"
+
+	"github.com/catdevman/oasis/plugin/common/internal/resource"
 )
 
 type Handler struct {
-	repo *Repository
+	repo     *Repository
+	basePath string
+	jobsPath string
 }
 
 func NewHandler(repo *Repository) *Handler {
@@ -22,49 +29,100 @@ func (h *Handler) Register(mux *http.ServeMux) {
 		prefix = "api/common"
 	}
 	basePath := "/" + prefix + "/ed-fi/attendances"
+	h.basePath = basePath
 	mux.HandleFunc("GET "+basePath, h.list)
 	mux.HandleFunc("GET "+basePath+"/{id}", h.get)
 	mux.HandleFunc("POST "+basePath, h.create)
 	mux.HandleFunc("PUT "+basePath+"/{id}", h.update)
-	mux.HandleFunc("DELETE "+basePath+"/{id}", h.delete)
+	mux.HandleFunc("DELETE "+basePath+"/{id}", h.deleteForbidden)
+	mux.HandleFunc("GET "+basePath+"/{id}/history", h.history)
+	mux.HandleFunc("GET "+basePath+"/deletes", h.deletes)
+	mux.HandleFunc("GET "+basePath+"/keyChanges", h.keyChanges)
+	h.jobsPath = "/" + prefix + "/bulk/v1/jobs"
+	mux.HandleFunc("POST "+basePath+"/bulk", h.bulk)
 }
 
 func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
-	limit := 50
-	offset := 0
-	if l := r.URL.Query().Get("limit"); l != "" {
-		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
-			limit = parsed
-		}
+	q, errs := resource.ParseListQuery(r.URL.Query(), columns)
+	if len(errs) > 0 {
+		resource.WriteFieldErrors(w, r, errs)
+		return
 	}
-	if o := r.URL.Query().Get("offset"); o != "" {
-		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
-			offset = parsed
-		}
+	expand, ok := resource.ExpandParam(w, r, &schema)
+	if !ok {
+		return
 	}
-	items, err := h.repo.List(limit, offset)
+	q.Fields = expand.Fields(&schema, q.Fields)
+	items, err := h.repo.List(r.Context(), q)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		resource.WriteRepoError(w, r, err)
 		return
 	}
 	if items == nil {
 		items = make([]Attendance, 0)
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(items)
+	page := resource.Page{Total: -1}
+	if len(items) > q.Limit {
+		items = items[:q.Limit]
+		page.HasNext = true
+		page.Next = q.NextCursor(items[len(items)-1].targets(q.OrderColumns()))
+	}
+	if q.TotalCount {
+		if page.Total, err = h.repo.Count(r.Context(), q); err != nil {
+			resource.WriteRepoError(w, r, err)
+			return
+		}
+	}
+	q.WriteHeaders(w, r.URL, page)
+	projected, err := resource.Project(items, q.Fields)
+	if err != nil {
+		resource.WriteRepoError(w, r, err)
+		return
+	}
+	if len(expand) > 0 {
+		if projected, err = h.repo.Expand(r.Context(), projected, expand); err != nil {
+			resource.WriteRepoError(w, r, err)
+			return
+		}
+	}
+	if err := resource.WriteTagged(w, r, projected); err != nil {
+		resource.WriteRepoError(w, r, err)
+	}
 }
 
 func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
-	item, err := h.repo.Get(id)
+	id, ok := resource.PathID(w, r)
+	if !ok {
+		return
+	}
+	expand, ok := resource.ExpandParam(w, r, &schema)
+	if !ok {
+		return
+	}
+	item, err := h.repo.Get(r.Context(), id)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		resource.WriteRepoError(w, r, err)
 		return
 	}
 	if item == nil {
-		w.WriteHeader(http.StatusNotFound)
+		resource.WriteRepoError(w, r, resource.ErrNotFound)
+		return
+	}
+	if len(expand) > 0 {
+		// The row version does not cover the expanded resources, so the
+		// ETag is taken from the whole body instead.
+		expanded, err := h.repo.Expand(r.Context(), []*Attendance{item}, expand)
+		if err != nil {
+			resource.WriteRepoError(w, r, err)
+			return
+		}
+		if err := resource.WriteTagged(w, r, expanded[0]); err != nil {
+			resource.WriteRepoError(w, r, err)
+		}
+		return
+	}
+	w.Header().Set("ETag", resource.FormatETag(*item.ETag))
+	if resource.NotModified(w, r) {
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -72,23 +130,172 @@ func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"message": "created"})
+	item, ok := decode(w, r)
+	if !ok {
+		return
+	}
+	if err := h.repo.Create(resource.ActorContext(r), item); err != nil {
+		resource.WriteRepoError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", h.basePath+"/"+*item.Id)
+	w.Header().Set("ETag", resource.FormatETag(*item.ETag))
+	resource.WriteJSON(w, http.StatusCreated, item)
 }
 
 func (h *Handler) update(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"message": "updated"})
+	id, ok := resource.PathID(w, r)
+	if !ok {
+		return
+	}
+	version, ok := resource.IfMatch(w, r)
+	if !ok {
+		return
+	}
+	item, ok := decode(w, r)
+	if !ok {
+		return
+	}
+	if item.Id != nil && *item.Id != id {
+		resource.WriteFieldErrors(w, r, []resource.FieldError{
+			{Field: "id", Message: "must match the id in the URL"},
+		})
+		return
+	}
+	if err := h.repo.Update(resource.ActorContext(r), id, version, item); err != nil {
+		resource.WriteRepoError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", resource.FormatETag(*item.ETag))
+	resource.WriteJSON(w, http.StatusOK, item)
+}
+
+// decode reads and validates the request body, writing a 400 listing every
+// invalid field when it does not match the resource's columns.
+func decode(w http.ResponseWriter, r *http.Request) (*Attendance, bool) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		resource.WriteError(w, r, http.StatusBadRequest, "INVALID_REQUEST", "could not read request body")
+		return nil, false
+	}
+	if errs := resource.Validate(body, columns); len(errs) > 0 {
+		resource.WriteFieldErrors(w, r, errs)
+		return nil, false
+	}
+	var item Attendance
+	if err := json.Unmarshal(body, &item); err != nil {
+		resource.WriteError(w, r, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		return nil, false
+	}
+	return &item, true
 }
 
-func (h *Handler) delete(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
-	err := h.repo.Delete(id)
+// bulk upserts many records at once, sent as a JSON array or as NDJSON
+// (Content-Type application/x-ndjson). With async=true the records are
+// written by a background job and the response is 202 pointing at it.
+func (h *Handler) bulk(w http.ResponseWriter, r *http.Request) {
+	async := false
+	if v := r.URL.Query().Get("async"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			resource.WriteFieldErrors(w, r, []resource.FieldError{{Field: "async", Message: "must be true or false"}})
+			return
+		}
+		async = b
+	}
+	limit := resource.MaxBulkRecords
+	if async {
+		limit = resource.MaxBulkJobRecords
+	}
+	records, err := resource.ReadBulk(r, limit)
+	if errors.Is(err, resource.ErrTooManyRecords) {
+		msg := fmt.Sprintf("at most %d records per request; send larger payloads with async=true", limit)
+		if async {
+			msg = fmt.Sprintf("at most %d records per job", limit)
+		}
+		resource.WriteError(w, r, http.StatusRequestEntityTooLarge, "TOO_MANY_RECORDS", msg)
+		return
+	}
+	if err != nil {
+		resource.WriteError(w, r, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		return
+	}
+	if async {
+		job, err := h.repo.StartBulk(resource.ActorContext(r), records)
+		if err != nil {
+			resource.WriteRepoError(w, r, err)
+			return
+		}
+		w.Header().Set("Location", h.jobsPath+"/"+job.ID)
+		resource.WriteJSON(w, http.StatusAccepted, job)
+		return
+	}
+	report, err := h.repo.Bulk(resource.ActorContext(r), records)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		resource.WriteRepoError(w, r, err)
+		return
+	}
+	resource.WriteJSON(w, http.StatusOK, report)
+}
+
+// history lists the audit entries for one resource, oldest first. It pages
+// with limit and offset only.
+func (h *Handler) history(w http.ResponseWriter, r *http.Request) {
+	id, ok := resource.PathID(w, r)
+	if !ok {
+		return
+	}
+	q, errs := resource.ParseListQuery(r.URL.Query(), nil)
+	if len(errs) > 0 {
+		resource.WriteFieldErrors(w, r, errs)
 		return
 	}
-	w.WriteHeader(http.StatusNoContent)
+	changes, err := h.repo.History(r.Context(), id, q)
+	if err != nil {
+		resource.WriteRepoError(w, r, err)
+		return
+	}
+	if len(changes) == 0 && q.Offset == 0 {
+		resource.WriteError(w, r, http.StatusNotFound, "NOT_FOUND", "resource has no history")
+		return
+	}
+	resource.WriteJSON(w, http.StatusOK, changes)
+}
+
+// deletes lists deleted resources for Ed-Fi Change Queries. It pages with
+// limit and offset and honours minChangeVersion and maxChangeVersion.
+func (h *Handler) deletes(w http.ResponseWriter, r *http.Request) {
+	q, errs := resource.ParseListQuery(r.URL.Query(), nil)
+	if len(errs) > 0 {
+		resource.WriteFieldErrors(w, r, errs)
+		return
+	}
+	deletes, err := h.repo.Deletes(r.Context(), q)
+	if err != nil {
+		resource.WriteRepoError(w, r, err)
+		return
+	}
+	resource.WriteJSON(w, http.StatusOK, deletes)
+}
+
+// keyChanges lists natural key changes for Ed-Fi Change Queries.
+func (h *Handler) keyChanges(w http.ResponseWriter, r *http.Request) {
+	q, errs := resource.ParseListQuery(r.URL.Query(), nil)
+	if len(errs) > 0 {
+		resource.WriteFieldErrors(w, r, errs)
+		return
+	}
+	changes, err := h.repo.KeyChanges(r.Context(), q)
+	if err != nil {
+		resource.WriteRepoError(w, r, err)
+		return
+	}
+	resource.WriteJSON(w, http.StatusOK, changes)
+}
+
+// deleteForbidden rejects DELETE: attendances are kept for the record and
+// are corrected with PUT instead.
+func (h *Handler) deleteForbidden(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Allow", "GET, PUT")
+	resource.WriteError(w, r, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "attendances may not be deleted; correct them with PUT")
 }
@@ -2,7 +2,11 @@
 package attendance
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+
+	"github.com/catdevman/oasis/plugin/common/internal/resource"
 )
 
 type Repository struct {
@@ -13,34 +17,105 @@ func NewRepository(db *sql.DB) *Repository {
 	return &Repository{db: db}
 }
 
+var columns = []resource.Column{
+	resource.IDColumn,
+	{Name: "CourseSectionIdentifier", JSON: "coursesectionidentifier", Type: resource.String, Required: true, Filter: true, Key: true},
+	{Name: "AttendanceEventType", JSON: "attendanceeventtype", Type: resource.String, Required: false, Filter: true},
+	{Name: "StudentUniqueId", JSON: "studentuniqueid", Type: resource.String, Required: true, Filter: true, Key: true},
+	{Name: "AttendanceEventDate", JSON: "attendanceeventdate", Type: resource.Date, Required: true, Filter: true, Key: true},
+	{Name: "AttendanceStatus", JSON: "attendancestatus", Type: resource.String, Required: false, Filter: true, Descriptor: "AttendanceEventCategory"},
+}
+
+// schema describes the resource to expand=, for expanding both its own
+// references and references into it.
+var schema = resource.Schema{
+	Name:    "attendance",
+	Table:   "edfi.StudentSectionAttendanceEvent",
+	Columns: columns,
+	Refs: []resource.Ref{
+		{Name: "section", Target: "section", Cols: []string{"CourseSectionIdentifier"}},
+		{Name: "student", Target: "student", Cols: []string{"StudentUniqueId"}},
+	},
+	SoftDelete: false,
+}
+
+func init() {
+	resource.RegisterSchema(&schema)
+}
+
+// Attendance is identified by Id; its natural key is CourseSectionIdentifier, StudentUniqueId, AttendanceEventDate.
 type Attendance struct {
-	Field0 *string `json:"coursesectionidentifier"`
+	Id *string `json:"id"`
 
-	Field1 *string `json:"attendanceeventtype"`
+	CourseSectionIdentifier *string `json:"coursesectionidentifier"`
+
+	AttendanceEventType *string `json:"attendanceeventtype"`
+
+	StudentUniqueId *string `json:"studentuniqueid"`
+
+	AttendanceEventDate *string `json:"attendanceeventdate"`
+
+	AttendanceStatus *string `json:"attendancestatus"`
+
+	ETag *string `json:"_etag"`
 }
 
-func (r *Repository) List(limit, offset int) ([]Attendance, error) {
-	rows, err := r.db.Query("SELECT CourseSectionIdentifier, AttendanceEventType FROM edfi.StudentSectionAttendanceEvent LIMIT $1 OFFSET $2", limit, offset)
+// targets returns scan destinations for cols, in order.
+func (s *Attendance) targets(cols []resource.Column) []interface{} {
+	dest := make([]interface{}, len(cols))
+	for i, c := range cols {
+		switch c.Name {
+		case resource.IDColumn.Name:
+			dest[i] = &s.Id
+		case "CourseSectionIdentifier":
+			dest[i] = &s.CourseSectionIdentifier
+		case "AttendanceEventType":
+			dest[i] = &s.AttendanceEventType
+		case "StudentUniqueId":
+			dest[i] = &s.StudentUniqueId
+		case "AttendanceEventDate":
+			dest[i] = &s.AttendanceEventDate
+		case "AttendanceStatus":
+			dest[i] = &s.AttendanceStatus
+		case resource.VersionColumn.Name:
+			dest[i] = &s.ETag
+		}
+	}
+	return dest
+}
+
+func (r *Repository) List(ctx context.Context, q resource.ListQuery) ([]Attendance, error) {
+	query, args := q.SQL("edfi.StudentSectionAttendanceEvent", columns)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	selected := q.Selected(columns)
 	var items []Attendance
 	for rows.Next() {
 		var s Attendance
-		if err := rows.Scan(&s.Field0, &s.Field1); err != nil {
+		if err := rows.Scan(s.targets(selected)...); err != nil {
 			return nil, err
 		}
 		items = append(items, s)
 	}
-	return items, nil
+	return items, rows.Err()
 }
 
-func (r *Repository) Get(id string) (*Attendance, error) {
-	row := r.db.QueryRow("SELECT CourseSectionIdentifier, AttendanceEventType FROM edfi.StudentSectionAttendanceEvent WHERE CourseSectionIdentifier = $1", id)
+// Count returns the number of rows matching the query's filters.
+func (r *Repository) Count(ctx context.Context, q resource.ListQuery) (int64, error) {
+	query, args := q.CountSQL("edfi.StudentSectionAttendanceEvent")
+	var n int64
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(&n)
+	return n, err
+}
+
+func (r *Repository) Get(ctx context.Context, id string) (*Attendance, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT Id, CourseSectionIdentifier, AttendanceEventType, StudentUniqueId, to_char(AttendanceEventDate, 'YYYY-MM-DD'), AttendanceStatus, RowVersion::text FROM edfi.StudentSectionAttendanceEvent WHERE Id = $1", id)
 	var s Attendance
-	if err := row.Scan(&s.Field0, &s.Field1); err != nil {
+	if err := row.Scan(&s.Id, &s.CourseSectionIdentifier, &s.AttendanceEventType, &s.StudentUniqueId, &s.AttendanceEventDate, &s.AttendanceStatus, &s.ETag); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
@@ -49,7 +124,103 @@ func (r *Repository) Get(id string) (*Attendance, error) {
 	return &s, nil
 }
 
-func (r *Repository) Delete(id string) error {
-	_, err := r.db.Exec("DELETE FROM edfi.StudentSectionAttendanceEvent WHERE CourseSectionIdentifier = $1", id)
-	return err
+// Create inserts s and sets s.Id and s.ETag to the new row's id and
+// version. The write is attributed to the Actor carried by ctx in the audit
+// history.
+func (r *Repository) Create(ctx context.Context, s *Attendance) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := resource.CheckDescriptors(ctx, tx, columns, s.targets(columns)); err != nil {
+		return err
+	}
+	err = tx.QueryRowContext(ctx, "INSERT INTO edfi.StudentSectionAttendanceEvent (CourseSectionIdentifier, AttendanceEventType, StudentUniqueId, AttendanceEventDate, AttendanceStatus) VALUES ($1, $2, $3, $4, $5) RETURNING Id, RowVersion::text",
+		s.CourseSectionIdentifier, s.AttendanceEventType, s.StudentUniqueId, s.AttendanceEventDate, s.AttendanceStatus).Scan(&s.Id, &s.ETag)
+	if err != nil {
+		return resource.FromDB(err)
+	}
+	return tx.Commit()
+}
+
+// Bulk upserts records by natural key in one transaction: rows whose key
+// exists are overwritten and the rest are inserted. Each record's outcome
+// is reported in the returned report.
+func (r *Repository) Bulk(ctx context.Context, records []json.RawMessage) (resource.BulkReport, error) {
+	return resource.Bulk(ctx, r.db, records, columns, func(tx *sql.Tx, raw json.RawMessage) (resource.Written, error) {
+		var w resource.Written
+		var s Attendance
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return w, resource.FieldErrors{{Field: "", Message: err.Error()}}
+		}
+		if err := resource.CheckDescriptors(ctx, tx, columns, s.targets(columns)); err != nil {
+			return w, err
+		}
+		err := tx.QueryRowContext(ctx, "INSERT INTO edfi.StudentSectionAttendanceEvent AS t (CourseSectionIdentifier, AttendanceEventType, StudentUniqueId, AttendanceEventDate, AttendanceStatus) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (CourseSectionIdentifier, StudentUniqueId, AttendanceEventDate) DO UPDATE SET AttendanceEventType = EXCLUDED.AttendanceEventType, AttendanceStatus = EXCLUDED.AttendanceStatus, RowVersion = t.RowVersion + 1 RETURNING Id, RowVersion::text, xmax = 0",
+			s.CourseSectionIdentifier, s.AttendanceEventType, s.StudentUniqueId, s.AttendanceEventDate, s.AttendanceStatus).Scan(&w.ID, &w.Version, &w.Created)
+		return w, resource.FromDB(err)
+	})
+}
+
+// StartBulk runs Bulk in a background job and returns the job.
+func (r *Repository) StartBulk(ctx context.Context, records []json.RawMessage) (*resource.Job, error) {
+	return resource.StartJob(ctx, r.db, "attendances", records, r.Bulk)
+}
+
+// Update overwrites the row with the given id, natural key included, if its
+// version still matches (an empty version matches any) and sets s.ETag to
+// the bumped version.
+func (r *Repository) Update(ctx context.Context, id, version string, s *Attendance) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := resource.CheckDescriptors(ctx, tx, columns, s.targets(columns)); err != nil {
+		return err
+	}
+	err = tx.QueryRowContext(ctx, "UPDATE edfi.StudentSectionAttendanceEvent SET CourseSectionIdentifier = $1, AttendanceEventType = $2, StudentUniqueId = $3, AttendanceEventDate = $4, AttendanceStatus = $5, RowVersion = RowVersion + 1 WHERE Id = $6 AND ($7 = '' OR RowVersion::text = $7) RETURNING RowVersion::text",
+		s.CourseSectionIdentifier, s.AttendanceEventType, s.StudentUniqueId, s.AttendanceEventDate, s.AttendanceStatus, id, version).Scan(&s.ETag)
+	if err == sql.ErrNoRows {
+		return missOrStale(ctx, tx, id)
+	}
+	if err != nil {
+		return resource.FromDB(err)
+	}
+	s.Id = &id
+	return tx.Commit()
+}
+
+// missOrStale explains a conditional write that matched no row.
+func missOrStale(ctx context.Context, tx *sql.Tx, id string) error {
+	var one int
+	err := tx.QueryRowContext(ctx, "SELECT 1 FROM edfi.StudentSectionAttendanceEvent WHERE Id = $1", id).Scan(&one)
+	switch {
+	case err == sql.ErrNoRows:
+		return resource.ErrNotFound
+	case err != nil:
+		return err
+	}
+	return resource.ErrPreconditionFailed
+}
+
+// History returns the audit history of the row with the given id, oldest first.
+func (r *Repository) History(ctx context.Context, id string, q resource.ListQuery) ([]resource.Change, error) {
+	return resource.History(ctx, r.db, "edfi.StudentSectionAttendanceEvent", id, q)
+}
+
+// Deletes returns the rows deleted within q's change version bounds.
+func (r *Repository) Deletes(ctx context.Context, q resource.ListQuery) ([]resource.Delete, error) {
+	return resource.Deletes(ctx, r.db, "edfi.StudentSectionAttendanceEvent", q)
+}
+
+// KeyChanges returns the natural key changes within q's change version bounds.
+func (r *Repository) KeyChanges(ctx context.Context, q resource.ListQuery) ([]resource.KeyChange, error) {
+	return resource.KeyChanges(ctx, r.db, "edfi.StudentSectionAttendanceEvent", q)
+}
+
+// Expand embeds the references named by e in items.
+func (r *Repository) Expand(ctx context.Context, items interface{}, e resource.Expansion) ([]map[string]json.RawMessage, error) {
+	return resource.Expand(ctx, r.db, &schema, items, e)
 }
@@ -2,14 +2,15 @@
 package bellschedule
 
 import (
-	"encoding/json"
 	"net/http"
 	"os"
-	"strconv"
+
+	"github.com/catdevman/oasis/plugin/common/internal/resource"
 )
 
 type Handler struct {
-	repo *Repository
+	repo     *Repository
+	basePath string
 }
 
 func NewHandler(repo *Repository) *Handler {
@@ -22,39 +23,53 @@ func (h *Handler) Register(mux *http.ServeMux) {
 		prefix = "api/common"
 	}
 	basePath := "/" + prefix + "/ed-fi/bell-schedules"
+	h.basePath = basePath
 	mux.HandleFunc("GET "+basePath, h.list)
 	mux.HandleFunc("GET "+basePath+"/{id}", h.notImplemented)
 	mux.HandleFunc("POST "+basePath, h.notImplemented)
 	mux.HandleFunc("PUT "+basePath+"/{id}", h.notImplemented)
 	mux.HandleFunc("DELETE "+basePath+"/{id}", h.notImplemented)
+	mux.HandleFunc("GET "+basePath+"/{id}/history", h.notImplemented)
+	mux.HandleFunc("GET "+basePath+"/deletes", h.notImplemented)
+	mux.HandleFunc("GET "+basePath+"/keyChanges", h.notImplemented)
 }
 
 func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
-	limit := 50
-	offset := 0
-	if l := r.URL.Query().Get("limit"); l != "" {
-		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
-			limit = parsed
-		}
-	}
-	if o := r.URL.Query().Get("offset"); o != "" {
-		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
-			offset = parsed
-		}
+	q, errs := resource.ParseListQuery(r.URL.Query(), columns)
+	if len(errs) > 0 {
+		resource.WriteFieldErrors(w, r, errs)
+		return
 	}
-	items, err := h.repo.List(limit, offset)
+	items, err := h.repo.List(r.Context(), q)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		resource.WriteRepoError(w, r, err)
 		return
 	}
 	if items == nil {
 		items = make([]interface{}, 0)
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(items)
+	page := resource.Page{Total: -1}
+	if len(items) > q.Limit {
+		items = items[:q.Limit]
+		page.HasNext = true
+	}
+	if q.TotalCount {
+		if page.Total, err = h.repo.Count(r.Context(), q); err != nil {
+			resource.WriteRepoError(w, r, err)
+			return
+		}
+	}
+	q.WriteHeaders(w, r.URL, page)
+	projected, err := resource.Project(items, q.Fields)
+	if err != nil {
+		resource.WriteRepoError(w, r, err)
+		return
+	}
+	if err := resource.WriteTagged(w, r, projected); err != nil {
+		resource.WriteRepoError(w, r, err)
+	}
 }
 
 func (h *Handler) notImplemented(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusNotImplemented)
+	resource.WriteError(w, r, http.StatusNotImplemented, "NOT_IMPLEMENTED", "bell-schedules are not implemented yet")
 }
@@ -0,0 +1,53 @@
+// Package bulk serves the status of async bulk jobs. The POST /bulk routes
+// that start them are generated with each domain that allows bulk writes.
+package bulk
+
+import (
+	"database/sql"
+	"net/http"
+	"os"
+
+	"github.com/catdevman/oasis/plugin/common/internal/resource"
+)
+
+type Handler struct {
+	db *sql.DB
+}
+
+func NewHandler(db *sql.DB) *Handler {
+	return &Handler{db: db}
+}
+
+func (h *Handler) Register(mux *http.ServeMux) {
+	prefix := os.Getenv("OASIS_PLUGIN_PREFIX")
+	if prefix == "" {
+		prefix = "api/common"
+	}
+	mux.HandleFunc("GET /"+prefix+"/bulk/v1/jobs/{id}", h.job)
+}
+
+// job reports a job's progress and, once it has finished, its per-record
+// results. Only the job's creator and administrators may see it; anyone
+// else gets a 404 as if it did not exist.
+func (h *Handler) job(w http.ResponseWriter, r *http.Request) {
+	id, ok := resource.PathID(w, r)
+	if !ok {
+		return
+	}
+	job, err := resource.GetJob(r.Context(), h.db, id)
+	if err != nil {
+		resource.WriteRepoError(w, r, err)
+		return
+	}
+	if job == nil {
+		resource.WriteRepoError(w, r, resource.ErrNotFound)
+		return
+	}
+	actor := resource.ActorFrom(r)
+	owner := actor.Name() != "" && actor.Name() == job.CreatedBy
+	if !owner && !actor.HasRole(resource.AdminRoles...) {
+		resource.WriteRepoError(w, r, resource.ErrNotFound)
+		return
+	}
+	resource.WriteJSON(w, http.StatusOK, job)
+}
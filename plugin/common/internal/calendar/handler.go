@@ -3,13 +3,16 @@ package calendar
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
 	"os"
-	"strconv"
+
+	"github.com/catdevman/oasis/plugin/common/internal/resource"
 )
 
 type Handler struct {
-	repo *Repository
+	repo     *Repository
+	basePath string
 }
 
 func NewHandler(repo *Repository) *Handler {
@@ -22,49 +25,98 @@ func (h *Handler) Register(mux *http.ServeMux) {
 		prefix = "api/common"
 	}
 	basePath := "/" + prefix + "/ed-fi/calendars"
+	h.basePath = basePath
 	mux.HandleFunc("GET "+basePath, h.list)
 	mux.HandleFunc("GET "+basePath+"/{id}", h.get)
 	mux.HandleFunc("POST "+basePath, h.create)
 	mux.HandleFunc("PUT "+basePath+"/{id}", h.update)
 	mux.HandleFunc("DELETE "+basePath+"/{id}", h.delete)
+	mux.HandleFunc("GET "+basePath+"/{id}/history", h.history)
+	mux.HandleFunc("GET "+basePath+"/deletes", h.deletes)
+	mux.HandleFunc("GET "+basePath+"/keyChanges", h.keyChanges)
 }
 
 func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
-	limit := 50
-	offset := 0
-	if l := r.URL.Query().Get("limit"); l != "" {
-		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
-			limit = parsed
-		}
+	q, errs := resource.ParseListQuery(r.URL.Query(), columns)
+	if len(errs) > 0 {
+		resource.WriteFieldErrors(w, r, errs)
+		return
 	}
-	if o := r.URL.Query().Get("offset"); o != "" {
-		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
-			offset = parsed
-		}
+	expand, ok := resource.ExpandParam(w, r, &schema)
+	if !ok {
+		return
 	}
-	items, err := h.repo.List(limit, offset)
+	q.Fields = expand.Fields(&schema, q.Fields)
+	items, err := h.repo.List(r.Context(), q)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		resource.WriteRepoError(w, r, err)
 		return
 	}
 	if items == nil {
 		items = make([]Calendar, 0)
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(items)
+	page := resource.Page{Total: -1}
+	if len(items) > q.Limit {
+		items = items[:q.Limit]
+		page.HasNext = true
+		page.Next = q.NextCursor(items[len(items)-1].targets(q.OrderColumns()))
+	}
+	if q.TotalCount {
+		if page.Total, err = h.repo.Count(r.Context(), q); err != nil {
+			resource.WriteRepoError(w, r, err)
+			return
+		}
+	}
+	q.WriteHeaders(w, r.URL, page)
+	projected, err := resource.Project(items, q.Fields)
+	if err != nil {
+		resource.WriteRepoError(w, r, err)
+		return
+	}
+	if len(expand) > 0 {
+		if projected, err = h.repo.Expand(r.Context(), projected, expand); err != nil {
+			resource.WriteRepoError(w, r, err)
+			return
+		}
+	}
+	if err := resource.WriteTagged(w, r, projected); err != nil {
+		resource.WriteRepoError(w, r, err)
+	}
 }
 
 func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
-	item, err := h.repo.Get(id)
+	id, ok := resource.PathID(w, r)
+	if !ok {
+		return
+	}
+	expand, ok := resource.ExpandParam(w, r, &schema)
+	if !ok {
+		return
+	}
+	item, err := h.repo.Get(r.Context(), id)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		resource.WriteRepoError(w, r, err)
 		return
 	}
 	if item == nil {
-		w.WriteHeader(http.StatusNotFound)
+		resource.WriteRepoError(w, r, resource.ErrNotFound)
+		return
+	}
+	if len(expand) > 0 {
+		// The row version does not cover the expanded resources, so the
+		// ETag is taken from the whole body instead.
+		expanded, err := h.repo.Expand(r.Context(), []*Calendar{item}, expand)
+		if err != nil {
+			resource.WriteRepoError(w, r, err)
+			return
+		}
+		if err := resource.WriteTagged(w, r, expanded[0]); err != nil {
+			resource.WriteRepoError(w, r, err)
+		}
+		return
+	}
+	w.Header().Set("ETag", resource.FormatETag(*item.ETag))
+	if resource.NotModified(w, r) {
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -72,23 +124,133 @@ func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"message": "created"})
+	item, ok := decode(w, r)
+	if !ok {
+		return
+	}
+	if err := h.repo.Create(resource.ActorContext(r), item); err != nil {
+		resource.WriteRepoError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", h.basePath+"/"+*item.Id)
+	w.Header().Set("ETag", resource.FormatETag(*item.ETag))
+	resource.WriteJSON(w, http.StatusCreated, item)
 }
 
 func (h *Handler) update(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"message": "updated"})
+	id, ok := resource.PathID(w, r)
+	if !ok {
+		return
+	}
+	version, ok := resource.IfMatch(w, r)
+	if !ok {
+		return
+	}
+	item, ok := decode(w, r)
+	if !ok {
+		return
+	}
+	if item.Id != nil && *item.Id != id {
+		resource.WriteFieldErrors(w, r, []resource.FieldError{
+			{Field: "id", Message: "must match the id in the URL"},
+		})
+		return
+	}
+	if err := h.repo.Update(resource.ActorContext(r), id, version, item); err != nil {
+		resource.WriteRepoError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", resource.FormatETag(*item.ETag))
+	resource.WriteJSON(w, http.StatusOK, item)
 }
 
-func (h *Handler) delete(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
-	err := h.repo.Delete(id)
+// decode reads and validates the request body, writing a 400 listing every
+// invalid field when it does not match the resource's columns.
+func decode(w http.ResponseWriter, r *http.Request) (*Calendar, bool) {
+	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		resource.WriteError(w, r, http.StatusBadRequest, "INVALID_REQUEST", "could not read request body")
+		return nil, false
+	}
+	if errs := resource.Validate(body, columns); len(errs) > 0 {
+		resource.WriteFieldErrors(w, r, errs)
+		return nil, false
+	}
+	var item Calendar
+	if err := json.Unmarshal(body, &item); err != nil {
+		resource.WriteError(w, r, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		return nil, false
+	}
+	return &item, true
+}
+
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request) {
+	id, ok := resource.PathID(w, r)
+	if !ok {
+		return
+	}
+	version, ok := resource.IfMatch(w, r)
+	if !ok {
+		return
+	}
+	if err := h.repo.Delete(resource.ActorContext(r), id, version); err != nil {
+		resource.WriteRepoError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// history lists the audit entries for one resource, oldest first. It pages
+// with limit and offset only.
+func (h *Handler) history(w http.ResponseWriter, r *http.Request) {
+	id, ok := resource.PathID(w, r)
+	if !ok {
+		return
+	}
+	q, errs := resource.ParseListQuery(r.URL.Query(), nil)
+	if len(errs) > 0 {
+		resource.WriteFieldErrors(w, r, errs)
+		return
+	}
+	changes, err := h.repo.History(r.Context(), id, q)
+	if err != nil {
+		resource.WriteRepoError(w, r, err)
+		return
+	}
+	if len(changes) == 0 && q.Offset == 0 {
+		resource.WriteError(w, r, http.StatusNotFound, "NOT_FOUND", "resource has no history")
+		return
+	}
+	resource.WriteJSON(w, http.StatusOK, changes)
+}
+
+// deletes lists deleted resources for Ed-Fi Change Queries. It pages with
+// limit and offset and honours minChangeVersion and maxChangeVersion.
+func (h *Handler) deletes(w http.ResponseWriter, r *http.Request) {
+	q, errs := resource.ParseListQuery(r.URL.Query(), nil)
+	if len(errs) > 0 {
+		resource.WriteFieldErrors(w, r, errs)
+		return
+	}
+	deletes, err := h.repo.Deletes(r.Context(), q)
+	if err != nil {
+		resource.WriteRepoError(w, r, err)
+		return
+	}
+	resource.WriteJSON(w, http.StatusOK, deletes)
+}
+
+// keyChanges lists natural key changes for Ed-Fi Change Queries.
+func (h *Handler) keyChanges(w http.ResponseWriter, r *http.Request) {
+	q, errs := resource.ParseListQuery(r.URL.Query(), nil)
+	if len(errs) > 0 {
+		resource.WriteFieldErrors(w, r, errs)
+		return
+	}
+	changes, err := h.repo.KeyChanges(r.Context(), q)
+	if err != nil {
+		resource.WriteRepoError(w, r, err)
+		return
+	}
+	resource.WriteJSON(w, http.StatusOK, changes)
+}
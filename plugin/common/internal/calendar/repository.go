@@ -2,7 +2,11 @@
 package calendar
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+
+	"github.com/catdevman/oasis/plugin/common/internal/resource"
 )
 
 type Repository struct {
@@ -13,36 +17,91 @@ func NewRepository(db *sql.DB) *Repository {
 	return &Repository{db: db}
 }
 
+var columns = []resource.Column{
+	resource.IDColumn,
+	{Name: "CalendarCode", JSON: "calendarcode", Type: resource.String, Required: true, Filter: true, Key: true},
+	{Name: "CalendarDescription", JSON: "calendardescription", Type: resource.String, Required: false, Filter: false},
+	{Name: "SchoolYear", JSON: "schoolyear", Type: resource.Integer, Required: false, Filter: true},
+}
+
+// schema describes the resource to expand=, for expanding both its own
+// references and references into it.
+var schema = resource.Schema{
+	Name:       "calendar",
+	Table:      "Calendar",
+	Columns:    columns,
+	SoftDelete: false,
+}
+
+func init() {
+	resource.RegisterSchema(&schema)
+}
+
+// Calendar is identified by Id; its natural key is CalendarCode.
 type Calendar struct {
-	Field0 *string `json:"calendarcode"`
+	Id *string `json:"id"`
+
+	CalendarCode *string `json:"calendarcode"`
+
+	CalendarDescription *string `json:"calendardescription"`
 
-	Field1 *string `json:"calendardescription"`
+	SchoolYear *int64 `json:"schoolyear"`
 
-	Field2 *string `json:"schoolyear"`
+	ETag *string `json:"_etag"`
 }
 
-func (r *Repository) List(limit, offset int) ([]Calendar, error) {
-	rows, err := r.db.Query("SELECT CalendarCode, CalendarDescription, SchoolYear FROM Calendar LIMIT $1 OFFSET $2", limit, offset)
+// targets returns scan destinations for cols, in order.
+func (s *Calendar) targets(cols []resource.Column) []interface{} {
+	dest := make([]interface{}, len(cols))
+	for i, c := range cols {
+		switch c.Name {
+		case resource.IDColumn.Name:
+			dest[i] = &s.Id
+		case "CalendarCode":
+			dest[i] = &s.CalendarCode
+		case "CalendarDescription":
+			dest[i] = &s.CalendarDescription
+		case "SchoolYear":
+			dest[i] = &s.SchoolYear
+		case resource.VersionColumn.Name:
+			dest[i] = &s.ETag
+		}
+	}
+	return dest
+}
+
+func (r *Repository) List(ctx context.Context, q resource.ListQuery) ([]Calendar, error) {
+	query, args := q.SQL("Calendar", columns)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	selected := q.Selected(columns)
 	var items []Calendar
 	for rows.Next() {
 		var s Calendar
-		if err := rows.Scan(&s.Field0, &s.Field1, &s.Field2); err != nil {
+		if err := rows.Scan(s.targets(selected)...); err != nil {
 			return nil, err
 		}
 		items = append(items, s)
 	}
-	return items, nil
+	return items, rows.Err()
+}
+
+// Count returns the number of rows matching the query's filters.
+func (r *Repository) Count(ctx context.Context, q resource.ListQuery) (int64, error) {
+	query, args := q.CountSQL("Calendar")
+	var n int64
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(&n)
+	return n, err
 }
 
-func (r *Repository) Get(id string) (*Calendar, error) {
-	row := r.db.QueryRow("SELECT CalendarCode, CalendarDescription, SchoolYear FROM Calendar WHERE CalendarCode = $1", id)
+func (r *Repository) Get(ctx context.Context, id string) (*Calendar, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT Id, CalendarCode, CalendarDescription, SchoolYear, RowVersion::text FROM Calendar WHERE Id = $1", id)
 	var s Calendar
-	if err := row.Scan(&s.Field0, &s.Field1, &s.Field2); err != nil {
+	if err := row.Scan(&s.Id, &s.CalendarCode, &s.CalendarDescription, &s.SchoolYear, &s.ETag); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
@@ -51,7 +110,94 @@ func (r *Repository) Get(id string) (*Calendar, error) {
 	return &s, nil
 }
 
-func (r *Repository) Delete(id string) error {
-	_, err := r.db.Exec("DELETE FROM Calendar WHERE CalendarCode = $1", id)
-	return err
+// Create inserts s and sets s.Id and s.ETag to the new row's id and
+// version. The write is attributed to the Actor carried by ctx in the audit
+// history.
+func (r *Repository) Create(ctx context.Context, s *Calendar) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = tx.QueryRowContext(ctx, "INSERT INTO Calendar (CalendarCode, CalendarDescription, SchoolYear) VALUES ($1, $2, $3) RETURNING Id, RowVersion::text",
+		s.CalendarCode, s.CalendarDescription, s.SchoolYear).Scan(&s.Id, &s.ETag)
+	if err != nil {
+		return resource.FromDB(err)
+	}
+	return tx.Commit()
+}
+
+// Update overwrites the row with the given id, natural key included, if its
+// version still matches (an empty version matches any) and sets s.ETag to
+// the bumped version.
+func (r *Repository) Update(ctx context.Context, id, version string, s *Calendar) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = tx.QueryRowContext(ctx, "UPDATE Calendar SET CalendarCode = $1, CalendarDescription = $2, SchoolYear = $3, RowVersion = RowVersion + 1 WHERE Id = $4 AND ($5 = '' OR RowVersion::text = $5) RETURNING RowVersion::text",
+		s.CalendarCode, s.CalendarDescription, s.SchoolYear, id, version).Scan(&s.ETag)
+	if err == sql.ErrNoRows {
+		return missOrStale(ctx, tx, id)
+	}
+	if err != nil {
+		return resource.FromDB(err)
+	}
+	s.Id = &id
+	return tx.Commit()
+}
+
+// Delete removes the row with the given id if its version still matches.
+func (r *Repository) Delete(ctx context.Context, id, version string) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, "DELETE FROM Calendar WHERE Id = $1 AND ($2 = '' OR RowVersion::text = $2)", id, version)
+	if err != nil {
+		return resource.FromDB(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return missOrStale(ctx, tx, id)
+	}
+	return tx.Commit()
+}
+
+// missOrStale explains a conditional write that matched no row.
+func missOrStale(ctx context.Context, tx *sql.Tx, id string) error {
+	var one int
+	err := tx.QueryRowContext(ctx, "SELECT 1 FROM Calendar WHERE Id = $1", id).Scan(&one)
+	switch {
+	case err == sql.ErrNoRows:
+		return resource.ErrNotFound
+	case err != nil:
+		return err
+	}
+	return resource.ErrPreconditionFailed
+}
+
+// History returns the audit history of the row with the given id, oldest first.
+func (r *Repository) History(ctx context.Context, id string, q resource.ListQuery) ([]resource.Change, error) {
+	return resource.History(ctx, r.db, "Calendar", id, q)
+}
+
+// Deletes returns the rows deleted within q's change version bounds.
+func (r *Repository) Deletes(ctx context.Context, q resource.ListQuery) ([]resource.Delete, error) {
+	return resource.Deletes(ctx, r.db, "Calendar", q)
+}
+
+// KeyChanges returns the natural key changes within q's change version bounds.
+func (r *Repository) KeyChanges(ctx context.Context, q resource.ListQuery) ([]resource.KeyChange, error) {
+	return resource.KeyChanges(ctx, r.db, "Calendar", q)
+}
+
+// Expand embeds the references named by e in items.
+func (r *Repository) Expand(ctx context.Context, items interface{}, e resource.Expansion) ([]map[string]json.RawMessage, error) {
+	return resource.Expand(ctx, r.db, &schema, items, e)
 }
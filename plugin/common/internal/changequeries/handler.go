@@ -0,0 +1,38 @@
+// Package changequeries serves the Ed-Fi Change Queries endpoints that are
+// not tied to a single resource. The per-resource /deletes and /keyChanges
+// routes and the minChangeVersion/maxChangeVersion list parameters are
+// generated with each domain.
+package changequeries
+
+import (
+	"database/sql"
+	"net/http"
+	"os"
+
+	"github.com/catdevman/oasis/plugin/common/internal/resource"
+)
+
+type Handler struct {
+	db *sql.DB
+}
+
+func NewHandler(db *sql.DB) *Handler {
+	return &Handler{db: db}
+}
+
+func (h *Handler) Register(mux *http.ServeMux) {
+	prefix := os.Getenv("OASIS_PLUGIN_PREFIX")
+	if prefix == "" {
+		prefix = "api/common"
+	}
+	mux.HandleFunc("GET /"+prefix+"/ChangeQueries/v1/availableChangeVersions", h.availableChangeVersions)
+}
+
+func (h *Handler) availableChangeVersions(w http.ResponseWriter, r *http.Request) {
+	v, err := resource.AvailableChangeVersions(r.Context(), h.db)
+	if err != nil {
+		resource.WriteRepoError(w, r, err)
+		return
+	}
+	resource.WriteJSON(w, http.StatusOK, v)
+}
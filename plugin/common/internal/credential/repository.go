@@ -2,7 +2,10 @@
 package credential
 
 import (
+	"context"
 	"database/sql"
+
+	"github.com/catdevman/oasis/plugin/common/internal/resource"
 )
 
 type Repository struct {
@@ -13,6 +16,12 @@ func NewRepository(db *sql.DB) *Repository {
 	return &Repository{db: db}
 }
 
-func (r *Repository) List(limit, offset int) ([]interface{}, error) {
+var columns []resource.Column
+
+func (r *Repository) List(ctx context.Context, q resource.ListQuery) ([]interface{}, error) {
 	return []interface{}{}, nil
 }
+
+func (r *Repository) Count(ctx context.Context, q resource.ListQuery) (int64, error) {
+	return 0, nil
+}
@@ -0,0 +1,270 @@
+// Package descriptor serves the Ed-Fi descriptor endpoints,
+// /ed-fi/{type}Descriptors, for every type in Types. All types share the
+// edfi.Descriptor table. Values in the ed-fi.org namespace are seeded by
+// migration; districts extend a list by adding values under their own
+// namespace, which only administrators may do.
+package descriptor
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/catdevman/oasis/plugin/common/internal/resource"
+)
+
+// Types are the descriptor types served, without the "Descriptor" suffix.
+var Types = []string{
+	"AttendanceEventCategory",
+	"CohortType",
+	"CredentialField",
+	"CredentialType",
+	"GradeType",
+	"InterventionClass",
+	"PostSecondaryEventCategory",
+	"ProgramType",
+}
+
+// reservedNamespace holds the standard Ed-Fi values, which are read-only.
+const reservedNamespace = "uri://ed-fi.org/"
+
+type Handler struct {
+	repo *Repository
+}
+
+func NewHandler(repo *Repository) *Handler {
+	return &Handler{repo: repo}
+}
+
+func (h *Handler) Register(mux *http.ServeMux) {
+	prefix := os.Getenv("OASIS_PLUGIN_PREFIX")
+	if prefix == "" {
+		prefix = "api/common"
+	}
+	for _, t := range Types {
+		th := &typeHandler{repo: h.repo, t: t}
+		basePath := "/" + prefix + "/ed-fi/" + strings.ToLower(t[:1]) + t[1:] + "Descriptors"
+		th.basePath = basePath
+		mux.HandleFunc("GET "+basePath, th.list)
+		mux.HandleFunc("GET "+basePath+"/{id}", th.get)
+		mux.HandleFunc("POST "+basePath, th.create)
+		mux.HandleFunc("PUT "+basePath+"/{id}", th.update)
+		mux.HandleFunc("DELETE "+basePath+"/{id}", th.delete)
+	}
+}
+
+// typeHandler serves the routes of one descriptor type.
+type typeHandler struct {
+	repo     *Repository
+	t        string
+	basePath string
+}
+
+func (h *typeHandler) list(w http.ResponseWriter, r *http.Request) {
+	q, errs := resource.ParseListQuery(r.URL.Query(), columns)
+	if len(errs) > 0 {
+		resource.WriteFieldErrors(w, r, errs)
+		return
+	}
+	items, err := h.repo.List(r.Context(), h.t, q)
+	if err != nil {
+		resource.WriteRepoError(w, r, err)
+		return
+	}
+	if items == nil {
+		items = make([]Descriptor, 0)
+	}
+	page := resource.Page{Total: -1}
+	if len(items) > q.Limit {
+		items = items[:q.Limit]
+		page.HasNext = true
+		page.Next = q.NextCursor(items[len(items)-1].targets(q.OrderColumns()))
+	}
+	if q.TotalCount {
+		if page.Total, err = h.repo.Count(r.Context(), h.t, q); err != nil {
+			resource.WriteRepoError(w, r, err)
+			return
+		}
+	}
+	q.WriteHeaders(w, r.URL, page)
+	projected, err := resource.Project(items, q.Fields)
+	if err != nil {
+		resource.WriteRepoError(w, r, err)
+		return
+	}
+	body, err := json.Marshal(projected)
+	if err != nil {
+		resource.WriteRepoError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", resource.BodyETag(body))
+	if resource.NotModified(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(body, '\n'))
+}
+
+func (h *typeHandler) get(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	item, err := h.repo.Get(r.Context(), h.t, id)
+	if err != nil {
+		resource.WriteRepoError(w, r, err)
+		return
+	}
+	if item == nil {
+		resource.WriteRepoError(w, r, resource.ErrNotFound)
+		return
+	}
+	w.Header().Set("ETag", resource.FormatETag(*item.ETag))
+	if resource.NotModified(w, r) {
+		return
+	}
+	resource.WriteJSON(w, http.StatusOK, item)
+}
+
+func (h *typeHandler) create(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+	item, ok := h.decode(w, r)
+	if !ok {
+		return
+	}
+	if err := h.repo.Create(resource.ActorContext(r), h.t, item); err != nil {
+		resource.WriteRepoError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", h.basePath+"/"+strconv.FormatInt(*item.DescriptorId, 10))
+	w.Header().Set("ETag", resource.FormatETag(*item.ETag))
+	resource.WriteJSON(w, http.StatusCreated, item)
+}
+
+func (h *typeHandler) update(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	version, ok := resource.IfMatch(w, r)
+	if !ok {
+		return
+	}
+	item, ok := h.decode(w, r)
+	if !ok {
+		return
+	}
+	if item.DescriptorId != nil && *item.DescriptorId != id {
+		resource.WriteFieldErrors(w, r, []resource.FieldError{
+			{Field: "descriptorId", Message: "must match the id in the URL"},
+		})
+		return
+	}
+	if !h.editable(w, r, id) {
+		return
+	}
+	if err := h.repo.Update(resource.ActorContext(r), h.t, id, version, item); err != nil {
+		resource.WriteRepoError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", resource.FormatETag(*item.ETag))
+	resource.WriteJSON(w, http.StatusOK, item)
+}
+
+func (h *typeHandler) delete(w http.ResponseWriter, r *http.Request) {
+	if !h.authorize(w, r) {
+		return
+	}
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	version, ok := resource.IfMatch(w, r)
+	if !ok {
+		return
+	}
+	if !h.editable(w, r, id) {
+		return
+	}
+	if err := h.repo.Delete(resource.ActorContext(r), h.t, id, version); err != nil {
+		resource.WriteRepoError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorize allows descriptor changes to administrators only.
+func (h *typeHandler) authorize(w http.ResponseWriter, r *http.Request) bool {
+	if !resource.ActorFrom(r).HasRole(resource.AdminRoles...) {
+		resource.WriteError(w, r, http.StatusForbidden, "FORBIDDEN", "only administrators may change descriptors")
+		return false
+	}
+	return true
+}
+
+// editable rejects changes to the standard Ed-Fi values. Missing ids pass
+// through so the write reports 404 as usual.
+func (h *typeHandler) editable(w http.ResponseWriter, r *http.Request, id int64) bool {
+	item, err := h.repo.Get(r.Context(), h.t, id)
+	if err != nil {
+		resource.WriteRepoError(w, r, err)
+		return false
+	}
+	if item != nil && strings.HasPrefix(*item.Namespace, reservedNamespace) {
+		resource.WriteError(w, r, http.StatusForbidden, "FORBIDDEN", "standard Ed-Fi descriptors are read-only")
+		return false
+	}
+	return true
+}
+
+// decode reads and validates the request body. The namespace must be a
+// district namespace for this descriptor type.
+func (h *typeHandler) decode(w http.ResponseWriter, r *http.Request) (*Descriptor, bool) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		resource.WriteError(w, r, http.StatusBadRequest, "INVALID_REQUEST", "could not read request body")
+		return nil, false
+	}
+	if errs := resource.Validate(body, columns); len(errs) > 0 {
+		resource.WriteFieldErrors(w, r, errs)
+		return nil, false
+	}
+	var item Descriptor
+	if err := json.Unmarshal(body, &item); err != nil {
+		resource.WriteError(w, r, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		return nil, false
+	}
+	ns := *item.Namespace
+	switch {
+	case !resource.IsDescriptorURI(ns+"#"+*item.CodeValue, h.t):
+		resource.WriteFieldErrors(w, r, []resource.FieldError{
+			{Field: "namespace", Message: "must be uri://{authority}/" + h.t + "Descriptor"},
+		})
+		return nil, false
+	case strings.HasPrefix(ns, reservedNamespace):
+		resource.WriteFieldErrors(w, r, []resource.FieldError{
+			{Field: "namespace", Message: "is reserved for standard Ed-Fi descriptors; use your district's namespace"},
+		})
+		return nil, false
+	}
+	return &item, true
+}
+
+// pathID parses the descriptorId in the URL. Anything that is not an id
+// cannot name a descriptor, so it is a 404.
+func pathID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		resource.WriteRepoError(w, r, resource.ErrNotFound)
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,190 @@
+package descriptor
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/catdevman/oasis/plugin/common/internal/resource"
+)
+
+const table = "edfi.Descriptor"
+
+var columns = []resource.Column{
+	{Name: "DescriptorId", JSON: "descriptorId", Type: resource.Integer},
+	{Name: "Namespace", JSON: "namespace", Type: resource.String, Required: true, Filter: true},
+	{Name: "CodeValue", JSON: "codeValue", Type: resource.String, Required: true, Filter: true},
+	{Name: "ShortDescription", JSON: "shortDescription", Type: resource.String, Required: true, Filter: true},
+	{Name: "Description", JSON: "description", Type: resource.String},
+	{Name: "EffectiveBeginDate", JSON: "effectiveBeginDate", Type: resource.Date, Filter: true},
+	{Name: "EffectiveEndDate", JSON: "effectiveEndDate", Type: resource.Date, Filter: true},
+}
+
+// typeColumn scopes the shared table to one descriptor type. It is never
+// exposed as a property.
+var typeColumn = resource.Column{Name: "DescriptorType", Type: resource.String}
+
+type Descriptor struct {
+	DescriptorId       *int64  `json:"descriptorId"`
+	Namespace          *string `json:"namespace"`
+	CodeValue          *string `json:"codeValue"`
+	ShortDescription   *string `json:"shortDescription"`
+	Description        *string `json:"description"`
+	EffectiveBeginDate *string `json:"effectiveBeginDate"`
+	EffectiveEndDate   *string `json:"effectiveEndDate"`
+	ETag               *string `json:"_etag"`
+}
+
+// targets returns scan destinations for cols, in order.
+func (d *Descriptor) targets(cols []resource.Column) []interface{} {
+	dest := make([]interface{}, len(cols))
+	for i, c := range cols {
+		switch c.Name {
+		case "DescriptorId":
+			dest[i] = &d.DescriptorId
+		case "Namespace":
+			dest[i] = &d.Namespace
+		case "CodeValue":
+			dest[i] = &d.CodeValue
+		case "ShortDescription":
+			dest[i] = &d.ShortDescription
+		case "Description":
+			dest[i] = &d.Description
+		case "EffectiveBeginDate":
+			dest[i] = &d.EffectiveBeginDate
+		case "EffectiveEndDate":
+			dest[i] = &d.EffectiveEndDate
+		case resource.VersionColumn.Name:
+			dest[i] = &d.ETag
+		}
+	}
+	return dest
+}
+
+// Repository reads and writes every descriptor type; each method is scoped
+// to the type it is given.
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) List(ctx context.Context, t string, q resource.ListQuery) ([]Descriptor, error) {
+	query, args := q.WhereEq(typeColumn, t).SQL(table, columns)
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	selected := q.Selected(columns)
+	var items []Descriptor
+	for rows.Next() {
+		var d Descriptor
+		if err := rows.Scan(d.targets(selected)...); err != nil {
+			return nil, err
+		}
+		items = append(items, d)
+	}
+	return items, rows.Err()
+}
+
+// Count returns the number of descriptors of type t matching the query's filters.
+func (r *Repository) Count(ctx context.Context, t string, q resource.ListQuery) (int64, error) {
+	query, args := q.WhereEq(typeColumn, t).CountSQL(table)
+	var n int64
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(&n)
+	return n, err
+}
+
+func (r *Repository) Get(ctx context.Context, t string, id int64) (*Descriptor, error) {
+	all := append(append([]resource.Column(nil), columns...), resource.VersionColumn)
+	var d Descriptor
+	err := r.db.QueryRowContext(ctx, "SELECT "+resource.SelectList(all)+" FROM "+table+" WHERE DescriptorId = $1 AND DescriptorType = $2", id, t).
+		Scan(d.targets(all)...)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// Create inserts d as a descriptor of type t and sets its id and ETag.
+func (r *Repository) Create(ctx context.Context, t string, d *Descriptor) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = tx.QueryRowContext(ctx, `INSERT INTO edfi.Descriptor (DescriptorType, Namespace, CodeValue, ShortDescription, Description, EffectiveBeginDate, EffectiveEndDate)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING DescriptorId, RowVersion::text`,
+		t, d.Namespace, d.CodeValue, d.ShortDescription, d.Description, d.EffectiveBeginDate, d.EffectiveEndDate).
+		Scan(&d.DescriptorId, &d.ETag)
+	if err != nil {
+		return resource.FromDB(err)
+	}
+	return tx.Commit()
+}
+
+// Update overwrites the descriptor if its version still matches (an empty
+// version matches any). Renaming a descriptor that rows still reference
+// fails with resource.ErrConflict.
+func (r *Repository) Update(ctx context.Context, t string, id int64, version string, d *Descriptor) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = tx.QueryRowContext(ctx, `UPDATE edfi.Descriptor SET Namespace = $1, CodeValue = $2, ShortDescription = $3, Description = $4,
+		EffectiveBeginDate = $5, EffectiveEndDate = $6, RowVersion = RowVersion + 1
+		WHERE DescriptorId = $7 AND DescriptorType = $8 AND ($9 = '' OR RowVersion::text = $9) RETURNING RowVersion::text`,
+		d.Namespace, d.CodeValue, d.ShortDescription, d.Description, d.EffectiveBeginDate, d.EffectiveEndDate, id, t, version).
+		Scan(&d.ETag)
+	if err == sql.ErrNoRows {
+		return missOrStale(ctx, tx, t, id)
+	}
+	if err != nil {
+		return resource.FromDB(err)
+	}
+	d.DescriptorId = &id
+	return tx.Commit()
+}
+
+// Delete removes the descriptor if its version still matches. Descriptors
+// still referenced by other rows fail with resource.ErrConflict.
+func (r *Repository) Delete(ctx context.Context, t string, id int64, version string) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, "DELETE FROM edfi.Descriptor WHERE DescriptorId = $1 AND DescriptorType = $2 AND ($3 = '' OR RowVersion::text = $3)",
+		id, t, version)
+	if err != nil {
+		return resource.FromDB(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return missOrStale(ctx, tx, t, id)
+	}
+	return tx.Commit()
+}
+
+// missOrStale explains a conditional write that matched no row.
+func missOrStale(ctx context.Context, tx *sql.Tx, t string, id int64) error {
+	var one int
+	err := tx.QueryRowContext(ctx, "SELECT 1 FROM edfi.Descriptor WHERE DescriptorId = $1 AND DescriptorType = $2", id, t).Scan(&one)
+	switch {
+	case err == sql.ErrNoRows:
+		return resource.ErrNotFound
+	case err != nil:
+		return err
+	}
+	return resource.ErrPreconditionFailed
+}
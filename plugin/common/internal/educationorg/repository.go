@@ -2,7 +2,11 @@
 package educationorg
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+
+	"github.com/catdevman/oasis/plugin/common/internal/resource"
 )
 
 type Repository struct {
@@ -13,34 +17,86 @@ func NewRepository(db *sql.DB) *Repository {
 	return &Repository{db: db}
 }
 
+var columns = []resource.Column{
+	resource.IDColumn,
+	{Name: "OrganizationIdentifier", JSON: "organizationidentifier", Type: resource.String, Required: true, Filter: true, Key: true},
+	{Name: "OrganizationName", JSON: "organizationname", Type: resource.String, Required: false, Filter: true},
+}
+
+// schema describes the resource to expand=, for expanding both its own
+// references and references into it.
+var schema = resource.Schema{
+	Name:       "educationorg",
+	Table:      "edfi.School",
+	Columns:    columns,
+	SoftDelete: false,
+}
+
+func init() {
+	resource.RegisterSchema(&schema)
+}
+
+// EducationOrg is identified by Id; its natural key is OrganizationIdentifier.
 type EducationOrg struct {
-	Field0 *string `json:"organizationidentifier"`
+	Id *string `json:"id"`
+
+	OrganizationIdentifier *string `json:"organizationidentifier"`
+
+	OrganizationName *string `json:"organizationname"`
 
-	Field1 *string `json:"organizationname"`
+	ETag *string `json:"_etag"`
 }
 
-func (r *Repository) List(limit, offset int) ([]EducationOrg, error) {
-	rows, err := r.db.Query("SELECT OrganizationIdentifier, OrganizationName FROM edfi.School LIMIT $1 OFFSET $2", limit, offset)
+// targets returns scan destinations for cols, in order.
+func (s *EducationOrg) targets(cols []resource.Column) []interface{} {
+	dest := make([]interface{}, len(cols))
+	for i, c := range cols {
+		switch c.Name {
+		case resource.IDColumn.Name:
+			dest[i] = &s.Id
+		case "OrganizationIdentifier":
+			dest[i] = &s.OrganizationIdentifier
+		case "OrganizationName":
+			dest[i] = &s.OrganizationName
+		case resource.VersionColumn.Name:
+			dest[i] = &s.ETag
+		}
+	}
+	return dest
+}
+
+func (r *Repository) List(ctx context.Context, q resource.ListQuery) ([]EducationOrg, error) {
+	query, args := q.SQL("edfi.School", columns)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	selected := q.Selected(columns)
 	var items []EducationOrg
 	for rows.Next() {
 		var s EducationOrg
-		if err := rows.Scan(&s.Field0, &s.Field1); err != nil {
+		if err := rows.Scan(s.targets(selected)...); err != nil {
 			return nil, err
 		}
 		items = append(items, s)
 	}
-	return items, nil
+	return items, rows.Err()
+}
+
+// Count returns the number of rows matching the query's filters.
+func (r *Repository) Count(ctx context.Context, q resource.ListQuery) (int64, error) {
+	query, args := q.CountSQL("edfi.School")
+	var n int64
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(&n)
+	return n, err
 }
 
-func (r *Repository) Get(id string) (*EducationOrg, error) {
-	row := r.db.QueryRow("SELECT OrganizationIdentifier, OrganizationName FROM edfi.School WHERE OrganizationIdentifier = $1", id)
+func (r *Repository) Get(ctx context.Context, id string) (*EducationOrg, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT Id, OrganizationIdentifier, OrganizationName, RowVersion::text FROM edfi.School WHERE Id = $1", id)
 	var s EducationOrg
-	if err := row.Scan(&s.Field0, &s.Field1); err != nil {
+	if err := row.Scan(&s.Id, &s.OrganizationIdentifier, &s.OrganizationName, &s.ETag); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
@@ -49,7 +105,94 @@ func (r *Repository) Get(id string) (*EducationOrg, error) {
 	return &s, nil
 }
 
-func (r *Repository) Delete(id string) error {
-	_, err := r.db.Exec("DELETE FROM edfi.School WHERE OrganizationIdentifier = $1", id)
-	return err
+// Create inserts s and sets s.Id and s.ETag to the new row's id and
+// version. The write is attributed to the Actor carried by ctx in the audit
+// history.
+func (r *Repository) Create(ctx context.Context, s *EducationOrg) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = tx.QueryRowContext(ctx, "INSERT INTO edfi.School (OrganizationIdentifier, OrganizationName) VALUES ($1, $2) RETURNING Id, RowVersion::text",
+		s.OrganizationIdentifier, s.OrganizationName).Scan(&s.Id, &s.ETag)
+	if err != nil {
+		return resource.FromDB(err)
+	}
+	return tx.Commit()
+}
+
+// Update overwrites the row with the given id, natural key included, if its
+// version still matches (an empty version matches any) and sets s.ETag to
+// the bumped version.
+func (r *Repository) Update(ctx context.Context, id, version string, s *EducationOrg) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = tx.QueryRowContext(ctx, "UPDATE edfi.School SET OrganizationIdentifier = $1, OrganizationName = $2, RowVersion = RowVersion + 1 WHERE Id = $3 AND ($4 = '' OR RowVersion::text = $4) RETURNING RowVersion::text",
+		s.OrganizationIdentifier, s.OrganizationName, id, version).Scan(&s.ETag)
+	if err == sql.ErrNoRows {
+		return missOrStale(ctx, tx, id)
+	}
+	if err != nil {
+		return resource.FromDB(err)
+	}
+	s.Id = &id
+	return tx.Commit()
+}
+
+// Delete removes the row with the given id if its version still matches.
+func (r *Repository) Delete(ctx context.Context, id, version string) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, "DELETE FROM edfi.School WHERE Id = $1 AND ($2 = '' OR RowVersion::text = $2)", id, version)
+	if err != nil {
+		return resource.FromDB(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return missOrStale(ctx, tx, id)
+	}
+	return tx.Commit()
+}
+
+// missOrStale explains a conditional write that matched no row.
+func missOrStale(ctx context.Context, tx *sql.Tx, id string) error {
+	var one int
+	err := tx.QueryRowContext(ctx, "SELECT 1 FROM edfi.School WHERE Id = $1", id).Scan(&one)
+	switch {
+	case err == sql.ErrNoRows:
+		return resource.ErrNotFound
+	case err != nil:
+		return err
+	}
+	return resource.ErrPreconditionFailed
+}
+
+// History returns the audit history of the row with the given id, oldest first.
+func (r *Repository) History(ctx context.Context, id string, q resource.ListQuery) ([]resource.Change, error) {
+	return resource.History(ctx, r.db, "edfi.School", id, q)
+}
+
+// Deletes returns the rows deleted within q's change version bounds.
+func (r *Repository) Deletes(ctx context.Context, q resource.ListQuery) ([]resource.Delete, error) {
+	return resource.Deletes(ctx, r.db, "edfi.School", q)
+}
+
+// KeyChanges returns the natural key changes within q's change version bounds.
+func (r *Repository) KeyChanges(ctx context.Context, q resource.ListQuery) ([]resource.KeyChange, error) {
+	return resource.KeyChanges(ctx, r.db, "edfi.School", q)
+}
+
+// Expand embeds the references named by e in items.
+func (r *Repository) Expand(ctx context.Context, items interface{}, e resource.Expansion) ([]map[string]json.RawMessage, error) {
+	return resource.Expand(ctx, r.db, &schema, items, e)
 }
@@ -2,7 +2,11 @@
 package program
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+
+	"github.com/catdevman/oasis/plugin/common/internal/resource"
 )
 
 type Repository struct {
@@ -13,34 +17,88 @@ func NewRepository(db *sql.DB) *Repository {
 	return &Repository{db: db}
 }
 
+var columns = []resource.Column{
+	resource.IDColumn,
+	{Name: "ProgramName", JSON: "programname", Type: resource.String, Required: true, Filter: true, Key: true},
+	{Name: "ProgramType", JSON: "programtype", Type: resource.String, Required: false, Filter: true, Descriptor: "ProgramType"},
+}
+
+// schema describes the resource to expand=, for expanding both its own
+// references and references into it.
+var schema = resource.Schema{
+	Name:       "program",
+	Table:      "Program",
+	Columns:    columns,
+	SoftDelete: true,
+}
+
+func init() {
+	resource.RegisterSchema(&schema)
+}
+
+// Program is identified by Id; its natural key is ProgramName.
 type Program struct {
-	Field0 *string `json:"programname"`
+	Id *string `json:"id"`
 
-	Field1 *string `json:"programtype"`
+	ProgramName *string `json:"programname"`
+
+	ProgramType *string `json:"programtype"`
+
+	ETag *string `json:"_etag"`
 }
 
-func (r *Repository) List(limit, offset int) ([]Program, error) {
-	rows, err := r.db.Query("SELECT ProgramName, ProgramType FROM Program LIMIT $1 OFFSET $2", limit, offset)
+// targets returns scan destinations for cols, in order.
+func (s *Program) targets(cols []resource.Column) []interface{} {
+	dest := make([]interface{}, len(cols))
+	for i, c := range cols {
+		switch c.Name {
+		case resource.IDColumn.Name:
+			dest[i] = &s.Id
+		case "ProgramName":
+			dest[i] = &s.ProgramName
+		case "ProgramType":
+			dest[i] = &s.ProgramType
+		case resource.VersionColumn.Name:
+			dest[i] = &s.ETag
+		}
+	}
+	return dest
+}
+
+func (r *Repository) List(ctx context.Context, q resource.ListQuery) ([]Program, error) {
+	q = q.NotDeleted()
+	query, args := q.SQL("Program", columns)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	selected := q.Selected(columns)
 	var items []Program
 	for rows.Next() {
 		var s Program
-		if err := rows.Scan(&s.Field0, &s.Field1); err != nil {
+		if err := rows.Scan(s.targets(selected)...); err != nil {
 			return nil, err
 		}
 		items = append(items, s)
 	}
-	return items, nil
+	return items, rows.Err()
 }
 
-func (r *Repository) Get(id string) (*Program, error) {
-	row := r.db.QueryRow("SELECT ProgramName, ProgramType FROM Program WHERE ProgramName = $1", id)
+// Count returns the number of rows matching the query's filters.
+func (r *Repository) Count(ctx context.Context, q resource.ListQuery) (int64, error) {
+	q = q.NotDeleted()
+	query, args := q.CountSQL("Program")
+	var n int64
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(&n)
+	return n, err
+}
+
+func (r *Repository) Get(ctx context.Context, id string) (*Program, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT Id, ProgramName, ProgramType, RowVersion::text FROM Program WHERE Id = $1 AND DeletedAt IS NULL", id)
 	var s Program
-	if err := row.Scan(&s.Field0, &s.Field1); err != nil {
+	if err := row.Scan(&s.Id, &s.ProgramName, &s.ProgramType, &s.ETag); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
@@ -49,7 +107,125 @@ func (r *Repository) Get(id string) (*Program, error) {
 	return &s, nil
 }
 
-func (r *Repository) Delete(id string) error {
-	_, err := r.db.Exec("DELETE FROM Program WHERE ProgramName = $1", id)
-	return err
+// Create inserts s and sets s.Id and s.ETag to the new row's id and
+// version. The write is attributed to the Actor carried by ctx in the audit
+// history.
+func (r *Repository) Create(ctx context.Context, s *Program) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := resource.CheckDescriptors(ctx, tx, columns, s.targets(columns)); err != nil {
+		return err
+	}
+	err = tx.QueryRowContext(ctx, "INSERT INTO Program (ProgramName, ProgramType) VALUES ($1, $2) RETURNING Id, RowVersion::text",
+		s.ProgramName, s.ProgramType).Scan(&s.Id, &s.ETag)
+	if err != nil {
+		return resource.FromDB(err)
+	}
+	return tx.Commit()
+}
+
+// Update overwrites the row with the given id, natural key included, if its
+// version still matches (an empty version matches any) and sets s.ETag to
+// the bumped version.
+func (r *Repository) Update(ctx context.Context, id, version string, s *Program) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := resource.CheckDescriptors(ctx, tx, columns, s.targets(columns)); err != nil {
+		return err
+	}
+	err = tx.QueryRowContext(ctx, "UPDATE Program SET ProgramName = $1, ProgramType = $2, RowVersion = RowVersion + 1 WHERE Id = $3 AND DeletedAt IS NULL AND ($4 = '' OR RowVersion::text = $4) RETURNING RowVersion::text",
+		s.ProgramName, s.ProgramType, id, version).Scan(&s.ETag)
+	if err == sql.ErrNoRows {
+		return missOrStale(ctx, tx, id)
+	}
+	if err != nil {
+		return resource.FromDB(err)
+	}
+	s.Id = &id
+	return tx.Commit()
+}
+
+// Delete soft-deletes the row with the given id if its version still matches: it
+// stays in the table, hidden from reads, until an admin restores it.
+func (r *Repository) Delete(ctx context.Context, id, version string) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, "UPDATE Program SET DeletedAt = now(), RowVersion = RowVersion + 1 WHERE Id = $1 AND DeletedAt IS NULL AND ($2 = '' OR RowVersion::text = $2)", id, version)
+	if err != nil {
+		return resource.FromDB(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return missOrStale(ctx, tx, id)
+	}
+	return tx.Commit()
+}
+
+// Restore undoes a soft delete. It returns resource.ErrConflict when the
+// row exists but is not deleted.
+func (r *Repository) Restore(ctx context.Context, id string) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var deleted bool
+	err = tx.QueryRowContext(ctx, "SELECT DeletedAt IS NOT NULL FROM Program WHERE Id = $1 FOR UPDATE", id).Scan(&deleted)
+	switch {
+	case err == sql.ErrNoRows:
+		return resource.ErrNotFound
+	case err != nil:
+		return err
+	case !deleted:
+		return resource.ErrConflict
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE Program SET DeletedAt = NULL, RowVersion = RowVersion + 1 WHERE Id = $1", id); err != nil {
+		return resource.FromDB(err)
+	}
+	return tx.Commit()
+}
+
+// missOrStale explains a conditional write that matched no row.
+func missOrStale(ctx context.Context, tx *sql.Tx, id string) error {
+	var one int
+	err := tx.QueryRowContext(ctx, "SELECT 1 FROM Program WHERE Id = $1 AND DeletedAt IS NULL", id).Scan(&one)
+	switch {
+	case err == sql.ErrNoRows:
+		return resource.ErrNotFound
+	case err != nil:
+		return err
+	}
+	return resource.ErrPreconditionFailed
+}
+
+// History returns the audit history of the row with the given id, oldest first.
+func (r *Repository) History(ctx context.Context, id string, q resource.ListQuery) ([]resource.Change, error) {
+	return resource.History(ctx, r.db, "Program", id, q)
+}
+
+// Deletes returns the rows deleted within q's change version bounds.
+func (r *Repository) Deletes(ctx context.Context, q resource.ListQuery) ([]resource.Delete, error) {
+	return resource.Deletes(ctx, r.db, "Program", q)
+}
+
+// KeyChanges returns the natural key changes within q's change version bounds.
+func (r *Repository) KeyChanges(ctx context.Context, q resource.ListQuery) ([]resource.KeyChange, error) {
+	return resource.KeyChanges(ctx, r.db, "Program", q)
+}
+
+// Expand embeds the references named by e in items.
+func (r *Repository) Expand(ctx context.Context, items interface{}, e resource.Expansion) ([]map[string]json.RawMessage, error) {
+	return resource.Expand(ctx, r.db, &schema, items, e)
 }
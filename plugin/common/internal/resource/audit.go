@@ -0,0 +1,118 @@
+package resource
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/catdevman/oasis/shared/sdk"
+)
+
+// Actor identifies who made a write, taken from the identity headers the
+// host forwards. The audit trigger on every resource table records it.
+type Actor struct {
+	UserID    string
+	Roles     string
+	RequestID string
+}
+
+// AdminRoles are the roles allowed to perform administrative operations
+// such as restoring soft-deleted resources.
+var AdminRoles = []string{"admin", "administrator"}
+
+type actorKey struct{}
+
+// ActorFrom reads the forwarded identity headers.
+func ActorFrom(r *http.Request) Actor {
+	id := sdk.IdentityFrom(r)
+	return Actor{
+		UserID:    id.UserID,
+		Roles:     strings.Join(id.Roles, ","),
+		RequestID: id.RequestID,
+	}
+}
+
+// HasRole reports whether a holds any of roles.
+func (a Actor) HasRole(roles ...string) bool {
+	for _, held := range strings.Split(a.Roles, ",") {
+		held = strings.TrimSpace(held)
+		for _, r := range roles {
+			if held == r {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Name is how a is recorded: the user id, or the roles when the host sent
+// no user id.
+func (a Actor) Name() string {
+	if a.UserID == "" && a.Roles != "" {
+		return "role:" + a.Roles
+	}
+	return a.UserID
+}
+
+// ActorContext returns r's context carrying the request's Actor, for
+// passing to repository writes.
+func ActorContext(r *http.Request) context.Context {
+	return context.WithValue(r.Context(), actorKey{}, ActorFrom(r))
+}
+
+// Begin starts a transaction and tags it with the context's Actor, so the
+// audit trigger can attribute the rows it writes. The settings are local to
+// the transaction and vanish on commit or rollback.
+func Begin(ctx context.Context, db *sql.DB) (*sql.Tx, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	a, _ := ctx.Value(actorKey{}).(Actor)
+	_, err = tx.ExecContext(ctx, "SELECT set_config('oasis.actor', $1, true), set_config('oasis.request_id', $2, true)",
+		a.Name(), a.RequestID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return tx, nil
+}
+
+// Change is one entry of a resource's audit history. Before is null for an
+// insert and After is null for a delete.
+type Change struct {
+	ChangeID  int64           `json:"changeId"`
+	Operation string          `json:"operation"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	Actor     *string         `json:"actor"`
+	RequestID *string         `json:"requestId"`
+	ChangedAt time.Time       `json:"changedAt"`
+}
+
+// History returns the audit entries recorded for the row of table keyed by
+// key, oldest first. Only q's Limit and Offset are used.
+func History(ctx context.Context, db *sql.DB, table, key string, q ListQuery) ([]Change, error) {
+	rows, err := db.QueryContext(ctx, `SELECT ChangeId, Operation, COALESCE(Before, 'null'), COALESCE(After, 'null'), Actor, RequestId, ChangedAt
+		FROM audit.ChangeLog WHERE TableName = $1::regclass::text AND ResourceKey = $2
+		ORDER BY ChangeId LIMIT $3 OFFSET $4`, table, key, q.Limit, q.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []Change{}
+	for rows.Next() {
+		var c Change
+		var before, after []byte
+		if err := rows.Scan(&c.ChangeID, &c.Operation, &before, &after, &c.Actor, &c.RequestID, &c.ChangedAt); err != nil {
+			return nil, err
+		}
+		c.Before, c.After = before, after
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
@@ -0,0 +1,235 @@
+package resource
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	oerrors "github.com/catdevman/oasis/internal/errors"
+)
+
+// Bulk requests write many records of one resource in a single
+// transaction. Each record is upserted by its natural key inside its own
+// savepoint, so a bad record is reported without undoing the others.
+
+const (
+	// MaxBulkRecords is the most records a synchronous bulk request may
+	// carry; larger payloads must be submitted as an async job.
+	MaxBulkRecords = 1000
+	// MaxBulkJobRecords is the most records an async bulk job may carry.
+	MaxBulkJobRecords = 100000
+)
+
+// ErrTooManyRecords is returned by ReadBulk when a payload exceeds its limit.
+var ErrTooManyRecords = errors.New("resource: too many records")
+
+// BulkResult is the outcome of one record of a bulk request. Index is the
+// record's position in the payload, counting from 0.
+type BulkResult struct {
+	Index  int              `json:"index"`
+	Status int              `json:"status"`
+	ID     string           `json:"id,omitempty"`
+	ETag   string           `json:"_etag,omitempty"`
+	Error  *oerrors.Problem `json:"error,omitempty"`
+}
+
+// BulkReport is the response to a bulk request, and the result of a job.
+type BulkReport struct {
+	Total     int          `json:"total"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	Results   []BulkResult `json:"results"`
+}
+
+// Written is what an upsert reports about the row it wrote.
+type Written struct {
+	ID      string
+	Version string
+	Created bool
+}
+
+// ReadBulk reads a bulk request body: a JSON array of objects or, with
+// Content-Type application/x-ndjson, one object per line. Blank NDJSON lines
+// are skipped. Records are returned unparsed; Bulk validates each one.
+func ReadBulk(r *http.Request, limit int) ([]json.RawMessage, error) {
+	var records []json.RawMessage
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/x-ndjson" {
+		sc := bufio.NewScanner(r.Body)
+		sc.Buffer(nil, 1<<20)
+		for sc.Scan() {
+			line := bytes.TrimSpace(sc.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			if len(records) == limit {
+				return nil, ErrTooManyRecords
+			}
+			records = append(records, append(json.RawMessage(nil), line...))
+		}
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+	} else {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(body, &records); err != nil {
+			return nil, fmt.Errorf("body must be a JSON array or NDJSON: %w", err)
+		}
+		if len(records) > limit {
+			return nil, ErrTooManyRecords
+		}
+	}
+	if len(records) == 0 {
+		return nil, errors.New("no records in body")
+	}
+	return records, nil
+}
+
+// Bulk validates each record against cols and passes the valid ones to
+// upsert, all in one transaction attributed to the context's Actor. Record
+// failures are reported in the results; only an error that aborts the whole
+// transaction is returned.
+func Bulk(ctx context.Context, db *sql.DB, records []json.RawMessage, cols []Column,
+	upsert func(*sql.Tx, json.RawMessage) (Written, error)) (BulkReport, error) {
+	report := BulkReport{Total: len(records), Results: make([]BulkResult, len(records))}
+	tx, err := Begin(ctx, db)
+	if err != nil {
+		return report, err
+	}
+	defer tx.Rollback()
+
+	for i, raw := range records {
+		res := &report.Results[i]
+		res.Index = i
+		if errs := Validate(raw, cols); len(errs) > 0 {
+			res.fail(FieldErrors(errs))
+			report.Failed++
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, "SAVEPOINT bulk_record"); err != nil {
+			return report, err
+		}
+		written, err := upsert(tx, raw)
+		if err != nil {
+			if _, rbErr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT bulk_record"); rbErr != nil {
+				return report, rbErr
+			}
+			res.fail(err)
+			report.Failed++
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT bulk_record"); err != nil {
+			return report, err
+		}
+		res.Status = http.StatusOK
+		if written.Created {
+			res.Status = http.StatusCreated
+		}
+		res.ID, res.ETag = written.ID, FormatETag(written.Version)
+		report.Succeeded++
+	}
+	return report, tx.Commit()
+}
+
+func (res *BulkResult) fail(err error) {
+	p := oerrors.ToProblem(Classify(err))
+	res.Status, res.Error = p.Status, &p
+}
+
+// Job is an async bulk request. Results is set once the job completes;
+// Error is set if it failed as a whole.
+type Job struct {
+	ID          string       `json:"id"`
+	Resource    string       `json:"resource"`
+	Status      string       `json:"status"` // running, completed or failed
+	Total       int          `json:"total"`
+	Succeeded   int          `json:"succeeded"`
+	Failed      int          `json:"failed"`
+	Results     []BulkResult `json:"results,omitempty"`
+	Error       *string      `json:"error,omitempty"`
+	CreatedBy   string       `json:"createdBy"`
+	CreatedAt   time.Time    `json:"createdAt"`
+	CompletedAt *time.Time   `json:"completedAt"`
+}
+
+// StartJob records a job for records and runs it in the background with
+// ctx's Actor, detached from ctx's cancellation. It returns the new job.
+// The records are written MaxBulkRecords at a time, one transaction per
+// chunk, so a job that fails part way keeps the chunks already committed
+// and reports them.
+func StartJob(ctx context.Context, db *sql.DB, resource string, records []json.RawMessage,
+	run func(context.Context, []json.RawMessage) (BulkReport, error)) (*Job, error) {
+	a, _ := ctx.Value(actorKey{}).(Actor)
+	job := &Job{Resource: resource, Status: "running", Total: len(records), CreatedBy: a.Name()}
+	err := db.QueryRowContext(ctx, `INSERT INTO bulk.Job (Resource, Status, Total, CreatedBy)
+		VALUES ($1, $2, $3, $4) RETURNING Id, CreatedAt`, job.Resource, job.Status, job.Total, job.CreatedBy).
+		Scan(&job.ID, &job.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	id := job.ID
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		all := BulkReport{Results: []BulkResult{}}
+		status, errMsg := "completed", sql.NullString{}
+		for start := 0; start < len(records); start += MaxBulkRecords {
+			end := min(start+MaxBulkRecords, len(records))
+			report, err := run(ctx, records[start:end])
+			if err != nil {
+				status = "failed"
+				errMsg = sql.NullString{String: fmt.Sprintf("records %d-%d: %v", start, end-1, err), Valid: true}
+				break
+			}
+			for _, res := range report.Results {
+				res.Index += start
+				all.Results = append(all.Results, res)
+			}
+			all.Succeeded += report.Succeeded
+			all.Failed += report.Failed
+		}
+		results, _ := json.Marshal(all.Results)
+		db.ExecContext(ctx, `UPDATE bulk.Job SET Status = $2, Succeeded = $3, Failed = $4, Results = $5, Error = $6, CompletedAt = now()
+			WHERE Id = $1`, id, status, all.Succeeded, all.Failed, string(results), errMsg)
+	}()
+	return job, nil
+}
+
+// GetJob returns the job with the given id, or nil if there is none.
+func GetJob(ctx context.Context, db *sql.DB, id string) (*Job, error) {
+	var j Job
+	var results []byte
+	err := db.QueryRowContext(ctx, `SELECT Id, Resource, Status, Total, Succeeded, Failed, Results, Error, CreatedBy, CreatedAt, CompletedAt
+		FROM bulk.Job WHERE Id = $1`, id).
+		Scan(&j.ID, &j.Resource, &j.Status, &j.Total, &j.Succeeded, &j.Failed, &results, &j.Error, &j.CreatedBy, &j.CreatedAt, &j.CompletedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if results != nil {
+		if err := json.Unmarshal(results, &j.Results); err != nil {
+			return nil, err
+		}
+	}
+	return &j, nil
+}
+
+// AbandonJobs fails the jobs left running by a previous plugin process,
+// whose goroutines died with it.
+func AbandonJobs(db *sql.DB) error {
+	_, err := db.Exec(`UPDATE bulk.Job SET Status = 'failed', Error = 'interrupted by a plugin restart', CompletedAt = now()
+		WHERE Status = 'running'`)
+	return err
+}
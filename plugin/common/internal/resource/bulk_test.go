@@ -0,0 +1,39 @@
+package resource
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadBulk(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        int
+		wantErr     bool
+	}{
+		{"array", "application/json", `[{"a":1},{"a":2}]`, 2, false},
+		{"ndjson", "application/x-ndjson", "{\"a\":1}\n\n{\"a\":2}\n{\"a\":3}\n", 3, false},
+		{"ndjson with charset", "application/x-ndjson; charset=utf-8", `{"a":1}`, 1, false},
+		{"object", "application/json", `{"a":1}`, 0, true},
+		{"empty array", "application/json", `[]`, 0, true},
+		{"array over limit", "application/json", `[{},{},{},{}]`, 0, true},
+		{"ndjson over limit", "application/x-ndjson", "{}\n{}\n{}\n{}\n", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/x/bulk", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			records, err := ReadBulk(r, 3)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadBulk error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(records) != tt.want {
+				t.Errorf("ReadBulk returned %d records, want %d", len(records), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package resource
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+)
+
+// Every resource table carries a ChangeVersion drawn from one database-wide
+// sequence, bumped by trigger on each insert and update. Deletes and natural
+// key changes are recorded in changes.TrackedChange with their own version,
+// so a client can sync incrementally from the last version it saw.
+
+// ChangeVersions is the availableChangeVersions response.
+type ChangeVersions struct {
+	OldestChangeVersion int64 `json:"oldestChangeVersion"`
+	NewestChangeVersion int64 `json:"newestChangeVersion"`
+}
+
+// AvailableChangeVersions reports the range of change versions a client may
+// query. Tracked changes are never purged, so the oldest is always 0.
+func AvailableChangeVersions(ctx context.Context, db *sql.DB) (ChangeVersions, error) {
+	var v ChangeVersions
+	err := db.QueryRowContext(ctx, `SELECT CASE WHEN is_called THEN last_value ELSE 0 END
+		FROM changes.ChangeVersionSequence`).Scan(&v.NewestChangeVersion)
+	return v, err
+}
+
+// Delete is one entry of a resource's /deletes response.
+type Delete struct {
+	ID            string          `json:"id"`
+	ChangeVersion int64           `json:"changeVersion"`
+	KeyValues     json.RawMessage `json:"keyValues"`
+}
+
+// KeyChange is one entry of a resource's /keyChanges response.
+type KeyChange struct {
+	ID            string          `json:"id"`
+	ChangeVersion int64           `json:"changeVersion"`
+	OldKeyValues  json.RawMessage `json:"oldKeyValues"`
+	NewKeyValues  json.RawMessage `json:"newKeyValues"`
+}
+
+// trackedSQL selects table's tracked changes of one kind within q's change
+// version bounds, oldest first.
+func trackedSQL(table, op string, q ListQuery) (string, []interface{}) {
+	query := `SELECT ResourceKey, ChangeVersion, COALESCE(OldKeyValues, 'null'), COALESCE(NewKeyValues, 'null')
+		FROM changes.TrackedChange
+		WHERE TableName = $1::regclass::text AND Operation = $2
+		AND ($3 < 0 OR ChangeVersion >= $3) AND ($4 < 0 OR ChangeVersion <= $4)
+		ORDER BY ChangeVersion LIMIT $5 OFFSET $6`
+	return query, []interface{}{table, op, q.MinChangeVersion, q.MaxChangeVersion, q.Limit, q.Offset}
+}
+
+// Deletes lists the rows deleted (or soft-deleted) from table. Only q's
+// paging and change version bounds are used.
+func Deletes(ctx context.Context, db *sql.DB, table string, q ListQuery) ([]Delete, error) {
+	query, args := trackedSQL(table, "DELETE", q)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deletes := []Delete{}
+	for rows.Next() {
+		var d Delete
+		var oldKeys, newKeys []byte
+		if err := rows.Scan(&d.ID, &d.ChangeVersion, &oldKeys, &newKeys); err != nil {
+			return nil, err
+		}
+		d.KeyValues = oldKeys
+		deletes = append(deletes, d)
+	}
+	return deletes, rows.Err()
+}
+
+// KeyChanges lists the rows of table whose natural key was updated.
+func KeyChanges(ctx context.Context, db *sql.DB, table string, q ListQuery) ([]KeyChange, error) {
+	query, args := trackedSQL(table, "KEY_CHANGE", q)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []KeyChange{}
+	for rows.Next() {
+		var c KeyChange
+		var oldKeys, newKeys []byte
+		if err := rows.Scan(&c.ID, &c.ChangeVersion, &oldKeys, &newKeys); err != nil {
+			return nil, err
+		}
+		c.OldKeyValues, c.NewKeyValues = oldKeys, newKeys
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
@@ -0,0 +1,55 @@
+package resource
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// Descriptors are Ed-Fi's extensible code lists. Each value lives in
+// edfi.Descriptor and is referenced by URI, "{namespace}#{codeValue}", where
+// the namespace ends with the descriptor type, e.g.
+// "uri://ed-fi.org/AttendanceEventCategoryDescriptor#Tardy". Districts extend
+// a list by adding values under their own namespace.
+
+// IsDescriptorURI reports whether uri is well-formed for descriptor type t.
+// It does not check that the value exists.
+func IsDescriptorURI(uri, t string) bool {
+	ns, code, ok := strings.Cut(uri, "#")
+	if !ok || code == "" {
+		return false
+	}
+	authority, ok := strings.CutPrefix(ns, "uri://")
+	if !ok {
+		return false
+	}
+	authority, ok = strings.CutSuffix(authority, "/"+t+"Descriptor")
+	return ok && authority != ""
+}
+
+// CheckDescriptors verifies that every descriptor column of a row being
+// written names an existing descriptor of the column's type. targets are the
+// row's scan targets for cols, as returned by the generated targets method.
+// Unknown values are reported as FieldErrors.
+func CheckDescriptors(ctx context.Context, tx *sql.Tx, cols []Column, targets []interface{}) error {
+	var errs FieldErrors
+	for i, c := range cols {
+		p, ok := targets[i].(**string)
+		if c.Descriptor == "" || !ok || *p == nil {
+			continue
+		}
+		var found bool
+		err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM edfi.Descriptor WHERE Uri = $1 AND DescriptorType = $2)",
+			**p, c.Descriptor).Scan(&found)
+		if err != nil {
+			return err
+		}
+		if !found {
+			errs = append(errs, FieldError{Field: c.JSON, Message: "is not a known " + c.Descriptor + "Descriptor"})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
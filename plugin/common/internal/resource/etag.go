@@ -0,0 +1,84 @@
+package resource
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// VersionColumn is the row version every generated resource table carries.
+// It is bumped on each update, served as the ETag header and the "_etag"
+// property, and checked against If-Match before updates and deletes.
+var VersionColumn = Column{Name: "RowVersion", JSON: "_etag", Type: String}
+
+// versionExpr is how VersionColumn is read, so it scans into a string.
+const versionExpr = "RowVersion::text"
+
+// ErrPreconditionFailed is returned when If-Match names a stale version.
+var ErrPreconditionFailed = errors.New("resource: precondition failed")
+
+// FormatETag quotes a row version as a strong entity tag.
+func FormatETag(version string) string {
+	return `"` + version + `"`
+}
+
+// BodyETag derives an entity tag from a response body, for list responses
+// that have no single row version.
+func BodyETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// NotModified reports whether If-None-Match matches the ETag already set on
+// w, in which case it writes 304 and the handler must not write a body.
+func NotModified(w http.ResponseWriter, r *http.Request) bool {
+	inm := r.Header.Get("If-None-Match")
+	etag := w.Header().Get("ETag")
+	if inm == "" || etag == "" {
+		return false
+	}
+	for _, t := range strings.Split(inm, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == "*" || t == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// IfMatch returns the row version a write must match, or "" for
+// "If-Match: *". Writes require the header: when it is missing or does not
+// name a single version, IfMatch writes 428 and returns ok=false.
+func IfMatch(w http.ResponseWriter, r *http.Request) (version string, ok bool) {
+	im := strings.TrimSpace(r.Header.Get("If-Match"))
+	if im == "*" {
+		return "", true
+	}
+	if len(im) < 2 || im[0] != '"' || im[len(im)-1] != '"' || strings.Contains(im, ",") {
+		WriteError(w, r, http.StatusPreconditionRequired, "PRECONDITION_REQUIRED",
+			"If-Match with the resource's current ETag is required")
+		return "", false
+	}
+	return im[1 : len(im)-1], true
+}
+
+// WriteTagged writes v as a 200 JSON body tagged with BodyETag, or a 304 if
+// the client already has it. It is for responses that no single row
+// version describes, such as lists.
+func WriteTagged(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("ETag", BodyETag(body))
+	if NotModified(w, r) {
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(body, '\n'))
+	return nil
+}
@@ -0,0 +1,63 @@
+package resource
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIfMatch(t *testing.T) {
+	tests := []struct {
+		header      string
+		wantVersion string
+		wantOK      bool
+	}{
+		{`"3"`, "3", true},
+		{`*`, "", true},
+		{``, "", false},
+		{`W/"3"`, "", false},
+		{`"3", "4"`, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, "/x", nil)
+			r.Header.Set("If-Match", tt.header)
+			w := httptest.NewRecorder()
+			version, ok := IfMatch(w, r)
+			if version != tt.wantVersion || ok != tt.wantOK {
+				t.Errorf("IfMatch = %q, %v; want %q, %v", version, ok, tt.wantVersion, tt.wantOK)
+			}
+			if !ok && w.Code != http.StatusPreconditionRequired {
+				t.Errorf("status = %d, want 428", w.Code)
+			}
+		})
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{``, false},
+		{`"7"`, true},
+		{`W/"7"`, true},
+		{`"6", "7"`, true},
+		{`*`, true},
+		{`"6"`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/x", nil)
+			r.Header.Set("If-None-Match", tt.header)
+			w := httptest.NewRecorder()
+			w.Header().Set("ETag", FormatETag("7"))
+			if got := NotModified(w, r); got != tt.want {
+				t.Errorf("NotModified = %v, want %v", got, tt.want)
+			}
+			if tt.want && w.Code != http.StatusNotModified {
+				t.Errorf("status = %d, want 304", w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,341 @@
+package resource
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// MaxExpandDepth is how deeply expansions may nest: "section.course" is
+// two levels.
+const MaxExpandDepth = 2
+
+// Ref declares that a resource references another by the other's natural
+// key. Cols are the referencing columns, in the order of the target's Key
+// columns.
+type Ref struct {
+	Name   string // expand name, e.g. "course"
+	Target string // Name of the referenced Schema
+	Cols   []string
+}
+
+// Schema describes a generated resource to the code that expands
+// references into it. Each generated repository registers its own.
+type Schema struct {
+	Name       string
+	Table      string
+	Columns    []Column
+	Refs       []Ref
+	ReadRoles  []string // roles that may read the resource; empty for any caller
+	SoftDelete bool
+}
+
+var schemas = map[string]*Schema{}
+
+// RegisterSchema makes s available as the target of other schemas' Refs.
+func RegisterSchema(s *Schema) {
+	schemas[s.Name] = s
+}
+
+// CanRead reports whether a may read resources of s.
+func (s *Schema) CanRead(a Actor) bool {
+	return len(s.ReadRoles) == 0 || a.HasRole(s.ReadRoles...)
+}
+
+// RequireRead wraps the read routes of s, answering 403 to callers without
+// one of its ReadRoles.
+func (s *Schema) RequireRead(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.CanRead(ActorFrom(r)) {
+			WriteError(w, r, http.StatusForbidden, "FORBIDDEN", "your role may not read this resource")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Schema) ref(name string) (Ref, bool) {
+	for _, ref := range s.Refs {
+		if ref.Name == name {
+			return ref, true
+		}
+	}
+	return Ref{}, false
+}
+
+func (s *Schema) column(name string) Column {
+	for _, c := range s.Columns {
+		if c.Name == name {
+			return c
+		}
+	}
+	panic("resource: " + s.Name + " has no column " + name)
+}
+
+func (s *Schema) keyColumns() []Column {
+	var keys []Column
+	for _, c := range s.Columns {
+		if c.Key {
+			keys = append(keys, c)
+		}
+	}
+	return keys
+}
+
+// Expansion is a parsed expand parameter: each reference to expand, with
+// the expansions nested inside it.
+type Expansion map[string]Expansion
+
+// ParseExpand reads "section.course,student" against s. Unknown references
+// and paths deeper than MaxExpandDepth are errors.
+func ParseExpand(v string, s *Schema) (Expansion, []FieldError) {
+	if v == "" {
+		return nil, nil
+	}
+	e := Expansion{}
+	var errs []FieldError
+	for _, path := range strings.Split(v, ",") {
+		path = strings.TrimSpace(path)
+		names := strings.Split(path, ".")
+		if len(names) > MaxExpandDepth {
+			errs = append(errs, FieldError{Field: "expand", Message: fmt.Sprintf("%q nests deeper than %d levels", path, MaxExpandDepth)})
+			continue
+		}
+		node, schema := e, s
+		for _, name := range names {
+			ref, ok := schema.ref(name)
+			if !ok {
+				errs = append(errs, FieldError{Field: "expand", Message: fmt.Sprintf("unknown relationship %q", path)})
+				break
+			}
+			if node[name] == nil {
+				node[name] = Expansion{}
+			}
+			node, schema = node[name], schemas[ref.Target]
+		}
+	}
+	return e, errs
+}
+
+// forbidden returns the first expansion path a may not read, or "".
+func (e Expansion) forbidden(a Actor, s *Schema, prefix string) string {
+	for _, name := range e.names() {
+		ref, _ := s.ref(name)
+		target := schemas[ref.Target]
+		if !target.CanRead(a) {
+			return prefix + name
+		}
+		if path := e[name].forbidden(a, target, prefix+name+"."); path != "" {
+			return path
+		}
+	}
+	return ""
+}
+
+func (e Expansion) names() []string {
+	names := make([]string, 0, len(e))
+	for name := range e {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Fields adds the referencing columns of e's top-level references to a
+// fields selection, so they are read and their expansions can be joined.
+// An empty selection already reads every column.
+func (e Expansion) Fields(s *Schema, fields []Column) []Column {
+	if len(fields) == 0 {
+		return fields
+	}
+	out := append([]Column(nil), fields...)
+	for _, name := range e.names() {
+		ref, _ := s.ref(name)
+		for _, col := range ref.Cols {
+			if c := s.column(col); !hasColumn(out, c) {
+				out = append(out, c)
+			}
+		}
+	}
+	return out
+}
+
+// ExpandParam parses the request's expand parameter against s, writing a
+// 400 for an invalid one and a 403 if the caller may not read a resource
+// it expands into.
+func ExpandParam(w http.ResponseWriter, r *http.Request, s *Schema) (Expansion, bool) {
+	e, errs := ParseExpand(r.URL.Query().Get("expand"), s)
+	if len(errs) > 0 {
+		WriteFieldErrors(w, r, errs)
+		return nil, false
+	}
+	if path := e.forbidden(ActorFrom(r), s, ""); path != "" {
+		WriteError(w, r, http.StatusForbidden, "FORBIDDEN", fmt.Sprintf("your role may not expand %q", path))
+		return nil, false
+	}
+	return e, true
+}
+
+// Expand returns items, a slice of s's resources, with a property for each
+// reference in e holding the referenced resource, or null when there is
+// none. Each reference costs one query per level, however many items there
+// are.
+func Expand(ctx context.Context, db *sql.DB, s *Schema, items interface{}, e Expansion) ([]map[string]json.RawMessage, error) {
+	b, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+	var rows []map[string]json.RawMessage
+	if err := json.Unmarshal(b, &rows); err != nil {
+		return nil, err
+	}
+	for _, name := range e.names() {
+		ref, _ := s.ref(name)
+		target := schemas[ref.Target]
+		cols := make([]Column, len(ref.Cols))
+		for i, col := range ref.Cols {
+			cols[i] = s.column(col)
+		}
+
+		keys := map[string][]interface{}{}
+		for _, row := range rows {
+			if k, values, ok := refKey(row, cols); ok {
+				keys[k] = values
+			}
+		}
+		found, err := fetchByKey(ctx, db, target, keys)
+		if err != nil {
+			return nil, err
+		}
+		if len(e[name]) > 0 && len(found) > 0 {
+			list := make([]map[string]json.RawMessage, 0, len(found))
+			for _, f := range found {
+				list = append(list, f)
+			}
+			// Expand returns copies; fold the nested references back in.
+			expanded, err := Expand(ctx, db, target, list, e[name])
+			if err != nil {
+				return nil, err
+			}
+			for i, f := range list {
+				for k, v := range expanded[i] {
+					f[k] = v
+				}
+			}
+		}
+
+		for _, row := range rows {
+			row[name] = json.RawMessage("null")
+			if k, _, ok := refKey(row, cols); ok && found[k] != nil {
+				if row[name], err = json.Marshal(found[k]); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return rows, nil
+}
+
+// refKey encodes the values of cols in row as a lookup key, along with the
+// values to query by. ok is false if any of them is null.
+func refKey(row map[string]json.RawMessage, cols []Column) (key string, values []interface{}, ok bool) {
+	values = make([]interface{}, len(cols))
+	for i, c := range cols {
+		raw := row[c.JSON]
+		if raw == nil || string(raw) == "null" {
+			return "", nil, false
+		}
+		var v interface{}
+		if c.Type == Integer {
+			var n int64
+			if err := json.Unmarshal(raw, &n); err != nil {
+				return "", nil, false
+			}
+			v = n
+		} else {
+			var str string
+			if err := json.Unmarshal(raw, &str); err != nil {
+				return "", nil, false
+			}
+			v = str
+		}
+		values[i] = v
+	}
+	b, _ := json.Marshal(values)
+	return string(b), values, true
+}
+
+// fetchByKey reads the rows of s whose natural key is one of keys and
+// returns them keyed the same way. Soft-deleted rows are not found.
+func fetchByKey(ctx context.Context, db *sql.DB, s *Schema, keys map[string][]interface{}) (map[string]map[string]json.RawMessage, error) {
+	found := map[string]map[string]json.RawMessage{}
+	if len(keys) == 0 {
+		return found, nil
+	}
+	keyCols := s.keyColumns()
+	names := make([]string, len(keyCols))
+	for i, c := range keyCols {
+		names[i] = c.Name
+	}
+	var tuples []string
+	var args []interface{}
+	for _, values := range keys {
+		ph := make([]string, len(values))
+		for i, v := range values {
+			args = append(args, v)
+			ph[i] = fmt.Sprintf("$%d", len(args))
+		}
+		tuples = append(tuples, "("+strings.Join(ph, ", ")+")")
+	}
+	all := append(append([]Column(nil), s.Columns...), VersionColumn)
+	query := "SELECT " + SelectList(all) + " FROM " + s.Table +
+		" WHERE (" + strings.Join(names, ", ") + ") IN (" + strings.Join(tuples, ", ") + ")"
+	if s.SoftDelete {
+		query += " AND DeletedAt IS NULL"
+	}
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		dest := make([]interface{}, len(all))
+		for i, c := range all {
+			if c.Type == Integer {
+				dest[i] = new(sql.NullInt64)
+			} else {
+				dest[i] = new(sql.NullString)
+			}
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		item := make(map[string]json.RawMessage, len(all))
+		for i, c := range all {
+			var v interface{}
+			switch d := dest[i].(type) {
+			case *sql.NullInt64:
+				if d.Valid {
+					v = d.Int64
+				}
+			case *sql.NullString:
+				if d.Valid {
+					v = d.String
+				}
+			}
+			if item[c.JSON], err = json.Marshal(v); err != nil {
+				return nil, err
+			}
+		}
+		k, _, ok := refKey(item, keyCols)
+		if ok {
+			found[k] = item
+		}
+	}
+	return found, rows.Err()
+}
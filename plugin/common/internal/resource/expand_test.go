@@ -0,0 +1,100 @@
+package resource
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var (
+	testCourse = &Schema{Name: "test-course", Columns: []Column{
+		IDColumn,
+		{Name: "CourseIdentifier", JSON: "courseidentifier", Type: String, Key: true},
+	}}
+	testStudent = &Schema{Name: "test-student", ReadRoles: []string{"teacher"}, Columns: []Column{
+		IDColumn,
+		{Name: "StudentUniqueId", JSON: "studentuniqueid", Type: String, Key: true},
+	}}
+	testSection = &Schema{Name: "test-section", Columns: []Column{
+		IDColumn,
+		{Name: "CourseSectionIdentifier", JSON: "coursesectionidentifier", Type: String, Key: true},
+		{Name: "CourseIdentifier", JSON: "courseidentifier", Type: String},
+	}, Refs: []Ref{{Name: "course", Target: "test-course", Cols: []string{"CourseIdentifier"}}}}
+	testAttendance = &Schema{Name: "test-attendance", Columns: []Column{
+		IDColumn,
+		{Name: "CourseSectionIdentifier", JSON: "coursesectionidentifier", Type: String, Key: true},
+		{Name: "StudentUniqueId", JSON: "studentuniqueid", Type: String, Key: true},
+	}, Refs: []Ref{
+		{Name: "section", Target: "test-section", Cols: []string{"CourseSectionIdentifier"}},
+		{Name: "student", Target: "test-student", Cols: []string{"StudentUniqueId"}},
+	}}
+)
+
+func init() {
+	for _, s := range []*Schema{testCourse, testStudent, testSection, testAttendance} {
+		RegisterSchema(s)
+	}
+}
+
+func TestParseExpand(t *testing.T) {
+	tests := []struct {
+		expand  string
+		want    string
+		wantErr bool
+	}{
+		{"", "map[]", false},
+		{"section", "map[section:map[]]", false},
+		{"section.course,student", "map[section:map[course:map[]] student:map[]]", false},
+		{"section,section.course", "map[section:map[course:map[]]]", false},
+		{"teacher", "", true},
+		{"section.teacher", "", true},
+		{"section.course.section", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expand, func(t *testing.T) {
+			e, errs := ParseExpand(tt.expand, testAttendance)
+			if (len(errs) > 0) != tt.wantErr {
+				t.Fatalf("errors = %v, wantErr %v", errs, tt.wantErr)
+			}
+			if got := fmt.Sprint(e); !tt.wantErr && got != tt.want {
+				t.Errorf("ParseExpand = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandParamAuthorization(t *testing.T) {
+	tests := []struct {
+		expand, role string
+		want         int
+	}{
+		{"section.course", "student", http.StatusOK},
+		{"student", "student", http.StatusForbidden},
+		{"student", "teacher", http.StatusOK},
+		{"bogus", "teacher", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expand+"/"+tt.role, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/x?expand="+tt.expand, nil)
+			r.Header.Set("X-Oasis-User-Roles", tt.role)
+			w := httptest.NewRecorder()
+			_, ok := ExpandParam(w, r, testAttendance)
+			if ok != (tt.want == http.StatusOK) || (!ok && w.Code != tt.want) {
+				t.Errorf("ExpandParam ok = %v, status %d; want %d", ok, w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpansionFields(t *testing.T) {
+	e := Expansion{"course": {}}
+	fields := []Column{testSection.Columns[1]}
+	got := e.Fields(testSection, fields)
+	if len(got) != 2 || got[1].Name != "CourseIdentifier" {
+		t.Errorf("Fields = %v, want the selection plus CourseIdentifier", got)
+	}
+	if got := e.Fields(testSection, nil); got != nil {
+		t.Errorf("Fields(nil) = %v, want nil so every column is read", got)
+	}
+}
@@ -0,0 +1,31 @@
+package resource
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// IDColumn is the resource id every table carries: a UUID assigned on
+// insert that never changes, even when the natural key does. Generated
+// resources list it first so it breaks ties when paging.
+var IDColumn = Column{Name: "Id", JSON: "id", Type: String}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// ValidID reports whether id is formatted as a UUID.
+func ValidID(id string) bool {
+	return uuidPattern.MatchString(id)
+}
+
+// PathID returns the {id} path value in the lower case Postgres prints
+// UUIDs in. Anything that is not a UUID cannot name a resource, so it writes
+// a 404 rather than letting the cast fail in the database.
+func PathID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := r.PathValue("id")
+	if !ValidID(id) {
+		WriteRepoError(w, r, ErrNotFound)
+		return "", false
+	}
+	return strings.ToLower(id), true
+}
@@ -0,0 +1,182 @@
+package resource
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Page describes where a list response sits in the full result set.
+type Page struct {
+	HasNext bool
+	Next    string // cursor for the following page, when HasNext
+	Total   int64  // filtered row count, or -1 when totalCount was not requested
+}
+
+// cursor is the decoded form of the opaque ?cursor= token. Sort records the
+// order it was issued for, so a cursor cannot be replayed under another sort.
+type cursor struct {
+	Sort   string        `json:"s"`
+	Values []interface{} `json:"v"`
+}
+
+func sortSignature(keys []SortKey) string {
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k.Column.JSON
+		if k.Desc {
+			parts[i] = "-" + parts[i]
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func decodeCursor(token string, keys []SortKey) ([]interface{}, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+	var c cursor
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&c); err != nil {
+		return nil, err
+	}
+	if c.Sort != sortSignature(keys) || len(c.Values) != len(keys) {
+		return nil, errors.New("cursor does not match sort order")
+	}
+	values := make([]interface{}, len(keys))
+	for i, v := range c.Values {
+		switch v := v.(type) {
+		case nil:
+		case json.Number:
+			if keys[i].Column.Type != Integer {
+				return nil, errors.New("cursor value has the wrong type")
+			}
+			n, err := v.Int64()
+			if err != nil {
+				return nil, err
+			}
+			values[i] = n
+		case string:
+			if keys[i].Column.Type == Integer {
+				return nil, errors.New("cursor value has the wrong type")
+			}
+			values[i] = v
+		default:
+			return nil, errors.New("cursor value has the wrong type")
+		}
+	}
+	return values, nil
+}
+
+// NextCursor encodes the order-key values of the last row on a page. last
+// holds the scan targets for OrderKeys, as returned by the generated
+// targets method, i.e. pointers to the struct's pointer fields.
+func (lq ListQuery) NextCursor(last []interface{}) string {
+	values := make([]interface{}, len(last))
+	for i, t := range last {
+		switch p := t.(type) {
+		case **string:
+			if *p != nil {
+				values[i] = **p
+			}
+		case **int64:
+			if *p != nil {
+				values[i] = **p
+			}
+		}
+	}
+	b, _ := json.Marshal(cursor{Sort: sortSignature(lq.OrderKeys()), Values: values})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// keysetCond renders "rows after the cursor" for the current sort order,
+// numbering placeholders from start. Postgres sorts NULLs last ascending
+// and first descending, which the per-column comparisons mirror.
+func (lq ListQuery) keysetCond(start int) (string, []interface{}) {
+	keys := lq.OrderKeys()
+	var args []interface{}
+	ph := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", start+len(args)-1)
+	}
+
+	var disjuncts []string
+	for i, k := range keys {
+		col, v := k.Column.Name, lq.Cursor[i]
+		if !k.Desc && v == nil {
+			continue // nothing sorts after NULL ascending
+		}
+		var conj []string
+		for j := 0; j < i; j++ {
+			if v := lq.Cursor[j]; v == nil {
+				conj = append(conj, keys[j].Column.Name+" IS NULL")
+			} else {
+				conj = append(conj, keys[j].Column.Name+" = "+ph(v))
+			}
+		}
+		switch {
+		case !k.Desc:
+			conj = append(conj, "("+col+" > "+ph(v)+" OR "+col+" IS NULL)")
+		case v == nil:
+			conj = append(conj, col+" IS NOT NULL")
+		default:
+			conj = append(conj, col+" < "+ph(v))
+		}
+		disjuncts = append(disjuncts, "("+strings.Join(conj, " AND ")+")")
+	}
+	if len(disjuncts) == 0 {
+		return "FALSE", nil
+	}
+	return "(" + strings.Join(disjuncts, " OR ") + ")", args
+}
+
+// WriteHeaders sets Total-Count (when requested, as in the Ed-Fi API) and an
+// RFC 8288 Link header. Requests paged with offset get offset-based first,
+// prev, next and last links; all others page forward by cursor.
+func (lq ListQuery) WriteHeaders(w http.ResponseWriter, u *url.URL, p Page) {
+	if p.Total >= 0 {
+		w.Header().Set("Total-Count", strconv.FormatInt(p.Total, 10))
+	}
+
+	link := func(rel string, set func(url.Values)) string {
+		q := u.Query()
+		q.Del("cursor")
+		q.Del("offset")
+		set(q)
+		v := *u
+		v.RawQuery = q.Encode()
+		return fmt.Sprintf(`<%s>; rel="%s"`, v.RequestURI(), rel)
+	}
+	offset := func(n int) func(url.Values) {
+		return func(q url.Values) { q.Set("offset", strconv.Itoa(n)) }
+	}
+
+	if u.Query().Has("offset") {
+		links := []string{link("first", offset(0))}
+		if lq.Offset > 0 {
+			links = append(links, link("prev", offset(max(lq.Offset-lq.Limit, 0))))
+		}
+		if p.HasNext {
+			links = append(links, link("next", offset(lq.Offset+lq.Limit)))
+		}
+		if p.Total > 0 {
+			links = append(links, link("last", offset(int((p.Total-1)/int64(lq.Limit))*lq.Limit)))
+		}
+		w.Header().Set("Link", strings.Join(links, ", "))
+		return
+	}
+
+	links := []string{link("first", func(url.Values) {})}
+	if p.HasNext {
+		links = append(links, link("next", func(q url.Values) { q.Set("cursor", p.Next) }))
+	}
+	w.Header().Set("Link", strings.Join(links, ", "))
+}
@@ -0,0 +1,98 @@
+package resource
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	q, errs := parse(t, "sort=-schoolyear,firstname")
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	year, id := int64(2024), "s9"
+	var s struct {
+		SchoolYear *int64
+		FirstName  *string
+		ID         *string
+	}
+	s.SchoolYear, s.ID = &year, &id
+	token := q.NextCursor([]interface{}{&s.SchoolYear, &s.FirstName, &s.ID})
+
+	next, errs := parse(t, "sort=-schoolyear,firstname&cursor="+token)
+	if len(errs) > 0 {
+		t.Fatalf("cursor rejected: %v", errs)
+	}
+	if got := fmt.Sprint(next.Cursor); got != "[2024 <nil> s9]" {
+		t.Errorf("Cursor = %s", got)
+	}
+
+	sql, args := next.SQL("t", listCols)
+	want := "SELECT StudentUniqueId, FirstName, SchoolYear, to_char(EntryDate, 'YYYY-MM-DD'), Notes, RowVersion::text FROM t WHERE " +
+		"((SchoolYear < $1) OR (SchoolYear = $2 AND FirstName IS NULL AND (StudentUniqueId > $3 OR StudentUniqueId IS NULL))) " +
+		"ORDER BY SchoolYear DESC, FirstName ASC, StudentUniqueId ASC LIMIT $4 OFFSET $5"
+	if sql != want {
+		t.Errorf("SQL =\n  %s\nwant\n  %s", sql, want)
+	}
+	if got := fmt.Sprint(args); got != "[2024 2024 s9 51 0]" {
+		t.Errorf("args = %s", got)
+	}
+
+	if _, errs := parse(t, "sort=firstname&cursor="+token); len(errs) != 1 || errs[0].Field != "cursor" {
+		t.Errorf("cursor reused under another sort: errors = %v", errs)
+	}
+	if _, errs := parse(t, "cursor=not-a-cursor"); len(errs) != 1 {
+		t.Errorf("garbage cursor: errors = %v", errs)
+	}
+	if _, errs := parse(t, "offset=10&sort=-schoolyear,firstname&cursor="+token); len(errs) != 1 {
+		t.Errorf("cursor with offset: errors = %v", errs)
+	}
+}
+
+func TestWriteHeaders(t *testing.T) {
+	tests := []struct {
+		target string
+		page   Page
+		total  string
+		link   string
+	}{
+		{
+			"/s?limit=10",
+			Page{HasNext: true, Next: "abc", Total: -1},
+			"",
+			`</s?limit=10>; rel="first", </s?cursor=abc&limit=10>; rel="next"`,
+		},
+		{
+			"/s?limit=10&offset=20&totalCount=true",
+			Page{HasNext: true, Total: 45},
+			"45",
+			`</s?limit=10&offset=0&totalCount=true>; rel="first", </s?limit=10&offset=10&totalCount=true>; rel="prev", ` +
+				`</s?limit=10&offset=30&totalCount=true>; rel="next", </s?limit=10&offset=40&totalCount=true>; rel="last"`,
+		},
+		{
+			"/s",
+			Page{Total: 0},
+			"0",
+			`</s>; rel="first"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			u, _ := url.Parse(tt.target)
+			q, errs := ParseListQuery(u.Query(), listCols)
+			if len(errs) > 0 {
+				t.Fatal(errs)
+			}
+			w := httptest.NewRecorder()
+			q.WriteHeaders(w, u, tt.page)
+			if got := w.Header().Get("Total-Count"); got != tt.total {
+				t.Errorf("Total-Count = %q, want %q", got, tt.total)
+			}
+			if got := w.Header().Get("Link"); got != tt.link {
+				t.Errorf("Link =\n  %s\nwant\n  %s", got, tt.link)
+			}
+		})
+	}
+}
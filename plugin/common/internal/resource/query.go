@@ -0,0 +1,484 @@
+package resource
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Op is a filter comparison accepted on list endpoints.
+type Op string
+
+const (
+	Eq         Op = "eq"
+	Ne         Op = "ne"
+	Gt         Op = "gt"
+	Gte        Op = "gte"
+	Lt         Op = "lt"
+	Lte        Op = "lte"
+	Contains   Op = "contains"   // case-insensitive substring, strings only
+	StartsWith Op = "startswith" // case-insensitive prefix, strings only
+)
+
+// Ops returns the filter operators a column of type t accepts.
+func (t Type) Ops() []Op {
+	if t == String {
+		return []Op{Eq, Ne, Contains, StartsWith}
+	}
+	return []Op{Eq, Ne, Gt, Gte, Lt, Lte}
+}
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 500
+)
+
+// reserved are the query parameters that are never treated as filters.
+var reserved = map[string]bool{
+	"limit": true, "offset": true, "cursor": true, "totalCount": true,
+	"sort": true, "fields": true, "minChangeVersion": true, "maxChangeVersion": true,
+	"expand": true,
+}
+
+// Filter is a single parsed "column[op]=value" condition.
+type Filter struct {
+	Column Column
+	Op     Op
+	Values []interface{}
+}
+
+// SortKey orders a list by one column.
+type SortKey struct {
+	Column Column
+	Desc   bool
+}
+
+// ListQuery is a parsed list request. It is only ever built from
+// whitelisted columns, so the SQL it renders never interpolates user input.
+type ListQuery struct {
+	Limit      int
+	Offset     int
+	Cursor     []interface{} // key values of the last row of the previous page
+	TotalCount bool          // report the filtered row count in Total-Count
+	Filters    []Filter
+	Sort       []SortKey
+	Fields     []Column
+
+	// MinChangeVersion and MaxChangeVersion bound the rows' ChangeVersion,
+	// inclusively, for Ed-Fi Change Queries. -1 means unbounded.
+	MinChangeVersion int64
+	MaxChangeVersion int64
+
+	key        Column // tie-breaker appended to the sort order
+	notDeleted bool   // exclude soft-deleted rows
+}
+
+// ParseListQuery reads paging, filter, sort and field-selection parameters.
+//
+//	?lastsurname=Smith              equality (repeat the parameter to match any of several values)
+//	?schoolyear[gte]=2020           ranges: gt, gte, lt, lte; ne for inequality
+//	?firstname[contains]=ann        case-insensitive search: contains, startswith
+//	?sort=lastsurname,-firstname    ascending, or descending with a leading "-"
+//	?fields=studentuniqueid,firstname
+//	?cursor=...                     keyset paging from a Link rel="next" URL
+//	?totalCount=true                report the filtered count in Total-Count
+//	?minChangeVersion=100           only rows changed at or after version 100 (also maxChangeVersion)
+//
+// Only columns marked Filter may be filtered on. Parameters that do not name
+// a column are ignored so the host can add its own (e.g. "role"). cols[0]
+// is the unique key that breaks ties; without a sort parameter the list is
+// ordered by the natural key columns (those marked Key).
+func ParseListQuery(q url.Values, cols []Column) (ListQuery, []FieldError) {
+	lq := ListQuery{Limit: DefaultLimit, MinChangeVersion: -1, MaxChangeVersion: -1}
+	if len(cols) > 0 {
+		lq.key = cols[0]
+	}
+	var errs []FieldError
+
+	if v := q.Get("totalCount"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, FieldError{Field: "totalCount", Message: "must be true or false"})
+		}
+		lq.TotalCount = b
+	}
+
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxLimit {
+			errs = append(errs, FieldError{Field: "limit", Message: fmt.Sprintf("must be an integer between 1 and %d", MaxLimit)})
+		} else {
+			lq.Limit = n
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			errs = append(errs, FieldError{Field: "offset", Message: "must be a non-negative integer"})
+		} else {
+			lq.Offset = n
+		}
+	}
+
+	for _, p := range []struct {
+		name string
+		dest *int64
+	}{{"minChangeVersion", &lq.MinChangeVersion}, {"maxChangeVersion", &lq.MaxChangeVersion}} {
+		if v := q.Get(p.name); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 0 {
+				errs = append(errs, FieldError{Field: p.name, Message: "must be a non-negative integer"})
+			} else {
+				*p.dest = n
+			}
+		}
+	}
+
+	byJSON := make(map[string]Column, len(cols))
+	for _, c := range cols {
+		byJSON[c.JSON] = c
+	}
+
+	for key, values := range q {
+		if reserved[key] {
+			continue
+		}
+		name, op := key, Eq
+		if i := strings.IndexByte(key, '['); i > 0 && strings.HasSuffix(key, "]") {
+			name, op = key[:i], Op(key[i+1:len(key)-1])
+		}
+		c, ok := byJSON[name]
+		if !ok {
+			continue
+		}
+		if !c.Filter {
+			errs = append(errs, FieldError{Field: key, Message: "is not a filterable field"})
+			continue
+		}
+		if !hasOp(c.Type.Ops(), op) {
+			errs = append(errs, FieldError{Field: key, Message: fmt.Sprintf("unsupported operator %q for %s field", op, c.Type)})
+			continue
+		}
+		if op != Eq && len(values) > 1 {
+			errs = append(errs, FieldError{Field: key, Message: "may only be given once"})
+			continue
+		}
+		f := Filter{Column: c, Op: op}
+		for _, raw := range values {
+			v, msg := parseValue(c.Type, raw)
+			if msg != "" {
+				errs = append(errs, FieldError{Field: key, Message: msg})
+				break
+			}
+			f.Values = append(f.Values, v)
+		}
+		if len(f.Values) == len(values) {
+			lq.Filters = append(lq.Filters, f)
+		}
+	}
+	// Map iteration order is random; keep the rendered SQL deterministic.
+	sortFilters(lq.Filters)
+
+	if v := q.Get("sort"); v != "" {
+		for _, part := range strings.Split(v, ",") {
+			part = strings.TrimSpace(part)
+			desc := strings.HasPrefix(part, "-")
+			c, ok := byJSON[strings.TrimPrefix(part, "-")]
+			if !ok {
+				errs = append(errs, FieldError{Field: "sort", Message: fmt.Sprintf("unknown field %q", part)})
+				continue
+			}
+			lq.Sort = append(lq.Sort, SortKey{Column: c, Desc: desc})
+		}
+	}
+	if !q.Has("sort") {
+		for _, c := range cols {
+			if c.Key {
+				lq.Sort = append(lq.Sort, SortKey{Column: c})
+			}
+		}
+	}
+
+	if v := q.Get("fields"); v != "" {
+		for _, part := range strings.Split(v, ",") {
+			c, ok := byJSON[strings.TrimSpace(part)]
+			if !ok {
+				errs = append(errs, FieldError{Field: "fields", Message: fmt.Sprintf("unknown field %q", part)})
+				continue
+			}
+			lq.Fields = append(lq.Fields, c)
+		}
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		if q.Has("offset") {
+			errs = append(errs, FieldError{Field: "cursor", Message: "cannot be combined with offset"})
+		} else if values, err := decodeCursor(v, lq.OrderKeys()); err != nil {
+			errs = append(errs, FieldError{Field: "cursor", Message: "is invalid or does not match the sort order"})
+		} else {
+			lq.Cursor = values
+		}
+	}
+
+	return lq, errs
+}
+
+func hasOp(ops []Op, op Op) bool {
+	for _, o := range ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+func parseValue(t Type, raw string) (interface{}, string) {
+	switch t {
+	case Integer:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, "must be an integer"
+		}
+		return n, ""
+	case Date:
+		if _, err := time.Parse("2006-01-02", raw); err != nil {
+			return nil, "must be a date (YYYY-MM-DD)"
+		}
+	}
+	return raw, ""
+}
+
+func sortFilters(fs []Filter) {
+	sort.Slice(fs, func(i, j int) bool {
+		if fs[i].Column.JSON != fs[j].Column.JSON {
+			return fs[i].Column.JSON < fs[j].Column.JSON
+		}
+		return fs[i].Op < fs[j].Op
+	})
+}
+
+// Selected returns the columns to read: the requested fields plus the sort
+// columns needed to build the next cursor, or all of cols. The row version
+// is always read last.
+func (lq ListQuery) Selected(cols []Column) []Column {
+	if len(lq.Fields) == 0 {
+		return append(append([]Column(nil), cols...), VersionColumn)
+	}
+	selected := append([]Column(nil), lq.Fields...)
+	for _, k := range lq.OrderKeys() {
+		if !hasColumn(selected, k.Column) {
+			selected = append(selected, k.Column)
+		}
+	}
+	return append(selected, VersionColumn)
+}
+
+func hasColumn(cols []Column, c Column) bool {
+	for _, s := range cols {
+		if s.Name == c.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectList renders cols as a SELECT list. Dates are formatted in SQL so
+// they scan into strings as YYYY-MM-DD rather than timestamps.
+func SelectList(cols []Column) string {
+	exprs := make([]string, len(cols))
+	for i, c := range cols {
+		switch {
+		case c == VersionColumn:
+			exprs[i] = versionExpr
+		case c.Type == Date:
+			exprs[i] = "to_char(" + c.Name + ", 'YYYY-MM-DD')"
+		default:
+			exprs[i] = c.Name
+		}
+	}
+	return strings.Join(exprs, ", ")
+}
+
+// Where renders the filters as a WHERE clause (empty when there are none)
+// with placeholders numbered from $1. The cursor is not included, so the
+// clause also serves the total count.
+func (lq ListQuery) Where() (string, []interface{}) {
+	conds, args := lq.filterConds()
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// NotDeleted returns lq restricted to rows that have not been soft-deleted,
+// for tables with a DeletedAt column.
+func (lq ListQuery) NotDeleted() ListQuery {
+	lq.notDeleted = true
+	return lq
+}
+
+// WhereEq adds an equality condition on c that is not driven by the request,
+// e.g. to scope a shared table to one kind of row.
+func (lq ListQuery) WhereEq(c Column, v interface{}) ListQuery {
+	lq.Filters = append(append([]Filter(nil), lq.Filters...), Filter{Column: c, Op: Eq, Values: []interface{}{v}})
+	return lq
+}
+
+func (lq ListQuery) filterConds() ([]string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	if lq.notDeleted {
+		conds = append(conds, "DeletedAt IS NULL")
+	}
+	if lq.MinChangeVersion >= 0 {
+		args = append(args, lq.MinChangeVersion)
+		conds = append(conds, fmt.Sprintf("ChangeVersion >= $%d", len(args)))
+	}
+	if lq.MaxChangeVersion >= 0 {
+		args = append(args, lq.MaxChangeVersion)
+		conds = append(conds, fmt.Sprintf("ChangeVersion <= $%d", len(args)))
+	}
+	for _, f := range lq.Filters {
+		ph := fmt.Sprintf("$%d", len(args)+1)
+		switch f.Op {
+		case Eq:
+			if len(f.Values) == 1 {
+				conds = append(conds, f.Column.Name+" = "+ph)
+				args = append(args, f.Values[0])
+			} else {
+				conds = append(conds, f.Column.Name+" = ANY("+ph+")")
+				args = append(args, arrayOf(f.Column.Type, f.Values))
+			}
+		case Ne:
+			conds = append(conds, f.Column.Name+" <> "+ph)
+			args = append(args, f.Values[0])
+		case Gt, Gte, Lt, Lte:
+			conds = append(conds, f.Column.Name+" "+comparators[f.Op]+" "+ph)
+			args = append(args, f.Values[0])
+		case Contains:
+			conds = append(conds, f.Column.Name+" ILIKE "+ph)
+			args = append(args, "%"+escapeLike(f.Values[0].(string))+"%")
+		case StartsWith:
+			conds = append(conds, f.Column.Name+" ILIKE "+ph)
+			args = append(args, escapeLike(f.Values[0].(string))+"%")
+		}
+	}
+	return conds, args
+}
+
+var comparators = map[Op]string{Gt: ">", Gte: ">=", Lt: "<", Lte: "<="}
+
+func arrayOf(t Type, values []interface{}) interface{} {
+	if t == Integer {
+		a := make(pq.Int64Array, len(values))
+		for i, v := range values {
+			a[i] = v.(int64)
+		}
+		return a
+	}
+	a := make(pq.StringArray, len(values))
+	for i, v := range values {
+		a[i] = v.(string)
+	}
+	return a
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// OrderKeys is the requested sort order, always ending with the key column
+// so that paging is stable.
+func (lq ListQuery) OrderKeys() []SortKey {
+	keys := append([]SortKey(nil), lq.Sort...)
+	for _, s := range lq.Sort {
+		if s.Column.Name == lq.key.Name {
+			return keys
+		}
+	}
+	if lq.key.Name != "" {
+		keys = append(keys, SortKey{Column: lq.key})
+	}
+	return keys
+}
+
+// OrderColumns returns the columns of OrderKeys.
+func (lq ListQuery) OrderColumns() []Column {
+	keys := lq.OrderKeys()
+	cols := make([]Column, len(keys))
+	for i, k := range keys {
+		cols[i] = k.Column
+	}
+	return cols
+}
+
+// OrderBy renders OrderKeys as an ORDER BY clause.
+func (lq ListQuery) OrderBy() string {
+	var parts []string
+	for _, s := range lq.OrderKeys() {
+		dir := " ASC"
+		if s.Desc {
+			dir = " DESC"
+		}
+		parts = append(parts, s.Column.Name+dir)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " ORDER BY " + strings.Join(parts, ", ")
+}
+
+// SQL renders the list query against table. It fetches one row more than
+// Limit so the handler can tell whether a next page exists.
+func (lq ListQuery) SQL(table string, cols []Column) (string, []interface{}) {
+	conds, args := lq.filterConds()
+	if lq.Cursor != nil {
+		cond, cursorArgs := lq.keysetCond(len(args) + 1)
+		conds = append(conds, cond)
+		args = append(args, cursorArgs...)
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+	query := "SELECT " + SelectList(lq.Selected(cols)) + " FROM " + table + where + lq.OrderBy() +
+		fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+	return query, append(args, lq.Limit+1, lq.Offset)
+}
+
+// CountSQL renders a count of the rows matching the filters.
+func (lq ListQuery) CountSQL(table string) (string, []interface{}) {
+	where, args := lq.Where()
+	return "SELECT count(*) FROM " + table + where, args
+}
+
+// Project trims each item down to the selected fields and "_etag". With no
+// field selection the items are returned unchanged.
+func Project(items interface{}, fields []Column) (interface{}, error) {
+	if len(fields) == 0 {
+		return items, nil
+	}
+	b, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+	var all []map[string]json.RawMessage
+	if err := json.Unmarshal(b, &all); err != nil {
+		return nil, err
+	}
+	keep := append(fields[:len(fields):len(fields)], VersionColumn)
+	out := make([]map[string]json.RawMessage, len(all))
+	for i, item := range all {
+		out[i] = make(map[string]json.RawMessage, len(keep))
+		for _, f := range keep {
+			out[i][f.JSON] = item[f.JSON]
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,156 @@
+package resource
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+)
+
+var listCols = []Column{
+	{Name: "StudentUniqueId", JSON: "studentuniqueid", Type: String, Filter: true},
+	{Name: "FirstName", JSON: "firstname", Type: String, Filter: true},
+	{Name: "SchoolYear", JSON: "schoolyear", Type: Integer, Filter: true},
+	{Name: "EntryDate", JSON: "entrydate", Type: Date, Filter: true},
+	{Name: "Notes", JSON: "notes", Type: String},
+}
+
+func parse(t *testing.T, raw string) (ListQuery, []FieldError) {
+	t.Helper()
+	q, err := url.ParseQuery(raw)
+	if err != nil {
+		t.Fatalf("ParseQuery(%q): %v", raw, err)
+	}
+	return ParseListQuery(q, listCols)
+}
+
+func TestListQuerySQL(t *testing.T) {
+	tests := []struct {
+		query    string
+		wantSQL  string
+		wantArgs string
+	}{
+		{
+			"",
+			"SELECT StudentUniqueId, FirstName, SchoolYear, to_char(EntryDate, 'YYYY-MM-DD'), Notes, RowVersion::text FROM t ORDER BY StudentUniqueId ASC LIMIT $1 OFFSET $2",
+			"[51 0]",
+		},
+		{
+			"limit=10&offset=20&role=teacher",
+			"SELECT StudentUniqueId, FirstName, SchoolYear, to_char(EntryDate, 'YYYY-MM-DD'), Notes, RowVersion::text FROM t ORDER BY StudentUniqueId ASC LIMIT $1 OFFSET $2",
+			"[11 20]",
+		},
+		{
+			"firstname[contains]=an_n&schoolyear[gte]=2020&schoolyear[lt]=2024",
+			"SELECT StudentUniqueId, FirstName, SchoolYear, to_char(EntryDate, 'YYYY-MM-DD'), Notes, RowVersion::text FROM t WHERE FirstName ILIKE $1 AND SchoolYear >= $2 AND SchoolYear < $3 ORDER BY StudentUniqueId ASC LIMIT $4 OFFSET $5",
+			`[%an\_n% 2020 2024 51 0]`,
+		},
+		{
+			"studentuniqueid=a&studentuniqueid=b&sort=-schoolyear,firstname&fields=firstname,schoolyear",
+			"SELECT FirstName, SchoolYear, StudentUniqueId, RowVersion::text FROM t WHERE StudentUniqueId = ANY($1) ORDER BY SchoolYear DESC, FirstName ASC, StudentUniqueId ASC LIMIT $2 OFFSET $3",
+			"[[a b] 51 0]",
+		},
+		{
+			"entrydate=2024-08-15&sort=studentuniqueid",
+			"SELECT StudentUniqueId, FirstName, SchoolYear, to_char(EntryDate, 'YYYY-MM-DD'), Notes, RowVersion::text FROM t WHERE EntryDate = $1 ORDER BY StudentUniqueId ASC LIMIT $2 OFFSET $3",
+			"[2024-08-15 51 0]",
+		},
+		{
+			"minChangeVersion=100&maxChangeVersion=200&firstname=Ann",
+			"SELECT StudentUniqueId, FirstName, SchoolYear, to_char(EntryDate, 'YYYY-MM-DD'), Notes, RowVersion::text FROM t WHERE ChangeVersion >= $1 AND ChangeVersion <= $2 AND FirstName = $3 ORDER BY StudentUniqueId ASC LIMIT $4 OFFSET $5",
+			"[100 200 Ann 51 0]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, errs := parse(t, tt.query)
+			if len(errs) > 0 {
+				t.Fatalf("unexpected errors: %v", errs)
+			}
+			sql, args := q.SQL("t", listCols)
+			if sql != tt.wantSQL {
+				t.Errorf("SQL =\n  %s\nwant\n  %s", sql, tt.wantSQL)
+			}
+			if got := fmt.Sprint(args); got != tt.wantArgs {
+				t.Errorf("args = %s, want %s", got, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestNaturalKeyOrder(t *testing.T) {
+	cols := []Column{
+		IDColumn,
+		{Name: "CourseSectionIdentifier", JSON: "coursesectionidentifier", Type: String, Key: true},
+		{Name: "StudentUniqueId", JSON: "studentuniqueid", Type: String, Key: true},
+	}
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", " ORDER BY CourseSectionIdentifier ASC, StudentUniqueId ASC, Id ASC"},
+		{"sort=-studentuniqueid", " ORDER BY StudentUniqueId DESC, Id ASC"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, _ := url.ParseQuery(tt.query)
+			lq, errs := ParseListQuery(q, cols)
+			if len(errs) > 0 {
+				t.Fatalf("unexpected errors: %v", errs)
+			}
+			if got := lq.OrderBy(); got != tt.want {
+				t.Errorf("OrderBy = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseListQueryErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"limit=0", "limit"},
+		{"limit=501", "limit"},
+		{"offset=-1", "offset"},
+		{"notes=x", "notes"},
+		{"schoolyear[contains]=20", "schoolyear[contains]"},
+		{"firstname[gt]=a", "firstname[gt]"},
+		{"schoolyear=abc", "schoolyear"},
+		{"entrydate[gte]=08/15/2024", "entrydate[gte]"},
+		{"firstname[ne]=a&firstname[ne]=b", "firstname[ne]"},
+		{"sort=-nickname", "sort"},
+		{"fields=firstname,nickname", "fields"},
+		{"minChangeVersion=-1", "minChangeVersion"},
+		{"maxChangeVersion=latest", "maxChangeVersion"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, errs := parse(t, tt.query)
+			if len(errs) != 1 || errs[0].Field != tt.want {
+				t.Errorf("errors = %v, want one error on %q", errs, tt.want)
+			}
+		})
+	}
+}
+
+func TestProject(t *testing.T) {
+	type item struct {
+		A *string `json:"a"`
+		B *string `json:"b"`
+	}
+	a := "x"
+	out, err := Project([]item{{A: &a}}, []Column{{JSON: "a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := fmt.Sprintf("%s", out)
+	if got != `[map[_etag:null a:"x"]]` {
+		t.Errorf("Project = %s", got)
+	}
+
+	items := []item{{A: &a}}
+	same, _ := Project(items, nil)
+	if _, ok := same.([]item); !ok {
+		t.Errorf("Project with no fields should return the items unchanged, got %T", same)
+	}
+}
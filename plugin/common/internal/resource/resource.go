@@ -0,0 +1,143 @@
+// Package resource holds the runtime helpers shared by the generated
+// common-plugin domain handlers and repositories. The generator emits the
+// per-domain SQL and structs; everything that is identical across domains
+// (body validation, problem details, database error mapping) lives here.
+package resource
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	oerrors "github.com/catdevman/oasis/internal/errors"
+	"github.com/catdevman/oasis/shared"
+	"github.com/lib/pq"
+)
+
+// Type is the JSON/SQL type of a column.
+type Type int
+
+const (
+	String  Type = iota // TEXT columns, JSON strings
+	Integer             // INTEGER columns, JSON whole numbers
+	Date                // DATE columns, JSON strings formatted YYYY-MM-DD
+)
+
+func (t Type) String() string {
+	switch t {
+	case Integer:
+		return "integer"
+	case Date:
+		return "date"
+	default:
+		return "string"
+	}
+}
+
+// Column describes one column of a generated resource.
+type Column struct {
+	Name     string // database column name (e.g. "StudentUniqueId")
+	JSON     string // JSON property name (e.g. "studentuniqueid")
+	Type     Type
+	Required bool
+	Filter   bool // may be used as a list filter parameter
+	Key      bool // part of the natural key; lists sort by it by default
+	// Descriptor names the Ed-Fi descriptor type (e.g. "AttendanceEventCategory")
+	// whose URIs the column holds; empty for ordinary columns.
+	Descriptor string
+}
+
+var (
+	// ErrNotFound is returned by repositories when no row matched the key.
+	ErrNotFound = errors.New("resource: not found")
+	// ErrConflict is returned when a write violates a unique or foreign key.
+	ErrConflict = errors.New("resource: conflict")
+	// ErrInvalid is returned when a write violates a check or not-null constraint.
+	ErrInvalid = errors.New("resource: invalid")
+)
+
+// dbError keeps the constraint that failed alongside the sentinel so
+// handlers can report it without exposing the raw SQL error.
+type dbError struct {
+	kind       error
+	constraint string
+	err        error
+}
+
+func (e *dbError) Error() string { return e.kind.Error() + ": " + e.err.Error() }
+func (e *dbError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+// FromDB classifies a database error so handlers can map it to a status.
+// Errors that are not constraint violations are returned unchanged.
+func FromDB(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+	switch pqErr.Code.Name() {
+	case "unique_violation", "foreign_key_violation":
+		return &dbError{kind: ErrConflict, constraint: pqErr.Constraint, err: err}
+	case "check_violation", "not_null_violation":
+		return &dbError{kind: ErrInvalid, constraint: pqErr.Constraint, err: err}
+	}
+	return err
+}
+
+// WriteJSON encodes v as the response body with the given status.
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// WriteError writes problem details with the given status, code and detail.
+func WriteError(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	shared.WriteProblem(w, r, status, code, detail)
+}
+
+// WriteFieldErrors writes a 400 listing every invalid field.
+func WriteFieldErrors(w http.ResponseWriter, r *http.Request, errs []FieldError) {
+	shared.WriteError(w, r, FieldErrors(errs).classify())
+}
+
+// WriteRepoError reports an error returned by a generated repository with
+// the matching status. Unexpected errors are logged with the request's
+// correlation ID and answered with a 500 that does not reveal them.
+func WriteRepoError(w http.ResponseWriter, r *http.Request, err error) {
+	shared.WriteError(w, r, Classify(err))
+}
+
+// Classify maps a repository error to the *errors.OasisError that decides
+// its status, code and client-facing detail. Bulk requests use it to report
+// each record's failure in the response body.
+func Classify(err error) error {
+	var dbErr *dbError
+	constraint := ""
+	if errors.As(err, &dbErr) {
+		constraint = dbErr.constraint
+	}
+	var fieldErrs FieldErrors
+	switch {
+	case errors.As(err, &fieldErrs):
+		return fieldErrs.classify()
+	case errors.Is(err, ErrNotFound):
+		return oerrors.New("repository", oerrors.KindNotFound, "", "resource not found")
+	case errors.Is(err, ErrPreconditionFailed):
+		return oerrors.New("repository", oerrors.KindPrecondition, "", "resource was modified since it was read; fetch it again and retry")
+	case errors.Is(err, ErrConflict):
+		return oerrors.New("repository", oerrors.KindConflict, "", constraintMessage("conflicts with an existing resource", constraint))
+	case errors.Is(err, ErrInvalid):
+		return oerrors.New("repository", oerrors.KindInvalid, "", constraintMessage("violates a data constraint", constraint))
+	default:
+		return oerrors.E("repository", oerrors.KindInternal, err)
+	}
+}
+
+func constraintMessage(msg, constraint string) string {
+	if constraint == "" {
+		return "request " + msg
+	}
+	return "request " + msg + " (" + constraint + ")"
+}
@@ -0,0 +1,91 @@
+package resource
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+
+	oerrors "github.com/catdevman/oasis/internal/errors"
+)
+
+// FieldError reports a single invalid property in a request body.
+type FieldError = oerrors.FieldError
+
+// FieldErrors lets a repository report invalid fields that can only be
+// detected against the database; WriteRepoError renders it as a 400.
+type FieldErrors []FieldError
+
+func (e FieldErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Field + " " + fe.Message
+	}
+	return "resource: invalid fields: " + strings.Join(msgs, "; ")
+}
+
+func (e FieldErrors) classify() error {
+	err := oerrors.New("validate", oerrors.KindInvalid, "", "request failed validation")
+	err.Fields = e
+	return err
+}
+
+// Validate checks that body is a JSON object whose properties match cols:
+// required columns must be present and non-empty, and every supplied value
+// must have the column's type. Properties that are not columns are ignored.
+func Validate(body []byte, cols []Column) []FieldError {
+	var obj map[string]json.RawMessage
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&obj); err != nil || obj == nil {
+		return []FieldError{{Field: "", Message: "body must be a JSON object"}}
+	}
+
+	var errs []FieldError
+	for _, c := range cols {
+		raw, ok := obj[c.JSON]
+		if !ok || bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+			if c.Required {
+				errs = append(errs, FieldError{Field: c.JSON, Message: "is required"})
+			}
+			continue
+		}
+		if msg := checkType(raw, c); msg != "" {
+			errs = append(errs, FieldError{Field: c.JSON, Message: msg})
+		}
+	}
+	return errs
+}
+
+func checkType(raw json.RawMessage, c Column) string {
+	switch c.Type {
+	case Integer:
+		var n json.Number
+		if bytes.HasPrefix(bytes.TrimSpace(raw), []byte(`"`)) || json.Unmarshal(raw, &n) != nil {
+			return "must be an integer"
+		}
+		if _, err := n.Int64(); err != nil {
+			return "must be an integer"
+		}
+	case Date:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return "must be a date (YYYY-MM-DD)"
+		}
+		if _, err := time.Parse("2006-01-02", s); err != nil {
+			return "must be a date (YYYY-MM-DD)"
+		}
+	default:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return "must be a string"
+		}
+		if c.Required && strings.TrimSpace(s) == "" {
+			return "is required"
+		}
+		if c.Descriptor != "" && !IsDescriptorURI(s, c.Descriptor) {
+			return "must be a " + c.Descriptor + "Descriptor URI (uri://{namespace}/" + c.Descriptor + "Descriptor#{codeValue})"
+		}
+	}
+	return ""
+}
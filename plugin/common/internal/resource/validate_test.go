@@ -0,0 +1,131 @@
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+var testCols = []Column{
+	{Name: "StudentUniqueId", JSON: "studentuniqueid", Type: String, Required: true},
+	{Name: "FirstName", JSON: "firstname", Type: String},
+	{Name: "SchoolYear", JSON: "schoolyear", Type: Integer},
+	{Name: "BirthDate", JSON: "birthdate", Type: Date},
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []FieldError
+	}{
+		{"valid", `{"studentuniqueid":"s1","firstname":"Ada","schoolyear":2024,"birthdate":"2010-04-01"}`, nil},
+		{"optional omitted", `{"studentuniqueid":"s1"}`, nil},
+		{"optional null", `{"studentuniqueid":"s1","schoolyear":null}`, nil},
+		{"unknown ignored", `{"studentuniqueid":"s1","nickname":"A"}`, nil},
+		{"not an object", `[1,2]`, []FieldError{{Field: "", Message: "body must be a JSON object"}}},
+		{"malformed", `{`, []FieldError{{Field: "", Message: "body must be a JSON object"}}},
+		{"missing required", `{}`, []FieldError{{Field: "studentuniqueid", Message: "is required"}}},
+		{"blank required", `{"studentuniqueid":"  "}`, []FieldError{{Field: "studentuniqueid", Message: "is required"}}},
+		{
+			"wrong types",
+			`{"studentuniqueid":1,"schoolyear":"2024","birthdate":"04/01/2010"}`,
+			[]FieldError{
+				{Field: "studentuniqueid", Message: "must be a string"},
+				{Field: "schoolyear", Message: "must be an integer"},
+				{Field: "birthdate", Message: "must be a date (YYYY-MM-DD)"},
+			},
+		},
+		{"fractional integer", `{"studentuniqueid":"s1","schoolyear":2024.5}`, []FieldError{{Field: "schoolyear", Message: "must be an integer"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Validate([]byte(tt.body), testCols)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("Validate(%s) = %v, want %v", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromDB(t *testing.T) {
+	tests := []struct {
+		code pq.ErrorCode
+		want error
+	}{
+		{"23505", ErrConflict},
+		{"23503", ErrConflict},
+		{"23514", ErrInvalid},
+		{"23502", ErrInvalid},
+	}
+	for _, tt := range tests {
+		err := FromDB(&pq.Error{Code: tt.code, Constraint: "ux_student_key"})
+		if !errors.Is(err, tt.want) {
+			t.Errorf("FromDB(%s) = %v, want %v", tt.code, err, tt.want)
+		}
+	}
+
+	plain := errors.New("connection refused")
+	if got := FromDB(plain); got != plain {
+		t.Errorf("FromDB(plain) = %v, want it unchanged", got)
+	}
+	if got := FromDB(nil); got != nil {
+		t.Errorf("FromDB(nil) = %v, want nil", got)
+	}
+}
+
+func TestWriteRepoError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{ErrNotFound, 404},
+		{ErrPreconditionFailed, 412},
+		{FieldErrors{{Field: "programtype", Message: "is not a known ProgramTypeDescriptor"}}, 400},
+		{FromDB(&pq.Error{Code: "23505"}), 409},
+		{FromDB(&pq.Error{Code: "23514"}), 400},
+		{errors.New("boom"), 500},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		WriteRepoError(w, httptest.NewRequest(http.MethodGet, "/x", nil), tt.err)
+		if w.Code != tt.want {
+			t.Errorf("WriteRepoError(%v) status = %d, want %d", tt.err, w.Code, tt.want)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+			t.Errorf("WriteRepoError(%v) Content-Type = %q, want application/problem+json", tt.err, ct)
+		}
+		if tt.want == 500 && strings.Contains(w.Body.String(), tt.err.Error()) {
+			t.Errorf("WriteRepoError(%v) leaked the internal error: %s", tt.err, w.Body)
+		}
+	}
+}
+
+func TestValidateDescriptor(t *testing.T) {
+	cols := []Column{{Name: "ProgramType", JSON: "programtype", Type: String, Descriptor: "ProgramType"}}
+	tests := []struct {
+		value string
+		ok    bool
+	}{
+		{"uri://ed-fi.org/ProgramTypeDescriptor#Athletics", true},
+		{"uri://district.k12.us/ProgramTypeDescriptor#Robotics", true},
+		{"Athletics", false},
+		{"uri://ed-fi.org/ProgramTypeDescriptor#", false},
+		{"uri://ed-fi.org/CohortTypeDescriptor#Other", false},
+		{"uri:///ProgramTypeDescriptor#Athletics", false},
+		{"http://ed-fi.org/ProgramTypeDescriptor#Athletics", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			errs := Validate([]byte(`{"programtype":"`+tt.value+`"}`), cols)
+			if ok := len(errs) == 0; ok != tt.ok {
+				t.Errorf("Validate(%q) = %v, want ok=%v", tt.value, errs, tt.ok)
+			}
+		})
+	}
+}
@@ -2,7 +2,11 @@
 package section
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+
+	"github.com/catdevman/oasis/plugin/common/internal/resource"
 )
 
 type Repository struct {
@@ -13,34 +17,104 @@ func NewRepository(db *sql.DB) *Repository {
 	return &Repository{db: db}
 }
 
+var columns = []resource.Column{
+	resource.IDColumn,
+	{Name: "CourseSectionIdentifier", JSON: "coursesectionidentifier", Type: resource.String, Required: true, Filter: true, Key: true},
+	{Name: "CourseTitle", JSON: "coursetitle", Type: resource.String, Required: false, Filter: true},
+	{Name: "CourseIdentifier", JSON: "courseidentifier", Type: resource.String, Required: false, Filter: true},
+	{Name: "SessionBeginDate", JSON: "sessionbegindate", Type: resource.Date, Required: false, Filter: true},
+	{Name: "SessionEndDate", JSON: "sessionenddate", Type: resource.Date, Required: false, Filter: true},
+}
+
+// schema describes the resource to expand=, for expanding both its own
+// references and references into it.
+var schema = resource.Schema{
+	Name:    "section",
+	Table:   "edfi.Section",
+	Columns: columns,
+	Refs: []resource.Ref{
+		{Name: "course", Target: "coursecatalog", Cols: []string{"CourseIdentifier"}},
+	},
+	SoftDelete: false,
+}
+
+func init() {
+	resource.RegisterSchema(&schema)
+}
+
+// Section is identified by Id; its natural key is CourseSectionIdentifier.
 type Section struct {
-	Field0 *string `json:"coursesectionidentifier"`
+	Id *string `json:"id"`
 
-	Field1 *string `json:"coursetitle"`
+	CourseSectionIdentifier *string `json:"coursesectionidentifier"`
+
+	CourseTitle *string `json:"coursetitle"`
+
+	CourseIdentifier *string `json:"courseidentifier"`
+
+	SessionBeginDate *string `json:"sessionbegindate"`
+
+	SessionEndDate *string `json:"sessionenddate"`
+
+	ETag *string `json:"_etag"`
 }
 
-func (r *Repository) List(limit, offset int) ([]Section, error) {
-	rows, err := r.db.Query("SELECT CourseSectionIdentifier, CourseTitle FROM edfi.Section LIMIT $1 OFFSET $2", limit, offset)
+// targets returns scan destinations for cols, in order.
+func (s *Section) targets(cols []resource.Column) []interface{} {
+	dest := make([]interface{}, len(cols))
+	for i, c := range cols {
+		switch c.Name {
+		case resource.IDColumn.Name:
+			dest[i] = &s.Id
+		case "CourseSectionIdentifier":
+			dest[i] = &s.CourseSectionIdentifier
+		case "CourseTitle":
+			dest[i] = &s.CourseTitle
+		case "CourseIdentifier":
+			dest[i] = &s.CourseIdentifier
+		case "SessionBeginDate":
+			dest[i] = &s.SessionBeginDate
+		case "SessionEndDate":
+			dest[i] = &s.SessionEndDate
+		case resource.VersionColumn.Name:
+			dest[i] = &s.ETag
+		}
+	}
+	return dest
+}
+
+func (r *Repository) List(ctx context.Context, q resource.ListQuery) ([]Section, error) {
+	query, args := q.SQL("edfi.Section", columns)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	selected := q.Selected(columns)
 	var items []Section
 	for rows.Next() {
 		var s Section
-		if err := rows.Scan(&s.Field0, &s.Field1); err != nil {
+		if err := rows.Scan(s.targets(selected)...); err != nil {
 			return nil, err
 		}
 		items = append(items, s)
 	}
-	return items, nil
+	return items, rows.Err()
 }
 
-func (r *Repository) Get(id string) (*Section, error) {
-	row := r.db.QueryRow("SELECT CourseSectionIdentifier, CourseTitle FROM edfi.Section WHERE CourseSectionIdentifier = $1", id)
+// Count returns the number of rows matching the query's filters.
+func (r *Repository) Count(ctx context.Context, q resource.ListQuery) (int64, error) {
+	query, args := q.CountSQL("edfi.Section")
+	var n int64
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(&n)
+	return n, err
+}
+
+func (r *Repository) Get(ctx context.Context, id string) (*Section, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT Id, CourseSectionIdentifier, CourseTitle, CourseIdentifier, to_char(SessionBeginDate, 'YYYY-MM-DD'), to_char(SessionEndDate, 'YYYY-MM-DD'), RowVersion::text FROM edfi.Section WHERE Id = $1", id)
 	var s Section
-	if err := row.Scan(&s.Field0, &s.Field1); err != nil {
+	if err := row.Scan(&s.Id, &s.CourseSectionIdentifier, &s.CourseTitle, &s.CourseIdentifier, &s.SessionBeginDate, &s.SessionEndDate, &s.ETag); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
@@ -49,7 +123,94 @@ func (r *Repository) Get(id string) (*Section, error) {
 	return &s, nil
 }
 
-func (r *Repository) Delete(id string) error {
-	_, err := r.db.Exec("DELETE FROM edfi.Section WHERE CourseSectionIdentifier = $1", id)
-	return err
+// Create inserts s and sets s.Id and s.ETag to the new row's id and
+// version. The write is attributed to the Actor carried by ctx in the audit
+// history.
+func (r *Repository) Create(ctx context.Context, s *Section) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = tx.QueryRowContext(ctx, "INSERT INTO edfi.Section (CourseSectionIdentifier, CourseTitle, CourseIdentifier, SessionBeginDate, SessionEndDate) VALUES ($1, $2, $3, $4, $5) RETURNING Id, RowVersion::text",
+		s.CourseSectionIdentifier, s.CourseTitle, s.CourseIdentifier, s.SessionBeginDate, s.SessionEndDate).Scan(&s.Id, &s.ETag)
+	if err != nil {
+		return resource.FromDB(err)
+	}
+	return tx.Commit()
+}
+
+// Update overwrites the row with the given id, natural key included, if its
+// version still matches (an empty version matches any) and sets s.ETag to
+// the bumped version.
+func (r *Repository) Update(ctx context.Context, id, version string, s *Section) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = tx.QueryRowContext(ctx, "UPDATE edfi.Section SET CourseSectionIdentifier = $1, CourseTitle = $2, CourseIdentifier = $3, SessionBeginDate = $4, SessionEndDate = $5, RowVersion = RowVersion + 1 WHERE Id = $6 AND ($7 = '' OR RowVersion::text = $7) RETURNING RowVersion::text",
+		s.CourseSectionIdentifier, s.CourseTitle, s.CourseIdentifier, s.SessionBeginDate, s.SessionEndDate, id, version).Scan(&s.ETag)
+	if err == sql.ErrNoRows {
+		return missOrStale(ctx, tx, id)
+	}
+	if err != nil {
+		return resource.FromDB(err)
+	}
+	s.Id = &id
+	return tx.Commit()
+}
+
+// Delete removes the row with the given id if its version still matches.
+func (r *Repository) Delete(ctx context.Context, id, version string) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, "DELETE FROM edfi.Section WHERE Id = $1 AND ($2 = '' OR RowVersion::text = $2)", id, version)
+	if err != nil {
+		return resource.FromDB(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return missOrStale(ctx, tx, id)
+	}
+	return tx.Commit()
+}
+
+// missOrStale explains a conditional write that matched no row.
+func missOrStale(ctx context.Context, tx *sql.Tx, id string) error {
+	var one int
+	err := tx.QueryRowContext(ctx, "SELECT 1 FROM edfi.Section WHERE Id = $1", id).Scan(&one)
+	switch {
+	case err == sql.ErrNoRows:
+		return resource.ErrNotFound
+	case err != nil:
+		return err
+	}
+	return resource.ErrPreconditionFailed
+}
+
+// History returns the audit history of the row with the given id, oldest first.
+func (r *Repository) History(ctx context.Context, id string, q resource.ListQuery) ([]resource.Change, error) {
+	return resource.History(ctx, r.db, "edfi.Section", id, q)
+}
+
+// Deletes returns the rows deleted within q's change version bounds.
+func (r *Repository) Deletes(ctx context.Context, q resource.ListQuery) ([]resource.Delete, error) {
+	return resource.Deletes(ctx, r.db, "edfi.Section", q)
+}
+
+// KeyChanges returns the natural key changes within q's change version bounds.
+func (r *Repository) KeyChanges(ctx context.Context, q resource.ListQuery) ([]resource.KeyChange, error) {
+	return resource.KeyChanges(ctx, r.db, "edfi.Section", q)
+}
+
+// Expand embeds the references named by e in items.
+func (r *Repository) Expand(ctx context.Context, items interface{}, e resource.Expansion) ([]map[string]json.RawMessage, error) {
+	return resource.Expand(ctx, r.db, &schema, items, e)
 }
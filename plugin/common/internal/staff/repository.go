@@ -2,7 +2,11 @@
 package staff
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+
+	"github.com/catdevman/oasis/plugin/common/internal/resource"
 )
 
 type Repository struct {
@@ -13,36 +17,94 @@ func NewRepository(db *sql.DB) *Repository {
 	return &Repository{db: db}
 }
 
+var columns = []resource.Column{
+	resource.IDColumn,
+	{Name: "StaffUniqueId", JSON: "staffuniqueid", Type: resource.String, Required: true, Filter: true, Key: true},
+	{Name: "FirstName", JSON: "firstname", Type: resource.String, Required: false, Filter: true},
+	{Name: "LastSurname", JSON: "lastsurname", Type: resource.String, Required: false, Filter: true},
+}
+
+// schema describes the resource to expand=, for expanding both its own
+// references and references into it.
+var schema = resource.Schema{
+	Name:       "staff",
+	Table:      "edfi.Staff",
+	Columns:    columns,
+	ReadRoles:  []string{"admin", "administrator", "teacher"},
+	SoftDelete: true,
+}
+
+func init() {
+	resource.RegisterSchema(&schema)
+}
+
+// Staff is identified by Id; its natural key is StaffUniqueId.
 type Staff struct {
-	Field0 *string `json:"staffuniqueid"`
+	Id *string `json:"id"`
 
-	Field1 *string `json:"firstname"`
+	StaffUniqueId *string `json:"staffuniqueid"`
 
-	Field2 *string `json:"lastsurname"`
+	FirstName *string `json:"firstname"`
+
+	LastSurname *string `json:"lastsurname"`
+
+	ETag *string `json:"_etag"`
+}
+
+// targets returns scan destinations for cols, in order.
+func (s *Staff) targets(cols []resource.Column) []interface{} {
+	dest := make([]interface{}, len(cols))
+	for i, c := range cols {
+		switch c.Name {
+		case resource.IDColumn.Name:
+			dest[i] = &s.Id
+		case "StaffUniqueId":
+			dest[i] = &s.StaffUniqueId
+		case "FirstName":
+			dest[i] = &s.FirstName
+		case "LastSurname":
+			dest[i] = &s.LastSurname
+		case resource.VersionColumn.Name:
+			dest[i] = &s.ETag
+		}
+	}
+	return dest
 }
 
-func (r *Repository) List(limit, offset int) ([]Staff, error) {
-	rows, err := r.db.Query("SELECT StaffUniqueId, FirstName, LastSurname FROM edfi.Staff LIMIT $1 OFFSET $2", limit, offset)
+func (r *Repository) List(ctx context.Context, q resource.ListQuery) ([]Staff, error) {
+	q = q.NotDeleted()
+	query, args := q.SQL("edfi.Staff", columns)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	selected := q.Selected(columns)
 	var items []Staff
 	for rows.Next() {
 		var s Staff
-		if err := rows.Scan(&s.Field0, &s.Field1, &s.Field2); err != nil {
+		if err := rows.Scan(s.targets(selected)...); err != nil {
 			return nil, err
 		}
 		items = append(items, s)
 	}
-	return items, nil
+	return items, rows.Err()
 }
 
-func (r *Repository) Get(id string) (*Staff, error) {
-	row := r.db.QueryRow("SELECT StaffUniqueId, FirstName, LastSurname FROM edfi.Staff WHERE StaffUniqueId = $1", id)
+// Count returns the number of rows matching the query's filters.
+func (r *Repository) Count(ctx context.Context, q resource.ListQuery) (int64, error) {
+	q = q.NotDeleted()
+	query, args := q.CountSQL("edfi.Staff")
+	var n int64
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(&n)
+	return n, err
+}
+
+func (r *Repository) Get(ctx context.Context, id string) (*Staff, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT Id, StaffUniqueId, FirstName, LastSurname, RowVersion::text FROM edfi.Staff WHERE Id = $1 AND DeletedAt IS NULL", id)
 	var s Staff
-	if err := row.Scan(&s.Field0, &s.Field1, &s.Field2); err != nil {
+	if err := row.Scan(&s.Id, &s.StaffUniqueId, &s.FirstName, &s.LastSurname, &s.ETag); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
@@ -51,7 +113,119 @@ func (r *Repository) Get(id string) (*Staff, error) {
 	return &s, nil
 }
 
-func (r *Repository) Delete(id string) error {
-	_, err := r.db.Exec("DELETE FROM edfi.Staff WHERE StaffUniqueId = $1", id)
-	return err
+// Create inserts s and sets s.Id and s.ETag to the new row's id and
+// version. The write is attributed to the Actor carried by ctx in the audit
+// history.
+func (r *Repository) Create(ctx context.Context, s *Staff) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = tx.QueryRowContext(ctx, "INSERT INTO edfi.Staff (StaffUniqueId, FirstName, LastSurname) VALUES ($1, $2, $3) RETURNING Id, RowVersion::text",
+		s.StaffUniqueId, s.FirstName, s.LastSurname).Scan(&s.Id, &s.ETag)
+	if err != nil {
+		return resource.FromDB(err)
+	}
+	return tx.Commit()
+}
+
+// Update overwrites the row with the given id, natural key included, if its
+// version still matches (an empty version matches any) and sets s.ETag to
+// the bumped version.
+func (r *Repository) Update(ctx context.Context, id, version string, s *Staff) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = tx.QueryRowContext(ctx, "UPDATE edfi.Staff SET StaffUniqueId = $1, FirstName = $2, LastSurname = $3, RowVersion = RowVersion + 1 WHERE Id = $4 AND DeletedAt IS NULL AND ($5 = '' OR RowVersion::text = $5) RETURNING RowVersion::text",
+		s.StaffUniqueId, s.FirstName, s.LastSurname, id, version).Scan(&s.ETag)
+	if err == sql.ErrNoRows {
+		return missOrStale(ctx, tx, id)
+	}
+	if err != nil {
+		return resource.FromDB(err)
+	}
+	s.Id = &id
+	return tx.Commit()
+}
+
+// Delete soft-deletes the row with the given id if its version still matches: it
+// stays in the table, hidden from reads, until an admin restores it.
+func (r *Repository) Delete(ctx context.Context, id, version string) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, "UPDATE edfi.Staff SET DeletedAt = now(), RowVersion = RowVersion + 1 WHERE Id = $1 AND DeletedAt IS NULL AND ($2 = '' OR RowVersion::text = $2)", id, version)
+	if err != nil {
+		return resource.FromDB(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return missOrStale(ctx, tx, id)
+	}
+	return tx.Commit()
+}
+
+// Restore undoes a soft delete. It returns resource.ErrConflict when the
+// row exists but is not deleted.
+func (r *Repository) Restore(ctx context.Context, id string) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var deleted bool
+	err = tx.QueryRowContext(ctx, "SELECT DeletedAt IS NOT NULL FROM edfi.Staff WHERE Id = $1 FOR UPDATE", id).Scan(&deleted)
+	switch {
+	case err == sql.ErrNoRows:
+		return resource.ErrNotFound
+	case err != nil:
+		return err
+	case !deleted:
+		return resource.ErrConflict
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE edfi.Staff SET DeletedAt = NULL, RowVersion = RowVersion + 1 WHERE Id = $1", id); err != nil {
+		return resource.FromDB(err)
+	}
+	return tx.Commit()
+}
+
+// missOrStale explains a conditional write that matched no row.
+func missOrStale(ctx context.Context, tx *sql.Tx, id string) error {
+	var one int
+	err := tx.QueryRowContext(ctx, "SELECT 1 FROM edfi.Staff WHERE Id = $1 AND DeletedAt IS NULL", id).Scan(&one)
+	switch {
+	case err == sql.ErrNoRows:
+		return resource.ErrNotFound
+	case err != nil:
+		return err
+	}
+	return resource.ErrPreconditionFailed
+}
+
+// History returns the audit history of the row with the given id, oldest first.
+func (r *Repository) History(ctx context.Context, id string, q resource.ListQuery) ([]resource.Change, error) {
+	return resource.History(ctx, r.db, "edfi.Staff", id, q)
+}
+
+// Deletes returns the rows deleted within q's change version bounds.
+func (r *Repository) Deletes(ctx context.Context, q resource.ListQuery) ([]resource.Delete, error) {
+	return resource.Deletes(ctx, r.db, "edfi.Staff", q)
+}
+
+// KeyChanges returns the natural key changes within q's change version bounds.
+func (r *Repository) KeyChanges(ctx context.Context, q resource.ListQuery) ([]resource.KeyChange, error) {
+	return resource.KeyChanges(ctx, r.db, "edfi.Staff", q)
+}
+
+// Expand embeds the references named by e in items.
+func (r *Repository) Expand(ctx context.Context, items interface{}, e resource.Expansion) ([]map[string]json.RawMessage, error) {
+	return resource.Expand(ctx, r.db, &schema, items, e)
 }
@@ -2,7 +2,11 @@
 package student
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+
+	"github.com/catdevman/oasis/plugin/common/internal/resource"
 )
 
 type Repository struct {
@@ -13,36 +17,94 @@ func NewRepository(db *sql.DB) *Repository {
 	return &Repository{db: db}
 }
 
+var columns = []resource.Column{
+	resource.IDColumn,
+	{Name: "StudentUniqueId", JSON: "studentuniqueid", Type: resource.String, Required: true, Filter: true, Key: true},
+	{Name: "FirstName", JSON: "firstname", Type: resource.String, Required: false, Filter: true},
+	{Name: "LastSurname", JSON: "lastsurname", Type: resource.String, Required: false, Filter: true},
+}
+
+// schema describes the resource to expand=, for expanding both its own
+// references and references into it.
+var schema = resource.Schema{
+	Name:       "student",
+	Table:      "edfi.Student",
+	Columns:    columns,
+	ReadRoles:  []string{"admin", "administrator", "teacher"},
+	SoftDelete: true,
+}
+
+func init() {
+	resource.RegisterSchema(&schema)
+}
+
+// Student is identified by Id; its natural key is StudentUniqueId.
 type Student struct {
-	Field0 *string `json:"studentuniqueid"`
+	Id *string `json:"id"`
 
-	Field1 *string `json:"firstname"`
+	StudentUniqueId *string `json:"studentuniqueid"`
 
-	Field2 *string `json:"lastsurname"`
+	FirstName *string `json:"firstname"`
+
+	LastSurname *string `json:"lastsurname"`
+
+	ETag *string `json:"_etag"`
+}
+
+// targets returns scan destinations for cols, in order.
+func (s *Student) targets(cols []resource.Column) []interface{} {
+	dest := make([]interface{}, len(cols))
+	for i, c := range cols {
+		switch c.Name {
+		case resource.IDColumn.Name:
+			dest[i] = &s.Id
+		case "StudentUniqueId":
+			dest[i] = &s.StudentUniqueId
+		case "FirstName":
+			dest[i] = &s.FirstName
+		case "LastSurname":
+			dest[i] = &s.LastSurname
+		case resource.VersionColumn.Name:
+			dest[i] = &s.ETag
+		}
+	}
+	return dest
 }
 
-func (r *Repository) List(limit, offset int) ([]Student, error) {
-	rows, err := r.db.Query("SELECT StudentUniqueId, FirstName, LastSurname FROM edfi.Student LIMIT $1 OFFSET $2", limit, offset)
+func (r *Repository) List(ctx context.Context, q resource.ListQuery) ([]Student, error) {
+	q = q.NotDeleted()
+	query, args := q.SQL("edfi.Student", columns)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	selected := q.Selected(columns)
 	var items []Student
 	for rows.Next() {
 		var s Student
-		if err := rows.Scan(&s.Field0, &s.Field1, &s.Field2); err != nil {
+		if err := rows.Scan(s.targets(selected)...); err != nil {
 			return nil, err
 		}
 		items = append(items, s)
 	}
-	return items, nil
+	return items, rows.Err()
 }
 
-func (r *Repository) Get(id string) (*Student, error) {
-	row := r.db.QueryRow("SELECT StudentUniqueId, FirstName, LastSurname FROM edfi.Student WHERE StudentUniqueId = $1", id)
+// Count returns the number of rows matching the query's filters.
+func (r *Repository) Count(ctx context.Context, q resource.ListQuery) (int64, error) {
+	q = q.NotDeleted()
+	query, args := q.CountSQL("edfi.Student")
+	var n int64
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(&n)
+	return n, err
+}
+
+func (r *Repository) Get(ctx context.Context, id string) (*Student, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT Id, StudentUniqueId, FirstName, LastSurname, RowVersion::text FROM edfi.Student WHERE Id = $1 AND DeletedAt IS NULL", id)
 	var s Student
-	if err := row.Scan(&s.Field0, &s.Field1, &s.Field2); err != nil {
+	if err := row.Scan(&s.Id, &s.StudentUniqueId, &s.FirstName, &s.LastSurname, &s.ETag); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
@@ -51,7 +113,119 @@ func (r *Repository) Get(id string) (*Student, error) {
 	return &s, nil
 }
 
-func (r *Repository) Delete(id string) error {
-	_, err := r.db.Exec("DELETE FROM edfi.Student WHERE StudentUniqueId = $1", id)
-	return err
+// Create inserts s and sets s.Id and s.ETag to the new row's id and
+// version. The write is attributed to the Actor carried by ctx in the audit
+// history.
+func (r *Repository) Create(ctx context.Context, s *Student) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = tx.QueryRowContext(ctx, "INSERT INTO edfi.Student (StudentUniqueId, FirstName, LastSurname) VALUES ($1, $2, $3) RETURNING Id, RowVersion::text",
+		s.StudentUniqueId, s.FirstName, s.LastSurname).Scan(&s.Id, &s.ETag)
+	if err != nil {
+		return resource.FromDB(err)
+	}
+	return tx.Commit()
+}
+
+// Update overwrites the row with the given id, natural key included, if its
+// version still matches (an empty version matches any) and sets s.ETag to
+// the bumped version.
+func (r *Repository) Update(ctx context.Context, id, version string, s *Student) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = tx.QueryRowContext(ctx, "UPDATE edfi.Student SET StudentUniqueId = $1, FirstName = $2, LastSurname = $3, RowVersion = RowVersion + 1 WHERE Id = $4 AND DeletedAt IS NULL AND ($5 = '' OR RowVersion::text = $5) RETURNING RowVersion::text",
+		s.StudentUniqueId, s.FirstName, s.LastSurname, id, version).Scan(&s.ETag)
+	if err == sql.ErrNoRows {
+		return missOrStale(ctx, tx, id)
+	}
+	if err != nil {
+		return resource.FromDB(err)
+	}
+	s.Id = &id
+	return tx.Commit()
+}
+
+// Delete soft-deletes the row with the given id if its version still matches: it
+// stays in the table, hidden from reads, until an admin restores it.
+func (r *Repository) Delete(ctx context.Context, id, version string) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, "UPDATE edfi.Student SET DeletedAt = now(), RowVersion = RowVersion + 1 WHERE Id = $1 AND DeletedAt IS NULL AND ($2 = '' OR RowVersion::text = $2)", id, version)
+	if err != nil {
+		return resource.FromDB(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return missOrStale(ctx, tx, id)
+	}
+	return tx.Commit()
+}
+
+// Restore undoes a soft delete. It returns resource.ErrConflict when the
+// row exists but is not deleted.
+func (r *Repository) Restore(ctx context.Context, id string) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var deleted bool
+	err = tx.QueryRowContext(ctx, "SELECT DeletedAt IS NOT NULL FROM edfi.Student WHERE Id = $1 FOR UPDATE", id).Scan(&deleted)
+	switch {
+	case err == sql.ErrNoRows:
+		return resource.ErrNotFound
+	case err != nil:
+		return err
+	case !deleted:
+		return resource.ErrConflict
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE edfi.Student SET DeletedAt = NULL, RowVersion = RowVersion + 1 WHERE Id = $1", id); err != nil {
+		return resource.FromDB(err)
+	}
+	return tx.Commit()
+}
+
+// missOrStale explains a conditional write that matched no row.
+func missOrStale(ctx context.Context, tx *sql.Tx, id string) error {
+	var one int
+	err := tx.QueryRowContext(ctx, "SELECT 1 FROM edfi.Student WHERE Id = $1 AND DeletedAt IS NULL", id).Scan(&one)
+	switch {
+	case err == sql.ErrNoRows:
+		return resource.ErrNotFound
+	case err != nil:
+		return err
+	}
+	return resource.ErrPreconditionFailed
+}
+
+// History returns the audit history of the row with the given id, oldest first.
+func (r *Repository) History(ctx context.Context, id string, q resource.ListQuery) ([]resource.Change, error) {
+	return resource.History(ctx, r.db, "edfi.Student", id, q)
+}
+
+// Deletes returns the rows deleted within q's change version bounds.
+func (r *Repository) Deletes(ctx context.Context, q resource.ListQuery) ([]resource.Delete, error) {
+	return resource.Deletes(ctx, r.db, "edfi.Student", q)
+}
+
+// KeyChanges returns the natural key changes within q's change version bounds.
+func (r *Repository) KeyChanges(ctx context.Context, q resource.ListQuery) ([]resource.KeyChange, error) {
+	return resource.KeyChanges(ctx, r.db, "edfi.Student", q)
+}
+
+// Expand embeds the references named by e in items.
+func (r *Repository) Expand(ctx context.Context, items interface{}, e resource.Expansion) ([]map[string]json.RawMessage, error) {
+	return resource.Expand(ctx, r.db, &schema, items, e)
 }
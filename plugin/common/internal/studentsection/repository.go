@@ -2,7 +2,11 @@
 package studentsection
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+
+	"github.com/catdevman/oasis/plugin/common/internal/resource"
 )
 
 type Repository struct {
@@ -13,34 +17,90 @@ func NewRepository(db *sql.DB) *Repository {
 	return &Repository{db: db}
 }
 
+var columns = []resource.Column{
+	resource.IDColumn,
+	{Name: "CourseSectionIdentifier", JSON: "coursesectionidentifier", Type: resource.String, Required: true, Filter: true, Key: true},
+	{Name: "StudentUniqueId", JSON: "studentuniqueid", Type: resource.String, Required: true, Filter: true, Key: true},
+}
+
+// schema describes the resource to expand=, for expanding both its own
+// references and references into it.
+var schema = resource.Schema{
+	Name:    "studentsection",
+	Table:   "edfi.StudentSectionAssociation",
+	Columns: columns,
+	Refs: []resource.Ref{
+		{Name: "section", Target: "section", Cols: []string{"CourseSectionIdentifier"}},
+		{Name: "student", Target: "student", Cols: []string{"StudentUniqueId"}},
+	},
+	SoftDelete: false,
+}
+
+func init() {
+	resource.RegisterSchema(&schema)
+}
+
+// StudentSection is identified by Id; its natural key is CourseSectionIdentifier, StudentUniqueId.
 type StudentSection struct {
-	Field0 *string `json:"coursesectionidentifier"`
+	Id *string `json:"id"`
+
+	CourseSectionIdentifier *string `json:"coursesectionidentifier"`
+
+	StudentUniqueId *string `json:"studentuniqueid"`
 
-	Field1 *string `json:"studentuniqueid"`
+	ETag *string `json:"_etag"`
 }
 
-func (r *Repository) List(limit, offset int) ([]StudentSection, error) {
-	rows, err := r.db.Query("SELECT CourseSectionIdentifier, StudentUniqueId FROM edfi.StudentSectionAssociation LIMIT $1 OFFSET $2", limit, offset)
+// targets returns scan destinations for cols, in order.
+func (s *StudentSection) targets(cols []resource.Column) []interface{} {
+	dest := make([]interface{}, len(cols))
+	for i, c := range cols {
+		switch c.Name {
+		case resource.IDColumn.Name:
+			dest[i] = &s.Id
+		case "CourseSectionIdentifier":
+			dest[i] = &s.CourseSectionIdentifier
+		case "StudentUniqueId":
+			dest[i] = &s.StudentUniqueId
+		case resource.VersionColumn.Name:
+			dest[i] = &s.ETag
+		}
+	}
+	return dest
+}
+
+func (r *Repository) List(ctx context.Context, q resource.ListQuery) ([]StudentSection, error) {
+	query, args := q.SQL("edfi.StudentSectionAssociation", columns)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	selected := q.Selected(columns)
 	var items []StudentSection
 	for rows.Next() {
 		var s StudentSection
-		if err := rows.Scan(&s.Field0, &s.Field1); err != nil {
+		if err := rows.Scan(s.targets(selected)...); err != nil {
 			return nil, err
 		}
 		items = append(items, s)
 	}
-	return items, nil
+	return items, rows.Err()
+}
+
+// Count returns the number of rows matching the query's filters.
+func (r *Repository) Count(ctx context.Context, q resource.ListQuery) (int64, error) {
+	query, args := q.CountSQL("edfi.StudentSectionAssociation")
+	var n int64
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(&n)
+	return n, err
 }
 
-func (r *Repository) Get(id string) (*StudentSection, error) {
-	row := r.db.QueryRow("SELECT CourseSectionIdentifier, StudentUniqueId FROM edfi.StudentSectionAssociation WHERE CourseSectionIdentifier = $1", id)
+func (r *Repository) Get(ctx context.Context, id string) (*StudentSection, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT Id, CourseSectionIdentifier, StudentUniqueId, RowVersion::text FROM edfi.StudentSectionAssociation WHERE Id = $1", id)
 	var s StudentSection
-	if err := row.Scan(&s.Field0, &s.Field1); err != nil {
+	if err := row.Scan(&s.Id, &s.CourseSectionIdentifier, &s.StudentUniqueId, &s.ETag); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
@@ -49,7 +109,94 @@ func (r *Repository) Get(id string) (*StudentSection, error) {
 	return &s, nil
 }
 
-func (r *Repository) Delete(id string) error {
-	_, err := r.db.Exec("DELETE FROM edfi.StudentSectionAssociation WHERE CourseSectionIdentifier = $1", id)
-	return err
+// Create inserts s and sets s.Id and s.ETag to the new row's id and
+// version. The write is attributed to the Actor carried by ctx in the audit
+// history.
+func (r *Repository) Create(ctx context.Context, s *StudentSection) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = tx.QueryRowContext(ctx, "INSERT INTO edfi.StudentSectionAssociation (CourseSectionIdentifier, StudentUniqueId) VALUES ($1, $2) RETURNING Id, RowVersion::text",
+		s.CourseSectionIdentifier, s.StudentUniqueId).Scan(&s.Id, &s.ETag)
+	if err != nil {
+		return resource.FromDB(err)
+	}
+	return tx.Commit()
+}
+
+// Update overwrites the row with the given id, natural key included, if its
+// version still matches (an empty version matches any) and sets s.ETag to
+// the bumped version.
+func (r *Repository) Update(ctx context.Context, id, version string, s *StudentSection) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = tx.QueryRowContext(ctx, "UPDATE edfi.StudentSectionAssociation SET CourseSectionIdentifier = $1, StudentUniqueId = $2, RowVersion = RowVersion + 1 WHERE Id = $3 AND ($4 = '' OR RowVersion::text = $4) RETURNING RowVersion::text",
+		s.CourseSectionIdentifier, s.StudentUniqueId, id, version).Scan(&s.ETag)
+	if err == sql.ErrNoRows {
+		return missOrStale(ctx, tx, id)
+	}
+	if err != nil {
+		return resource.FromDB(err)
+	}
+	s.Id = &id
+	return tx.Commit()
+}
+
+// Delete removes the row with the given id if its version still matches.
+func (r *Repository) Delete(ctx context.Context, id, version string) error {
+	tx, err := resource.Begin(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, "DELETE FROM edfi.StudentSectionAssociation WHERE Id = $1 AND ($2 = '' OR RowVersion::text = $2)", id, version)
+	if err != nil {
+		return resource.FromDB(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return missOrStale(ctx, tx, id)
+	}
+	return tx.Commit()
+}
+
+// missOrStale explains a conditional write that matched no row.
+func missOrStale(ctx context.Context, tx *sql.Tx, id string) error {
+	var one int
+	err := tx.QueryRowContext(ctx, "SELECT 1 FROM edfi.StudentSectionAssociation WHERE Id = $1", id).Scan(&one)
+	switch {
+	case err == sql.ErrNoRows:
+		return resource.ErrNotFound
+	case err != nil:
+		return err
+	}
+	return resource.ErrPreconditionFailed
+}
+
+// History returns the audit history of the row with the given id, oldest first.
+func (r *Repository) History(ctx context.Context, id string, q resource.ListQuery) ([]resource.Change, error) {
+	return resource.History(ctx, r.db, "edfi.StudentSectionAssociation", id, q)
+}
+
+// Deletes returns the rows deleted within q's change version bounds.
+func (r *Repository) Deletes(ctx context.Context, q resource.ListQuery) ([]resource.Delete, error) {
+	return resource.Deletes(ctx, r.db, "edfi.StudentSectionAssociation", q)
+}
+
+// KeyChanges returns the natural key changes within q's change version bounds.
+func (r *Repository) KeyChanges(ctx context.Context, q resource.ListQuery) ([]resource.KeyChange, error) {
+	return resource.KeyChanges(ctx, r.db, "edfi.StudentSectionAssociation", q)
+}
+
+// Expand embeds the references named by e in items.
+func (r *Repository) Expand(ctx context.Context, items interface{}, e resource.Expansion) ([]map[string]json.RawMessage, error) {
+	return resource.Expand(ctx, r.db, &schema, items, e)
 }
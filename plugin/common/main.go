@@ -1,15 +1,7 @@
 package main
 
-import (
-	"github.com/catdevman/oasis/shared"
-	"github.com/hashicorp/go-plugin"
-)
+import "github.com/catdevman/oasis/shared/sdk"
 
 func main() {
-	plugin.Serve(&plugin.ServeConfig{
-		HandshakeConfig: shared.Handshake,
-		Plugins: map[string]plugin.Plugin{
-			"http_plugin": &shared.HTTPPluginAdapter{Impl: New()},
-		},
-	})
+	sdk.Serve(New())
 }
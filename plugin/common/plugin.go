@@ -2,21 +2,22 @@
 package main
 
 import (
-	"bytes"
-	"database/sql"
-	"io"
+	_ "embed"
+	"log/slog"
 	"net/http"
-	"net/http/httptest"
-	"sync"
+	"os"
 
 	"github.com/catdevman/oasis/plugin/common/internal/academicrecord"
 	"github.com/catdevman/oasis/plugin/common/internal/assessment"
 	"github.com/catdevman/oasis/plugin/common/internal/attendance"
 	"github.com/catdevman/oasis/plugin/common/internal/bellschedule"
+	"github.com/catdevman/oasis/plugin/common/internal/bulk"
 	"github.com/catdevman/oasis/plugin/common/internal/calendar"
+	"github.com/catdevman/oasis/plugin/common/internal/changequeries"
 	"github.com/catdevman/oasis/plugin/common/internal/cohort"
 	"github.com/catdevman/oasis/plugin/common/internal/coursecatalog"
 	"github.com/catdevman/oasis/plugin/common/internal/credential"
+	"github.com/catdevman/oasis/plugin/common/internal/descriptor"
 	"github.com/catdevman/oasis/plugin/common/internal/discipline"
 	"github.com/catdevman/oasis/plugin/common/internal/educationorg"
 	"github.com/catdevman/oasis/plugin/common/internal/grades"
@@ -24,78 +25,56 @@ import (
 	"github.com/catdevman/oasis/plugin/common/internal/intervention"
 	"github.com/catdevman/oasis/plugin/common/internal/postsecondary"
 	"github.com/catdevman/oasis/plugin/common/internal/program"
+	"github.com/catdevman/oasis/plugin/common/internal/resource"
 	"github.com/catdevman/oasis/plugin/common/internal/section"
 	"github.com/catdevman/oasis/plugin/common/internal/staff"
 	"github.com/catdevman/oasis/plugin/common/internal/student"
 	"github.com/catdevman/oasis/plugin/common/internal/studentsection"
-	"github.com/catdevman/oasis/shared"
+	"github.com/catdevman/oasis/shared/sdk"
 )
 
-type CommonPlugin struct {
-	mux    *http.ServeMux
-	db     *sql.DB
-	dbOnce sync.Once
-}
-
-func New() *CommonPlugin {
-	p := &CommonPlugin{
-		mux: http.NewServeMux(),
-	}
-	p.dbOnce.Do(p.setupDatabase)
-
-	// Register all 19 domains
-	academicrecord.NewHandler(academicrecord.NewRepository(p.db)).Register(p.mux)
-	assessment.NewHandler(assessment.NewRepository(p.db)).Register(p.mux)
-	attendance.NewHandler(attendance.NewRepository(p.db)).Register(p.mux)
-	bellschedule.NewHandler(bellschedule.NewRepository(p.db)).Register(p.mux)
-	calendar.NewHandler(calendar.NewRepository(p.db)).Register(p.mux)
-	cohort.NewHandler(cohort.NewRepository(p.db)).Register(p.mux)
-	coursecatalog.NewHandler(coursecatalog.NewRepository(p.db)).Register(p.mux)
-	credential.NewHandler(credential.NewRepository(p.db)).Register(p.mux)
-	discipline.NewHandler(discipline.NewRepository(p.db)).Register(p.mux)
-	educationorg.NewHandler(educationorg.NewRepository(p.db)).Register(p.mux)
-	grades.NewHandler(grades.NewRepository(p.db)).Register(p.mux)
-	graduation.NewHandler(graduation.NewRepository(p.db)).Register(p.mux)
-	intervention.NewHandler(intervention.NewRepository(p.db)).Register(p.mux)
-	postsecondary.NewHandler(postsecondary.NewRepository(p.db)).Register(p.mux)
-	program.NewHandler(program.NewRepository(p.db)).Register(p.mux)
-	section.NewHandler(section.NewRepository(p.db)).Register(p.mux)
-	staff.NewHandler(staff.NewRepository(p.db)).Register(p.mux)
-	student.NewHandler(student.NewRepository(p.db)).Register(p.mux)
-	studentsection.NewHandler(studentsection.NewRepository(p.db)).Register(p.mux)
-
-	return p
-}
+// openAPI is generated from the domain spec in generate.go.
+//
+//go:embed openapi.json
+var openAPI []byte
 
-func (p *CommonPlugin) setupDatabase() {
-	db, err := shared.OpenDatabase()
+func New() *sdk.Plugin {
+	db, err := sdk.DB()
 	if err != nil {
-		panic("Failed to open database: " + err.Error())
+		slog.Error("opening the database", "error", err)
+		os.Exit(1)
 	}
-	p.db = db
-}
+	mux := http.NewServeMux()
 
-func (p *CommonPlugin) ServeHTTP(req shared.HTTPRequest) (shared.HTTPResponse, error) {
-	r, err := http.NewRequest(req.Method, req.URL, bytes.NewReader(req.Body))
-	if err != nil {
-		return shared.HTTPResponse{}, err
-	}
-	r.Header = req.Header
+	// Register all 19 domains
+	academicrecord.NewHandler(academicrecord.NewRepository(db)).Register(mux)
+	assessment.NewHandler(assessment.NewRepository(db)).Register(mux)
+	attendance.NewHandler(attendance.NewRepository(db)).Register(mux)
+	bellschedule.NewHandler(bellschedule.NewRepository(db)).Register(mux)
+	calendar.NewHandler(calendar.NewRepository(db)).Register(mux)
+	cohort.NewHandler(cohort.NewRepository(db)).Register(mux)
+	coursecatalog.NewHandler(coursecatalog.NewRepository(db)).Register(mux)
+	credential.NewHandler(credential.NewRepository(db)).Register(mux)
+	discipline.NewHandler(discipline.NewRepository(db)).Register(mux)
+	educationorg.NewHandler(educationorg.NewRepository(db)).Register(mux)
+	grades.NewHandler(grades.NewRepository(db)).Register(mux)
+	graduation.NewHandler(graduation.NewRepository(db)).Register(mux)
+	intervention.NewHandler(intervention.NewRepository(db)).Register(mux)
+	postsecondary.NewHandler(postsecondary.NewRepository(db)).Register(mux)
+	program.NewHandler(program.NewRepository(db)).Register(mux)
+	section.NewHandler(section.NewRepository(db)).Register(mux)
+	staff.NewHandler(staff.NewRepository(db)).Register(mux)
+	student.NewHandler(student.NewRepository(db)).Register(mux)
+	studentsection.NewHandler(studentsection.NewRepository(db)).Register(mux)
 
-	w := httptest.NewRecorder()
-	p.mux.ServeHTTP(w, r)
+	changequeries.NewHandler(db).Register(mux)
+	descriptor.NewHandler(descriptor.NewRepository(db)).Register(mux)
+	bulk.NewHandler(db).Register(mux)
 
-	resp := w.Result()
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return shared.HTTPResponse{}, err
+	// Bulk jobs still marked running died with the previous plugin process.
+	if err := resource.AbandonJobs(db); err != nil {
+		slog.Error("abandoning interrupted bulk jobs", "error", err)
 	}
 
-	return shared.HTTPResponse{
-		StatusCode: resp.StatusCode,
-		Header:     resp.Header,
-		Body:       body,
-	}, nil
+	return &sdk.Plugin{Handler: mux, OpenAPI: openAPI}
 }
-func (p *CommonPlugin) GetRoutes() ([]string, error) { return []string{}, nil }
-func (p *CommonPlugin) GetMenuItems() ([]shared.MenuItem, error) { return nil, nil }
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/catdevman/oasis/shared/plugintest"
+	"github.com/lib/pq"
+)
+
+// TestStudents runs against an ephemeral database; it is skipped unless
+// OASIS_TEST_DB_URL names a Postgres server.
+func TestStudents(t *testing.T) {
+	plugintest.Postgres(t, "../../migrations")
+	host := plugintest.Start(t, plugintest.Options{Name: "common-plugin", Prefix: "api/common"}, New)
+	admin := host.As(plugintest.User{ID: "u-1", Roles: []string{"admin"}})
+
+	resp := admin.Get("/api/common/ed-fi/students")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET students = %d, want 200", resp.StatusCode)
+	}
+	var students []json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&students); err != nil {
+		t.Fatalf("decoding students: %v", err)
+	}
+	if len(students) != 0 {
+		t.Errorf("a fresh database has %d students, want 0", len(students))
+	}
+
+	resp = admin.Get("/api/common/ed-fi/students/00000000-0000-0000-0000-000000000000")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("GET missing student = %d, want 404", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("missing student Content-Type = %q, want application/problem+json", ct)
+	}
+}
+
+// TestUnknownBulkJob polls a job id that was never issued, as a caller who
+// would only see their own jobs.
+func TestUnknownBulkJob(t *testing.T) {
+	plugintest.Postgres(t, "../../migrations")
+	host := plugintest.Start(t, plugintest.Options{Name: "common-plugin", Prefix: "api/common"}, New)
+	teacher := host.As(plugintest.User{ID: "u-2", Roles: []string{"teacher"}})
+
+	resp := teacher.Get("/api/common/bulk/v1/jobs/00000000-0000-0000-0000-000000000000")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET unknown job = %d, want 404", resp.StatusCode)
+	}
+}
+
+// TestBulkUpsert writes a batch in which one record updates a row written
+// earlier in the same batch, one fails validation and one fails in the
+// database; the failures must not undo the others.
+func TestBulkUpsert(t *testing.T) {
+	plugintest.Postgres(t, "../../migrations")
+	host := plugintest.Start(t, plugintest.Options{Name: "common-plugin", Prefix: "api/common"}, New)
+	admin := host.As(plugintest.User{ID: "u-1", Roles: []string{"admin"}})
+
+	resp := admin.Post("/api/common/ed-fi/assessments/bulk", "application/json", []byte(`[
+		{"assessmentidentifier": "A1", "assessmenttitle": "Reading"},
+		{"assessmentidentifier": "A1", "assessmenttitle": "Reading, revised"},
+		{"assessmentidentifier": "A2"},
+		{"assessmentidentifier": "A3", "assessmenttitle": "no NUL \u0000 in text"},
+		{"assessmentidentifier": "A4", "assessmenttitle": "Math"}
+	]`))
+	var report struct {
+		Total, Succeeded, Failed int
+		Results                  []struct {
+			Status int
+			ID     string
+		}
+	}
+	decode(t, resp, http.StatusOK, &report)
+	if report.Total != 5 || report.Succeeded != 3 || report.Failed != 2 {
+		t.Errorf("report = %d total, %d succeeded, %d failed; want 5, 3, 2", report.Total, report.Succeeded, report.Failed)
+	}
+	want := []int{http.StatusCreated, http.StatusOK, http.StatusBadRequest, http.StatusInternalServerError, http.StatusCreated}
+	for i, res := range report.Results {
+		if i < len(want) && res.Status != want[i] {
+			t.Errorf("record %d status = %d, want %d", i, res.Status, want[i])
+		}
+	}
+	if len(report.Results) == 5 && report.Results[1].ID != report.Results[0].ID {
+		t.Errorf("second A1 record wrote id %s, want the first record's %s", report.Results[1].ID, report.Results[0].ID)
+	}
+
+	var assessments []struct{ AssessmentIdentifier, AssessmentTitle, Id string }
+	decode(t, admin.Get("/api/common/ed-fi/assessments"), http.StatusOK, &assessments)
+	if len(assessments) != 2 || assessments[0].AssessmentTitle != "Reading, revised" || assessments[1].AssessmentIdentifier != "A4" {
+		t.Fatalf("assessments after bulk = %+v, want A1 revised and A4", assessments)
+	}
+
+	// A key held by a soft-deleted row is not revived by an upsert.
+	resp = admin.With("If-Match", "*").Do(http.MethodDelete, "/api/common/ed-fi/assessments/"+assessments[1].Id, "", nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("DELETE A4 = %d, want 204", resp.StatusCode)
+	}
+	resp = admin.Post("/api/common/ed-fi/assessments/bulk", "application/json",
+		[]byte(`[{"assessmentidentifier": "A4", "assessmenttitle": "Math"}]`))
+	decode(t, resp, http.StatusOK, &report)
+	if len(report.Results) != 1 || report.Results[0].Status != http.StatusConflict {
+		t.Errorf("upserting a soft-deleted key = %+v, want one 409", report.Results)
+	}
+}
+
+// TestSoftDeleteAndRestore hides a deleted student from reads until an
+// admin restores it.
+func TestSoftDeleteAndRestore(t *testing.T) {
+	plugintest.Postgres(t, "../../migrations")
+	host := plugintest.Start(t, plugintest.Options{Name: "common-plugin", Prefix: "api/common"}, New)
+	admin := host.As(plugintest.User{ID: "u-1", Roles: []string{"admin"}})
+	teacher := host.As(plugintest.User{ID: "u-2", Roles: []string{"teacher"}})
+
+	var student struct{ Id, StudentUniqueId string }
+	resp := admin.Post("/api/common/ed-fi/students", "application/json", []byte(`{"studentuniqueid": "S1"}`))
+	decode(t, resp, http.StatusCreated, &student)
+	path := "/api/common/ed-fi/students/" + student.Id
+
+	if resp := admin.Do(http.MethodDelete, path, "", nil); resp.StatusCode != http.StatusPreconditionRequired {
+		t.Errorf("DELETE without If-Match = %d, want 428", resp.StatusCode)
+	}
+	if resp := admin.With("If-Match", "*").Do(http.MethodDelete, path, "", nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("DELETE = %d, want 204", resp.StatusCode)
+	}
+	if resp := admin.Get(path); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET deleted student = %d, want 404", resp.StatusCode)
+	}
+	var students []json.RawMessage
+	decode(t, admin.Get("/api/common/ed-fi/students"), http.StatusOK, &students)
+	if len(students) != 0 {
+		t.Errorf("list has %d students after the delete, want 0", len(students))
+	}
+
+	if resp := teacher.Post(path+"/restore", "", nil); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("restore as teacher = %d, want 403", resp.StatusCode)
+	}
+	decode(t, admin.Post(path+"/restore", "", nil), http.StatusOK, &student)
+	if student.StudentUniqueId != "S1" {
+		t.Errorf("restored student = %+v, want S1", student)
+	}
+	if resp := admin.Get(path); resp.StatusCode != http.StatusOK {
+		t.Errorf("GET restored student = %d, want 200", resp.StatusCode)
+	}
+	if resp := admin.Post(path+"/restore", "", nil); resp.StatusCode != http.StatusConflict {
+		t.Errorf("restoring a live student = %d, want 409", resp.StatusCode)
+	}
+}
+
+// TestChangeTracking checks what the audit and change-tracking triggers
+// record for a create, a natural-key change and a soft delete.
+func TestChangeTracking(t *testing.T) {
+	db := plugintest.Postgres(t, "../../migrations")
+	host := plugintest.Start(t, plugintest.Options{Name: "common-plugin", Prefix: "api/common"}, New)
+	admin := host.As(plugintest.User{ID: "u-1", Roles: []string{"admin"}})
+
+	var student struct{ Id string }
+	resp := admin.Post("/api/common/ed-fi/students", "application/json", []byte(`{"studentuniqueid": "S1"}`))
+	decode(t, resp, http.StatusCreated, &student)
+	path := "/api/common/ed-fi/students/" + student.Id
+
+	resp = admin.With("If-Match", resp.Header.Get("ETag")).Do(http.MethodPut, path, "application/json",
+		[]byte(`{"studentuniqueid": "S2", "firstname": "Ada"}`))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT = %d, want 200", resp.StatusCode)
+	}
+	if resp := admin.With("If-Match", `"0"`).Do(http.MethodDelete, path, "", nil); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("DELETE with a stale ETag = %d, want 412", resp.StatusCode)
+	}
+	if resp := admin.With("If-Match", resp.Header.Get("ETag")).Do(http.MethodDelete, path, "", nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("DELETE = %d, want 204", resp.StatusCode)
+	}
+
+	var history []struct {
+		Operation string
+		Before    map[string]any
+		After     map[string]any
+		Actor     *string
+		RequestID *string
+	}
+	decode(t, admin.Get(path+"/history"), http.StatusOK, &history)
+	ops := make([]string, len(history))
+	for i, c := range history {
+		ops[i] = c.Operation
+		if c.Actor == nil || *c.Actor != "u-1" || c.RequestID == nil {
+			t.Errorf("history[%d] actor = %v, request id = %v; want u-1 and an id", i, c.Actor, c.RequestID)
+		}
+	}
+	if strings.Join(ops, ",") != "INSERT,UPDATE,UPDATE" {
+		t.Fatalf("history operations = %v, want INSERT, UPDATE, UPDATE", ops)
+	}
+	if history[0].Before != nil || history[1].Before["studentuniqueid"] != "S1" || history[1].After["studentuniqueid"] != "S2" {
+		t.Errorf("history images = %+v, want the key change from S1 to S2", history)
+	}
+	if history[2].After["deletedat"] == nil {
+		t.Errorf("last history entry %+v does not record the soft delete", history[2])
+	}
+
+	var keyChanges []struct {
+		ID                         string
+		OldKeyValues, NewKeyValues map[string]string
+	}
+	decode(t, admin.Get("/api/common/ed-fi/students/keyChanges"), http.StatusOK, &keyChanges)
+	if len(keyChanges) != 1 || keyChanges[0].ID != student.Id ||
+		keyChanges[0].OldKeyValues["studentuniqueid"] != "S1" || keyChanges[0].NewKeyValues["studentuniqueid"] != "S2" {
+		t.Errorf("keyChanges = %+v, want %s from S1 to S2", keyChanges, student.Id)
+	}
+	var deletes []struct {
+		ID        string
+		KeyValues map[string]string
+	}
+	decode(t, admin.Get("/api/common/ed-fi/students/deletes"), http.StatusOK, &deletes)
+	if len(deletes) != 1 || deletes[0].ID != student.Id || deletes[0].KeyValues["studentuniqueid"] != "S2" {
+		t.Errorf("deletes = %+v, want %s keyed S2", deletes, student.Id)
+	}
+
+	if _, err := db.Exec("DELETE FROM audit.ChangeLog"); err == nil {
+		t.Error("deleting audit history succeeded, want it rejected")
+	}
+}
+
+// TestDescriptorReferences rejects descriptor values that are not in
+// edfi.Descriptor, both in the handler and in the foreign key behind it.
+func TestDescriptorReferences(t *testing.T) {
+	db := plugintest.Postgres(t, "../../migrations")
+	host := plugintest.Start(t, plugintest.Options{Name: "common-plugin", Prefix: "api/common"}, New)
+	admin := host.As(plugintest.User{ID: "u-1", Roles: []string{"admin"}})
+
+	resp := admin.Post("/api/common/ed-fi/programs", "application/json",
+		[]byte(`{"programname": "P1", "programtype": "uri://ed-fi.org/ProgramTypeDescriptor#Regular education"}`))
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("POST program with a standard type = %d, want 201", resp.StatusCode)
+	}
+
+	var problem struct {
+		Errors []struct{ Field string }
+	}
+	resp = admin.Post("/api/common/ed-fi/programs", "application/json",
+		[]byte(`{"programname": "P2", "programtype": "uri://ed-fi.org/ProgramTypeDescriptor#Unknown"}`))
+	decode(t, resp, http.StatusBadRequest, &problem)
+	if len(problem.Errors) != 1 || problem.Errors[0].Field != "programtype" {
+		t.Errorf("unknown program type errors = %+v, want one on programtype", problem.Errors)
+	}
+
+	_, err := db.Exec(`INSERT INTO Program (ProgramName, ProgramType) VALUES ('P3', 'uri://ed-fi.org/ProgramTypeDescriptor#Unknown')`)
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code.Name() != "foreign_key_violation" {
+		t.Errorf("inserting an unknown program type directly = %v, want a foreign key violation", err)
+	}
+}
+
+// TestPagingAndExpand follows the cursor Link of an expanded attendance
+// list to its end.
+func TestPagingAndExpand(t *testing.T) {
+	plugintest.Postgres(t, "../../migrations")
+	host := plugintest.Start(t, plugintest.Options{Name: "common-plugin", Prefix: "api/common"}, New)
+	admin := host.As(plugintest.User{ID: "u-1", Roles: []string{"admin"}})
+
+	post := func(path, body string) {
+		t.Helper()
+		if resp := admin.Post("/api/common/ed-fi/"+path, "application/json", []byte(body)); resp.StatusCode != http.StatusCreated {
+			t.Fatalf("POST %s %s = %d, want 201", path, body, resp.StatusCode)
+		}
+	}
+	post("course-catalogs", `{"courseidentifier": "ALG1", "coursetitle": "Algebra I"}`)
+	post("sections", `{"coursesectionidentifier": "ALG1-01", "courseidentifier": "ALG1"}`)
+	ids := []string{"S1", "S2", "S3"}
+	for _, id := range ids {
+		post("students", `{"studentuniqueid": "`+id+`"}`)
+		post("attendances", `{"coursesectionidentifier": "ALG1-01", "studentuniqueid": "`+id+`", "attendanceeventdate": "2024-09-03",
+			"attendancestatus": "uri://ed-fi.org/AttendanceEventCategoryDescriptor#Present"}`)
+	}
+
+	var seen []string
+	next := "/api/common/ed-fi/attendances?limit=2&expand=section.course,student"
+	for pages := 0; next != ""; pages++ {
+		if pages == len(ids) {
+			t.Fatalf("still paging after %d pages", pages)
+		}
+		resp := admin.Get(next)
+		var page []struct {
+			StudentUniqueId string
+			Section         struct {
+				Course struct{ CourseTitle string }
+			}
+			Student struct{ StudentUniqueId string }
+		}
+		decode(t, resp, http.StatusOK, &page)
+		for _, a := range page {
+			seen = append(seen, a.StudentUniqueId)
+			if a.Section.Course.CourseTitle != "Algebra I" || a.Student.StudentUniqueId != a.StudentUniqueId {
+				t.Errorf("attendance for %s expanded to %+v", a.StudentUniqueId, a)
+			}
+		}
+		next = nextLink(resp)
+	}
+	if strings.Join(seen, ",") != strings.Join(ids, ",") {
+		t.Errorf("paged through %v, want %v", seen, ids)
+	}
+}
+
+// decode checks resp's status and decodes its JSON body into v.
+func decode(t *testing.T, resp *http.Response, status int, v any) {
+	t.Helper()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != status {
+		t.Fatalf("%s %s = %d %s, want %d", resp.Request.Method, resp.Request.URL, resp.StatusCode, body, status)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		t.Fatalf("decoding %s: %v", body, err)
+	}
+}
+
+// nextLink returns the rel="next" target of resp's Link header, or "".
+func nextLink(resp *http.Response) string {
+	for _, link := range strings.Split(resp.Header.Get("Link"), ", ") {
+		if target, ok := strings.CutSuffix(link, `>; rel="next"`); ok {
+			return strings.TrimPrefix(target, "<")
+		}
+	}
+	return ""
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"debug/buildinfo"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/catdevman/oasis/internal/logging"
+	"github.com/catdevman/oasis/shared"
+	"github.com/hashicorp/go-plugin"
+)
+
+// restartBackoff is how long the host waits after starting a plugin
+// process before starting it again, so a plugin that crashes on start is
+// not restarted by every request.
+const restartBackoff = time.Second
+
+// managedPlugin is a plugin process started from plugins.yaml. It
+// implements shared.HTTPPlugin by forwarding each call to the process and
+// timing it for the metrics, and starts the process again when a call
+// finds that it has exited.
+type managedPlugin struct {
+	config PluginConfig
+	dbURL  string
+	level  slog.Level
+
+	mu          sync.Mutex
+	client      *plugin.Client
+	rpc         shared.HTTPPlugin
+	lastAttempt time.Time
+	startedAt   time.Time
+	restarts    int
+	version     string // of the binary last started
+}
+
+// startPlugin starts the plugin described by config, logging at level.
+func startPlugin(config PluginConfig, dbURL string, level slog.Level) (*managedPlugin, error) {
+	m := &managedPlugin{config: config, dbURL: dbURL, level: level}
+	if err := m.start(); err != nil {
+		return nil, err
+	}
+	hostMetrics.PluginStarted(config.Name)
+	return m, nil
+}
+
+// start launches the plugin process and connects to it. The caller holds
+// m.mu, or has not yet shared m.
+func (m *managedPlugin) start() error {
+	m.lastAttempt = time.Now()
+	cmd := exec.Command(m.config.Path)
+	cmd.Env = append(os.Environ(),
+		"OASIS_DB_URL="+m.dbURL,
+		"OASIS_PLUGIN_NAME="+m.config.Name,
+		"OASIS_PLUGIN_PREFIX="+m.config.Prefix,
+		"OASIS_LOG_LEVEL="+logging.LevelName(m.level),
+		"OASIS_HOST_URL="+hostURL,
+	)
+	cmd.Env = append(cmd.Env, traceConfig.Env()...)
+
+	// The plugin's stderr, and go-plugin's own lines about it, are
+	// relogged through this logger tagged with the plugin's name.
+	client := plugin.NewClient(&plugin.ClientConfig{
+		HandshakeConfig: shared.Handshake,
+		Plugins:         map[string]plugin.Plugin{"http_plugin": &shared.HTTPPluginAdapter{Host: hostServices{plugin: m.config.Name}}},
+		Cmd:             cmd,
+		Logger:          logging.HCLog(logHandler, m.level).With("plugin", m.config.Name),
+	})
+	rpcClient, err := client.Client()
+	if err != nil {
+		client.Kill()
+		return fmt.Errorf("connecting: %w", err)
+	}
+	raw, err := rpcClient.Dispense("http_plugin")
+	if err != nil {
+		client.Kill()
+		return fmt.Errorf("dispensing: %w", err)
+	}
+	m.client, m.rpc, m.startedAt = client, raw.(shared.HTTPPlugin), m.lastAttempt
+	// A restarted plugin is brought up to date; loadPlugins pushes to new
+	// ones once every plugin has declared its sections.
+	if err := m.rpc.ApplySettings(hostSettings.Values()); err != nil {
+		slog.Warn("pushing settings", "plugin", m.config.Name, "error", err)
+	}
+	m.version = "unknown"
+	if info, err := buildinfo.ReadFile(m.config.Path); err == nil {
+		m.version = buildVersion(info)
+	}
+	return nil
+}
+
+// exited reports whether the plugin's process has exited and not yet been
+// restarted.
+func (m *managedPlugin) exited() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.client.Exited()
+}
+
+// current returns the running plugin, restarting its process first if it
+// has exited.
+func (m *managedPlugin) current() (shared.HTTPPlugin, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.client.Exited() {
+		return m.rpc, nil
+	}
+	if time.Since(m.lastAttempt) < restartBackoff {
+		return nil, errors.New("plugin exited; waiting to restart it")
+	}
+	slog.Warn("restarting exited plugin", "plugin", m.config.Name)
+	m.client.Kill()
+	if err := m.start(); err != nil {
+		return nil, err
+	}
+	m.restarts++
+	hostMetrics.PluginRestarted(m.config.Name)
+	return m.rpc, nil
+}
+
+// call runs f against the running plugin and records its duration as the
+// RPC named rpc.
+func (m *managedPlugin) call(rpc string, f func(shared.HTTPPlugin) error) error {
+	p, err := m.current()
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	err = f(p)
+	hostMetrics.ObserveRPC(m.config.Name, rpc, time.Since(start), err)
+	return err
+}
+
+func (m *managedPlugin) ServeHTTP(req shared.HTTPRequest) (resp shared.HTTPResponse, err error) {
+	err = m.call("ServeHTTP", func(p shared.HTTPPlugin) error {
+		resp, err = p.ServeHTTP(req)
+		return err
+	})
+	return resp, err
+}
+
+func (m *managedPlugin) GetRoutes() (routes []string, err error) {
+	err = m.call("GetRoutes", func(p shared.HTTPPlugin) error {
+		routes, err = p.GetRoutes()
+		return err
+	})
+	return routes, err
+}
+
+func (m *managedPlugin) GetMenuItems() (items []shared.MenuItem, err error) {
+	err = m.call("GetMenuItems", func(p shared.HTTPPlugin) error {
+		items, err = p.GetMenuItems()
+		return err
+	})
+	return items, err
+}
+
+func (m *managedPlugin) GetOpenAPI() (doc []byte, err error) {
+	err = m.call("GetOpenAPI", func(p shared.HTTPPlugin) error {
+		doc, err = p.GetOpenAPI()
+		return err
+	})
+	return doc, err
+}
+
+func (m *managedPlugin) GetMetrics() (metrics []byte, err error) {
+	err = m.call("GetMetrics", func(p shared.HTTPPlugin) error {
+		metrics, err = p.GetMetrics()
+		return err
+	})
+	return metrics, err
+}
+
+func (m *managedPlugin) GetSettingsSections() (sections []shared.SettingsSection, err error) {
+	err = m.call("GetSettingsSections", func(p shared.HTTPPlugin) error {
+		sections, err = p.GetSettingsSections()
+		return err
+	})
+	return sections, err
+}
+
+func (m *managedPlugin) ApplySettings(values shared.Settings) error {
+	return m.call("ApplySettings", func(p shared.HTTPPlugin) error {
+		return p.ApplySettings(values)
+	})
+}
+
+// Kill stops the plugin process.
+func (m *managedPlugin) Kill() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.client.Kill()
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	oerrors "github.com/catdevman/oasis/internal/errors"
+	"github.com/catdevman/oasis/shared/sdk"
+)
+
+// defaultCSP is the Content-Security-Policy sent unless the security
+// settings replace it. Inline scripts run only with the response's nonce;
+// inline styles are allowed because the Tailwind CDN injects its own.
+const defaultCSP = "default-src 'self'; " +
+	"script-src 'self' 'nonce-{nonce}' https://unpkg.com https://cdn.tailwindcss.com; " +
+	"style-src 'self' 'unsafe-inline' https://unpkg.com https://fonts.googleapis.com; " +
+	"font-src 'self' https://fonts.gstatic.com; img-src 'self' data:; connect-src 'self'; " +
+	"object-src 'none'; base-uri 'self'; form-action 'self'; frame-ancestors 'none'"
+
+// csrfCookie holds the CSRF token a page sends back in sdk.CSRFHeader.
+const csrfCookie = "oasis_csrf"
+
+// securityConfig is the security section of plugins.yaml.
+var securityConfig SecurityConfig
+
+type nonceKey struct{}
+
+// cspNonce is the nonce of r's response, which its inline scripts carry.
+func cspNonce(r *http.Request) string {
+	nonce, _ := r.Context().Value(nonceKey{}).(string)
+	return nonce
+}
+
+func randomToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// withSecurity adds the security headers of c to every response, answers
+// CORS requests for the paths c's rules cover, and refuses requests that
+// fail the CSRF check.
+func withSecurity(c SecurityConfig, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce := randomToken()
+		h := w.Header()
+		setHeader(h, "Content-Security-Policy", c.Headers.ContentSecurityPolicy, defaultCSP, nonce)
+		setHeader(h, "X-Frame-Options", c.Headers.FrameOptions, "DENY", nonce)
+		setHeader(h, "Referrer-Policy", c.Headers.ReferrerPolicy, "strict-origin-when-cross-origin", nonce)
+		h.Set("X-Content-Type-Options", "nosniff")
+
+		if rule := c.corsRule(r.URL.Path); rule != nil && r.Header.Get("Origin") != "" {
+			if rule.handle(w, r) {
+				return
+			}
+		}
+		if !c.CSRF.passes(r) {
+			oerrors.WriteProblem(w, r, oerrors.NewProblem(http.StatusForbidden, "CSRF",
+				"the request was not sent from an Oasis page; reload the page and try again"))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), nonceKey{}, nonce)))
+	})
+}
+
+// setHeader sets the header key to value, or to def if value is empty,
+// with {nonce} replaced; off sets nothing.
+func setHeader(h http.Header, key, value, def, nonce string) {
+	switch value {
+	case "off":
+		return
+	case "":
+		value = def
+	}
+	h.Set(key, strings.ReplaceAll(value, "{nonce}", nonce))
+}
+
+// csrfToken returns the CSRF token of r's browser, giving it one if it has
+// none, for a page to send back with the requests it makes.
+func csrfToken(w http.ResponseWriter, r *http.Request) string {
+	if cookie, err := r.Cookie(csrfCookie); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+	token := randomToken()
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return token
+}
+
+// passes reports whether r may proceed: one with a safe method or without
+// cookies, which cannot be forged across sites, or one whose sdk.CSRFHeader
+// matches its CSRF cookie.
+func (c CSRFConfig) passes(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	if c.Disabled || len(r.Cookies()) == 0 {
+		return true
+	}
+	for _, prefix := range c.Exempt {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return true
+		}
+	}
+	cookie, err := r.Cookie(csrfCookie)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(r.Header.Get(sdk.CSRFHeader))) == 1
+}
+
+// corsRule returns the rule with the longest path prefix of path, or nil.
+func (c SecurityConfig) corsRule(path string) *CORSRule {
+	var best *CORSRule
+	for i, rule := range c.CORS {
+		if strings.HasPrefix(path, rule.Path) && (best == nil || len(rule.Path) > len(best.Path)) {
+			best = &c.CORS[i]
+		}
+	}
+	return best
+}
+
+// handle adds the CORS headers for r's origin to w, if the rule
+// allows it, and reports whether it answered r, a preflight request. A
+// preflight the rule does not allow is refused.
+func (rule *CORSRule) handle(w http.ResponseWriter, r *http.Request) bool {
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	origin := r.Header.Get("Origin")
+	allowed := slices.Contains(rule.Origins, origin) || slices.Contains(rule.Origins, "*")
+	method := r.Header.Get("Access-Control-Request-Method")
+	if r.Method != http.MethodOptions || method == "" {
+		if allowed {
+			rule.allowOrigin(h, origin)
+			if len(rule.ExposeHeaders) > 0 {
+				h.Set("Access-Control-Expose-Headers", strings.Join(rule.ExposeHeaders, ", "))
+			}
+		}
+		return false
+	}
+
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+	methods := rule.Methods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	}
+	if !allowed || !slices.Contains(methods, method) {
+		oerrors.WriteProblem(w, r, oerrors.NewProblem(http.StatusForbidden, "CORS",
+			origin+" may not send "+method+" requests to "+r.URL.Path))
+		return true
+	}
+	rule.allowOrigin(h, origin)
+	h.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	if len(rule.Headers) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(rule.Headers, ", "))
+	}
+	if maxAge, err := time.ParseDuration(rule.MaxAge); err == nil {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(maxAge.Seconds())))
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+func (rule *CORSRule) allowOrigin(h http.Header, origin string) {
+	if rule.Credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	} else if slices.Contains(rule.Origins, "*") {
+		origin = "*"
+	}
+	h.Set("Access-Control-Allow-Origin", origin)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/catdevman/oasis/internal/settings"
+	"github.com/catdevman/oasis/shared"
+)
+
+// settingsTimeout bounds storing a settings change.
+const settingsTimeout = 5 * time.Second
+
+// hostSettings are the system settings, with the sections the loaded
+// plugins add.
+var hostSettings = settings.New(settings.System)
+
+func (hostServices) Settings() (shared.SettingsDocument, error) {
+	return hostSettings.Document(), nil
+}
+
+func (hostServices) UpdateSettings(u shared.SettingsUpdate) ([]shared.FieldError, error) {
+	if hostDB == nil {
+		return nil, errors.New("the host has no database connection")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), settingsTimeout)
+	defer cancel()
+	invalid, err := hostSettings.Update(ctx, hostDB, u)
+	if err != nil || len(invalid) > 0 {
+		return invalid, err
+	}
+	var changed []string
+	for section, values := range u.Values {
+		for key := range values {
+			changed = append(changed, section+"."+key)
+		}
+	}
+	slices.Sort(changed)
+	slog.Info("settings changed", "settings", strings.Join(changed, ","), "actor", u.Actor, "request_id", u.RequestID)
+	pushSettings()
+	return nil, nil
+}
+
+// pushSettings sends the current settings to every plugin.
+func pushSettings() {
+	values := hostSettings.Values()
+	for _, p := range plugs {
+		if err := p.ApplySettings(values); err != nil {
+			slog.Warn("pushing settings", "plugin", p.config.Name, "error", err)
+		}
+	}
+}
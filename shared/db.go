@@ -1,24 +1,39 @@
 package shared
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"os"
 	"time"
 
+	"github.com/XSAM/otelsql"
 	_ "github.com/lib/pq"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // OpenDatabase reads the OASIS_DB_URL environment variable and opens
 // a Postgres connection with standardized settings. Plugins should call this
-// instead of opening the database directly.
+// instead of opening the database directly. Queries made with a context
+// carrying a span are traced as its children.
 func OpenDatabase() (*sql.DB, error) {
 	dbURL := os.Getenv("OASIS_DB_URL")
 	if dbURL == "" {
 		return nil, fmt.Errorf("OASIS_DB_URL environment variable not set")
 	}
 
-	db, err := sql.Open("postgres", dbURL)
+	db, err := otelsql.Open("postgres", dbURL,
+		otelsql.WithAttributes(semconv.DBSystemNamePostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			OmitConnResetSession: true,
+			// Queries outside a request, such as those at startup,
+			// would otherwise each start a trace of their own.
+			SpanFilter: func(ctx context.Context, _ otelsql.Method, _ string, _ []driver.NamedValue) bool {
+				return trace.SpanContextFromContext(ctx).IsValid()
+			},
+		}))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -0,0 +1,76 @@
+package shared
+
+import (
+	"slices"
+	"time"
+)
+
+// FeatureFlag turns a feature on for everyone, or only for the users,
+// roles and education organizations it targets, so it can be rolled out
+// to one school before the whole district.
+type FeatureFlag struct {
+	Key         string    `json:"key"`
+	Description string    `json:"description"`
+	Enabled     bool      `json:"enabled"` // on for everyone, whatever the targets
+	Users       []string  `json:"users"`
+	Roles       []string  `json:"roles"`
+	EdOrgs      []string  `json:"ed_orgs"` // education organization identifiers
+	UpdatedBy   string    `json:"updated_by,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at,omitzero"`
+}
+
+// FlagSubject is who a flag is evaluated for, and where: the education
+// organizations the request concerns, such as the school a page shows.
+type FlagSubject struct {
+	UserID string   `json:"user_id"`
+	Roles  []string `json:"roles"`
+	EdOrgs []string `json:"ed_orgs"`
+}
+
+// The reasons a flag is on or off for a subject.
+const (
+	FlagReasonUnknown  = "unknown"  // no flag has the key, so it is off
+	FlagReasonEnabled  = "enabled"  // on for everyone
+	FlagReasonUser     = "user"     // on for the subject's user
+	FlagReasonRole     = "role"     // on for one of the subject's roles
+	FlagReasonEdOrg    = "ed_org"   // on at one of the subject's education organizations
+	FlagReasonTargeted = "targeted" // the subject is not targeted, so it is off
+)
+
+// Evaluate reports whether f is on for s, and why.
+func (f FeatureFlag) Evaluate(s FlagSubject) FlagResult {
+	switch {
+	case f.Enabled:
+		return FlagResult{Enabled: true, Reason: FlagReasonEnabled}
+	case s.UserID != "" && slices.Contains(f.Users, s.UserID):
+		return FlagResult{Enabled: true, Reason: FlagReasonUser}
+	case slices.ContainsFunc(s.Roles, func(r string) bool { return slices.Contains(f.Roles, r) }):
+		return FlagResult{Enabled: true, Reason: FlagReasonRole}
+	case slices.ContainsFunc(s.EdOrgs, func(o string) bool { return slices.Contains(f.EdOrgs, o) }):
+		return FlagResult{Enabled: true, Reason: FlagReasonEdOrg}
+	}
+	return FlagResult{Reason: FlagReasonTargeted}
+}
+
+// FlagResult is a flag's value for a subject.
+type FlagResult struct {
+	Enabled bool
+	Reason  string
+}
+
+// FlagEvaluation asks for the flag Key's value for Subject, attributed to
+// a request for the record of evaluations.
+type FlagEvaluation struct {
+	Key       string
+	Subject   FlagSubject
+	RequestID string
+}
+
+// FlagUpdate creates or replaces Flag, or deletes the flag with its key,
+// attributed for the audit log.
+type FlagUpdate struct {
+	Flag      FeatureFlag
+	Delete    bool
+	Actor     string
+	RequestID string
+}
@@ -0,0 +1,199 @@
+package shared
+
+import (
+	"net/rpc"
+	"time"
+
+	"github.com/hashicorp/go-plugin"
+)
+
+// HostServices is what the host offers plugins in return, served back over
+// go-plugin's broker when the host dispenses a plugin.
+type HostServices interface {
+	// Health reports the state of the host, its plugins and the database.
+	Health() (SystemHealth, error)
+	// Settings returns every settings section with its current values.
+	Settings() (SettingsDocument, error)
+	// UpdateSettings validates and stores u, then pushes the new values
+	// to every plugin. If any value is invalid nothing is stored, and the
+	// invalid fields, named "section.key", are returned.
+	UpdateSettings(u SettingsUpdate) (invalid []FieldError, err error)
+	// Flags returns every feature flag, by key.
+	Flags() ([]FeatureFlag, error)
+	// UpdateFlag creates, replaces or deletes a feature flag. If the flag
+	// is invalid nothing is stored and the invalid fields are returned.
+	UpdateFlag(u FlagUpdate) (invalid []FieldError, err error)
+	// EvaluateFlag reports whether a feature flag is on for a subject, and
+	// records the evaluation.
+	EvaluateFlag(e FlagEvaluation) (FlagResult, error)
+}
+
+// HostReceiver is implemented by plugins that use HostServices; the
+// adapter hands them the host's services once connected.
+type HostReceiver interface {
+	SetHost(HostServices)
+}
+
+// The overall health statuses.
+const (
+	StatusHealthy   = "healthy"
+	StatusDegraded  = "degraded"  // serving, but a plugin is down or a resource is nearly exhausted
+	StatusUnhealthy = "unhealthy" // the database is unreachable
+)
+
+// SystemHealth is the state of a running Oasis installation.
+type SystemHealth struct {
+	Status    string         `json:"status"`
+	Version   string         `json:"version"` // the host's build
+	StartedAt time.Time      `json:"started_at"`
+	Plugins   []PluginHealth `json:"plugins"`
+	Database  DatabaseHealth `json:"database"`
+	Disk      *DiskUsage     `json:"disk,omitempty"` // nil where the platform cannot report it
+}
+
+// PluginHealth is the state of one plugin process.
+type PluginHealth struct {
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	State     string     `json:"state"` // running or exited
+	Version   string     `json:"version"`
+	StartedAt time.Time  `json:"started_at"`
+	Restarts  int        `json:"restarts"`
+	LatencyMS float64    `json:"latency_ms"`     // round trip of an RPC call to the process
+	Pool      *PoolStats `json:"pool,omitempty"` // nil for plugins without a database connection
+	Error     string     `json:"error,omitempty"`
+}
+
+// PoolStats describe a plugin's database connection pool.
+type PoolStats struct {
+	InUse     int   `json:"in_use"`
+	MaxOpen   int   `json:"max_open"`
+	WaitCount int64 `json:"wait_count"` // connections waited for since the plugin started
+}
+
+// Saturated reports whether every connection the pool may open is in use.
+func (s PoolStats) Saturated() bool {
+	return s.MaxOpen > 0 && s.InUse >= s.MaxOpen
+}
+
+// DatabaseHealth is the host's view of the database.
+type DatabaseHealth struct {
+	Connected bool    `json:"connected"`
+	LatencyMS float64 `json:"latency_ms"`
+	Migration string  `json:"migration"` // the last migration applied
+	Error     string  `json:"error,omitempty"`
+}
+
+// DiskUsage is the space on the filesystem the host runs from.
+type DiskUsage struct {
+	Path        string  `json:"path"`
+	TotalBytes  uint64  `json:"total_bytes"`
+	FreeBytes   uint64  `json:"free_bytes"`
+	UsedPercent float64 `json:"used_percent"`
+}
+
+// HostServicesRPCServer serves HostServices to a plugin over the broker.
+type HostServicesRPCServer struct {
+	Impl HostServices
+}
+
+func (s *HostServicesRPCServer) Health(args interface{}, resp *SystemHealth) error {
+	health, err := s.Impl.Health()
+	if err != nil {
+		return err
+	}
+	*resp = health
+	return nil
+}
+
+func (s *HostServicesRPCServer) Settings(args interface{}, resp *SettingsDocument) error {
+	doc, err := s.Impl.Settings()
+	if err != nil {
+		return err
+	}
+	*resp = doc
+	return nil
+}
+
+func (s *HostServicesRPCServer) UpdateSettings(u SettingsUpdate, resp *[]FieldError) error {
+	invalid, err := s.Impl.UpdateSettings(u)
+	if err != nil {
+		return err
+	}
+	*resp = invalid
+	return nil
+}
+
+func (s *HostServicesRPCServer) Flags(args interface{}, resp *[]FeatureFlag) error {
+	flags, err := s.Impl.Flags()
+	if err != nil {
+		return err
+	}
+	*resp = flags
+	return nil
+}
+
+func (s *HostServicesRPCServer) UpdateFlag(u FlagUpdate, resp *[]FieldError) error {
+	invalid, err := s.Impl.UpdateFlag(u)
+	if err != nil {
+		return err
+	}
+	*resp = invalid
+	return nil
+}
+
+func (s *HostServicesRPCServer) EvaluateFlag(e FlagEvaluation, resp *FlagResult) error {
+	result, err := s.Impl.EvaluateFlag(e)
+	if err != nil {
+		return err
+	}
+	*resp = result
+	return nil
+}
+
+// HostServicesRPC is the plugin's client for HostServices.
+type HostServicesRPC struct{ client *rpc.Client }
+
+func (h *HostServicesRPC) Health() (SystemHealth, error) {
+	var resp SystemHealth
+	err := h.client.Call("Plugin.Health", new(interface{}), &resp)
+	return resp, err
+}
+
+func (h *HostServicesRPC) Settings() (SettingsDocument, error) {
+	var resp SettingsDocument
+	err := h.client.Call("Plugin.Settings", new(interface{}), &resp)
+	return resp, err
+}
+
+func (h *HostServicesRPC) UpdateSettings(u SettingsUpdate) ([]FieldError, error) {
+	var resp []FieldError
+	err := h.client.Call("Plugin.UpdateSettings", u, &resp)
+	return resp, err
+}
+
+func (h *HostServicesRPC) Flags() ([]FeatureFlag, error) {
+	var resp []FeatureFlag
+	err := h.client.Call("Plugin.Flags", new(interface{}), &resp)
+	return resp, err
+}
+
+func (h *HostServicesRPC) UpdateFlag(u FlagUpdate) ([]FieldError, error) {
+	var resp []FieldError
+	err := h.client.Call("Plugin.UpdateFlag", u, &resp)
+	return resp, err
+}
+
+func (h *HostServicesRPC) EvaluateFlag(e FlagEvaluation) (FlagResult, error) {
+	var resp FlagResult
+	err := h.client.Call("Plugin.EvaluateFlag", e, &resp)
+	return resp, err
+}
+
+// serveHost serves host to the plugin behind c and tells the plugin where
+// to find it.
+func serveHost(b *plugin.MuxBroker, c *rpc.Client, host HostServices) error {
+	id := b.NextId()
+	go b.AcceptAndServe(id, &HostServicesRPCServer{Impl: host})
+	return c.Call("Plugin.SetHost", id, new(struct{}))
+}
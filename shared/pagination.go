@@ -2,6 +2,7 @@ package shared
 
 import (
 	"bytes"
+	"fmt"
 	"html/template"
 )
 
@@ -12,28 +13,75 @@ type Pagination struct {
 	HasPrev  bool
 	NextPage int
 	PrevPage int
+
+	// The fields below are only set by NewPaginationWithTotal, when the API
+	// reported a Total-Count; they drive the numbered pages and the
+	// page-size selector.
+	PageSize   int
+	TotalCount int
+	TotalPages int
+	Pages      []int // page numbers to link, with 0 marking an elided gap
+	PageSizes  []int
+}
+
+// PageSizes offered by the page-size selector.
+var PageSizes = []int{10, 25, 50, 100}
+
+// PageURL returns the URL of the given page, keeping the page size.
+func (p Pagination) PageURL(page int) string {
+	if p.PageSize > 0 {
+		return fmt.Sprintf("%s?page=%d&pageSize=%d", p.BaseURL, page, p.PageSize)
+	}
+	return fmt.Sprintf("%s?page=%d", p.BaseURL, page)
+}
+
+// FirstItem and LastItem are the 1-based positions shown on this page.
+func (p Pagination) FirstItem() int {
+	if p.TotalCount == 0 {
+		return 0
+	}
+	return (p.Page-1)*p.PageSize + 1
+}
+
+func (p Pagination) LastItem() int {
+	return min(p.Page*p.PageSize, p.TotalCount)
 }
 
 var paginationTmpl = template.Must(template.New("pagination").Parse(`
     <div class="flex items-center justify-between border-t border-gray-200 bg-white px-4 py-3 sm:px-6 mt-4 rounded-b-lg">
         <div class="flex flex-1 justify-between sm:hidden">
             {{if .HasPrev}}
-            <a href="{{.BaseURL}}?page={{.PrevPage}}" hx-get="{{.BaseURL}}?page={{.PrevPage}}" hx-target="#main-content" hx-push-url="true" class="relative inline-flex items-center rounded-md border border-gray-300 bg-white px-4 py-2 text-sm font-medium text-gray-700 hover:bg-gray-50">Previous</a>
+            <a href="{{.PageURL .PrevPage}}" hx-get="{{.PageURL .PrevPage}}" hx-target="#main-content" hx-push-url="true" class="relative inline-flex items-center rounded-md border border-gray-300 bg-white px-4 py-2 text-sm font-medium text-gray-700 hover:bg-gray-50">Previous</a>
             {{end}}
             {{if .HasNext}}
-            <a href="{{.BaseURL}}?page={{.NextPage}}" hx-get="{{.BaseURL}}?page={{.NextPage}}" hx-target="#main-content" hx-push-url="true" class="relative ml-3 inline-flex items-center rounded-md border border-gray-300 bg-white px-4 py-2 text-sm font-medium text-gray-700 hover:bg-gray-50">Next</a>
+            <a href="{{.PageURL .NextPage}}" hx-get="{{.PageURL .NextPage}}" hx-target="#main-content" hx-push-url="true" class="relative ml-3 inline-flex items-center rounded-md border border-gray-300 bg-white px-4 py-2 text-sm font-medium text-gray-700 hover:bg-gray-50">Next</a>
             {{end}}
         </div>
         <div class="hidden sm:flex sm:flex-1 sm:items-center sm:justify-between">
-            <div>
+            <div class="flex items-center gap-4">
                 <p class="text-sm text-gray-700">
+                    {{if .TotalPages}}
+                    Showing <span class="font-medium">{{.FirstItem}}</span> to <span class="font-medium">{{.LastItem}}</span> of <span class="font-medium">{{.TotalCount}}</span> results
+                    {{else}}
                     Showing page <span class="font-medium">{{.Page}}</span>
+                    {{end}}
                 </p>
+                {{if .PageSizes}}
+                <label class="text-sm text-gray-700">
+                    <span class="sr-only">Rows per page</span>
+                    <select name="pageSize" hx-get="{{.BaseURL}}" hx-trigger="change" hx-target="#main-content" hx-push-url="true" class="rounded-md border-gray-300 py-1 text-sm">
+                        {{$size := .PageSize}}
+                        {{range .PageSizes}}
+                        <option value="{{.}}" {{if eq . $size}}selected{{end}}>{{.}} per page</option>
+                        {{end}}
+                    </select>
+                </label>
+                {{end}}
             </div>
             <div>
                 <nav class="isolate inline-flex -space-x-px rounded-md shadow-sm" aria-label="Pagination">
                     {{if .HasPrev}}
-                    <a href="{{.BaseURL}}?page={{.PrevPage}}" hx-get="{{.BaseURL}}?page={{.PrevPage}}" hx-target="#main-content" hx-push-url="true" class="relative inline-flex items-center rounded-l-md px-2 py-2 text-gray-400 ring-1 ring-inset ring-gray-300 hover:bg-gray-50 focus:z-20 focus:outline-offset-0">
+                    <a href="{{.PageURL .PrevPage}}" hx-get="{{.PageURL .PrevPage}}" hx-target="#main-content" hx-push-url="true" class="relative inline-flex items-center rounded-l-md px-2 py-2 text-gray-400 ring-1 ring-inset ring-gray-300 hover:bg-gray-50 focus:z-20 focus:outline-offset-0">
                         <span class="sr-only">Previous</span>
                         <svg class="h-5 w-5" viewBox="0 0 20 20" fill="currentColor" aria-hidden="true">
                             <path fill-rule="evenodd" d="M12.79 5.23a.75.75 0 01-.02 1.06L8.832 10l3.938 3.71a.75.75 0 11-1.04 1.08l-4.5-4.25a.75.75 0 010-1.08l4.5-4.25a.75.75 0 011.06.02z" clip-rule="evenodd" />
@@ -48,8 +96,19 @@ var paginationTmpl = template.Must(template.New("pagination").Parse(`
                     </span>
                     {{end}}
 
+                    {{$p := .}}
+                    {{range .Pages}}
+                    {{if eq . 0}}
+                    <span class="relative inline-flex items-center px-4 py-2 text-sm font-semibold text-gray-700 ring-1 ring-inset ring-gray-300">...</span>
+                    {{else if eq . $p.Page}}
+                    <span aria-current="page" class="relative z-10 inline-flex items-center bg-blue-600 px-4 py-2 text-sm font-semibold text-white">{{.}}</span>
+                    {{else}}
+                    <a href="{{$p.PageURL .}}" hx-get="{{$p.PageURL .}}" hx-target="#main-content" hx-push-url="true" class="relative inline-flex items-center px-4 py-2 text-sm font-semibold text-gray-900 ring-1 ring-inset ring-gray-300 hover:bg-gray-50 focus:z-20 focus:outline-offset-0">{{.}}</a>
+                    {{end}}
+                    {{end}}
+
                     {{if .HasNext}}
-                    <a href="{{.BaseURL}}?page={{.NextPage}}" hx-get="{{.BaseURL}}?page={{.NextPage}}" hx-target="#main-content" hx-push-url="true" class="relative inline-flex items-center rounded-r-md px-2 py-2 text-gray-400 ring-1 ring-inset ring-gray-300 hover:bg-gray-50 focus:z-20 focus:outline-offset-0">
+                    <a href="{{.PageURL .NextPage}}" hx-get="{{.PageURL .NextPage}}" hx-target="#main-content" hx-push-url="true" class="relative inline-flex items-center rounded-r-md px-2 py-2 text-gray-400 ring-1 ring-inset ring-gray-300 hover:bg-gray-50 focus:z-20 focus:outline-offset-0">
                         <span class="sr-only">Next</span>
                         <svg class="h-5 w-5" viewBox="0 0 20 20" fill="currentColor" aria-hidden="true">
                             <path fill-rule="evenodd" d="M7.21 14.77a.75.75 0 01.02-1.06L11.168 10 7.23 6.29a.75.75 0 111.04-1.08l4.5 4.25a.75.75 0 010 1.08l-4.5 4.25a.75.75 0 01-1.06-.02z" clip-rule="evenodd" />
@@ -80,7 +139,7 @@ func (p Pagination) Render() template.HTML {
 // It takes the current page, the limit (page size), and the slice of items fetched with limit+1
 // It modifies the slice pointer to strip the extra item if present.
 func NewPagination(baseURL string, page int, limit int, items *[]map[string]interface{}) Pagination {
-    hasNext := len(*items) > limit
+	hasNext := len(*items) > limit
 	if hasNext {
 		*items = (*items)[:limit]
 	}
@@ -94,3 +153,37 @@ func NewPagination(baseURL string, page int, limit int, items *[]map[string]inte
 		PrevPage: page - 1,
 	}
 }
+
+// NewPaginationWithTotal builds pagination state from the total row count
+// reported by a list endpoint's Total-Count header, which enables the
+// numbered page links and the page-size selector.
+func NewPaginationWithTotal(baseURL string, page, pageSize, totalCount int) Pagination {
+	totalPages := (totalCount + pageSize - 1) / pageSize
+	return Pagination{
+		BaseURL:    baseURL,
+		Page:       page,
+		HasNext:    page < totalPages,
+		HasPrev:    page > 1,
+		NextPage:   page + 1,
+		PrevPage:   page - 1,
+		PageSize:   pageSize,
+		TotalCount: totalCount,
+		TotalPages: totalPages,
+		Pages:      pageWindow(page, totalPages),
+		PageSizes:  PageSizes,
+	}
+}
+
+// pageWindow lists the first and last page and up to two pages either side
+// of the current one, with 0 standing in for each elided run.
+func pageWindow(page, totalPages int) []int {
+	var pages []int
+	for n := 1; n <= totalPages; n++ {
+		if n == 1 || n == totalPages || (n >= page-2 && n <= page+2) {
+			pages = append(pages, n)
+		} else if len(pages) > 0 && pages[len(pages)-1] != 0 {
+			pages = append(pages, 0)
+		}
+	}
+	return pages
+}
@@ -14,6 +14,9 @@ type HTTPRequest struct {
 	URL    string
 	Header http.Header
 	Body   []byte
+	// TraceContext is the W3C trace context of the host's span for the
+	// request, for the plugin to continue.
+	TraceContext map[string]string
 }
 
 // HTTPResponse is the serializable structure that represents an HTTP response.
@@ -28,7 +31,25 @@ type HTTPPlugin interface {
 	ServeHTTP(req HTTPRequest) (HTTPResponse, error)
 	GetRoutes() ([]string, error)
 	GetMenuItems() ([]MenuItem, error)
-}
+	// GetOpenAPI returns the plugin's OpenAPI 3.1 document as JSON, with
+	// paths relative to the plugin's prefix, or nil if it serves no API.
+	GetOpenAPI() ([]byte, error)
+	// GetMetrics returns the plugin's own Prometheus metrics in the
+	// length-delimited protobuf exposition format, or nil if it has none.
+	// The host serves them on /metrics labelled with the plugin's name.
+	GetMetrics() ([]byte, error)
+	// GetSettingsSections returns the settings sections the plugin adds
+	// to the system settings, or nil if it has none.
+	GetSettingsSections() ([]SettingsSection, error)
+	// ApplySettings hands the plugin the values of every settings section.
+	// The host calls it when the plugin starts and after every change.
+	ApplySettings(Settings) error
+}
+
+// RouteHeader is the response header a plugin names the route pattern
+// that served a request in, such as "/api/common/ed-fi/students/{id}". The
+// host uses it as a metrics label and does not pass it on.
+const RouteHeader = "X-Oasis-Route"
 
 type MenuItem struct {
 	Label        string   `json:"label"`
@@ -41,7 +62,8 @@ type MenuItem struct {
 // Here is the RPC server that HTTPPluginRPC talks to, conforming to
 // the requirements of net/rpc.
 type HTTPPluginRPCServer struct {
-	Impl HTTPPlugin
+	Impl   HTTPPlugin
+	broker *plugin.MuxBroker
 }
 
 func (s *HTTPPluginRPCServer) ServeHTTP(req HTTPRequest, resp *HTTPResponse) error {
@@ -71,6 +93,52 @@ func (s *HTTPPluginRPCServer) GetMenuItems(args interface{}, resp *[]MenuItem) e
 	return nil
 }
 
+func (s *HTTPPluginRPCServer) GetOpenAPI(args interface{}, resp *[]byte) error {
+	doc, err := s.Impl.GetOpenAPI()
+	if err != nil {
+		return err
+	}
+	*resp = doc
+	return nil
+}
+
+func (s *HTTPPluginRPCServer) GetMetrics(args interface{}, resp *[]byte) error {
+	metrics, err := s.Impl.GetMetrics()
+	if err != nil {
+		return err
+	}
+	*resp = metrics
+	return nil
+}
+
+func (s *HTTPPluginRPCServer) GetSettingsSections(args interface{}, resp *[]SettingsSection) error {
+	sections, err := s.Impl.GetSettingsSections()
+	if err != nil {
+		return err
+	}
+	*resp = sections
+	return nil
+}
+
+func (s *HTTPPluginRPCServer) ApplySettings(settings Settings, resp *struct{}) error {
+	return s.Impl.ApplySettings(settings)
+}
+
+// SetHost connects to the HostServices the host serves on the broker
+// under id and hands them to Impl, if it is a HostReceiver.
+func (s *HTTPPluginRPCServer) SetHost(id uint32, resp *struct{}) error {
+	receiver, ok := s.Impl.(HostReceiver)
+	if !ok {
+		return nil
+	}
+	conn, err := s.broker.Dial(id)
+	if err != nil {
+		return err
+	}
+	receiver.SetHost(&HostServicesRPC{client: rpc.NewClient(conn)})
+	return nil
+}
+
 // Here is the RPC client that the host will use to talk to the plugin.
 type HTTPPluginRPC struct{ client *rpc.Client }
 
@@ -102,6 +170,37 @@ func (g *HTTPPluginRPC) GetMenuItems() ([]MenuItem, error) {
 	return resp, nil
 }
 
+func (g *HTTPPluginRPC) GetOpenAPI() ([]byte, error) {
+	var resp []byte
+	err := g.client.Call("Plugin.GetOpenAPI", new(interface{}), &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (g *HTTPPluginRPC) GetMetrics() ([]byte, error) {
+	var resp []byte
+	err := g.client.Call("Plugin.GetMetrics", new(interface{}), &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (g *HTTPPluginRPC) GetSettingsSections() ([]SettingsSection, error) {
+	var resp []SettingsSection
+	err := g.client.Call("Plugin.GetSettingsSections", new(interface{}), &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (g *HTTPPluginRPC) ApplySettings(settings Settings) error {
+	return g.client.Call("Plugin.ApplySettings", settings, new(struct{}))
+}
+
 // Handshake is a common handshake that is shared by plugin and host.
 var Handshake = plugin.HandshakeConfig{
 	ProtocolVersion:  1,
@@ -114,14 +213,22 @@ var PluginMap = map[string]plugin.Plugin{
 	"http_plugin": &HTTPPluginAdapter{},
 }
 
+// HTTPPluginAdapter serves Impl on the plugin side. On the host side, a
+// non-nil Host is offered to the plugin when it is dispensed.
 type HTTPPluginAdapter struct {
 	Impl HTTPPlugin
+	Host HostServices
 }
 
-func (p *HTTPPluginAdapter) Server(*plugin.MuxBroker) (interface{}, error) {
-	return &HTTPPluginRPCServer{Impl: p.Impl}, nil
+func (p *HTTPPluginAdapter) Server(b *plugin.MuxBroker) (interface{}, error) {
+	return &HTTPPluginRPCServer{Impl: p.Impl, broker: b}, nil
 }
 
 func (p *HTTPPluginAdapter) Client(b *plugin.MuxBroker, c *rpc.Client) (interface{}, error) {
+	if p.Host != nil {
+		if err := serveHost(b, c, p.Host); err != nil {
+			return nil, err
+		}
+	}
 	return &HTTPPluginRPC{client: c}, nil
 }
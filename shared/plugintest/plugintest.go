@@ -0,0 +1,294 @@
+// Package plugintest runs a plugin behind a fake host for end-to-end
+// tests. The plugin is served over go-plugin's RPC transport, either in the
+// test process or as a real subprocess, and requests are sent to it as a
+// chosen user the way the host's router would: with the identity headers
+// set, a request ID assigned and menu items authorized by role.
+//
+//	func TestHealth(t *testing.T) {
+//		host := plugintest.Start(t, plugintest.Options{Prefix: "api/admin"}, New)
+//		resp := host.As(plugintest.User{Roles: []string{"admin"}}).Get("/api/admin/health")
+//		if resp.StatusCode != http.StatusOK { ... }
+//	}
+package plugintest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	oerrors "github.com/catdevman/oasis/internal/errors"
+	"github.com/catdevman/oasis/internal/logging"
+	"github.com/catdevman/oasis/shared"
+	"github.com/catdevman/oasis/shared/sdk"
+	"github.com/hashicorp/go-plugin"
+)
+
+// Options configure the plugin as plugins.yaml would.
+type Options struct {
+	Name   string // OASIS_PLUGIN_NAME; defaults to "test-plugin"
+	Prefix string // OASIS_PLUGIN_PREFIX, without slashes
+	// LogLevel is the OASIS_LOG_LEVEL of a plugin run by Exec, whose log
+	// lines are written to the test log; it defaults to info.
+	LogLevel string
+	// Env is extra environment for the plugin. In-process plugins see it
+	// through os.Getenv for the duration of the test.
+	Env map[string]string
+	// Host, if set, is offered to the plugin as the host's services.
+	Host shared.HostServices
+}
+
+func (o Options) environ() map[string]string {
+	env := map[string]string{
+		"OASIS_PLUGIN_NAME":   o.Name,
+		"OASIS_PLUGIN_PREFIX": o.Prefix,
+		"OASIS_LOG_LEVEL":     o.LogLevel,
+	}
+	if env["OASIS_PLUGIN_NAME"] == "" {
+		env["OASIS_PLUGIN_NAME"] = "test-plugin"
+	}
+	for k, v := range o.Env {
+		env[k] = v
+	}
+	return env
+}
+
+// Host is a fake host serving one plugin.
+type Host struct {
+	t      testing.TB
+	Plugin shared.HTTPPlugin // the plugin as seen through RPC
+	Prefix string
+	Routes []string          // top-level routes the plugin claimed
+	Menu   []shared.MenuItem // the plugin's menu items
+}
+
+// Start builds a plugin with newPlugin, after setting the environment
+// described by opts, and serves it in the test process over RPC. The
+// plugin is shut down when the test ends.
+func Start[P shared.HTTPPlugin](t testing.TB, opts Options, newPlugin func() P) *Host {
+	t.Helper()
+	for k, v := range opts.environ() {
+		t.Setenv(k, v)
+	}
+	impl := newPlugin()
+	if s, ok := any(impl).(interface{ Shutdown() }); ok {
+		t.Cleanup(s.Shutdown)
+	}
+
+	client, _ := plugin.TestPluginRPCConn(t, map[string]plugin.Plugin{
+		"http_plugin": &shared.HTTPPluginAdapter{Impl: impl, Host: opts.Host},
+	}, nil)
+	t.Cleanup(func() { client.Close() })
+	return connect(t, opts, client)
+}
+
+// Exec runs the plugin binary at path as a subprocess, as the host does,
+// and connects to it. The process is stopped when the test ends.
+func Exec(t testing.TB, path string, opts Options) *Host {
+	t.Helper()
+	level, err := logging.ParseLevel(opts.LogLevel)
+	if err != nil {
+		t.Fatalf("plugintest: %v", err)
+	}
+	env := opts.environ()
+	cmd := exec.Command(path)
+	cmd.Env = os.Environ()
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	pc := plugin.NewClient(&plugin.ClientConfig{
+		HandshakeConfig: shared.Handshake,
+		Plugins:         map[string]plugin.Plugin{"http_plugin": &shared.HTTPPluginAdapter{Host: opts.Host}},
+		Cmd:             cmd,
+		Logger:          logging.HCLog(logging.NewHandler(testWriter{t}), level).With("plugin", env["OASIS_PLUGIN_NAME"]),
+	})
+	t.Cleanup(pc.Kill)
+	client, err := pc.Client()
+	if err != nil {
+		t.Fatalf("plugintest: starting %s: %v", path, err)
+	}
+	return connect(t, opts, client)
+}
+
+// Build compiles the plugin package at dir into a temporary binary for
+// Exec, e.g. Build(t, ".") from the plugin's own tests.
+func Build(t testing.TB, dir string) string {
+	t.Helper()
+	bin := filepath.Join(t.TempDir(), "plugin")
+	cmd := exec.Command("go", "build", "-o", bin, ".")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("plugintest: building %s: %v\n%s", dir, err, out)
+	}
+	return bin
+}
+
+// testWriter writes log lines to the test log.
+type testWriter struct{ t testing.TB }
+
+func (w testWriter) Write(p []byte) (int, error) {
+	w.t.Log(strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
+
+func connect(t testing.TB, opts Options, client plugin.ClientProtocol) *Host {
+	t.Helper()
+	raw, err := client.Dispense("http_plugin")
+	if err != nil {
+		t.Fatalf("plugintest: dispensing plugin: %v", err)
+	}
+	h := &Host{t: t, Plugin: raw.(shared.HTTPPlugin), Prefix: opts.Prefix}
+	if h.Routes, err = h.Plugin.GetRoutes(); err != nil {
+		t.Fatalf("plugintest: GetRoutes: %v", err)
+	}
+	if h.Menu, err = h.Plugin.GetMenuItems(); err != nil {
+		t.Fatalf("plugintest: GetMenuItems: %v", err)
+	}
+	return h
+}
+
+// User is who a request is sent as. The zero User is an anonymous caller
+// with no roles.
+type User struct {
+	ID    string
+	Roles []string
+}
+
+// Client sends requests to the plugin as one user.
+type Client struct {
+	host   *Host
+	user   User
+	header http.Header
+}
+
+// As returns a client that sends requests as u.
+func (h *Host) As(u User) *Client {
+	return &Client{host: h, user: u}
+}
+
+// With returns a copy of c that also sends the header name: value, such as
+// If-Match.
+func (c *Client) With(name, value string) *Client {
+	header := c.header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set(name, value)
+	return &Client{host: c.host, user: c.user, header: header}
+}
+
+func (c *Client) Get(path string) *http.Response {
+	return c.Do(http.MethodGet, path, "", nil)
+}
+
+func (c *Client) Post(path, contentType string, body []byte) *http.Response {
+	return c.Do(http.MethodPost, path, contentType, body)
+}
+
+// Do sends a request through the fake host and returns the plugin's
+// response. The identity headers are set for the chosen user directly;
+// the host's own stripping and setting of them is tested through its
+// router. Like the router, the host answers 404 for paths the plugin has
+// not claimed and 403 for menu pages the user's roles may not view. An RPC
+// failure fails the test.
+func (c *Client) Do(method, path, contentType string, body []byte) *http.Response {
+	c.host.t.Helper()
+	r, err := http.NewRequest(method, path, bytes.NewReader(body))
+	if err != nil {
+		c.host.t.Fatalf("plugintest: %v", err)
+	}
+	for name, values := range c.header {
+		r.Header[name] = values
+	}
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	r.Header.Set(sdk.RequestIDHeader, oerrors.NewRequestID())
+	if c.user.ID != "" {
+		r.Header.Set(sdk.UserIDHeader, c.user.ID)
+	}
+	if len(c.user.Roles) > 0 {
+		r.Header.Set(sdk.RolesHeader, strings.Join(c.user.Roles, ","))
+		r.Header.Set(sdk.RoleHeader, c.user.Roles[0])
+	}
+
+	if problem := c.host.route(r); problem != nil {
+		return problem
+	}
+	resp, err := c.host.Plugin.ServeHTTP(shared.HTTPRequest{
+		Method: method, URL: r.URL.String(), Header: r.Header, Body: body,
+	})
+	if err != nil {
+		c.host.t.Fatalf("plugintest: %s %s: %v", method, path, err)
+	}
+	resp.Header.Del(shared.RouteHeader)
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode)),
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       io.NopCloser(bytes.NewReader(resp.Body)),
+		Request:    r,
+	}
+}
+
+// route applies the router's checks to r, returning the host's response
+// when it would not reach the plugin: menu pages are authorized first,
+// then the path must fall under the plugin's prefix or a claimed route.
+func (h *Host) route(r *http.Request) *http.Response {
+	path := strings.Trim(r.URL.Path, "/")
+	for _, item := range h.Menu {
+		if "/"+path != item.Path && !strings.HasPrefix("/"+path, item.Path+"/") {
+			continue
+		}
+		if !menuAllows(item, sdk.IdentityFrom(r)) {
+			return h.problem(r, oerrors.New("router", oerrors.KindForbidden, "", "your role may not view this page"))
+		}
+		break
+	}
+	claimed := h.Prefix != "" && strings.HasPrefix(path, h.Prefix)
+	for _, route := range h.Routes {
+		claimed = claimed || strings.HasPrefix(path, strings.TrimPrefix(route, "/"))
+	}
+	if !claimed {
+		return h.problem(r, oerrors.New("router", oerrors.KindNotFound, "", "no plugin is registered for this path"))
+	}
+	return nil
+}
+
+func menuAllows(item shared.MenuItem, id sdk.Identity) bool {
+	for _, allowed := range item.AllowedRoles {
+		if allowed == "*" || id.HasRole(allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Host) problem(r *http.Request, err error) *http.Response {
+	rec := &recorder{header: http.Header{}}
+	oerrors.Write(rec, r, err)
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", rec.status, http.StatusText(rec.status)),
+		StatusCode: rec.status,
+		Header:     rec.header,
+		Body:       io.NopCloser(&rec.body),
+		Request:    r,
+	}
+}
+
+// recorder is the minimal http.ResponseWriter the fake host writes its
+// own responses to.
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *recorder) Header() http.Header         { return w.header }
+func (w *recorder) Write(b []byte) (int, error) { return w.body.Write(b) }
+func (w *recorder) WriteHeader(status int)      { w.status = status }
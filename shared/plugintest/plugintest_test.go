@@ -0,0 +1,114 @@
+package plugintest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	oerrors "github.com/catdevman/oasis/internal/errors"
+	"github.com/catdevman/oasis/shared"
+	"github.com/catdevman/oasis/shared/sdk"
+)
+
+func newExample() *sdk.Plugin {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /"+sdk.Prefix("api/example")+"/whoami", func(w http.ResponseWriter, r *http.Request) {
+		id := sdk.IdentityFrom(r)
+		w.Header().Set("X-Request", id.RequestID)
+		w.Header().Set("X-If-Match", r.Header.Get("If-Match"))
+		io.WriteString(w, id.UserID)
+	})
+	mux.HandleFunc("GET /reports", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "reports")
+	})
+	return &sdk.Plugin{
+		Handler: mux,
+		Routes:  []string{"/reports"},
+		Menu:    []shared.MenuItem{{Label: "Reports", Path: "/reports", AllowedRoles: []string{"admin"}}},
+	}
+}
+
+func TestHost(t *testing.T) {
+	host := Start(t, Options{Prefix: "api/example"}, newExample)
+	admin := host.As(User{ID: "u-1", Roles: []string{"teacher", "admin"}})
+	teacher := host.As(User{ID: "u-2", Roles: []string{"teacher"}})
+
+	tests := []struct {
+		name   string
+		client *Client
+		path   string
+		status int
+		body   string
+	}{
+		{"identity forwarded", teacher, "/api/example/whoami", http.StatusOK, "u-2"},
+		{"menu allowed", admin, "/reports", http.StatusOK, "reports"},
+		{"menu forbidden", teacher, "/reports", http.StatusForbidden, ""},
+		{"unclaimed path", admin, "/elsewhere", http.StatusNotFound, ""},
+		{"plugin 404", admin, "/api/example/missing", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := tt.client.Get(tt.path)
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("GET %s = %d %s, want %d", tt.path, resp.StatusCode, body, tt.status)
+			}
+			if tt.body != "" && string(body) != tt.body {
+				t.Errorf("GET %s body = %q, want %q", tt.path, body, tt.body)
+			}
+		})
+	}
+
+	resp := teacher.Get("/reports")
+	if ct := resp.Header.Get("Content-Type"); ct != oerrors.ContentType {
+		t.Errorf("host 403 Content-Type = %q, want %q", ct, oerrors.ContentType)
+	}
+	if resp := teacher.Get("/api/example/whoami"); resp.Header.Get("X-Request") == "" {
+		t.Error("plugin saw no request ID")
+	}
+	if resp := teacher.With("If-Match", "*").Get("/api/example/whoami"); resp.Header.Get("X-If-Match") != "*" {
+		t.Errorf("plugin saw If-Match %q, want *", resp.Header.Get("X-If-Match"))
+	}
+	if resp := teacher.Get("/api/example/whoami"); resp.Header.Get("X-If-Match") != "" {
+		t.Error("With changed the client it was called on")
+	}
+}
+
+func TestExec(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a plugin binary")
+	}
+	// The admin plugin reports the health it gets back from the host's
+	// services, across the process boundary.
+	host := Exec(t, Build(t, "../../plugin/admin"), Options{Name: "admin-plugin", Prefix: "api/admin", LogLevel: "debug",
+		Host: healthyHost{}})
+	resp := host.As(User{Roles: []string{"admin"}}).Get("/api/admin/health")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /api/admin/health = %d, want 200", resp.StatusCode)
+	}
+	var health shared.SystemHealth
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil || health.Status != shared.StatusHealthy {
+		t.Errorf("health = %+v, %v; want the host's", health, err)
+	}
+}
+
+type healthyHost struct{}
+
+func (healthyHost) Health() (shared.SystemHealth, error) {
+	return shared.SystemHealth{Status: shared.StatusHealthy}, nil
+}
+
+func (healthyHost) Settings() (shared.SettingsDocument, error) { return shared.SettingsDocument{}, nil }
+
+func (healthyHost) UpdateSettings(shared.SettingsUpdate) ([]shared.FieldError, error) {
+	return nil, nil
+}
+
+func (healthyHost) Flags() ([]shared.FeatureFlag, error) { return nil, nil }
+
+func (healthyHost) UpdateFlag(shared.FlagUpdate) ([]shared.FieldError, error) { return nil, nil }
+
+func (healthyHost) EvaluateFlag(shared.FlagEvaluation) (shared.FlagResult, error) {
+	return shared.FlagResult{}, nil
+}
@@ -0,0 +1,27 @@
+package shared
+
+import (
+	"net/http"
+
+	oerrors "github.com/catdevman/oasis/internal/errors"
+)
+
+// Problem and FieldError are the RFC 9457 problem details every Oasis API
+// error is reported as, for plugins that build or decode them.
+type (
+	Problem    = oerrors.Problem
+	FieldError = oerrors.FieldError
+)
+
+// WriteError writes err as application/problem+json. Wrap a cause in an
+// internal/errors OasisError to choose its status, code and client-facing
+// detail; any other error is a 500 whose cause is logged, not returned.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	oerrors.Write(w, r, err)
+}
+
+// WriteProblem writes a problem with the given status, code and detail,
+// stamped with the request's correlation ID.
+func WriteProblem(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	oerrors.WriteProblem(w, r, oerrors.NewProblem(status, code, detail))
+}
@@ -0,0 +1,29 @@
+package sdk
+
+import (
+	"net/http"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// Client is an HTTP client for calls a plugin makes while serving a
+// request, such as a UI plugin fetching from the host's API. Requests made
+// with the serving request's context carry its trace context, so the host
+// continues the same trace.
+var Client = &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
+
+// CSRFHeader carries the CSRF token of the page that sent a request. The
+// host refuses requests with cookies and an unsafe method without it, so a
+// plugin that calls the host's APIs with its caller's cookies forwards it.
+const CSRFHeader = "X-CSRF-Token"
+
+// HostURL is where the plugin calls the host's APIs, from OASIS_HOST_URL,
+// without a trailing slash.
+func HostURL() string {
+	if u := os.Getenv("OASIS_HOST_URL"); u != "" {
+		return strings.TrimSuffix(u, "/")
+	}
+	return "http://127.0.0.1:8080"
+}
@@ -0,0 +1,46 @@
+package sdk
+
+import (
+	"database/sql"
+	"sync"
+
+	"github.com/catdevman/oasis/shared"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+var database struct {
+	mu    sync.Mutex
+	db    *sql.DB
+	stats prometheus.Collector
+}
+
+// DB returns the plugin's database connection, opening it with
+// shared.OpenDatabase on first use. A failed open is retried by the next
+// call. Its pool statistics are published as go_sql_* metrics, and it is
+// closed when the plugin shuts down.
+func DB() (*sql.DB, error) {
+	database.mu.Lock()
+	defer database.mu.Unlock()
+	if database.db != nil {
+		return database.db, nil
+	}
+	db, err := shared.OpenDatabase()
+	if err != nil {
+		return nil, err
+	}
+	database.db = db
+	database.stats = collectors.NewDBStatsCollector(db, "oasis")
+	registry.MustRegister(database.stats)
+	return db, nil
+}
+
+func closeDB() {
+	database.mu.Lock()
+	defer database.mu.Unlock()
+	if database.db != nil {
+		registry.Unregister(database.stats)
+		database.db.Close()
+		database.db = nil
+	}
+}
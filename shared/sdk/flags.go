@@ -0,0 +1,62 @@
+package sdk
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/catdevman/oasis/shared"
+)
+
+// Flags are the feature flags of one request's caller. The host evaluates
+// each flag, and records the evaluation, the first time it is asked for.
+// Hand a Flags to a template to guard markup with a flag:
+//
+//	{{if .Flags.Enabled "new-gradebook"}} ... {{end}}
+type Flags struct {
+	r       *http.Request
+	subject shared.FlagSubject
+
+	mu      sync.Mutex
+	results map[string]bool
+}
+
+// FlagsFor returns the flags of r's caller at edOrgs, the education
+// organizations the request concerns, such as the school a page shows.
+func FlagsFor(r *http.Request, edOrgs ...string) *Flags {
+	id := IdentityFrom(r)
+	return &Flags{
+		r:       r,
+		subject: shared.FlagSubject{UserID: id.UserID, Roles: id.Roles, EdOrgs: edOrgs},
+		results: map[string]bool{},
+	}
+}
+
+// Enabled reports whether the flag key is on. Flags are off when the
+// plugin is not connected to a host or the host cannot evaluate them.
+func (f *Flags) Enabled(key string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if on, ok := f.results[key]; ok {
+		return on
+	}
+	host := Host()
+	if host == nil {
+		return false
+	}
+	result, err := host.EvaluateFlag(shared.FlagEvaluation{
+		Key:       key,
+		Subject:   f.subject,
+		RequestID: f.r.Header.Get(RequestIDHeader),
+	})
+	if err != nil {
+		Logger(f.r).Warn("evaluating feature flag", "flag", key, "error", err)
+		return false
+	}
+	f.results[key] = result.Enabled
+	return result.Enabled
+}
+
+// FlagEnabled reports whether the flag key is on for r's caller at edOrgs.
+func FlagEnabled(r *http.Request, key string, edOrgs ...string) bool {
+	return FlagsFor(r, edOrgs...).Enabled(key)
+}
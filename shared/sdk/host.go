@@ -0,0 +1,28 @@
+package sdk
+
+import (
+	"sync"
+
+	"github.com/catdevman/oasis/shared"
+)
+
+var host struct {
+	mu       sync.Mutex
+	services shared.HostServices
+}
+
+// Host returns the services the host offers plugins, or nil when the
+// plugin is not connected to a host that offers them.
+func Host() shared.HostServices {
+	host.mu.Lock()
+	defer host.mu.Unlock()
+	return host.services
+}
+
+// SetHost implements shared.HostReceiver. The host calls it each time it
+// connects to the plugin.
+func (p *Plugin) SetHost(h shared.HostServices) {
+	host.mu.Lock()
+	defer host.mu.Unlock()
+	host.services = h
+}
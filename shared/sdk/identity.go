@@ -0,0 +1,74 @@
+package sdk
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/catdevman/oasis/shared"
+)
+
+// The identity headers the host forwards with every request.
+const (
+	UserIDHeader    = "X-Oasis-User-ID"
+	RolesHeader     = "X-Oasis-User-Roles" // comma-separated
+	RoleHeader      = "X-User-Role"        // the single role the development router sends
+	RequestIDHeader = "X-Request-ID"
+)
+
+// Identity is the caller of a request, as authenticated by the host.
+type Identity struct {
+	UserID    string
+	Roles     []string
+	RequestID string
+}
+
+// IdentityFrom reads the identity headers of r. RolesHeader takes
+// precedence over RoleHeader.
+func IdentityFrom(r *http.Request) Identity {
+	roles := r.Header.Get(RolesHeader)
+	if roles == "" {
+		roles = r.Header.Get(RoleHeader)
+	}
+	id := Identity{
+		UserID:    r.Header.Get(UserIDHeader),
+		RequestID: r.Header.Get(RequestIDHeader),
+	}
+	for _, role := range strings.Split(roles, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			id.Roles = append(id.Roles, role)
+		}
+	}
+	return id
+}
+
+// HasRole reports whether id holds any of roles.
+func (id Identity) HasRole(roles ...string) bool {
+	for _, held := range id.Roles {
+		for _, r := range roles {
+			if held == r {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Name is how id is recorded in audit logs: the user ID, or the roles
+// when the host sent no user ID.
+func (id Identity) Name() string {
+	if id.UserID == "" && len(id.Roles) > 0 {
+		return "role:" + strings.Join(id.Roles, ",")
+	}
+	return id.UserID
+}
+
+// RequireRole wraps next so that callers holding none of roles get a 403.
+func RequireRole(next http.Handler, roles ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !IdentityFrom(r).HasRole(roles...) {
+			shared.WriteProblem(w, r, http.StatusForbidden, "FORBIDDEN", "your role may not perform this operation")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,75 @@
+package sdk
+
+import (
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/catdevman/oasis/internal/logging"
+	"github.com/catdevman/oasis/internal/tracing"
+	"github.com/catdevman/oasis/shared"
+	"github.com/hashicorp/go-hclog"
+)
+
+// A plugin started by the host logs from the start, before main builds its
+// Plugin: the default slog logger and the standard log package write JSON
+// lines to stderr at OASIS_LOG_LEVEL for the host to collect.
+func init() {
+	if os.Getenv(shared.Handshake.MagicCookieKey) == shared.Handshake.MagicCookieValue {
+		logHandler()
+	}
+}
+
+// logHandler installs the plugin's log handler as the slog default on
+// first use and returns it.
+var logHandler = sync.OnceValue(func() slog.Handler {
+	level, err := logging.ParseLevel(os.Getenv("OASIS_LOG_LEVEL"))
+	h := newLogHandler(os.Stderr, level)
+	slog.SetDefault(slog.New(h))
+	// Standard log lines tagged [DEBUG], [ERR] and so on, as go-plugin
+	// writes them, keep their level.
+	log.SetFlags(0)
+	log.SetOutput(logging.HCLog(h, logging.LevelTrace).StandardWriter(&hclog.StandardLoggerOptions{InferLevels: true}))
+	if err != nil {
+		slog.Warn("ignoring OASIS_LOG_LEVEL", "error", err)
+	}
+	return h
+})
+
+// hclogTimeFormat is the timestamp layout go-plugin parses from hclog
+// lines on a plugin's stderr.
+const hclogTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// newLogHandler writes JSON records with hclog's @timestamp, @level and
+// @message keys, the form go-plugin parses from a plugin's stderr, so the
+// host relogs each line at its own level with its attributes intact.
+func newLogHandler(w io.Writer, level slog.Leveler) slog.Handler {
+	return slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) > 0 {
+				return a
+			}
+			switch a.Key {
+			case slog.TimeKey:
+				return slog.String("@timestamp", a.Value.Time().Format(hclogTimeFormat))
+			case slog.LevelKey:
+				return slog.String("@level", logging.LevelName(a.Value.Any().(slog.Level)))
+			case slog.MessageKey:
+				return slog.String("@message", a.Value.String())
+			}
+			return a
+		},
+	})
+}
+
+// Logger returns the default logger tagged with the request and trace IDs
+// of r, so the plugin's lines for a request can be found from the host's
+// and from its trace.
+func Logger(r *http.Request) *slog.Logger {
+	return slog.Default().With("request_id", r.Header.Get(RequestIDHeader),
+		"trace_id", tracing.TraceID(r.Context()))
+}
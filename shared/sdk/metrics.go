@@ -0,0 +1,33 @@
+package sdk
+
+import (
+	"github.com/catdevman/oasis/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// registry holds the plugin's own metrics: the Go runtime and process
+// collectors, the database pool and whatever the plugin registers.
+var registry = func() *prometheus.Registry {
+	r := prometheus.NewRegistry()
+	r.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	return r
+}()
+
+// Metrics returns the registry a plugin registers its own Prometheus
+// collectors with. The host serves them on its /metrics endpoint with a
+// plugin label, so collectors should not add one.
+//
+//	var imports = prometheus.NewCounter(prometheus.CounterOpts{
+//		Name: "oasis_sis_imports_total", Help: "SIS imports run.",
+//	})
+//
+//	func init() { sdk.Metrics().MustRegister(imports) }
+func Metrics() prometheus.Registerer {
+	return registry
+}
+
+// GetMetrics returns the plugin's metrics for the host.
+func (p *Plugin) GetMetrics() ([]byte, error) {
+	return metrics.Encode(registry)
+}
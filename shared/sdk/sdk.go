@@ -0,0 +1,206 @@
+// Package sdk turns an http.Handler into an Oasis plugin process. A plugin
+// describes itself with a Plugin and calls Serve from main; the SDK adapts
+// the host's RPC calls to the handler, opens the database on demand and
+// shuts the process down cleanly when the host stops it.
+//
+//	func main() {
+//		mux := http.NewServeMux()
+//		mux.HandleFunc("GET /"+sdk.Prefix("api/example")+"/hello", hello)
+//		sdk.Serve(&sdk.Plugin{Handler: mux})
+//	}
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/catdevman/oasis/internal/logging"
+	"github.com/catdevman/oasis/internal/tracing"
+	"github.com/catdevman/oasis/shared"
+	"github.com/hashicorp/go-plugin"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Plugin is everything the host asks a plugin for. It implements
+// shared.HTTPPlugin.
+type Plugin struct {
+	// Name identifies the plugin. It defaults to the OASIS_PLUGIN_NAME the
+	// host starts the plugin with, and the host tags the plugin's log lines
+	// with it.
+	Name string
+	// Handler serves every request routed to the plugin. Requests keep
+	// their full path, prefix included.
+	Handler http.Handler
+	// Routes are top-level paths the plugin claims outside its prefix,
+	// such as UI pages.
+	Routes []string
+	// Menu lists the navigation entries the host shows to allowed roles.
+	Menu []shared.MenuItem
+	// OpenAPI is the plugin's OpenAPI 3.1 document, with paths relative to
+	// its prefix, or nil if it serves no API.
+	OpenAPI []byte
+	// Settings are sections the plugin adds to the system settings, for
+	// administrators to edit. Read their values with CurrentSettings.
+	Settings []shared.SettingsSection
+	// OnSettings, if set, is called with the values of every settings
+	// section each time the host pushes them: when it connects to the
+	// plugin and after every change.
+	OnSettings func(shared.Settings)
+	// OnShutdown, if set, runs once when the plugin is stopped, before the
+	// database connection is closed.
+	OnShutdown func()
+
+	shutdown    sync.Once
+	flushTraces func(context.Context) error
+}
+
+// ServeHTTP runs a request forwarded by the host through Handler, in a
+// span continuing the host's trace. The request's context carries the
+// span, so queries made with it join the trace.
+func (p *Plugin) ServeHTTP(req shared.HTTPRequest) (shared.HTTPResponse, error) {
+	ctx, span := tracing.Tracer().Start(tracing.Extract(context.Background(), req.TraceContext),
+		req.Method, trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+	r, err := http.NewRequestWithContext(ctx, req.Method, req.URL, bytes.NewReader(req.Body))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return shared.HTTPResponse{}, err
+	}
+	if req.Header != nil {
+		r.Header = req.Header
+	}
+
+	start := time.Now()
+	resp := p.serve(r).Result()
+	route := r.Pattern
+	if _, path, ok := strings.Cut(route, " "); ok {
+		route = path
+	}
+	if route != "" {
+		resp.Header.Set(shared.RouteHeader, route)
+		span.SetName(r.Method + " " + route)
+		span.SetAttributes(semconv.HTTPRoute(route))
+	}
+	span.SetAttributes(semconv.HTTPRequestMethodKey.String(r.Method),
+		semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if resp.StatusCode >= 500 {
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+	}
+	Logger(r).Debug("handled request", "method", r.Method, "path", r.URL.Path,
+		"status", resp.StatusCode, "duration", time.Since(start))
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return shared.HTTPResponse{}, err
+	}
+	return shared.HTTPResponse{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       body,
+	}, nil
+}
+
+// serve runs r through Handler. A handler that panics is answered with a
+// 500 problem in place of anything it wrote, and the panic logged, so one
+// bad request cannot take the plugin process down.
+func (p *Plugin) serve(r *http.Request) (w *httptest.ResponseRecorder) {
+	w = httptest.NewRecorder()
+	defer func() {
+		if v := recover(); v != nil {
+			w = httptest.NewRecorder()
+			shared.WriteError(w, r, fmt.Errorf("handler panicked: %v\n%s", v, debug.Stack()))
+		}
+	}()
+	p.Handler.ServeHTTP(w, r)
+	return w
+}
+
+func (p *Plugin) GetRoutes() ([]string, error)             { return p.Routes, nil }
+func (p *Plugin) GetMenuItems() ([]shared.MenuItem, error) { return p.Menu, nil }
+func (p *Plugin) GetOpenAPI() ([]byte, error)              { return p.OpenAPI, nil }
+
+// Shutdown runs OnShutdown, closes the database and flushes buffered
+// spans. Only the first call has any effect; Serve calls it when the
+// plugin is stopped.
+func (p *Plugin) Shutdown() {
+	p.shutdown.Do(func() {
+		if p.OnShutdown != nil {
+			p.OnShutdown()
+		}
+		closeDB()
+		if p.flushTraces != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := p.flushTraces(ctx); err != nil {
+				slog.Warn("flushing traces", "error", err)
+			}
+		}
+	})
+}
+
+// ServeConfig is the go-plugin configuration Serve uses, for harnesses
+// that serve the plugin themselves.
+func (p *Plugin) ServeConfig() *plugin.ServeConfig {
+	return &plugin.ServeConfig{
+		HandshakeConfig: shared.Handshake,
+		Plugins: map[string]plugin.Plugin{
+			"http_plugin": &shared.HTTPPluginAdapter{Impl: p},
+		},
+	}
+}
+
+// Serve runs p as a plugin process until the host stops it, either over
+// RPC or with SIGTERM, then shuts it down and exits.
+func Serve(p *Plugin) {
+	handler := logHandler()
+	if p.Name == "" {
+		p.Name = os.Getenv("OASIS_PLUGIN_NAME")
+	}
+	if p.Handler == nil {
+		p.Handler = http.NotFoundHandler()
+	}
+	cfg, err := tracing.FromEnv()
+	if err == nil {
+		p.flushTraces, err = tracing.Setup(p.Name, cfg)
+	}
+	if err != nil {
+		slog.Warn("tracing disabled", "error", err)
+	}
+
+	// go-plugin ignores SIGINT, which the terminal sends to the whole
+	// process group, and leaves SIGTERM fatal; catch it to close cleanly.
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM)
+	go func() {
+		<-sig
+		p.Shutdown()
+		os.Exit(0)
+	}()
+
+	config := p.ServeConfig()
+	config.Logger = logging.HCLog(handler, logging.LevelTrace)
+	plugin.Serve(config)
+	p.Shutdown()
+}
+
+// Prefix returns the URL prefix the host routes to the plugin, without
+// slashes, or def when the plugin runs outside a host.
+func Prefix(def string) string {
+	if prefix := os.Getenv("OASIS_PLUGIN_PREFIX"); prefix != "" {
+		return prefix
+	}
+	return def
+}
@@ -0,0 +1,220 @@
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/catdevman/oasis/internal/metrics"
+	"github.com/catdevman/oasis/internal/tracing"
+	"github.com/catdevman/oasis/shared"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestIdentityFrom(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    []string
+	}{
+		{"roles header", map[string]string{RolesHeader: "administrator, teacher"}, []string{"administrator", "teacher"}},
+		{"roles win over role", map[string]string{RolesHeader: "teacher", RoleHeader: "admin"}, []string{"teacher"}},
+		{"development role", map[string]string{RoleHeader: "admin"}, []string{"admin"}},
+		{"none", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			id := IdentityFrom(r)
+			if len(id.Roles) != len(tt.want) {
+				t.Fatalf("Roles = %q, want %q", id.Roles, tt.want)
+			}
+			for i := range tt.want {
+				if id.Roles[i] != tt.want[i] || !id.HasRole(tt.want[i]) {
+					t.Errorf("Roles = %q, want %q", id.Roles, tt.want)
+				}
+			}
+			if id.HasRole("guardian") {
+				t.Error("HasRole(guardian) = true for a caller without it")
+			}
+		})
+	}
+}
+
+func TestPluginServeHTTP(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/example/echo", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-User", IdentityFrom(r).UserID)
+		w.WriteHeader(http.StatusCreated)
+		w.Write(body)
+	})
+	mux.Handle("GET /api/example/admin", RequireRole(http.NotFoundHandler(), "admin"))
+	p := &Plugin{Handler: mux}
+
+	header := http.Header{}
+	header.Set(UserIDHeader, "u-1")
+	resp, err := p.ServeHTTP(shared.HTTPRequest{
+		Method: http.MethodPost,
+		URL:    "/api/example/echo?x=1",
+		Header: header,
+		Body:   []byte("hello"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusCreated || string(resp.Body) != "hello" || resp.Header.Get("X-User") != "u-1" {
+		t.Errorf("echo = %d %q %v, want 201 \"hello\" with X-User u-1", resp.StatusCode, resp.Body, resp.Header)
+	}
+	if route := resp.Header.Get(shared.RouteHeader); route != "/api/example/echo" {
+		t.Errorf("%s = %q, want the matched pattern", shared.RouteHeader, route)
+	}
+
+	resp, err = p.ServeHTTP(shared.HTTPRequest{Method: http.MethodGet, URL: "/api/example/admin",
+		Header: http.Header{"X-User-Role": {"teacher"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("RequireRole answered %d to a teacher, want 403", resp.StatusCode)
+	}
+
+	mux.HandleFunc("GET /api/example/panic", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Partial", "yes")
+		var job *struct{ CreatedBy string }
+		io.WriteString(w, job.CreatedBy)
+	})
+	resp, err = p.ServeHTTP(shared.HTTPRequest{Method: http.MethodGet, URL: "/api/example/panic"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusInternalServerError || resp.Header.Get("Content-Type") != "application/problem+json" || resp.Header.Get("X-Partial") != "" {
+		t.Errorf("a panicking handler answered %d %v, want a bare 500 problem", resp.StatusCode, resp.Header)
+	}
+}
+
+func TestLogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(newLogHandler(&buf, slog.LevelInfo))
+	logger.Debug("hidden")
+	logger.Warn("slow query", "table", "edfi_student")
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("log output %q is not one JSON line: %v", buf.String(), err)
+	}
+	if line["@level"] != "warn" || line["@message"] != "slow query" || line["table"] != "edfi_student" {
+		t.Errorf("line = %v, want hclog keys with the table attribute", line)
+	}
+	if _, err := time.Parse(hclogTimeFormat, fmt.Sprint(line["@timestamp"])); err != nil {
+		t.Errorf("@timestamp: %v", err)
+	}
+}
+
+func TestGetMetrics(t *testing.T) {
+	raw, err := (&Plugin{}).GetMetrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	families, err := metrics.Decode(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		if f.GetName() == "go_goroutines" {
+			return
+		}
+	}
+	t.Errorf("GetMetrics returned %d families without go_goroutines", len(families))
+}
+
+func TestPluginServeHTTPTrace(t *testing.T) {
+	if _, err := tracing.Setup("test", tracing.Config{}); err != nil {
+		t.Fatal(err)
+	}
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	var handlerTrace string
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/example/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlerTrace = tracing.TraceID(r.Context())
+	})
+	p := &Plugin{Handler: mux}
+
+	ctx, host := tracing.Tracer().Start(context.Background(), "host")
+	defer host.End()
+	if _, err := p.ServeHTTP(shared.HTTPRequest{Method: http.MethodGet, URL: "/api/example/items/7",
+		TraceContext: tracing.Inject(ctx)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := host.SpanContext().TraceID().String(); handlerTrace != want {
+		t.Errorf("handler's trace = %q, want the host's %q", handlerTrace, want)
+	}
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("ended %d spans, want 1", len(spans))
+	}
+	if s := spans[0]; s.Name() != "GET /api/example/items/{id}" || s.Parent().SpanID() != host.SpanContext().SpanID() {
+		t.Errorf("span %q with parent %s, want the route as a child of the host span", s.Name(), s.Parent().SpanID())
+	}
+}
+
+// flagHost turns on the flags in on, counting the evaluations it is asked
+// for.
+type flagHost struct {
+	shared.HostServices
+	on    map[string]bool
+	asked []shared.FlagEvaluation
+}
+
+func (h *flagHost) EvaluateFlag(e shared.FlagEvaluation) (shared.FlagResult, error) {
+	h.asked = append(h.asked, e)
+	return shared.FlagResult{Enabled: h.on[e.Key]}, nil
+}
+
+func TestFlags(t *testing.T) {
+	p := &Plugin{}
+	r, _ := http.NewRequest(http.MethodGet, "/gradebook", nil)
+	r.Header.Set(UserIDHeader, "u-1")
+	r.Header.Set(RequestIDHeader, "req-1")
+	if FlagEnabled(r, "new-gradebook") {
+		t.Error("a flag is on without a host")
+	}
+
+	host := &flagHost{on: map[string]bool{"new-gradebook": true}}
+	p.SetHost(host)
+	t.Cleanup(func() { p.SetHost(nil) })
+
+	tmpl := template.Must(template.New("page").Parse(`{{if .Flags.Enabled "new-gradebook"}}new{{else}}old{{end}} ` +
+		`{{if .Flags.Enabled "report-cards"}}cards{{end}}{{if .Flags.Enabled "new-gradebook"}}!{{end}}`))
+	var out strings.Builder
+	if err := tmpl.Execute(&out, struct{ Flags *Flags }{FlagsFor(r, "255901001")}); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "new !" {
+		t.Errorf("template = %q, want the new gradebook", out.String())
+	}
+	// Each flag is evaluated once per request.
+	if len(host.asked) != 2 {
+		t.Fatalf("host evaluated %d flags, want 2", len(host.asked))
+	}
+	e := host.asked[0]
+	if e.Key != "new-gradebook" || e.Subject.UserID != "u-1" || e.Subject.EdOrgs[0] != "255901001" || e.RequestID != "req-1" {
+		t.Errorf("evaluation = %+v, want new-gradebook for u-1 at 255901001 in req-1", e)
+	}
+}
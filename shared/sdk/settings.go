@@ -0,0 +1,37 @@
+package sdk
+
+import (
+	"sync"
+
+	"github.com/catdevman/oasis/shared"
+)
+
+var settings struct {
+	mu     sync.RWMutex
+	values shared.Settings
+}
+
+// CurrentSettings returns the values of every settings section as the
+// host last pushed them, or nil before the first push.
+//
+//	var enabled []string
+//	sdk.CurrentSettings().Decode("system", "features", &enabled)
+func CurrentSettings() shared.Settings {
+	settings.mu.RLock()
+	defer settings.mu.RUnlock()
+	return settings.values
+}
+
+func (p *Plugin) GetSettingsSections() ([]shared.SettingsSection, error) { return p.Settings, nil }
+
+// ApplySettings records the values the host pushed and passes them to
+// OnSettings.
+func (p *Plugin) ApplySettings(values shared.Settings) error {
+	settings.mu.Lock()
+	settings.values = values
+	settings.mu.Unlock()
+	if p.OnSettings != nil {
+		p.OnSettings(values)
+	}
+	return nil
+}
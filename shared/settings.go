@@ -0,0 +1,62 @@
+package shared
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// The types a setting may have.
+const (
+	SettingBool   = "bool"
+	SettingInt    = "int"
+	SettingString = "string" // one of Options, if the field has any
+	SettingList   = "list"   // a list of strings, each one of Options if the field has any
+)
+
+// SettingsSection is a group of settings an administrator can edit. The
+// host declares the "system" section; a plugin adds its own by returning
+// them from GetSettingsSections, usually named after the plugin.
+type SettingsSection struct {
+	Name   string         `json:"name"`
+	Label  string         `json:"label"`
+	Fields []SettingField `json:"fields"`
+}
+
+// SettingField is one setting and the values it accepts.
+type SettingField struct {
+	Key         string          `json:"key"`
+	Label       string          `json:"label"`
+	Description string          `json:"description,omitempty"`
+	Type        string          `json:"type"`
+	Default     json.RawMessage `json:"default"`
+	Min         *int            `json:"min,omitempty"` // bounds of an int
+	Max         *int            `json:"max,omitempty"`
+	Options     []string        `json:"options,omitempty"`
+}
+
+// Settings are setting values as JSON, by section name and key.
+type Settings map[string]map[string]json.RawMessage
+
+// Decode unmarshals the value of the setting key in section into v.
+func (s Settings) Decode(section, key string, v interface{}) error {
+	raw, ok := s[section][key]
+	if !ok {
+		return fmt.Errorf("no setting %s.%s", section, key)
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// SettingsDocument is every section with its current values, defaults
+// filled in.
+type SettingsDocument struct {
+	Sections []SettingsSection `json:"sections"`
+	Values   Settings          `json:"values"`
+}
+
+// SettingsUpdate is a change to some settings, attributed for the audit
+// log.
+type SettingsUpdate struct {
+	Values    Settings
+	Actor     string
+	RequestID string
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/catdevman/oasis/internal/certs"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// certReloadInterval is how often certificate files are checked for
+// rotation.
+const certReloadInterval = time.Minute
+
+// defaultACMECache is where ACME accounts and certificates are kept unless
+// tls.acme.cache_dir says otherwise.
+const defaultACMECache = "acme"
+
+// newUserServers returns the server for user traffic on c.Listen. When
+// c.TLS is enabled it serves HTTPS, with HTTP/2, and redirect is the plain
+// HTTP server on tls.redirect_from, if set. Certificates from files are
+// reloaded until ctx is done.
+func newUserServers(ctx context.Context, c *AppConfig, handler http.Handler) (srv, redirect *http.Server, err error) {
+	srv = &http.Server{Addr: c.Listen, Handler: handler}
+	if !c.TLS.Enabled() {
+		return srv, nil, nil
+	}
+	srv.Protocols = new(http.Protocols)
+	srv.Protocols.SetHTTP1(true)
+	srv.Protocols.SetHTTP2(true)
+
+	challenges := func(h http.Handler) http.Handler { return h }
+	if c.TLS.ACME.Enabled() {
+		m, err := newACMEManager(c.TLS.ACME)
+		if err != nil {
+			return nil, nil, err
+		}
+		srv.TLSConfig = m.TLSConfig()
+		challenges = m.HTTPHandler
+	} else {
+		cert, err := certs.New(c.TLS.CertFile, c.TLS.KeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		go cert.Watch(ctx, certReloadInterval)
+		srv.TLSConfig = &tls.Config{GetCertificate: cert.GetCertificate}
+	}
+	srv.TLSConfig.MinVersion = tls.VersionTLS12
+	srv.Handler = withHSTS(c.TLS, handler)
+
+	if c.TLS.RedirectFrom != "" {
+		redirect = &http.Server{Addr: c.TLS.RedirectFrom, Handler: challenges(redirectHTTPS(c.Listen))}
+	}
+	return srv, redirect, nil
+}
+
+// newACMEManager returns the manager that obtains, caches and renews the
+// certificates c asks for.
+func newACMEManager(c ACMEConfig) (*autocert.Manager, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading tls.acme.ca_file: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls.acme.ca_file %s holds no PEM certificates", c.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+	}
+	client := &acme.Client{
+		DirectoryURL: c.DirectoryURL,
+		HTTPClient:   &http.Client{Transport: &orderLocator{next: transport}},
+	}
+	cache := c.CacheDir
+	if cache == "" {
+		cache = defaultACMECache
+	}
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(c.Domains...),
+		Cache:      autocert.DirCache(cache),
+		Email:      c.Email,
+		Client:     client,
+	}, nil
+}
+
+// orderLocator fills in the Location of an ACME order when finalizing it.
+// RFC 8555 does not require the header there, and CAs such as Pebble omit
+// it, but the acme package waits for the order to be issued at that URL.
+type orderLocator struct {
+	next http.RoundTripper
+
+	mu     sync.Mutex
+	orders map[string]string // order URLs by finalize URL
+}
+
+func (l *orderLocator) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := l.next.RoundTrip(req)
+	if err != nil || req.Method != http.MethodPost {
+		return resp, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if order, ok := l.orders[req.URL.String()]; ok && resp.Header.Get("Location") == "" {
+		resp.Header.Set("Location", order)
+		return resp, nil
+	}
+	location := resp.Header.Get("Location")
+	if location == "" || resp.StatusCode != http.StatusCreated {
+		return resp, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	var order struct {
+		Finalize string `json:"finalize"`
+	}
+	if json.Unmarshal(body, &order) == nil && order.Finalize != "" {
+		if l.orders == nil {
+			l.orders = map[string]string{}
+		}
+		l.orders[order.Finalize] = location
+	}
+	return resp, nil
+}
+
+// redirectHTTPS redirects every request to the same URL over HTTPS on the
+// port of listen.
+func redirectHTTPS(listen string) http.Handler {
+	_, port, _ := net.SplitHostPort(listen)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.Trim(host, "[]")
+		if port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+// withHSTS tells browsers to keep to HTTPS for tls.hsts_max_age, if set.
+func withHSTS(c TLSConfig, next http.Handler) http.Handler {
+	if c.HSTSMaxAge == "" {
+		return next
+	}
+	maxAge, _ := time.ParseDuration(c.HSTSMaxAge)
+	value := fmt.Sprintf("max-age=%d", int64(maxAge.Seconds()))
+	if c.HSTSIncludeSubdomains {
+		value += "; includeSubDomains"
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Strict-Transport-Security", value)
+		next.ServeHTTP(w, r)
+	})
+}